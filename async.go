@@ -0,0 +1,558 @@
+package mixpanel
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OverflowPolicy decides what an AsyncConsumer does with messages sent
+// while its queue is full.
+type OverflowPolicy int
+
+const (
+	// Block makes Send wait for room in the queue, or for its context.
+	Block OverflowPolicy = iota
+	// DropNewest discards the messages being sent.
+	DropNewest
+	// DropOldest discards the oldest queued messages to make room.
+	DropOldest
+	// SpillToDisk writes the messages to AsyncConfig.SpillDir, from where
+	// they are resent like a SpoolConsumer does.
+	SpillToDisk
+)
+
+// Defaults of AsyncConfig.
+const (
+	DefaultQueueSize = 10000
+	DefaultBatchSize = 50
+)
+
+// ErrClosed is returned when sending to a closed consumer.
+var ErrClosed = errors.New("mixpanel: consumer closed")
+
+/*
+AsyncConfig configures an AsyncConsumer.
+
+QueueSize bounds the number of queued messages and BatchSize the number
+of messages handed to the wrapped consumer at once. Overflow selects
+what happens when the queue is full; SpillToDisk needs SpillDir and,
+since spilled events are resent through the import endpoint, the
+project API secret.
+
+Every endpoint has its own queue, of at most QueueSize messages, and
+its own delivery goroutines. Endpoints tunes them per endpoint, "events"
+or "people" for example; the other endpoints use QueueSize and BatchSize
+with a single goroutine delivering messages as soon as they are queued.
+
+OnError, when set, is called from the delivery goroutines with the
+errors of the wrapped consumer, as *DeliveryError errors carrying the
+lost messages, which are logged otherwise. It must not block for long,
+as deliveries wait for it. See also WithErrorHandler.
+*/
+type AsyncConfig struct {
+	QueueSize int
+	BatchSize int
+	Overflow  OverflowPolicy
+	SpillDir  string
+	OnError   func(err error)
+	Endpoints map[string]EndpointConfig
+}
+
+/*
+EndpointConfig tunes the queue of an endpoint in an AsyncConsumer.
+QueueSize and BatchSize replace those of the AsyncConfig when not 0.
+FlushInterval lets a batch wait for up to BatchSize messages for that
+long after its first message was queued, for larger batches of the
+updates that are not latency sensitive; Flush and Close do not wait.
+Concurrency is the number of batches delivered at once, 1 by default.
+Example:
+
+	ac, err := NewAsyncConsumer(NewStdConsumer(), AsyncConfig{
+	    Endpoints: map[string]EndpointConfig{
+	        "events": {BatchSize: 50, Concurrency: 4},
+	        "people": {BatchSize: 50, FlushInterval: 10 * time.Second},
+	    },
+	})
+*/
+type EndpointConfig struct {
+	QueueSize     int
+	BatchSize     int
+	FlushInterval time.Duration
+	Concurrency   int
+}
+
+type queued struct {
+	endpoint string
+	msg      []byte
+	// done is the delivery callback of the message, if any
+	done func(error)
+	at   time.Time
+}
+
+// lane is the queue of an endpoint and the state of its workers.
+type lane struct {
+	endpoint string
+	cfg      EndpointConfig
+	queue    []queued
+	inflight int
+	// ready is closed and replaced, when workers are waiting, as messages
+	// are queued, or a flush or close starts
+	ready   chan struct{}
+	waiting int
+}
+
+/*
+AsyncConsumer queues messages in memory and delivers them to another
+consumer from background goroutines, so that Send returns immediately.
+The queues are bounded, see AsyncConfig. Example:
+
+	ac, err := NewAsyncConsumer(NewStdConsumer(), AsyncConfig{
+	    QueueSize: 50000,
+	    Overflow:  DropOldest,
+	})
+	mp := NewMixpanelWithConsumer(token, ac)
+	defer mp.Close(context.Background())
+
+Delivery errors are handed to AsyncConfig.OnError, or logged. See also
+WithAsync.
+*/
+type AsyncConsumer struct {
+	next   Consumer
+	cfg    AsyncConfig
+	spill  *SpoolConsumer
+	errors errorHandler
+
+	mu     sync.Mutex
+	lanes  map[string]*lane
+	closed bool
+	// closing is closed once the Close in progress returns, and closeErr
+	// is the error of the Close that finished, once done
+	closing  chan struct{}
+	done     bool
+	closeErr error
+	flushing int
+	changed  chan struct{} // closed and replaced whenever a queue shrinks
+	workers  sync.WaitGroup
+	// lastFlush is when the last batch was handed to next.
+	lastFlush time.Time
+
+	dropped atomic.Uint64
+	spilled atomic.Uint64
+}
+
+// NewAsyncConsumer creates an AsyncConsumer delivering to next.
+func NewAsyncConsumer(next Consumer, cfg AsyncConfig) (*AsyncConsumer, error) {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	ac := &AsyncConsumer{
+		next:    next,
+		cfg:     cfg,
+		lanes:   make(map[string]*lane),
+		changed: make(chan struct{}),
+	}
+	ac.errors.set(cfg.OnError)
+	if cfg.Overflow == SpillToDisk {
+		if cfg.SpillDir == "" {
+			return nil, errors.New("mixpanel: SpillToDisk needs a SpillDir")
+		}
+		spill, err := NewSpoolConsumer(next, cfg.SpillDir, time.Minute)
+		if err != nil {
+			return nil, err
+		}
+		ac.spill = spill
+	}
+	return ac, nil
+}
+
+/*
+WithAsync makes the calls of the Mixpanel object return as soon as their
+messages are queued, rather than once they are delivered, by wrapping
+its consumer in an AsyncConsumer configured by cfg. The calls still
+fail synchronously for invalid messages, but delivery errors go to
+cfg.OnError. Flush and Close wait for the queued messages. Example:
+
+	mp := NewMixpanel(token, WithAsync(AsyncConfig{
+	    Overflow: DropOldest,
+	    OnError:  func(err error) { metrics.Inc("mixpanel_errors") },
+	}))
+	defer mp.Close(context.Background())
+
+Options given before WithAsync configure the wrapped consumer, those
+given after reach it through Unwrap. WithAsync panics when NewAsyncConsumer
+fails, for SpillToDisk without a SpillDir for example; call it directly
+to handle the error.
+*/
+func WithAsync(cfg AsyncConfig) Option {
+	return func(mp *Mixpanel) {
+		ac, err := NewAsyncConsumer(mp.c, cfg)
+		if err != nil {
+			panic(err)
+		}
+		mp.c = ac
+	}
+}
+
+// SetErrorHandler replaces AsyncConfig.OnError by fn, and forwards it to
+// the wrapped consumer.
+func (ac *AsyncConsumer) SetErrorHandler(fn func(error)) {
+	ac.errors.set(fn)
+	if c, ok := findConsumer[interface{ SetErrorHandler(func(error)) }](ac.next); ok {
+		c.SetErrorHandler(fn)
+	}
+}
+
+// Dropped returns the number of messages discarded by the overflow policy.
+func (ac *AsyncConsumer) Dropped() uint64 {
+	return ac.dropped.Load()
+}
+
+// Spilled returns the number of messages written to disk by SpillToDisk.
+func (ac *AsyncConsumer) Spilled() uint64 {
+	return ac.spilled.Load()
+}
+
+// Len returns the number of queued messages, for health checks to tell
+// whether ac is backing up. It is safe for concurrent use, as are Bytes
+// and LastFlush.
+func (ac *AsyncConsumer) Len() int {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	n := 0
+	for _, l := range ac.lanes {
+		n += len(l.queue)
+	}
+	return n
+}
+
+// Bytes returns the size of the queued messages.
+func (ac *AsyncConsumer) Bytes() int {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	n := 0
+	for _, l := range ac.lanes {
+		for _, q := range l.queue {
+			n += len(q.msg)
+		}
+	}
+	return n
+}
+
+// LastFlush returns when ac last handed a batch to the wrapped consumer,
+// the zero time before the first batch.
+func (ac *AsyncConsumer) LastFlush() time.Time {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	return ac.lastFlush
+}
+
+// lane returns the lane of endpoint, starting its workers the first
+// time. ac.mu must be held.
+func (ac *AsyncConsumer) lane(endpoint string) *lane {
+	if l, ok := ac.lanes[endpoint]; ok {
+		return l
+	}
+	cfg := ac.cfg.Endpoints[endpoint]
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = ac.cfg.QueueSize
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = ac.cfg.BatchSize
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	l := &lane{endpoint: endpoint, cfg: cfg, ready: make(chan struct{})}
+	ac.lanes[endpoint] = l
+	for i := 0; i < cfg.Concurrency; i++ {
+		ac.workers.Add(1)
+		go ac.work(l)
+	}
+	return l
+}
+
+// signal wakes up the workers of l. ac.mu must be held.
+func (l *lane) signal() {
+	close(l.ready)
+	l.ready = make(chan struct{})
+}
+
+// Send queues msgs, applying the overflow policy when the queue is full.
+// High priority messages, see WithPriorityEvents, are sent right away.
+func (ac *AsyncConsumer) Send(ctx context.Context, endpoint string, msgs [][]byte) error {
+	if isPriorityContext(ctx) {
+		// high priority messages skip the queue
+		return ac.next.Send(ctx, endpoint, msgs)
+	}
+	done := countdown(claimDelivery(ctx), len(msgs))
+	// fail reports the outcome of the messages from i on
+	fail := func(i int, err error) {
+		for ; done != nil && i < len(msgs); i++ {
+			done(err)
+		}
+	}
+	now := time.Now()
+	for i, msg := range msgs {
+		ac.mu.Lock()
+		if ac.closed {
+			ac.mu.Unlock()
+			fail(i, ErrClosed)
+			return ErrClosed
+		}
+		l := ac.lane(endpoint)
+		for !ac.closed && len(l.queue) >= l.cfg.QueueSize {
+			switch ac.cfg.Overflow {
+			case DropNewest:
+				ac.mu.Unlock()
+				ac.dropped.Add(uint64(len(msgs) - i))
+				fail(i, ErrDropped)
+				return nil
+			case DropOldest:
+				if oldest := l.queue[0]; oldest.done != nil {
+					// reported outside the lock, the callback may track
+					defer oldest.done(ErrDropped)
+				}
+				l.queue = l.queue[1:]
+				ac.dropped.Add(1)
+			case SpillToDisk:
+				ac.mu.Unlock()
+				if err := ac.spill.spool(endpoint, msgs[i:]); err != nil {
+					fail(i, err)
+					return err
+				}
+				ac.spilled.Add(uint64(len(msgs) - i))
+				fail(i, ErrSpooled)
+				return nil
+			default:
+				changed := ac.changed
+				ac.mu.Unlock()
+				select {
+				case <-changed:
+				case <-ctx.Done():
+					fail(i, ctx.Err())
+					return ctx.Err()
+				}
+				ac.mu.Lock()
+			}
+		}
+		if ac.closed {
+			ac.mu.Unlock()
+			fail(i, ErrClosed)
+			return ErrClosed
+		}
+		l.queue = append(l.queue, queued{endpoint, msg, done, now})
+		if l.waiting > 0 && (l.cfg.FlushInterval <= 0 || len(l.queue) == 1 || len(l.queue) >= l.cfg.BatchSize) {
+			l.signal()
+		}
+		ac.mu.Unlock()
+	}
+	return nil
+}
+
+// Flush waits until every queued message has been handed to the wrapped
+// consumer, then flushes it.
+func (ac *AsyncConsumer) Flush(ctx context.Context) error {
+	ac.mu.Lock()
+	ac.flushing++
+	for _, l := range ac.lanes {
+		l.signal()
+	}
+	ac.mu.Unlock()
+	err := ac.drain(ctx)
+	ac.mu.Lock()
+	ac.flushing--
+	ac.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return ac.next.Flush(ctx)
+}
+
+// Close stops accepting messages, delivers the queued ones and closes the
+// wrapped consumer. Calling it again, even concurrently, waits for the
+// call in progress and returns its error, unless ctx of that call was
+// done first: the next call then resumes the close.
+func (ac *AsyncConsumer) Close(ctx context.Context) error {
+	for {
+		ac.mu.Lock()
+		if !ac.closed {
+			ac.closed = true
+			ac.notify()
+			for _, l := range ac.lanes {
+				l.signal()
+			}
+		}
+		if ac.done {
+			ac.mu.Unlock()
+			return ac.closeErr
+		}
+		closing := ac.closing
+		if closing == nil {
+			break
+		}
+		ac.mu.Unlock()
+		select {
+		case <-closing:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	closing := make(chan struct{})
+	ac.closing = closing
+	ac.mu.Unlock()
+
+	err := ac.close(ctx)
+	ac.mu.Lock()
+	ac.closing = nil
+	// an interrupted close is left to the next call rather than cached
+	if err == nil || ctx.Err() == nil {
+		ac.done = true
+		ac.closeErr = err
+	}
+	ac.mu.Unlock()
+	close(closing)
+	return err
+}
+
+// Unwrap returns the consumer wrapped by ac.
+func (ac *AsyncConsumer) Unwrap() Consumer {
+	return ac.next
+}
+
+// close waits for the workers and closes the wrapped consumer.
+func (ac *AsyncConsumer) close(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		ac.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if ac.spill != nil {
+		ac.spill.stopResending()
+	}
+	return ac.next.Close(ctx)
+}
+
+func (ac *AsyncConsumer) drain(ctx context.Context) error {
+	for {
+		ac.mu.Lock()
+		pending := 0
+		for _, l := range ac.lanes {
+			pending += len(l.queue) + l.inflight
+		}
+		if pending == 0 {
+			ac.mu.Unlock()
+			return nil
+		}
+		changed := ac.changed
+		ac.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// notify wakes up everybody waiting for the queue to change. ac.mu must
+// be held.
+func (ac *AsyncConsumer) notify() {
+	close(ac.changed)
+	ac.changed = make(chan struct{})
+}
+
+// work delivers the batches of l until ac is closed and l is empty.
+func (ac *AsyncConsumer) work(l *lane) {
+	defer ac.workers.Done()
+	for {
+		ac.mu.Lock()
+		for !l.full(ac.closed || ac.flushing > 0) {
+			if len(l.queue) == 0 && ac.closed {
+				ac.mu.Unlock()
+				return
+			}
+			ready := l.ready
+			var timer *time.Timer
+			var timeout <-chan time.Time
+			if len(l.queue) > 0 {
+				// a partial batch waiting for FlushInterval
+				timer = time.NewTimer(time.Until(l.queue[0].at.Add(l.cfg.FlushInterval)))
+				timeout = timer.C
+			}
+			l.waiting++
+			ac.mu.Unlock()
+			select {
+			case <-ready:
+			case <-timeout:
+			}
+			if timer != nil {
+				timer.Stop()
+			}
+			ac.mu.Lock()
+			l.waiting--
+		}
+		n := len(l.queue)
+		if n > l.cfg.BatchSize {
+			n = l.cfg.BatchSize
+		}
+		batch := append([]queued(nil), l.queue[:n]...)
+		l.queue = l.queue[n:]
+		l.inflight += n
+		ac.notify()
+		ac.mu.Unlock()
+
+		ac.deliver(l.endpoint, batch)
+
+		ac.mu.Lock()
+		l.inflight -= n
+		ac.lastFlush = time.Now()
+		ac.notify()
+		ac.mu.Unlock()
+	}
+}
+
+// full reports whether l has a batch ready for delivery: BatchSize
+// messages, or messages queued for FlushInterval, or any message when
+// flushing.
+func (l *lane) full(flushing bool) bool {
+	switch {
+	case len(l.queue) == 0:
+		return false
+	case flushing || len(l.queue) >= l.cfg.BatchSize || l.cfg.FlushInterval <= 0:
+		return true
+	}
+	return !time.Now().Before(l.queue[0].at.Add(l.cfg.FlushInterval))
+}
+
+// deliver sends a batch of endpoint to the wrapped consumer.
+func (ac *AsyncConsumer) deliver(endpoint string, batch []queued) {
+	msgs := make([][]byte, len(batch))
+	var callbacks []func(error)
+	for i, q := range batch {
+		msgs[i] = q.msg
+		if q.done != nil {
+			callbacks = append(callbacks, q.done)
+		}
+	}
+	var done func(error)
+	if len(callbacks) > 0 {
+		done = func(err error) {
+			for _, fn := range callbacks {
+				fn(err)
+			}
+		}
+	}
+	if err := sendWithDelivery(context.Background(), ac.next, endpoint, msgs, done); err != nil {
+		ac.errors.report(&DeliveryError{Endpoint: endpoint, Messages: msgs, Err: err})
+	}
+}
@@ -0,0 +1,246 @@
+package mixpanel
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gatedConsumer records messages and blocks deliveries until released.
+type gatedConsumer struct {
+	mu     sync.Mutex
+	gate   chan struct{}
+	msgs   []string
+	closed bool
+}
+
+func (gc *gatedConsumer) Send(ctx context.Context, endpoint string, msgs [][]byte) error {
+	<-gc.gate
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	for _, msg := range msgs {
+		gc.msgs = append(gc.msgs, string(msg))
+	}
+	return nil
+}
+
+func (gc *gatedConsumer) Flush(ctx context.Context) error { return nil }
+
+func (gc *gatedConsumer) Close(ctx context.Context) error {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	gc.closed = true
+	return nil
+}
+
+func (gc *gatedConsumer) Messages() []string {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	return append([]string(nil), gc.msgs...)
+}
+
+func TestAsyncConsumerOverflow(t *testing.T) {
+	for _, c := range []struct {
+		policy   OverflowPolicy
+		expected string
+	}{
+		{DropNewest, "[1 2 3]"},
+		{DropOldest, "[1 4 5]"},
+	} {
+		gc := &gatedConsumer{gate: make(chan struct{})}
+		ac, err := NewAsyncConsumer(gc, AsyncConfig{QueueSize: 2, BatchSize: 1, Overflow: c.policy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := context.Background()
+		ac.Send(ctx, "events", [][]byte{[]byte("1")})
+		// wait for the worker to pick up the first message
+		for ac.Len() != 0 {
+			time.Sleep(time.Millisecond)
+		}
+		for _, msg := range []string{"2", "3", "4", "5"} {
+			if err := ac.Send(ctx, "events", [][]byte{[]byte(msg)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if ac.Dropped() != 2 {
+			t.Errorf("Expected 2 dropped messages, got %d", ac.Dropped())
+		}
+		close(gc.gate)
+		if err := ac.Close(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if got := "[" + strings.Join(gc.Messages(), " ") + "]"; got != c.expected {
+			t.Errorf("Policy %d: expected %s got %s", c.policy, c.expected, got)
+		}
+	}
+}
+
+func TestAsyncConsumerBlock(t *testing.T) {
+	gc := &gatedConsumer{gate: make(chan struct{})}
+	ac, _ := NewAsyncConsumer(gc, AsyncConfig{QueueSize: 1, BatchSize: 1})
+	ctx := context.Background()
+	ac.Send(ctx, "events", [][]byte{[]byte("1")})
+	for ac.Len() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	ac.Send(ctx, "events", [][]byte{[]byte("2")})
+
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := ac.Send(timeout, "events", [][]byte{[]byte("3")}); err != context.DeadlineExceeded {
+		t.Errorf("Expected Send to block until the deadline, got %v", err)
+	}
+
+	close(gc.gate)
+	if err := ac.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(gc.Messages(), " "); got != "1 2" {
+		t.Errorf("Expected 1 2 got %s", got)
+	}
+	ac.Close(ctx)
+	if err := ac.Send(ctx, "events", [][]byte{[]byte("4")}); err != ErrClosed {
+		t.Errorf("Expected ErrClosed got %v", err)
+	}
+}
+
+func TestWithAsync(t *testing.T) {
+	gc := &gatedConsumer{gate: make(chan struct{})}
+	errs := make(chan error, 1)
+	mp := NewMixpanelWithConsumer(token, gc, WithAsync(AsyncConfig{
+		OnError: func(err error) { errs <- err },
+	}))
+
+	// the gated consumer blocks: Track must not wait for it
+	if err := mp.Track("13793", "Signed Up", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := gc.Messages(); len(got) != 0 {
+		t.Errorf("Expected nothing delivered yet, got %v", got)
+	}
+	close(gc.gate)
+	if err := mp.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := gc.Messages(); len(got) != 1 || !strings.Contains(got[0], `"Signed Up"`) {
+		t.Errorf("Expected the event to be delivered on Close, got %v", got)
+	}
+	select {
+	case err := <-errs:
+		t.Errorf("Unexpected delivery error %v", err)
+	default:
+	}
+}
+
+func TestWithAsyncOnError(t *testing.T) {
+	errs := make(chan error, 1)
+	mp := NewMixpanel(token, WithAsync(AsyncConfig{
+		OnError: func(err error) { errs <- err },
+	}), WithAPIHost("http://127.0.0.1:1"))
+
+	if err := mp.Track("13793", "Signed Up", nil); err != nil {
+		t.Fatalf("Expected Track to return before delivery, got %v", err)
+	}
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Error("Expected a delivery error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnError was not called")
+	}
+	mp.Close(context.Background())
+}
+
+func TestAsyncConsumerEndpoints(t *testing.T) {
+	gc := &gatedConsumer{gate: make(chan struct{})}
+	close(gc.gate)
+	ac, err := NewAsyncConsumer(gc, AsyncConfig{
+		BatchSize: 10,
+		Endpoints: map[string]EndpointConfig{
+			"people": {BatchSize: 3, FlushInterval: time.Hour},
+			"events": {Concurrency: 4},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for i := 0; i < 4; i++ {
+		ac.Send(ctx, "people", [][]byte{[]byte(fmt.Sprintf("p%d", i))})
+		ac.Send(ctx, "events", [][]byte{[]byte(fmt.Sprintf("e%d", i))})
+	}
+	// the events go out right away, the people updates in batches of 3
+	// or once they waited for FlushInterval
+	deadline := time.Now().Add(5 * time.Second)
+	for ac.Len() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 1 queued people update, got %d", ac.Len())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := ac.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ac.Len() != 0 || len(gc.Messages()) != 8 {
+		t.Errorf("Expected every message delivered on Flush, got %q", gc.Messages())
+	}
+	ac.Close(ctx)
+}
+
+func TestAsyncConsumerConcurrentClose(t *testing.T) {
+	gc := &gatedConsumer{gate: make(chan struct{})}
+	ac, _ := NewAsyncConsumer(gc, AsyncConfig{})
+	ctx := context.Background()
+	ac.Send(ctx, "events", [][]byte{[]byte("1")})
+
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() { errs <- ac.Close(ctx) }()
+	}
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case err := <-errs:
+		t.Fatalf("Expected Close to wait for the delivery, got %v", err)
+	default:
+	}
+	close(gc.gate)
+	for i := 0; i < 3; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	if got := gc.Messages(); len(got) != 1 {
+		t.Errorf("Expected 1 message, got %q", got)
+	}
+}
+
+func TestAsyncConsumerCloseResumes(t *testing.T) {
+	gc := &gatedConsumer{gate: make(chan struct{})}
+	ac, _ := NewAsyncConsumer(gc, AsyncConfig{})
+	ctx := context.Background()
+	ac.Send(ctx, "events", [][]byte{[]byte("1")})
+
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := ac.Close(timeout); err != context.DeadlineExceeded {
+		t.Fatalf("Expected Close to stop at the deadline, got %v", err)
+	}
+	if err := ac.Send(ctx, "events", [][]byte{[]byte("2")}); err != ErrClosed {
+		t.Errorf("Expected ErrClosed got %v", err)
+	}
+
+	close(gc.gate)
+	if err := ac.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	if !gc.closed || len(gc.msgs) != 1 {
+		t.Errorf("Expected the message delivered and the consumer closed, got %q closed %v", gc.msgs, gc.closed)
+	}
+}
@@ -0,0 +1,158 @@
+package mixpanel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+/*
+AuditRecord is the audit of a request to Mixpanel: when it was sent,
+its payload, a single message or a JSON array of them, and its outcome.
+Status is the HTTP status, 0 when the request failed before getting a
+response or the consumer does not speak HTTP; Error is empty on success.
+*/
+type AuditRecord struct {
+	Time     time.Time       `json:"time"`
+	Endpoint string          `json:"endpoint"`
+	Messages int             `json:"messages"`
+	Payload  json.RawMessage `json:"payload"`
+	Status   int             `json:"status,omitempty"`
+	Latency  time.Duration   `json:"latency_ns"`
+	Attempt  int             `json:"attempt"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// AuditLog stores the audit records of an AuditingConsumer, in a file or
+// a database. Audit is called concurrently, and must not retain r.
+type AuditLog interface {
+	Audit(r *AuditRecord) error
+}
+
+// JSONAuditLog writes audit records as JSON lines.
+type JSONAuditLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONAuditLog returns an AuditLog writing to w, a line per record.
+func NewJSONAuditLog(w io.Writer) *JSONAuditLog {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &JSONAuditLog{enc: enc}
+}
+
+func (l *JSONAuditLog) Audit(r *AuditRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.enc.Encode(r)
+}
+
+/*
+AuditingConsumer writes every payload leaving the process, and its
+outcome, to an AuditLog. When the wrapped consumer has an AfterSend
+method, like StdConsumer, or is an AsyncConsumer or SpoolConsumer
+wrapping one, every HTTP request is audited with its status, latency
+and attempt; otherwise every call to Send is. Example:
+
+	f, err := os.OpenFile("mixpanel-audit.jsonl", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	...
+	mp := NewMixpanel(token, WithAudit(NewJSONAuditLog(f)))
+
+The errors of the audit log are handed to the error handler, see
+WithErrorHandler, they do not fail the requests.
+*/
+type AuditingConsumer struct {
+	next   Consumer
+	log    AuditLog
+	hooked bool
+	errors errorHandler
+}
+
+// NewAuditingConsumer returns a consumer auditing the requests of next to
+// log.
+func NewAuditingConsumer(next Consumer, log AuditLog) *AuditingConsumer {
+	ac := &AuditingConsumer{next: next, log: log}
+	if c, ok := findConsumer[interface{ AfterSend(func(*SendInfo)) }](next); ok {
+		ac.hooked = true
+		c.AfterSend(func(info *SendInfo) {
+			r := &AuditRecord{
+				Endpoint: info.Endpoint,
+				Messages: info.Messages,
+				Payload:  info.Payload,
+				Attempt:  info.Attempt,
+			}
+			if resp := info.Response; resp != nil {
+				r.Status = resp.StatusCode
+				r.Latency = resp.Duration
+			}
+			r.Time = time.Now().Add(-r.Latency)
+			ac.audit(r, info.Err)
+		})
+	}
+	return ac
+}
+
+// WithAudit audits the requests of the client to log, see
+// AuditingConsumer. Given after WithAsync it still audits the requests of
+// the wrapped consumer.
+func WithAudit(log AuditLog) Option {
+	return func(mp *Mixpanel) {
+		mp.c = NewAuditingConsumer(mp.c, log)
+	}
+}
+
+func (ac *AuditingConsumer) audit(r *AuditRecord, err error) {
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if err := ac.log.Audit(r); err != nil {
+		ac.errors.report(fmt.Errorf("mixpanel: cannot audit a request to %s: %v", r.Endpoint, err))
+	}
+}
+
+func (ac *AuditingConsumer) Send(ctx context.Context, endpoint string, msgs [][]byte) error {
+	if ac.hooked || len(msgs) == 0 {
+		return ac.next.Send(ctx, endpoint, msgs)
+	}
+	start := time.Now()
+	err := ac.next.Send(ctx, endpoint, msgs)
+	payload := msgs[0]
+	if len(msgs) > 1 {
+		payload = jsonArray(msgs)
+	}
+	ac.audit(&AuditRecord{
+		Time:     start,
+		Endpoint: endpoint,
+		Messages: len(msgs),
+		Payload:  payload,
+		Latency:  time.Since(start),
+		Attempt:  attemptOf(ctx),
+	}, err)
+	return err
+}
+
+func (ac *AuditingConsumer) Flush(ctx context.Context) error {
+	return ac.next.Flush(ctx)
+}
+
+func (ac *AuditingConsumer) Close(ctx context.Context) error {
+	return ac.next.Close(ctx)
+}
+
+// Unwrap returns the consumer audited by ac.
+func (ac *AuditingConsumer) Unwrap() Consumer {
+	return ac.next
+}
+
+// SetErrorHandler sets the handler of the errors of the audit log, and
+// forwards it to the wrapped consumer.
+func (ac *AuditingConsumer) SetErrorHandler(fn func(error)) {
+	ac.errors.set(fn)
+	if c, ok := findConsumer[interface{ SetErrorHandler(func(error)) }](ac.next); ok {
+		c.SetErrorHandler(fn)
+	}
+}
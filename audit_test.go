@@ -0,0 +1,73 @@
+package mixpanel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWithAudit(t *testing.T) {
+	rs := newRecordingServer()
+	defer rs.Close()
+
+	var buf bytes.Buffer
+	mp := NewMixpanel(token, WithAPIHost(rs.URL), WithAsync(AsyncConfig{}), WithAudit(NewJSONAuditLog(&buf)))
+	mp.Track("12345", "Signed Up", nil)
+	mp.PeopleSet("12345", &P{"$email": "john@example.com"})
+	if err := mp.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 audit records got %q", buf.String())
+	}
+	// the endpoints are delivered independently, in any order
+	var r AuditRecord
+	for _, line := range lines {
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatal(err)
+		}
+		if r.Endpoint == "events" {
+			break
+		}
+	}
+	if r.Endpoint != "events" || r.Status != 200 || r.Attempt != 1 || r.Messages != 1 || r.Error != "" || r.Time.IsZero() {
+		t.Errorf("Unexpected audit record %+v", r)
+	}
+	if !bytes.Contains(r.Payload, []byte(`"event":"Signed Up"`)) {
+		t.Errorf("Expected the event in the payload got %s", r.Payload)
+	}
+}
+
+type failingAuditLog struct{}
+
+func (failingAuditLog) Audit(r *AuditRecord) error {
+	return errors.New("disk full")
+}
+
+func TestAuditingConsumerWithoutHooks(t *testing.T) {
+	var buf bytes.Buffer
+	var errs []error
+	ac := NewAuditingConsumer(&failingConsumer{}, NewJSONAuditLog(&buf))
+	mp := NewMixpanelWithConsumer(token, ac, WithErrorHandler(func(err error) { errs = append(errs, err) }))
+	if err := mp.Track("12345", "Signed Up", nil); err == nil {
+		t.Fatal("Expected the error of the consumer")
+	}
+	var r AuditRecord
+	if err := json.Unmarshal(buf.Bytes(), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Endpoint != "events" || r.Status != 0 || r.Error != "unavailable" || r.Attempt != 1 {
+		t.Errorf("Unexpected audit record %+v", r)
+	}
+
+	ac.log = failingAuditLog{}
+	mp.Track("12345", "Signed Up", nil)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "disk full") {
+		t.Errorf("Expected the error of the audit log got %v", errs)
+	}
+}
@@ -0,0 +1,237 @@
+package mixpanel
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// IdentityCall is the call IdentityBackfill makes to tie the ids of a
+// pair.
+type IdentityCall int
+
+const (
+	// MergeIdentities merges the users of the ids with $merge, see
+	// Mixpanel.Merge, whatever their age. It needs the project API
+	// secret.
+	MergeIdentities IdentityCall = iota
+	// IdentifyIdentities identifies the anonymous id as the user id with
+	// $identify, see Mixpanel.Identify.
+	IdentifyIdentities
+	// AliasIdentities aliases the user id to the anonymous id with
+	// $create_alias, see Mixpanel.Alias.
+	AliasIdentities
+)
+
+// String returns the name of the call, as parsed by ParseIdentityCall.
+func (c IdentityCall) String() string {
+	switch c {
+	case MergeIdentities:
+		return "merge"
+	case IdentifyIdentities:
+		return "identify"
+	case AliasIdentities:
+		return "alias"
+	}
+	return fmt.Sprintf("IdentityCall(%d)", int(c))
+}
+
+// ParseIdentityCall returns the IdentityCall named name: merge, identify
+// or alias.
+func ParseIdentityCall(name string) (IdentityCall, error) {
+	for _, c := range []IdentityCall{MergeIdentities, IdentifyIdentities, AliasIdentities} {
+		if strings.EqualFold(name, c.String()) {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("mixpanel: unknown identity call %q, expected merge, identify or alias", name)
+}
+
+/*
+IdentityBackfillOptions tunes IdentityBackfill.
+
+Call is the call made for every pair, $merge by default. Rate caps the
+pairs sent per second. A pair failing with a network error, a 429 or a
+5xx status is retried up to MaxRetries times, with an exponential
+backoff. Skip ignores that many pairs at the start of the input, to
+resume an interrupted backfill. OnResult is called with the outcome of
+every pair read, invalid ones included.
+*/
+type IdentityBackfillOptions struct {
+	Call       IdentityCall
+	Rate       float64
+	MaxRetries int
+	Skip       int
+	OnResult   func(IdentityResult)
+}
+
+// IdentityPair is a pair of ids read by IdentityBackfill, on the line
+// Line of the input.
+type IdentityPair struct {
+	Line   int
+	AnonID string
+	UserID string
+}
+
+// IdentityResult is the outcome of a pair: Err is nil once the pair was
+// sent, and Invalid tells the pairs that could not be read from those
+// that failed to send.
+type IdentityResult struct {
+	IdentityPair
+	Invalid bool
+	Err     error
+}
+
+// IdentityBackfillReport counts the pairs processed by IdentityBackfill,
+// and lists those that could not be sent.
+type IdentityBackfillReport struct {
+	// Pairs read from the input, skipped ones included.
+	Read int
+	// Pairs sent.
+	Sent int
+	// Pairs skipped at the start of the input, see
+	// IdentityBackfillOptions.Skip.
+	Skipped int
+	// Lines without two different ids.
+	Invalid int
+	// Pairs that failed to send, with Failures listing them.
+	Failed   int
+	Failures []IdentityResult
+	// Retries of the pairs failing transiently.
+	Retries int
+}
+
+/*
+IdentityBackfill ties the identities of a historical identity graph, as
+when migrating from another analytics tool: it reads pairs of
+anonymous and user ids from r, and makes the IdentityCall of opts for
+every pair, see IdentityCall.
+
+r is CSV, a pair "anon_id,user_id" per line, with an optional header
+naming those columns; lines starting with # are ignored. Example:
+
+	f, _ := os.Open("identities.csv")
+	report, err := mp.IdentityBackfill(ctx, f, &IdentityBackfillOptions{Rate: 50})
+
+Pairs failing to send are counted and listed in the report rather than
+ending the backfill, which only stops on a read error or when ctx is
+done. With a buffered consumer the calls are only sent on the final
+flush, whose error is returned, so that per pair results need an
+unbuffered consumer such as StdConsumer.
+*/
+func (mp *Mixpanel) IdentityBackfill(ctx context.Context, r io.Reader, opts *IdentityBackfillOptions) (*IdentityBackfillReport, error) {
+	if opts == nil {
+		opts = &IdentityBackfillOptions{}
+	}
+	call, err := mp.identityCall(opts.Call)
+	if err != nil {
+		return nil, err
+	}
+	report := &IdentityBackfillReport{}
+	result := func(res IdentityResult) {
+		if opts.OnResult != nil {
+			opts.OnResult(res)
+		}
+	}
+
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.ReuseRecord = true
+	var next time.Time
+	for first := true; ; first = false {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			report.Read++
+			report.Invalid++
+			result(IdentityResult{IdentityPair: IdentityPair{Line: parseErr.Line}, Invalid: true, Err: err})
+			continue
+		} else if err != nil {
+			return report, err
+		}
+		if first && len(record) >= 2 && strings.EqualFold(record[0], "anon_id") && strings.EqualFold(record[1], "user_id") {
+			continue
+		}
+
+		report.Read++
+		if report.Read <= opts.Skip {
+			report.Skipped++
+			continue
+		}
+		line, _ := cr.FieldPos(0)
+		pair := IdentityPair{Line: line, AnonID: strings.TrimSpace(record[0])}
+		if len(record) >= 2 {
+			pair.UserID = strings.TrimSpace(record[1])
+		}
+		if len(record) != 2 || pair.AnonID == "" || pair.UserID == "" || pair.AnonID == pair.UserID {
+			report.Invalid++
+			result(IdentityResult{IdentityPair: pair, Invalid: true, Err: errors.New("mixpanel: expected two different ids")})
+			continue
+		}
+
+		if opts.Rate > 0 {
+			now := time.Now()
+			if next.Before(now) {
+				next = now
+			}
+			if err := sleep(ctx, next.Sub(now)); err != nil {
+				return report, err
+			}
+			next = next.Add(time.Duration(float64(time.Second) / opts.Rate))
+		}
+		err = mp.sendIdentityPair(ctx, call, pair, opts.MaxRetries, report)
+		if err != nil && ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		res := IdentityResult{IdentityPair: pair, Err: err}
+		if err != nil {
+			report.Failed++
+			report.Failures = append(report.Failures, res)
+		} else {
+			report.Sent++
+		}
+		result(res)
+	}
+	return report, mp.Flush(ctx)
+}
+
+// identityCall returns the function making call for a pair.
+func (mp *Mixpanel) identityCall(call IdentityCall) (func(anon_id, user_id string) error, error) {
+	switch call {
+	case MergeIdentities:
+		return func(anon_id, user_id string) error { return mp.Merge(user_id, anon_id) }, nil
+	case IdentifyIdentities:
+		return func(anon_id, user_id string) error { return mp.Identify(user_id, anon_id) }, nil
+	case AliasIdentities:
+		return func(anon_id, user_id string) error { return mp.Alias(user_id, anon_id) }, nil
+	}
+	return nil, fmt.Errorf("mixpanel: unknown identity call %v", call)
+}
+
+// sendIdentityPair makes call for pair, retrying it on transient errors.
+func (mp *Mixpanel) sendIdentityPair(ctx context.Context, call func(anon_id, user_id string) error, pair IdentityPair, maxRetries int, report *IdentityBackfillReport) error {
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		err := call(pair.AnonID, pair.UserID)
+		if err == nil || attempt >= maxRetries || !IsTransient(err) {
+			return err
+		}
+		report.Retries++
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+		delay *= 2
+	}
+}
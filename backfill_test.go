@@ -0,0 +1,82 @@
+package mixpanel
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIdentityBackfill(t *testing.T) {
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = time.Millisecond
+
+	var mu sync.Mutex
+	var identified []string
+	failures := map[string]int{"u3": 1, "u4": 10}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		data, _ := base64.URLEncoding.DecodeString(r.Form.Get("data"))
+		var event struct {
+			Event      string            `json:"event"`
+			Properties map[string]string `json:"properties"`
+		}
+		json.Unmarshal(data, &event)
+		mu.Lock()
+		defer mu.Unlock()
+		user := event.Properties["$identified_id"]
+		if failures[user] > 0 {
+			failures[user]--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		identified = append(identified, event.Event+":"+event.Properties["$anon_id"]+">"+user)
+		w.Write([]byte(`{"status": 1, "error": null}`))
+	}))
+	defer ts.Close()
+
+	c := NewStdConsumer()
+	c.SetAPIHost(ts.URL)
+	mp := NewMixpanelWithConsumer(token, c)
+	input := "anon_id,user_id\nd0,u0\n# comment\nd1,u1\nd2\nd3,u3\nd4,u4\nd5,d5\n"
+	var results []IdentityResult
+	report, err := mp.IdentityBackfill(context.Background(), strings.NewReader(input), &IdentityBackfillOptions{
+		Call:       IdentifyIdentities,
+		MaxRetries: 2,
+		Skip:       1,
+		OnResult:   func(res IdentityResult) { results = append(results, res) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"$identify:d1>u1", "$identify:d3>u3"}
+	if strings.Join(identified, " ") != strings.Join(want, " ") {
+		t.Errorf("Expected %v got %v", want, identified)
+	}
+	if report.Read != 6 || report.Skipped != 1 || report.Sent != 2 || report.Invalid != 2 || report.Failed != 1 || report.Retries != 3 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if len(report.Failures) != 1 || report.Failures[0].UserID != "u4" || report.Failures[0].Line != 7 || report.Failures[0].Err == nil {
+		t.Errorf("Unexpected failures %+v", report.Failures)
+	}
+	if len(results) != 5 || !results[1].Invalid || results[1].Line != 5 {
+		t.Errorf("Unexpected results %+v", results)
+	}
+}
+
+func TestParseIdentityCall(t *testing.T) {
+	for _, call := range []IdentityCall{MergeIdentities, IdentifyIdentities, AliasIdentities} {
+		if parsed, err := ParseIdentityCall(call.String()); err != nil || parsed != call {
+			t.Errorf("Expected %v got %v, %v", call, parsed, err)
+		}
+	}
+	if _, err := ParseIdentityCall("link"); err == nil {
+		t.Error("Expected an error for an unknown call")
+	}
+}
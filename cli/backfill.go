@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+)
+
+var backfillArgs struct {
+	file       string
+	call       string
+	rate       float64
+	maxRetries int
+	skip       int
+	report     string
+}
+
+func init() {
+	register(&command{
+		name:    "backfill-identities",
+		args:    "--file <identities.csv>",
+		summary: "tie pairs of anonymous and user ids, anon_id,user_id per line, with $merge, $identify or $create_alias",
+		flags: func(fs *flag.FlagSet) {
+			args := &backfillArgs
+			fs.StringVar(&args.file, "file", "", "CSV file of anon_id,user_id pairs, - for stdin")
+			fs.StringVar(&args.call, "call", "merge", "merge, identify or alias")
+			fs.Float64Var(&args.rate, "rate", 10, "maximum pairs sent per second, 0 for no limit")
+			fs.IntVar(&args.maxRetries, "max-retries", 3, "retries of a pair failing with a network error, a 429 or a 5xx status")
+			fs.IntVar(&args.skip, "skip", 0, "pairs to skip at the start of the file, to resume an interrupted backfill")
+			fs.StringVar(&args.report, "report", "", "write the outcome of every pair to this CSV file")
+		},
+		run: runBackfillIdentities,
+	})
+}
+
+func runBackfillIdentities(a *app, args []string) error {
+	cmd := commands["backfill-identities"]
+	opts := &backfillArgs
+	if opts.file == "" {
+		return usagef(cmd, "missing --file")
+	}
+	call, err := mixpanel.ParseIdentityCall(opts.call)
+	if err != nil {
+		return usagef(cmd, "%v", err)
+	}
+	if call == mixpanel.MergeIdentities && a.apiSecret == "" {
+		return &configError{"merging identities needs the project API secret, set MIXPANEL_API_SECRET or pass --api-secret"}
+	}
+	mp, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	var input io.Reader = a.stdin
+	if opts.file != "-" {
+		f, err := os.Open(opts.file)
+		if err != nil {
+			return &configError{err.Error()}
+		}
+		defer f.Close()
+		input = f
+	}
+
+	var report *csv.Writer
+	if opts.report != "" {
+		f, err := os.Create(opts.report)
+		if err != nil {
+			return &configError{err.Error()}
+		}
+		defer f.Close()
+		w := bufio.NewWriter(f)
+		defer w.Flush()
+		report = csv.NewWriter(w)
+		defer report.Flush()
+		report.Write([]string{"line", "anon_id", "user_id", "status", "error"})
+	}
+
+	backfillOpts := &mixpanel.IdentityBackfillOptions{
+		Call:       call,
+		Rate:       opts.rate,
+		MaxRetries: opts.maxRetries,
+		Skip:       opts.skip,
+		OnResult: func(res mixpanel.IdentityResult) {
+			status, msg := "sent", ""
+			switch {
+			case res.Invalid:
+				status, msg = "invalid", res.Err.Error()
+				fmt.Fprintf(a.stderr, "line %d: %v\n", res.Line, res.Err)
+			case res.Err != nil:
+				status, msg = "failed", res.Err.Error()
+				fmt.Fprintf(a.stderr, "line %d: %s,%s: %v\n", res.Line, res.AnonID, res.UserID, res.Err)
+			}
+			if report != nil {
+				report.Write([]string{strconv.Itoa(res.Line), res.AnonID, res.UserID, status, msg})
+			}
+		},
+	}
+	progress, err := mp.IdentityBackfill(context.Background(), input, backfillOpts)
+	if progress != nil {
+		fmt.Fprintf(a.text(), "sent %d of %d pairs with %s, %d invalid, %d failed, %d skipped\n",
+			progress.Sent, progress.Read, call, progress.Invalid, progress.Failed, progress.Skipped)
+		a.count("read", progress.Read)
+		a.count("backfilled", progress.Sent)
+		a.count("invalid", progress.Invalid)
+		a.count("failed", progress.Failed)
+		a.count("skipped", progress.Skipped)
+		a.count("retries", progress.Retries)
+	}
+	if err != nil {
+		return err
+	}
+	if n := progress.Invalid + progress.Failed; n > 0 {
+		return fmt.Errorf("%d pairs could not be sent", n)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBackfillIdentities(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "identities.csv")
+	report := filepath.Join(dir, "report.csv")
+	os.WriteFile(input, []byte("anon_id,user_id\nd1,u1\nd2\nd3,u3\n"), 0o644)
+
+	a, received := newTestApp(t)
+	code := a.main([]string{"backfill-identities", "--file", input, "--call", "identify", "--rate", "0", "--report", report})
+	if code != exitAPI {
+		t.Errorf("Expected the invalid pair to fail the backfill, got %d: %s", code, a.stderr)
+	}
+	if len(*received) != 2 {
+		t.Fatalf("Expected 2 messages got %v", *received)
+	}
+	for i, msg := range *received {
+		props := msg["properties"].(map[string]interface{})
+		id := fmt.Sprint(2*i + 1)
+		if msg["event"] != "$identify" || props["$identified_id"] != "u"+id || props["$anon_id"] != "d"+id {
+			t.Errorf("Unexpected message %v", msg)
+		}
+	}
+	if out := a.stdout.(fmt.Stringer).String(); !strings.Contains(out, "sent 2 of 3 pairs with identify, 1 invalid, 0 failed") {
+		t.Errorf("Unexpected summary %q", out)
+	}
+	want := "line,anon_id,user_id,status,error\n2,d1,u1,sent,\n3,d2,,invalid,mixpanel: expected two different ids\n4,d3,u3,sent,\n"
+	if data, _ := os.ReadFile(report); string(data) != want {
+		t.Errorf("Unexpected report %q", data)
+	}
+
+	a, _ = newTestApp(t)
+	if code := a.main([]string{"backfill-identities", "--file", input}); code != exitConfig {
+		t.Errorf("Expected merging without an API secret to fail, got %d", code)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	a, received := newTestApp(t)
+	if code := a.main([]string{"--dry-run", "track", "12345", "Signed Up", "Plan=Pro"}); code != exitOK {
+		t.Fatalf("Expected success got %d: %s", code, a.stderr)
+	}
+	if len(*received) != 0 {
+		t.Errorf("Expected nothing to be sent got %v", *received)
+	}
+	out := a.stdout.(fmt.Stringer).String()
+	if !strings.HasPrefix(out, "POST "+a.apiHost+"/track\n{\n") || !strings.Contains(out, `"Plan": "Pro"`) {
+		t.Errorf("Unexpected preview %q", out)
+	}
+}
+
+func TestDryRunImport(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "events.ndjson")
+	os.WriteFile(input, []byte(`{"event": "Signed Up", "properties": {"time": 1704067200, "distinct_id": "u1"}}`+"\n"), 0o644)
+
+	a, _ := newTestApp(t)
+	a.apiSecret = "secret"
+	if code := a.main([]string{"import", "--dry-run", "--file", input}); code != exitOK {
+		t.Fatalf("Expected success got %d: %s", code, a.stderr)
+	}
+	out := a.stdout.(fmt.Stringer).String()
+	if !strings.HasPrefix(out, "POST "+a.apiHost+"/import\n[\n") || !strings.Contains(out, "imported 1 of 1 records") {
+		t.Errorf("Unexpected preview %q", out)
+	}
+}
+
+func TestDryRunQueries(t *testing.T) {
+	for _, args := range [][]string{
+		{"--dry-run", "people", "list"},
+		{"--dry-run", "export", "--from", "2024-01-01", "--to", "2024-01-01"},
+	} {
+		a, _ := newTestApp(t)
+		a.apiHost = "http://127.0.0.1:1"
+		a.apiSecret = "secret"
+		if code := a.main(args); code != exitOK {
+			t.Fatalf("%v: expected success got %d: %s", args, code, a.stderr)
+		}
+		if out := a.stdout.(fmt.Stringer).String(); !strings.HasPrefix(out, "GET http://127.0.0.1:1/api/2.0/") && !strings.HasPrefix(out, "POST http://127.0.0.1:1/api/2.0/") {
+			t.Errorf("%v: unexpected preview %q", args, out)
+		}
+	}
+
+	a, _ := newTestApp(t)
+	if code := a.main([]string{"--dry-run", "ping"}); code != exitUsage {
+		t.Errorf("Expected ping --dry-run to be a usage error got %d", code)
+	}
+}
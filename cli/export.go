@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+)
+
+var exportArgs struct {
+	from        string
+	to          string
+	events      listFlag
+	where       string
+	limit       int
+	format      string
+	file        string
+	columns     listFlag
+	rate        float64
+	maxRetries  int
+	checkpoint  string
+	concurrency int
+}
+
+func init() {
+	register(&command{
+		name:    "export",
+		args:    "--from <YYYY-MM-DD> --to <YYYY-MM-DD>",
+		summary: "export raw events as JSON lines or CSV",
+		flags: func(fs *flag.FlagSet) {
+			args := &exportArgs
+			fs.StringVar(&args.from, "from", "", "first day to export, YYYY-MM-DD")
+			fs.StringVar(&args.to, "to", "", "last day to export, YYYY-MM-DD")
+			args.events = nil
+			fs.Var(&args.events, "event", "export only this event (repeatable)")
+			fs.StringVar(&args.where, "where", "", "segmentation expression the events must match")
+			fs.IntVar(&args.limit, "limit", 0, "maximum number of events")
+			fs.StringVar(&args.format, "format", "jsonl", "jsonl or csv")
+			fs.StringVar(&args.file, "file", "", "write to this file rather than stdout")
+			args.columns = nil
+			fs.Var(&args.columns, "column", "CSV: property given its own column, the others go to a JSON properties column (repeatable)")
+			fs.Float64Var(&args.rate, "rate", 0, "maximum requests per hour, the export API allows 60")
+			fs.IntVar(&args.maxRetries, "max-retries", 3, "retries of a request failing with a network error, a 429 or a 5xx status")
+			fs.StringVar(&args.checkpoint, "checkpoint", "", "export one day per request, keeping the days exported in this file "+
+				"to resume an interrupted export; needs --file")
+			fs.IntVar(&args.concurrency, "concurrency", 1, "export up to this many days at once, ignored with --limit")
+		},
+		run: runExport,
+	})
+}
+
+func runExport(a *app, args []string) error {
+	cmd := commands["export"]
+	opts := &exportArgs
+	from, err := time.Parse("2006-01-02", opts.from)
+	if err != nil {
+		return usagef(cmd, "invalid --from %q, expected YYYY-MM-DD", opts.from)
+	}
+	to, err := time.Parse("2006-01-02", opts.to)
+	if err != nil {
+		return usagef(cmd, "invalid --to %q, expected YYYY-MM-DD", opts.to)
+	}
+	var write func(w io.Writer, header bool) func(*mixpanel.Event) error
+	switch opts.format {
+	case "jsonl":
+		write = jsonlWriter
+	case "csv":
+		write = csvWriter(opts.columns)
+	default:
+		return usagef(cmd, "unknown format %q", opts.format)
+	}
+	if opts.checkpoint != "" && opts.file == "" {
+		return usagef(cmd, "--checkpoint needs --file")
+	}
+	if a.jsonOutput() && opts.file == "" {
+		return usagef(cmd, "--output json needs --file")
+	}
+	if opts.concurrency > 1 && opts.checkpoint != "" {
+		return usagef(cmd, "--concurrency cannot be used with --checkpoint")
+	}
+	q, err := a.queryClient()
+	if err != nil {
+		return err
+	}
+
+	cp, err := readExportCheckpoint(opts.checkpoint)
+	if err != nil {
+		return err
+	}
+	out := a.stdout
+	var file *os.File
+	if opts.file != "" {
+		if cp != nil {
+			file, err = os.OpenFile(opts.file, os.O_WRONLY, 0)
+			if err == nil {
+				// drop what was written of the day being exported
+				if err = file.Truncate(cp.Offset); err == nil {
+					_, err = file.Seek(cp.Offset, io.SeekStart)
+				}
+			}
+			from, _ = time.Parse("2006-01-02", cp.Next)
+			fmt.Fprintf(a.stderr, "resuming at %s\n", cp.Next)
+		} else {
+			file, err = os.Create(opts.file)
+		}
+		if err != nil {
+			return &configError{err.Error()}
+		}
+		defer file.Close()
+		out = file
+	}
+	w := bufio.NewWriter(out)
+	defer w.Flush()
+	emit := write(w, cp == nil || cp.Offset == 0)
+
+	x := &exporter{a: a, q: q, emit: emit, maxRetries: opts.maxRetries}
+	if opts.rate > 0 {
+		x.interval = time.Duration(float64(time.Hour) / opts.rate)
+	}
+	query := &mixpanel.ExportQuery{
+		From:        from,
+		To:          to,
+		Events:      opts.events,
+		Where:       opts.where,
+		Limit:       opts.limit,
+		Concurrency: opts.concurrency,
+	}
+	if opts.checkpoint == "" {
+		err = x.export(query)
+	} else {
+		for day := from; !day.After(to) && err == nil; day = day.AddDate(0, 0, 1) {
+			if opts.limit > 0 && x.n >= opts.limit {
+				break
+			}
+			query.From, query.To = day, day
+			if opts.limit > 0 {
+				query.Limit = opts.limit - x.n
+			}
+			if err = x.export(query); err != nil {
+				break
+			}
+			if err = emit(nil); err != nil {
+				break
+			}
+			if err = w.Flush(); err != nil {
+				break
+			}
+			offset, _ := file.Seek(0, io.SeekCurrent)
+			data, _ := json.Marshal(&exportCheckpoint{Next: day.AddDate(0, 0, 1).Format("2006-01-02"), Offset: offset})
+			err = writeCheckpoint(opts.checkpoint, data)
+		}
+	}
+	a.count("exported", x.n)
+	if err != nil {
+		return err
+	}
+	if err := emit(nil); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stderr, "exported %d events\n", x.n)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if opts.checkpoint != "" {
+		os.Remove(opts.checkpoint)
+	}
+	return nil
+}
+
+// exportCheckpoint is the progress of an export interrupted after the
+// day before Next, having written Offset bytes to the output file.
+type exportCheckpoint struct {
+	Next   string `json:"next"`
+	Offset int64  `json:"offset"`
+}
+
+func readExportCheckpoint(path string) (*exportCheckpoint, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, &configError{err.Error()}
+	}
+	cp := &exportCheckpoint{}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, &configError{fmt.Sprintf("invalid checkpoint %s: %v", path, err)}
+	}
+	if _, err := time.Parse("2006-01-02", cp.Next); err != nil {
+		return nil, &configError{fmt.Sprintf("invalid checkpoint %s: %v", path, err)}
+	}
+	return cp, nil
+}
+
+// exporter sends export requests no more often than every interval,
+// retrying them on transient errors.
+type exporter struct {
+	a          *app
+	q          *mixpanel.QueryClient
+	emit       func(*mixpanel.Event) error
+	interval   time.Duration
+	maxRetries int
+
+	last time.Time
+	// n counts the events exported.
+	n int
+}
+
+func (x *exporter) export(query *mixpanel.ExportQuery) error {
+	delay := time.Second
+	for attempt := 0; ; attempt++ {
+		if wait := time.Until(x.last.Add(x.interval)); wait > 0 {
+			time.Sleep(wait)
+		}
+		x.last = time.Now()
+
+		it := x.q.Export(context.Background(), query)
+		n := 0
+		for it.Next() {
+			var e mixpanel.Event
+			if err := it.Scan(&e); err != nil {
+				it.Close()
+				return err
+			}
+			if err := x.emit(&e); err != nil {
+				it.Close()
+				return err
+			}
+			n++
+		}
+		it.Close()
+		x.n += n
+		err := it.Err()
+		// events already written cannot be taken back
+		if err == nil || n > 0 || attempt >= x.maxRetries || !mixpanel.IsTransient(err) {
+			return err
+		}
+		fmt.Fprintf(x.a.stderr, "retrying in %v: %v\n", delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// jsonlWriter writes events as JSON lines. A nil event flushes the
+// output.
+func jsonlWriter(w io.Writer, header bool) func(*mixpanel.Event) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return func(e *mixpanel.Event) error {
+		if e == nil {
+			return nil
+		}
+		return enc.Encode(e)
+	}
+}
+
+// csvWriter writes events as CSV with a column for the event name, the
+// distinct_id, the time and each of columns; the other properties are
+// written as a JSON object in a last column. The header row is left out
+// when appending to an earlier output, and a nil event flushes the
+// output.
+func csvWriter(columns []string) func(w io.Writer, header bool) func(*mixpanel.Event) error {
+	return func(w io.Writer, withHeader bool) func(*mixpanel.Event) error {
+		cw := csv.NewWriter(w)
+		header := append([]string{"event", "distinct_id", "time"}, columns...)
+		if withHeader {
+			cw.Write(append(header, "properties"))
+		}
+		return func(e *mixpanel.Event) error {
+			if e == nil {
+				cw.Flush()
+				return cw.Error()
+			}
+			props := mixpanel.P{}
+			if e.Properties != nil {
+				props.Update(e.Properties)
+			}
+			record := []string{e.Event}
+			for _, key := range header[1:] {
+				record = append(record, csvValue(props[key]))
+				delete(props, key)
+			}
+			rest, err := json.Marshal(props)
+			if err != nil {
+				return err
+			}
+			return cw.Write(append(record, string(rest)))
+		}
+	}
+}
+
+func csvValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// listFlag is a repeatable flag.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
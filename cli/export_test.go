@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportCommand(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, _, _ := r.BasicAuth(); r.URL.Path != "/api/2.0/export" || user != "secret" {
+			t.Errorf("Unexpected request %s as %q", r.URL, user)
+		}
+		w.Write([]byte(`{"event": "Signup", "properties": {"distinct_id": "u1", "time": 1704067200, "Plan": "Pro", "n": 2}}
+{"event": "Signup", "properties": {"distinct_id": "u2", "time": 1704067260, "$browser": "Firefox"}}
+`))
+	}))
+	defer ts.Close()
+
+	for format, want := range map[string]string{
+		"csv": "event,distinct_id,time,Plan,properties\n" +
+			"Signup,u1,1704067200,Pro,\"{\"\"n\"\":2}\"\n" +
+			"Signup,u2,1704067260,,\"{\"\"$browser\"\":\"\"Firefox\"\"}\"\n",
+		"jsonl": `{"event":"Signup","properties":{"Plan":"Pro","distinct_id":"u1","n":2,"time":1704067200}}` + "\n" +
+			`{"event":"Signup","properties":{"$browser":"Firefox","distinct_id":"u2","time":1704067260}}` + "\n",
+	} {
+		a, _ := newTestApp(t)
+		a.apiHost = ts.URL
+		a.apiSecret = "secret"
+		code := a.main([]string{"export", "--from", "2024-01-01", "--to", "2024-01-31", "--event", "Signup", "--format", format, "--column", "Plan"})
+		if code != exitOK {
+			t.Fatalf("%s: expected success got %d: %s", format, code, a.stderr)
+		}
+		if out := a.stdout.(fmt.Stringer).String(); out != want {
+			t.Errorf("%s: unexpected output %q", format, out)
+		}
+	}
+}
+
+func TestExportCheckpoint(t *testing.T) {
+	fail := true
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		day := r.URL.Query().Get("from_date")
+		if r.URL.Query().Get("to_date") != day {
+			t.Errorf("Expected one day per request got %s", r.URL)
+		}
+		if day == "2024-01-02" && fail {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "invalid"}`))
+			return
+		}
+		fmt.Fprintf(w, `{"event": "Signup", "properties": {"distinct_id": "%s", "time": 1704067200}}`+"\n", day)
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "events.csv")
+	checkpoint := filepath.Join(dir, "checkpoint")
+	args := []string{"export", "--api-secret", "secret", "--from", "2024-01-01", "--to", "2024-01-03",
+		"--format", "csv", "--file", file, "--checkpoint", checkpoint}
+	a, _ := newTestApp(t)
+	a.apiHost = ts.URL
+	if code := a.main(args); code != exitAPI {
+		t.Fatalf("Expected the failed day to stop the export got %d: %s", code, a.stderr)
+	}
+	if data, _ := os.ReadFile(checkpoint); !strings.Contains(string(data), `"next":"2024-01-02"`) {
+		t.Fatalf("Unexpected checkpoint %s", data)
+	}
+
+	fail = false
+	a, _ = newTestApp(t)
+	a.apiHost = ts.URL
+	if code := a.main(args); code != exitOK {
+		t.Fatalf("Expected success got %d: %s", code, a.stderr)
+	}
+	want := "event,distinct_id,time,properties\n" +
+		"Signup,2024-01-01,1704067200,{}\n" +
+		"Signup,2024-01-02,1704067200,{}\n" +
+		"Signup,2024-01-03,1704067200,{}\n"
+	if data, _ := os.ReadFile(file); string(data) != want {
+		t.Errorf("Unexpected export %q", data)
+	}
+	if _, err := os.Stat(checkpoint); !os.IsNotExist(err) {
+		t.Errorf("Expected the checkpoint to be removed, got %v", err)
+	}
+}
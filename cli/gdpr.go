@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+)
+
+type gdprOptions struct {
+	oauthToken  string
+	ccpa        bool
+	task        string
+	noWait      bool
+	poll        time.Duration
+	fromFile    string
+	distinctIDs listFlag
+	file        string
+	yes         bool
+}
+
+var gdprArgs gdprOptions
+
+// gdprFlags registers the flags shared by the gdpr commands.
+func gdprFlags(fs *flag.FlagSet) {
+	args := &gdprArgs
+	fs.StringVar(&args.oauthToken, "gdpr-token", "", "OAuth token for GDPR APIs (default $MIXPANEL_GDPR_TOKEN)")
+	fs.BoolVar(&args.ccpa, "ccpa", false, "make the request under the CCPA rather than the GDPR")
+	fs.StringVar(&args.task, "task", "", "follow the task of this id, requested earlier")
+	fs.BoolVar(&args.noWait, "no-wait", false, "print the task id rather than waiting for the task to be done")
+	fs.DurationVar(&args.poll, "poll", 30*time.Second, "how often to check the status of the task")
+}
+
+func init() {
+	register(group("gdpr", "delete or export the data of users through the compliance API",
+		&command{
+			name:    "delete",
+			args:    "[--distinct-ids <file>] [distinct_id...]",
+			summary: "delete all the data of users",
+			flags: func(fs *flag.FlagSet) {
+				gdprFlags(fs)
+				fs.StringVar(&gdprArgs.fromFile, "distinct-ids", "", "file of distinct_ids, one per line, - for stdin")
+				fs.BoolVar(&gdprArgs.yes, "yes", false, "do not ask for confirmation")
+			},
+			run: runGDPRDelete,
+		},
+		&command{
+			name:    "export",
+			args:    "--distinct-id <id>...",
+			summary: "download an archive of all the data of users",
+			flags: func(fs *flag.FlagSet) {
+				gdprFlags(fs)
+				gdprArgs.distinctIDs = nil
+				fs.Var(&gdprArgs.distinctIDs, "distinct-id", "distinct_id of a user (repeatable)")
+				fs.StringVar(&gdprArgs.file, "file", "", "file to download the archive to (default mixpanel-gdpr-<task>.zip)")
+			},
+			run: runGDPRExport,
+		},
+	))
+}
+
+func runGDPRDelete(a *app, args []string) error {
+	cmd := commands["gdpr"].subcommands["delete"]
+	opts := &gdprArgs
+	c, err := a.complianceClient()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	var tasks []*mixpanel.ComplianceTask
+	if opts.task != "" {
+		tasks = append(tasks, c.DeletionTask(opts.task))
+	} else {
+		ids := args
+		if opts.fromFile != "" {
+			input := a.stdin
+			if opts.fromFile != "-" {
+				f, err := os.Open(opts.fromFile)
+				if err != nil {
+					return &configError{err.Error()}
+				}
+				defer f.Close()
+				input = f
+			}
+			read, err := readIDs(input)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, read...)
+		}
+		if len(ids) == 0 {
+			return usagef(cmd, "no distinct_ids to delete")
+		}
+		if !opts.yes {
+			ok, err := a.confirm(fmt.Sprintf("Permanently delete all the data of %d users?", len(ids)))
+			if err != nil || !ok {
+				return err
+			}
+		}
+		for len(ids) > 0 {
+			n := len(ids)
+			if n > mixpanel.MaxComplianceIDs {
+				n = mixpanel.MaxComplianceIDs
+			}
+			task, err := c.RequestDeletion(ctx, ids[:n], opts.regulation())
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(a.text(), "requested the deletion of %d users: task %s\n", n, task.ID)
+			a.result.Tasks = append(a.result.Tasks, task.ID)
+			tasks = append(tasks, task)
+			ids = ids[n:]
+		}
+	}
+	if opts.noWait || a.dryRun {
+		return nil
+	}
+
+	failed := 0
+	for _, task := range tasks {
+		if err := a.waitTask(ctx, c, task); err != nil {
+			return err
+		}
+		if task.Status != mixpanel.TaskSuccess {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d deletion tasks failed", failed)
+	}
+	return nil
+}
+
+func runGDPRExport(a *app, args []string) error {
+	cmd := commands["gdpr"].subcommands["export"]
+	opts := &gdprArgs
+	c, err := a.complianceClient()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	var task *mixpanel.ComplianceTask
+	if opts.task != "" {
+		task = c.RetrievalTask(opts.task)
+	} else {
+		ids := append(opts.distinctIDs, args...)
+		if len(ids) == 0 {
+			return usagef(cmd, "missing --distinct-id")
+		}
+		if task, err = c.RequestRetrieval(ctx, ids, opts.regulation()); err != nil {
+			return err
+		}
+		fmt.Fprintf(a.text(), "requested the data of %d users: task %s\n", len(ids), task.ID)
+		a.result.Tasks = append(a.result.Tasks, task.ID)
+	}
+	if opts.noWait || a.dryRun {
+		return nil
+	}
+
+	if err := a.waitTask(ctx, c, task); err != nil {
+		return err
+	}
+	if task.Status != mixpanel.TaskSuccess {
+		return fmt.Errorf("retrieval task %s failed", task.ID)
+	}
+	output := opts.file
+	if output == "" {
+		output = "mixpanel-gdpr-" + task.ID + ".zip"
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return &configError{err.Error()}
+	}
+	if err := c.Download(ctx, task, f); err != nil {
+		f.Close()
+		os.Remove(output)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.text(), "downloaded %s\n", output)
+	return nil
+}
+
+// regulation returns the compliance type of the requests.
+func (opts *gdprOptions) regulation() string {
+	if opts.ccpa {
+		return mixpanel.CCPA
+	}
+	return mixpanel.GDPR
+}
+
+// waitTask polls task until it is done, printing its status as it
+// changes.
+func (a *app) waitTask(ctx context.Context, c *mixpanel.ComplianceClient, task *mixpanel.ComplianceTask) error {
+	status := task.Status
+	for {
+		if err := c.Status(ctx, task); err != nil {
+			return err
+		}
+		if task.Status != status {
+			status = task.Status
+			fmt.Fprintf(a.stderr, "task %s: %s\n", task.ID, strings.ToLower(status))
+		}
+		if task.Done() {
+			return nil
+		}
+		time.Sleep(gdprArgs.poll)
+	}
+}
+
+// complianceClient returns a client of the compliance API, authenticated
+// with the project token and the GDPR OAuth token.
+func (a *app) complianceClient() (*mixpanel.ComplianceClient, error) {
+	if a.token == "" {
+		return nil, &configError{"no project token, set MIXPANEL_TOKEN or pass --token"}
+	}
+	oauthToken := gdprArgs.oauthToken
+	if oauthToken == "" {
+		oauthToken = os.Getenv("MIXPANEL_GDPR_TOKEN")
+	}
+	if oauthToken == "" {
+		return nil, &configError{"no OAuth token for GDPR APIs, set MIXPANEL_GDPR_TOKEN or pass --gdpr-token"}
+	}
+	c := mixpanel.NewComplianceClient(a.token, oauthToken)
+	switch {
+	case a.apiHost != "":
+		c.Endpoint = strings.TrimRight(a.apiHost, "/") + "/api/app"
+	case a.eu:
+		c.Endpoint = mixpanel.EUComplianceEndpoint
+	}
+	if a.dryRun {
+		c.HTTPClient = &http.Client{Transport: &dryRunTransport{a.text()}}
+	}
+	return c, nil
+}
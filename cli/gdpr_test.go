@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGDPRDelete(t *testing.T) {
+	var requested []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/app/data-deletions/v3.0/":
+			r.ParseForm()
+			requested = append(requested, r.PostForm.Get("distinct_ids"))
+			w.Write([]byte(`{"status": "ok", "results": {"task_id": "7"}}`))
+		case "/api/app/data-deletions/v3.0/7":
+			w.Write([]byte(`{"status": "ok", "results": {"status": "SUCCESS"}}`))
+		default:
+			t.Errorf("Unexpected request %s", r.URL)
+		}
+	}))
+	defer ts.Close()
+
+	ids := filepath.Join(t.TempDir(), "ids.txt")
+	os.WriteFile(ids, []byte("u1\nu2\n"), 0o644)
+	a, _ := newTestApp(t)
+	a.apiHost = ts.URL
+	if code := a.main([]string{"gdpr", "delete", "--gdpr-token", "oauth", "--distinct-ids", ids, "--yes", "--poll", "1ms"}); code != exitOK {
+		t.Fatalf("Expected success got %d: %s", code, a.stderr)
+	}
+	if len(requested) != 1 || requested[0] != `["u1","u2"]` {
+		t.Errorf("Unexpected requests %v", requested)
+	}
+	if out := a.stdout.(fmt.Stringer).String(); out != "requested the deletion of 2 users: task 7\n" {
+		t.Errorf("Unexpected output %q", out)
+	}
+	if !strings.Contains(a.stderr.(fmt.Stringer).String(), "task 7: success") {
+		t.Errorf("Expected the status to be printed, got %q", a.stderr)
+	}
+}
+
+func TestGDPRExport(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/app/data-retrievals/v3.0/9":
+			w.Write([]byte(`{"status": "ok", "results": {"status": "SUCCESS", "result": "` + ts.URL + `/archive.zip"}}`))
+		case "/archive.zip":
+			w.Write([]byte("zip"))
+		default:
+			t.Errorf("Unexpected request %s", r.URL)
+		}
+	}))
+	defer ts.Close()
+
+	output := filepath.Join(t.TempDir(), "out.zip")
+	a, _ := newTestApp(t)
+	a.apiHost = ts.URL
+	t.Setenv("MIXPANEL_GDPR_TOKEN", "oauth")
+	if code := a.main([]string{"gdpr", "export", "--task", "9", "--file", output}); code != exitOK {
+		t.Fatalf("Expected success got %d: %s", code, a.stderr)
+	}
+	if data, _ := os.ReadFile(output); string(data) != "zip" {
+		t.Errorf("Unexpected archive %q", data)
+	}
+
+	t.Setenv("MIXPANEL_GDPR_TOKEN", "")
+	if code := a.main([]string{"gdpr", "export", "--distinct-id", "u1"}); code != exitConfig {
+		t.Errorf("Expected a missing OAuth token to be a configuration error got %d", code)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+)
+
+func init() {
+	updates := []struct {
+		name    string
+		summary string
+		update  func(mp *mixpanel.Mixpanel, key, id string, props *mixpanel.P) error
+	}{
+		{"set", "set group profile properties", (*mixpanel.Mixpanel).GroupSet},
+		{"set_once", "set group profile properties that are not set yet", (*mixpanel.Mixpanel).GroupSetOnce},
+		{"union", "merge values into list properties of a group profile", (*mixpanel.Mixpanel).GroupUnion},
+		{"remove", "remove values from list properties of a group profile", (*mixpanel.Mixpanel).GroupRemove},
+	}
+
+	var cmds []*command
+	for _, u := range updates {
+		u := u
+		cmd := &command{
+			name:    u.name,
+			args:    "<group_key> <group_id> key=value...",
+			summary: u.summary,
+			minArgs: 3,
+		}
+		cmd.run = func(a *app, args []string) error {
+			props, err := extractProperties(cmd, args[2:])
+			if err != nil {
+				return err
+			}
+			mp, err := a.client()
+			if err != nil {
+				return err
+			}
+			return u.update(mp, args[0], args[1], props)
+		}
+		cmds = append(cmds, cmd)
+	}
+
+	register(group("group", "update and delete group profiles", append(cmds,
+		&command{
+			name:    "unset",
+			args:    "<group_key> <group_id> <property>...",
+			summary: "remove group profile properties",
+			minArgs: 3,
+			run: func(a *app, args []string) error {
+				mp, err := a.client()
+				if err != nil {
+					return err
+				}
+				return mp.GroupUnset(args[0], args[1], args[2:])
+			},
+		},
+		&command{
+			name:    "delete",
+			args:    "<group_key> <group_id>",
+			summary: "delete a group profile",
+			minArgs: 2,
+			run: func(a *app, args []string) error {
+				mp, err := a.client()
+				if err != nil {
+					return err
+				}
+				return mp.GroupDelete(args[0], args[1])
+			},
+		},
+	)...))
+}
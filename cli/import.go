@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+)
+
+var importArgs struct {
+	file        string
+	format      string
+	failures    string
+	strict      bool
+	profiles    bool
+	concurrency int
+	batchSize   int
+	rate        float64
+	maxRetries  int
+	checkpoint  string
+	mapping     mixpanel.CSVMapping
+}
+
+func init() {
+	register(&command{
+		name:    "import",
+		args:    "--file <events.ndjson|events.csv>",
+		summary: "import a file of events or profiles in batches",
+		flags: func(fs *flag.FlagSet) {
+			args := &importArgs
+			fs.StringVar(&args.file, "file", "", "file to import, - for stdin")
+			fs.StringVar(&args.format, "format", "", "ndjson or csv, guessed from the file extension by default")
+			fs.StringVar(&args.failures, "failures", "", "write the records that could not be imported to this file, to retry them")
+			fs.BoolVar(&args.strict, "strict", false, "have Mixpanel validate every event and report the invalid ones")
+			fs.BoolVar(&args.profiles, "profiles", false, "the CSV file holds profiles rather than events")
+			fs.IntVar(&args.concurrency, "concurrency", 1, "number of requests sent at once")
+			fs.IntVar(&args.batchSize, "batch-size", mixpanel.MaxImportBatch, "records per request")
+			fs.Float64Var(&args.rate, "rate", 0, "maximum records sent per second")
+			fs.IntVar(&args.maxRetries, "max-retries", 3, "retries of a request failing with a network error, a 429 or a 5xx status")
+			fs.StringVar(&args.checkpoint, "checkpoint", "", "file keeping the records imported, to resume an interrupted import")
+
+			m := &args.mapping
+			fs.StringVar(&m.Event, "event", "", "CSV: name of every event")
+			fs.StringVar(&m.EventColumn, "event-column", "", "CSV: column holding the event name")
+			fs.StringVar(&m.DistinctIDColumn, "distinct-id-column", "distinct_id", "CSV: column holding the distinct_id")
+			fs.StringVar(&m.TimeColumn, "time-column", "", "CSV: column holding the time (default time for events)")
+			fs.StringVar(&m.TimeLayout, "time-layout", "", "CSV: unix, unix_ms or a Go time layout (default RFC 3339)")
+			fs.StringVar(&m.InsertIDColumn, "insert-id-column", "", "CSV: column holding the $insert_id")
+			m.Columns, m.Types = map[string]string{}, map[string]string{}
+			fs.Var(mapFlag(m.Columns), "rename", "CSV: column=property renames a column, column=- drops it (repeatable)")
+			fs.Var(mapFlag(m.Types), "type", "CSV: column=int|float|bool|time|list sets the type of a column (repeatable)")
+		},
+		run: runImport,
+	})
+}
+
+func runImport(a *app, args []string) error {
+	cmd := commands["import"]
+	opts := &importArgs
+	if opts.file == "" {
+		return usagef(cmd, "missing --file")
+	}
+	format := opts.format
+	if format == "" {
+		format = "ndjson"
+		if strings.EqualFold(filepath.Ext(opts.file), ".csv") {
+			format = "csv"
+		}
+	}
+	if format != "ndjson" && format != "csv" {
+		return usagef(cmd, "unknown format %q", format)
+	}
+	if opts.profiles && format != "csv" {
+		return usagef(cmd, "--profiles needs a CSV file")
+	}
+	if !opts.profiles && a.apiSecret == "" {
+		return &configError{"importing events needs the project API secret, set MIXPANEL_API_SECRET or pass --api-secret"}
+	}
+	if !opts.profiles && opts.mapping.TimeColumn == "" {
+		opts.mapping.TimeColumn = "time"
+	}
+	mp, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	var input io.Reader = a.stdin
+	var size int64
+	if opts.file != "-" {
+		f, err := os.Open(opts.file)
+		if err != nil {
+			return &configError{err.Error()}
+		}
+		defer f.Close()
+		if info, err := f.Stat(); err == nil {
+			size = info.Size()
+		}
+		input = f
+	}
+	counter := &countingReader{r: input}
+	input = bufio.NewReader(counter)
+
+	skip, err := readImportCheckpoint(opts.checkpoint)
+	if err != nil {
+		return err
+	}
+	if skip > 0 {
+		fmt.Fprintf(a.stderr, "resuming after %d records\n", skip)
+	}
+
+	var failures io.Writer
+	var written int64
+	if opts.failures != "" {
+		// a resumed import adds to the failures of the interrupted one
+		flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if skip > 0 {
+			flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+		f, err := os.OpenFile(opts.failures, flag, 0o644)
+		if err != nil {
+			return &configError{err.Error()}
+		}
+		defer f.Close()
+		if info, err := f.Stat(); err == nil {
+			written = info.Size()
+		}
+		w := bufio.NewWriter(f)
+		defer w.Flush()
+		failures = w
+	}
+	if format == "csv" {
+		// keep the header apart to repeat it in the failures file
+		header, err := input.(*bufio.Reader).ReadString('\n')
+		if err != nil && header == "" {
+			return fmt.Errorf("cannot read the CSV header: %v", err)
+		}
+		if failures != nil && written == 0 {
+			io.WriteString(failures, strings.TrimRight(header, "\r\n")+"\n")
+		}
+		input = io.MultiReader(strings.NewReader(header), input)
+	}
+
+	bar := &progressBar{w: a.stderr, total: size, input: counter}
+	importOpts := &mixpanel.ImportOptions{
+		BatchSize:   opts.batchSize,
+		Concurrency: opts.concurrency,
+		Strict:      opts.strict,
+		Rate:        opts.rate,
+		MaxRetries:  opts.maxRetries,
+		Skip:        skip,
+		Progress:    bar.update,
+		OnInvalid: func(line int, data []byte, err error) {
+			bar.println(fmt.Sprintf("line %d: %v", line, err))
+			if failures != nil {
+				failures.Write(data)
+				io.WriteString(failures, "\n")
+			}
+		},
+		OnFailed: func(line int, data []byte, record mixpanel.FailedRecord) {
+			bar.println(fmt.Sprintf("line %d: rejected: %v", line, record))
+			if failures != nil {
+				failures.Write(data)
+				io.WriteString(failures, "\n")
+			}
+		},
+	}
+	if opts.checkpoint != "" {
+		importOpts.Checkpoint = func(records int) {
+			writeCheckpoint(opts.checkpoint, []byte(strconv.Itoa(records)+"\n"))
+		}
+	}
+
+	ctx := context.Background()
+	var progress *mixpanel.ImportProgress
+	switch {
+	case format == "ndjson":
+		progress, err = mp.ImportFromReader(ctx, input, importOpts)
+	case opts.profiles:
+		progress, err = mp.ImportProfilesCSV(ctx, input, &opts.mapping, importOpts)
+	default:
+		progress, err = mp.ImportEventsCSV(ctx, input, &opts.mapping, importOpts)
+	}
+	bar.done()
+	if progress != nil {
+		fmt.Fprintf(a.text(), "imported %d of %d records in %d batches, %d invalid, %d rejected\n",
+			progress.Imported, progress.Read, progress.Batches, progress.Invalid, progress.Failed)
+		a.count("read", progress.Read)
+		a.count("imported", progress.Imported)
+		a.count("batches", progress.Batches)
+		a.count("invalid", progress.Invalid)
+		a.count("rejected", progress.Failed)
+		a.count("skipped", progress.Skipped)
+		a.result.RequestIDs = append(a.result.RequestIDs, progress.RequestIDs...)
+	}
+	if err != nil {
+		return err
+	}
+	if opts.checkpoint != "" {
+		os.Remove(opts.checkpoint)
+	}
+	if n := progress.Invalid + progress.Failed; n > 0 {
+		return fmt.Errorf("%d records could not be imported", n)
+	}
+	return nil
+}
+
+// readImportCheckpoint returns the number of records imported by an
+// interrupted import, 0 when there is no checkpoint.
+func readImportCheckpoint(path string) (int, error) {
+	if path == "" {
+		return 0, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, &configError{err.Error()}
+	}
+	records, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, &configError{fmt.Sprintf("invalid checkpoint %s: %v", path, err)}
+	}
+	return records, nil
+}
+
+// mapFlag is a repeatable key=value flag filling a map.
+type mapFlag map[string]string
+
+func (m mapFlag) String() string {
+	pairs := make([]string, 0, len(m))
+	for k, v := range m {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m mapFlag) Set(value string) error {
+	for _, pair := range strings.Split(value, ",") {
+		idx := strings.Index(pair, "=")
+		if idx <= 0 {
+			return fmt.Errorf("invalid %q, expected key=value", pair)
+		}
+		m[pair[:idx]] = pair[idx+1:]
+	}
+	return nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n atomic.Int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n.Add(int64(n))
+	return n, err
+}
+
+// progressBar redraws a single status line as an import progresses.
+type progressBar struct {
+	w     io.Writer
+	total int64
+	input *countingReader
+	width int
+}
+
+func (pb *progressBar) update(p mixpanel.ImportProgress) {
+	line := fmt.Sprintf("read %d, imported %d, rejected %d, invalid %d", p.Read, p.Imported, p.Failed, p.Invalid)
+	if pb.total > 0 {
+		const size = 30
+		done := int(pb.input.n.Load() * size / pb.total)
+		if done > size {
+			done = size
+		}
+		line = fmt.Sprintf("[%s%s] %3d%% %s", strings.Repeat("=", done), strings.Repeat(" ", size-done), done*100/size, line)
+	}
+	pb.print(line)
+}
+
+// println prints a message above the status line.
+func (pb *progressBar) println(msg string) {
+	pb.print(msg)
+	fmt.Fprintln(pb.w)
+	pb.width = 0
+}
+
+func (pb *progressBar) print(line string) {
+	pad := ""
+	if len(line) < pb.width {
+		pad = strings.Repeat(" ", pb.width-len(line))
+	}
+	fmt.Fprintf(pb.w, "\r%s%s", line, pad)
+	pb.width = len(line)
+}
+
+func (pb *progressBar) done() {
+	if pb.width > 0 {
+		fmt.Fprintln(pb.w)
+		pb.width = 0
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestImportCommand(t *testing.T) {
+	var mu sync.Mutex
+	var events []map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, _, _ := r.BasicAuth(); r.URL.Path != "/import" || user != "secret" {
+			t.Errorf("Unexpected request %s as %q", r.URL, user)
+		}
+		gz, _ := gzip.NewReader(r.Body)
+		var batch []map[string]interface{}
+		json.NewDecoder(gz).Decode(&batch)
+		mu.Lock()
+		events = append(events, batch...)
+		mu.Unlock()
+		fmt.Fprintf(w, `{"code": 200, "num_records_imported": %d, "status": "OK"}`, len(batch))
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "events.csv")
+	failures := filepath.Join(dir, "failures.csv")
+	os.WriteFile(input, []byte("user,ts,price\n"+
+		"u1,1704067200,9.99\n"+
+		"u2,1704067260,free\n"+
+		"u3,1704067320,5\n"), 0o644)
+
+	a, _ := newTestApp(t)
+	a.apiHost = ts.URL
+	a.apiSecret = "secret"
+	code := a.main([]string{"import", "--file", input, "--failures", failures, "--concurrency", "2", "--batch-size", "1",
+		"--event", "Purchase", "--distinct-id-column", "user", "--time-column", "ts", "--time-layout", "unix", "--type", "price=float"})
+	if code != exitAPI {
+		t.Errorf("Expected the invalid row to fail the import, got %d: %s", code, a.stderr)
+	}
+	if len(events) != 2 {
+		t.Errorf("Expected 2 events got %v", events)
+	}
+	if out := a.stdout.(fmt.Stringer).String(); !strings.Contains(out, "imported 2 of 3 records in 2 batches, 1 invalid") {
+		t.Errorf("Unexpected summary %q", out)
+	}
+	if report := a.stderr.(fmt.Stringer).String(); !strings.Contains(report, "line 3: column price") {
+		t.Errorf("Expected the invalid row to be reported, got %q", report)
+	}
+	if data, _ := os.ReadFile(failures); string(data) != "user,ts,price\nu2,1704067260,free\n" {
+		t.Errorf("Unexpected failures file %q", data)
+	}
+}
+
+func TestImportCommandNeedsSecret(t *testing.T) {
+	a, _ := newTestApp(t)
+	if code := a.main([]string{"import", "--file", "events.ndjson"}); code != exitConfig {
+		t.Errorf("Expected a configuration error got %d: %s", code, a.stderr)
+	}
+}
+
+func TestImportCheckpoint(t *testing.T) {
+	var ids []string
+	fail := true
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gz, _ := gzip.NewReader(r.Body)
+		var batch []map[string]interface{}
+		json.NewDecoder(gz).Decode(&batch)
+		if len(ids) == 2 && fail {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code": 400, "error": "invalid", "status": "Error"}`))
+			return
+		}
+		for _, e := range batch {
+			ids = append(ids, e["properties"].(map[string]interface{})["distinct_id"].(string))
+		}
+		fmt.Fprintf(w, `{"code": 200, "num_records_imported": %d, "status": "OK"}`, len(batch))
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "events.ndjson")
+	checkpoint := filepath.Join(dir, "checkpoint")
+	var input strings.Builder
+	for i := 0; i < 5; i++ {
+		fmt.Fprintf(&input, `{"event": "Signed Up", "properties": {"time": %d, "distinct_id": "u%d"}}`+"\n", 1704067200+i, i)
+	}
+	os.WriteFile(file, []byte(input.String()), 0o644)
+
+	args := []string{"import", "--api-secret", "secret", "--file", file, "--batch-size", "2", "--checkpoint", checkpoint}
+	a, _ := newTestApp(t)
+	a.apiHost = ts.URL
+	if code := a.main(args); code != exitAPI {
+		t.Fatalf("Expected the rejected batch to fail the import got %d: %s", code, a.stderr)
+	}
+	if data, _ := os.ReadFile(checkpoint); string(data) != "2\n" {
+		t.Fatalf("Expected a checkpoint after 2 records got %q", data)
+	}
+
+	fail = false
+	a, _ = newTestApp(t)
+	a.apiHost = ts.URL
+	if code := a.main(args); code != exitOK {
+		t.Fatalf("Expected success got %d: %s", code, a.stderr)
+	}
+	if fmt.Sprint(ids) != "[u0 u1 u2 u3 u4]" {
+		t.Errorf("Expected the import to resume got %v", ids)
+	}
+	if _, err := os.Stat(checkpoint); !os.IsNotExist(err) {
+		t.Errorf("Expected the checkpoint to be removed, got %v", err)
+	}
+}
+
+func TestImportCheckpointFailures(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch requests {
+		case 1:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code": 400, "num_records_imported": 1, "status": "Bad Request",
+				"error": "some data points in the request failed validation",
+				"failed_records": [{"index": 1, "field": "properties.time", "message": "'properties.time' is invalid"}]}`))
+		case 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte(`{"code": 200, "num_records_imported": 2, "status": "OK"}`))
+		}
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "events.csv")
+	failures := filepath.Join(dir, "failures.csv")
+	checkpoint := filepath.Join(dir, "checkpoint")
+	os.WriteFile(input, []byte("user,ts\n"+
+		"u0,1704067200\n"+
+		"u1,1704067260\n"+
+		"u2,1704067320\n"+
+		"u3,1704067380\n"), 0o644)
+
+	args := []string{"import", "--api-secret", "secret", "--file", input, "--failures", failures, "--checkpoint", checkpoint,
+		"--batch-size", "2", "--max-retries", "0", "--strict", "--event", "Signed Up", "--distinct-id-column", "user", "--time-column", "ts", "--time-layout", "unix"}
+	a, _ := newTestApp(t)
+	a.apiHost = ts.URL
+	if code := a.main(args); code != exitAPI {
+		t.Fatalf("Expected the rejected batch to fail the import got %d: %s", code, a.stderr)
+	}
+	if data, _ := os.ReadFile(checkpoint); string(data) != "2\n" {
+		t.Fatalf("Expected a checkpoint after 2 records got %q", data)
+	}
+
+	a, _ = newTestApp(t)
+	a.apiHost = ts.URL
+	a.main(args)
+	if requests != 3 {
+		t.Errorf("Expected the import to resume with 1 request got %d", requests)
+	}
+	// the rejected row is kept, with a single header, across the resume
+	if data, _ := os.ReadFile(failures); string(data) != "user,ts\nu1,1704067260\n" {
+		t.Errorf("Unexpected failures file %q", data)
+	}
+}
+
+func TestImportRequestIDs(t *testing.T) {
+	var ids []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids = append(ids, r.Header.Get("X-Request-Id"))
+		w.Write([]byte(`{"code": 200, "num_records_imported": 1, "status": "OK"}`))
+	}))
+	defer ts.Close()
+
+	input := filepath.Join(t.TempDir(), "events.ndjson")
+	os.WriteFile(input, []byte(`{"event": "Signed Up", "properties": {"time": 1704067200, "distinct_id": "u1"}}`+"\n"), 0o644)
+	a, _ := newTestApp(t)
+	a.apiHost = ts.URL
+	a.apiSecret = "secret"
+	if code := a.main([]string{"--output", "json", "import", "--file", input}); code != exitOK {
+		t.Fatalf("Expected success got %d: %s", code, a.stderr)
+	}
+	var res result
+	if err := json.Unmarshal([]byte(a.stdout.(fmt.Stringer).String()), &res); err != nil {
+		t.Fatalf("Expected a JSON result got %q: %v", a.stdout, err)
+	}
+	if len(ids) != 1 || ids[0] == "" || fmt.Sprint(res.RequestIDs) != fmt.Sprint(ids) {
+		t.Errorf("Expected the ID sent with the import in the result, got %v and %v", res.RequestIDs, ids)
+	}
+}
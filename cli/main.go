@@ -1,118 +1,543 @@
+/*
+Command mixpanel tracks events and updates profiles from the command
+line.
+
+	export MIXPANEL_TOKEN=...
+	mixpanel track 12345 "Signed Up" Plan=Pro
+	mixpanel --eu set 12345 '$email=amy@example.com'
+
+Property values that look like numbers, booleans, RFC 3339 times or
+JSON arrays are sent as such; use key:=json to give a raw JSON value.
+
+Global flags go before or right after the command name. Run
+"mixpanel help" for the list of commands and "mixpanel help <command>"
+for the flags of one of them.
+
+The exit status tells the class of error: 2 for a bad command line, 3
+for missing configuration, 4 when Mixpanel cannot be reached and 1 when
+it rejects the request. With --output json a JSON object describing the
+result is printed on stdout instead of the usual summaries:
+
+	{"command": "import", "status": "error", "exit_code": 1, "error": "...",
+	 "counts": {"imported": 1998, "rejected": 2, "sent": 1998}, "request_ids": ["..."]}
+*/
 package main
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
-	"log"
-	"os"
+	"time"
 
-	mixpanel "github.com/mixpanel/mixpanel-go"
+	mixpanel "github.com/Mistobaan/mixpanels-go"
 )
 
-func check(err error){
-	if err != nil {
-		log.Fatal(err)
+// Exit statuses, one per class of error.
+const (
+	exitOK      = 0
+	exitAPI     = 1
+	exitUsage   = 2
+	exitConfig  = 3
+	exitNetwork = 4
+)
+
+// command is a subcommand of the CLI.
+type command struct {
+	name    string
+	args    string
+	summary string
+	// minArgs is the number of required arguments.
+	minArgs int
+	// flags registers the flags specific to the command, if any.
+	flags func(fs *flag.FlagSet)
+	run   func(a *app, args []string) error
+	// subcommands of a group of commands such as "people list", keyed
+	// by their last word.
+	subcommands map[string]*command
+}
+
+var commands = map[string]*command{}
+
+func register(cmds ...*command) {
+	for _, cmd := range cmds {
+		commands[cmd.name] = cmd
 	}
 }
 
-func extractProperties(cmds []string) *mixpanel.P {
-	props := &mixpanel.P{}
-	for _, element := range cmds[2:] {
-		idx := strings.Index(element, "=")
-		if idx != -1 {
-			(*props)[element[:idx]] = element[idx+1:]
-		} else {
-			log.Fatalf("Invalid argument %s", element)
+// group returns a command grouping subs, whose names are prefixed by
+// the name of the group.
+func group(name, summary string, subs ...*command) *command {
+	cmd := &command{
+		name:        name,
+		summary:     summary,
+		subcommands: map[string]*command{},
+	}
+	var names []string
+	for _, sub := range subs {
+		cmd.subcommands[sub.name] = sub
+		names = append(names, sub.name)
+		sub.name = name + " " + sub.name
+	}
+	sort.Strings(names)
+	cmd.args = strings.Join(names, "|") + " ..."
+	return cmd
+}
+
+// lookup finds the command named by the first of args, descending into
+// groups, and returns it along with the remaining args.
+func lookup(args []string) (*command, []string, error) {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return nil, nil, &usageError{msg: fmt.Sprintf("unknown command %q", args[0])}
+	}
+	args = args[1:]
+	for cmd.subcommands != nil {
+		if len(args) == 0 {
+			return nil, nil, usagef(cmd, "missing %s command", cmd.name)
 		}
+		sub, ok := cmd.subcommands[args[0]]
+		if !ok {
+			return nil, nil, usagef(cmd, "unknown %s command %q", cmd.name, args[0])
+		}
+		cmd, args = sub, args[1:]
 	}
-	return props
+	return cmd, args, nil
 }
 
-// export MIXPANEL_TOKEN=
-// track id event_name a=b c=d d=e 
-// track 
-// 
-func main() {
-	token := os.Getenv("MIXPANEL_TOKEN")
-	if len(token) == 0 {
-		log.Fatal("Please Set MIXPANEL_TOKEN env variable")
-	} 
-
-	mp := mixpanel.NewMixpanel(token)
-	if len(os.Args) < 2 {
-		log.Fatal("not enough arguments")
-	}
-	cmds := os.Args[1:]
-
-	switch cmds[0] {
-	case "track":
-		if len(cmds) < 3 {
-			log.Fatal("not enough arguments for track")
-		} else if len(cmds) == 3 {
-			check(mp.Track(cmds[1], cmds[2], nil))
-		} else {
-			check(mp.Track(cmds[1], cmds[2], extractProperties(cmds[2:])))
+// app holds the global flags and the streams of a run of the CLI.
+type app struct {
+	token     string
+	apiSecret string
+	apiHost   string
+	eu        bool
+	verbose   bool
+	dryRun    bool
+	output    string
+
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	// sendErr is the last error of a request, unsent the number of
+	// messages lost to such errors.
+	sendErr error
+	unsent  int
+
+	result result
+}
+
+// result is the outcome of a command printed by --output json.
+type result struct {
+	Command    string         `json:"command,omitempty"`
+	Status     string         `json:"status"`
+	ExitCode   int            `json:"exit_code"`
+	Error      string         `json:"error,omitempty"`
+	Counts     map[string]int `json:"counts,omitempty"`
+	RequestIDs []string       `json:"request_ids,omitempty"`
+	// Tasks are the ids of the compliance tasks requested.
+	Tasks []string `json:"tasks,omitempty"`
+	// Data is the output of commands listing things.
+	Data interface{} `json:"data,omitempty"`
+}
+
+// count adds n to the count of name in the result.
+func (a *app) count(name string, n int) {
+	if a.result.Counts == nil {
+		a.result.Counts = map[string]int{}
+	}
+	a.result.Counts[name] += n
+}
+
+// jsonOutput reports whether the result is printed as JSON.
+func (a *app) jsonOutput() bool {
+	return a.output == "json"
+}
+
+// text returns where to print the summaries meant for people: stdout,
+// or stderr when stdout is kept for the JSON result.
+func (a *app) text() io.Writer {
+	if a.jsonOutput() {
+		return a.stderr
+	}
+	return a.stdout
+}
+
+// globalFlags registers the flags accepted by every command.
+func (a *app) globalFlags(fs *flag.FlagSet) {
+	fs.StringVar(&a.token, "token", a.token, "project token (default $MIXPANEL_TOKEN)")
+	fs.StringVar(&a.apiSecret, "api-secret", a.apiSecret, "project API secret, needed to import (default $MIXPANEL_API_SECRET)")
+	fs.StringVar(&a.apiHost, "api-host", a.apiHost, "API host, such as a tracking proxy")
+	fs.BoolVar(&a.eu, "eu", a.eu, "send to the EU residency servers")
+	fs.BoolVar(&a.verbose, "verbose", a.verbose, "print every request and its response")
+	fs.BoolVar(&a.dryRun, "dry-run", a.dryRun, "print the requests that would be sent, without sending them")
+	fs.StringVar(&a.output, "output", a.output, "text, or json to print the result as JSON on stdout")
+}
+
+// client returns a Mixpanel client configured by the global flags,
+// sending every message right away.
+func (a *app) client() (*mixpanel.Mixpanel, error) {
+	return a.clientWith(mixpanel.NewStdConsumer())
+}
+
+// clientWith is like client but sends through c, whose failed requests
+// are recorded in sendErr.
+func (a *app) clientWith(c interface {
+	mixpanel.Consumer
+	OnResponse(func(*mixpanel.Response))
+}) (*mixpanel.Mixpanel, error) {
+	if a.token == "" {
+		return nil, &configError{"no project token, set MIXPANEL_TOKEN or pass --token"}
+	}
+	c.OnResponse(func(r *mixpanel.Response) {
+		if a.verbose {
+			fmt.Fprintf(a.stderr, "%s: %d messages, HTTP %d in %v: %s\n",
+				r.Endpoint, r.Messages, r.StatusCode, r.Duration, strings.TrimSpace(string(r.Body)))
 		}
-	case "alias":
-		if len(cmds) < 2 {
-			log.Fatal("not enough arguments for alias")
+		if r.Err != nil {
+			a.sendErr = r.Err
+			a.unsent += r.Messages
+			a.count("unsent", r.Messages)
 		} else {
-			check(mp.Alias(cmds[1], cmds[2]))
-		} 
-	case "set":
-		if len(cmds) < 2 {
-			log.Fatal("not enough arguments for set")
-		} else {
-			check(mp.PeopleSet(cmds[1], extractProperties(cmds[1:])))
-		} 
-	case "set_once":
-		if len(cmds) < 2 {
-			log.Fatal("not enough arguments for set_once")
-		} else {
-			check(mp.PeopleSetOnce(cmds[1], extractProperties(cmds[1:])))
+			a.count("sent", r.Messages)
 		}
-	case "add":
-		if len(cmds) < 2 {
-			log.Fatal("not enough arguments for add [id] [key=value]*")
-		} else {
-			check(mp.PeopleIncrement(cmds[1], extractProperties(cmds[1:])))
+		// the ID sent with the request, or the one of a proxy answering
+		id := r.RequestID
+		if id == "" {
+			id = r.Header.Get(mixpanel.DefaultRequestIDHeader)
 		}
-	case "append":
-		if len(cmds) < 2 {
-			log.Fatal("not enough arguments for append [id] [key=value]*")
-		} else {
-			check(mp.PeopleAppend(cmds[1], extractProperties(cmds[1:])))
+		if id != "" {
+			a.result.RequestIDs = append(a.result.RequestIDs, id)
 		}
-	case "union":
-		if len(cmds) < 2 {
-			log.Fatal("not enough arguments for union [id] [key=value]*")
-		} else {
-			check(mp.PeopleUnion(cmds[1], extractProperties(cmds[1:])))
+	})
+	opts := []mixpanel.Option{mixpanel.WithRequestIDHeader(mixpanel.DefaultRequestIDHeader)}
+	if a.apiSecret != "" {
+		opts = append(opts, mixpanel.WithAPISecret(a.apiSecret))
+	}
+	switch {
+	case a.apiHost != "":
+		opts = append(opts, mixpanel.WithAPIHost(a.apiHost))
+	case a.eu:
+		opts = append(opts, mixpanel.WithAPIHost(mixpanel.EUAPIHost))
+	}
+	if a.dryRun {
+		opts = append(opts, mixpanel.WithHTTPClient(&http.Client{Transport: &dryRunTransport{a.text()}}))
+	}
+	return mixpanel.NewMixpanelWithConsumer(a.token, c, opts...), nil
+}
+
+// queryClient returns a client of the query and export APIs,
+// authenticated with the API secret.
+func (a *app) queryClient() (*mixpanel.QueryClient, error) {
+	if a.apiSecret == "" {
+		return nil, &configError{"no project API secret, set MIXPANEL_API_SECRET or pass --api-secret"}
+	}
+	q := mixpanel.NewQueryClient(a.apiSecret)
+	switch {
+	case a.apiHost != "":
+		q.Endpoint = strings.TrimRight(a.apiHost, "/") + "/api/2.0"
+		q.ExportEndpoint = q.Endpoint
+	case a.eu:
+		q.Endpoint = mixpanel.EUQueryEndpoint
+		q.ExportEndpoint = mixpanel.EUExportEndpoint
+	}
+	if a.dryRun {
+		q.HTTPClient = &http.Client{Transport: &dryRunTransport{a.text()}}
+	}
+	return q, nil
+}
+
+// usageError reports a bad command line.
+type usageError struct {
+	cmd *command
+	msg string
+}
+
+func (e *usageError) Error() string { return e.msg }
+
+func usagef(cmd *command, format string, args ...interface{}) error {
+	return &usageError{cmd, fmt.Sprintf(format, args...)}
+}
+
+// configError reports missing or invalid configuration.
+type configError struct{ msg string }
+
+func (e *configError) Error() string { return e.msg }
+
+// exitCode maps an error to the exit status of its class.
+func exitCode(err error) int {
+	var usage *usageError
+	var config *configError
+	var network net.Error
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &usage):
+		return exitUsage
+	case errors.As(err, &config):
+		return exitConfig
+	case errors.As(err, &network):
+		return exitNetwork
+	}
+	return exitAPI
+}
+
+func main() {
+	a := &app{
+		token:     os.Getenv("MIXPANEL_TOKEN"),
+		apiSecret: os.Getenv("MIXPANEL_API_SECRET"),
+		stdin:     os.Stdin,
+		stdout:    os.Stdout,
+		stderr:    os.Stderr,
+	}
+	os.Exit(a.main(os.Args[1:]))
+}
+
+// main runs the command line args and returns the exit status.
+func (a *app) main(args []string) int {
+	a.result = result{}
+	err := a.dispatch(args)
+	if err == flag.ErrHelp {
+		return exitOK
+	}
+	if a.jsonOutput() {
+		defer a.printResult(err)
+	}
+	if err != nil {
+		fmt.Fprintf(a.stderr, "mixpanel: %v\n", err)
+		var usage *usageError
+		if errors.As(err, &usage) {
+			if usage.cmd != nil {
+				fmt.Fprintf(a.stderr, "usage: mixpanel %s %s\n", usage.cmd.name, usage.cmd.args)
+			} else {
+				fmt.Fprintln(a.stderr, `run "mixpanel help" for usage`)
+			}
 		}
-	case "unset":
-		if len(cmds) < 2 {
-			log.Fatal("not enough arguments for unset [id] [*values]")
-		} else {
-			check(mp.PeopleUnset(cmds[1], cmds[1:]))
+	}
+	return exitCode(err)
+}
+
+// printResult prints the result of a command ending with err as JSON.
+func (a *app) printResult(err error) {
+	a.result.Status = "ok"
+	a.result.ExitCode = exitCode(err)
+	if err != nil {
+		a.result.Status = "error"
+		a.result.Error = err.Error()
+	}
+	enc := json.NewEncoder(a.stdout)
+	enc.SetEscapeHTML(false)
+	enc.Encode(&a.result)
+}
+
+func (a *app) dispatch(args []string) error {
+	fs := flag.NewFlagSet("mixpanel", flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	fs.Usage = func() { a.usage() }
+	a.globalFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return err
 		}
-	case "delete":
-		if len(cmds) < 2 {
-			log.Fatal("not enough arguments for delete <id>")
-		} else {
-			check(mp.PeopleDelete(cmds[1]))
+		return &usageError{msg: err.Error()}
+	}
+	if fs.NArg() == 0 {
+		a.usage()
+		return &usageError{msg: "no command"}
+	}
+
+	if fs.Arg(0) == "help" {
+		return a.help(fs.Args()[1:])
+	}
+	cmd, args, err := lookup(fs.Args())
+	if err != nil {
+		return err
+	}
+	cfs := a.flagSet(cmd)
+	if err := cfs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return err
 		}
-	case "charge":
-		if len(cmds) < 3 {
-			log.Fatal("not enough arguments for delete <id>")
-		} else {
-			amount, err := strconv.ParseFloat(cmds[2], 64)
-			check(err)
-			check(mp.PeopleTrackCharge(cmds[1], amount, extractProperties(cmds[2:])))
+		return &usageError{cmd: cmd, msg: err.Error()}
+	}
+	a.result.Command = cmd.name
+	if cfs.NArg() < cmd.minArgs {
+		return usagef(cmd, "not enough arguments for %s", cmd.name)
+	}
+	if a.output != "" && a.output != "text" && !a.jsonOutput() {
+		return usagef(cmd, "unknown output %q, expected text or json", a.output)
+	}
+	return cmd.run(a, cfs.Args())
+}
+
+// flagSet returns the flags of cmd, its own ones and the global ones.
+func (a *app) flagSet(cmd *command) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(a.stderr, "usage: mixpanel %s [flags] %s\n\n%s\n", cmd.name, cmd.args, cmd.summary)
+		if cmd.subcommands != nil {
+			fmt.Fprintln(a.stderr, "\ncommands:")
+			a.printCommands(cmd.subcommands)
+		}
+		fmt.Fprintln(a.stderr, "\nflags:")
+		a.printFlags(cmd)
+	}
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+	a.globalFlags(fs)
+	return fs
+}
+
+func (a *app) help(args []string) error {
+	if len(args) == 0 {
+		a.usage()
+		return nil
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return &usageError{msg: fmt.Sprintf("unknown command %q", args[0])}
+	}
+	for _, name := range args[1:] {
+		if sub, ok := cmd.subcommands[name]; ok {
+			cmd = sub
+		}
+	}
+	a.flagSet(cmd).Usage()
+	return nil
+}
+
+// printFlags prints the flags of cmd, or the global ones when cmd is
+// nil, with blank defaults so that the token never shows up.
+func (a *app) printFlags(cmd *command) {
+	fs := flag.NewFlagSet("mixpanel", flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	if cmd != nil && cmd.flags != nil {
+		cmd.flags(fs)
+	}
+	(&app{}).globalFlags(fs)
+	fs.PrintDefaults()
+}
+
+func (a *app) usage() {
+	fmt.Fprintln(a.stderr, "usage: mixpanel [flags] <command> [arguments]")
+	fmt.Fprintln(a.stderr, "\ncommands:")
+	a.printCommands(commands)
+	fmt.Fprintln(a.stderr, "\nflags:")
+	a.printFlags(nil)
+}
+
+func (a *app) printCommands(cmds map[string]*command) {
+	names := make([]string, 0, len(cmds))
+	for name := range cmds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(a.stderr, "  %-10s %s\n", name, cmds[name].summary)
+	}
+}
+
+// confirm asks a yes or no question on stdin.
+func (a *app) confirm(question string) (bool, error) {
+	fmt.Fprintf(a.stderr, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(a.stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return false, &usageError{msg: "no confirmation, pass --yes to skip it"}
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer != "y" && answer != "yes" {
+		fmt.Fprintln(a.stderr, "aborted")
+		return false, nil
+	}
+	return true, nil
+}
+
+// writeCheckpoint replaces the checkpoint file path with data, through
+// a rename so that it is never left half written.
+func writeCheckpoint(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+/*
+extractProperties parses key=value arguments into properties. Values
+that look like integers, floats, booleans, RFC 3339 times or JSON
+arrays are sent as such; key:=json sets a raw JSON value, for example
+to send a number as a string:
+
+	zip:='"01234"'
+*/
+func extractProperties(cmd *command, args []string) (*mixpanel.P, error) {
+	props := &mixpanel.P{}
+	for _, arg := range args {
+		idx := strings.Index(arg, "=")
+		if idx <= 0 {
+			return nil, usagef(cmd, "invalid property %q, expected key=value or key:=json", arg)
+		}
+		key, value := arg[:idx], arg[idx+1:]
+		if strings.HasSuffix(key, ":") {
+			key = strings.TrimSuffix(key, ":")
+			dec := json.NewDecoder(strings.NewReader(value))
+			dec.UseNumber()
+			var v interface{}
+			if err := dec.Decode(&v); err != nil || dec.More() {
+				return nil, usagef(cmd, "invalid JSON for %q: %s", key, value)
+			}
+			(*props)[key] = v
+			continue
 		}
-	case "help":
-		log.Fatal("You are on your own")
-	default:
-		log.Fatalf("Unknown command %s", cmds[0])
+		(*props)[key] = parseValue(value)
 	}
+	return props, nil
+}
+
+// jsonNumber matches the numbers of the JSON grammar, so that values
+// such as 007 or 0x10 stay strings.
+var jsonNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
 
+// parseValue guesses the type of a property value given on the command
+// line.
+func parseValue(value string) interface{} {
+	if jsonNumber.MatchString(value) {
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return i
+		}
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	switch value {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	for _, layout := range []string{time.RFC3339, mixpanel.TimeLayout} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	if strings.HasPrefix(value, "[") {
+		var list []interface{}
+		dec := json.NewDecoder(strings.NewReader(value))
+		dec.UseNumber()
+		if dec.Decode(&list) == nil && !dec.More() {
+			return list
+		}
+	}
+	return value
 }
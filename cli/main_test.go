@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestApp returns an app sending to a server recording the messages
+// it receives, batched or not.
+func newTestApp(t *testing.T) (*app, *[]map[string]interface{}) {
+	var received []map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		data, _ := base64.URLEncoding.DecodeString(r.Form.Get("data"))
+		var msgs []map[string]interface{}
+		if !bytes.HasPrefix(data, []byte("[")) {
+			data = append(append([]byte("["), data...), ']')
+		}
+		if err := json.Unmarshal(data, &msgs); err != nil {
+			t.Errorf("Unexpected payload %s", data)
+		}
+		for _, msg := range msgs {
+			msg["path"] = r.URL.Path
+			msg["request_id"] = r.Header.Get("X-Request-Id")
+			received = append(received, msg)
+		}
+		w.Write([]byte(`{"status": 1, "error": null}`))
+	}))
+	t.Cleanup(ts.Close)
+	return &app{
+		token:   "token",
+		apiHost: ts.URL,
+		stdout:  &bytes.Buffer{},
+		stderr:  &bytes.Buffer{},
+	}, &received
+}
+
+func TestTrackCommand(t *testing.T) {
+	a, received := newTestApp(t)
+	if code := a.main([]string{"track", "--verbose", "12345", "Signed Up", "Plan=Pro"}); code != exitOK {
+		t.Fatalf("Expected success got %d: %s", code, a.stderr)
+	}
+	if len(*received) != 1 {
+		t.Fatalf("Expected one message got %v", *received)
+	}
+	msg := (*received)[0]
+	props := msg["properties"].(map[string]interface{})
+	if msg["path"] != "/track" || msg["event"] != "Signed Up" || props["distinct_id"] != "12345" || props["Plan"] != "Pro" {
+		t.Errorf("Unexpected message %v", msg)
+	}
+	if !strings.Contains(a.stderr.(*bytes.Buffer).String(), "events: 1 messages, HTTP 200") {
+		t.Errorf("Expected the response to be printed, got %q", a.stderr)
+	}
+}
+
+func TestPeopleCommand(t *testing.T) {
+	a, received := newTestApp(t)
+	if code := a.main([]string{"set", "12345", "$email=amy@example.com"}); code != exitOK {
+		t.Fatalf("Expected success got %d: %s", code, a.stderr)
+	}
+	msg := (*received)[0]
+	set := msg["$set"].(map[string]interface{})
+	if msg["path"] != "/engage" || msg["$distinct_id"] != "12345" || set["$email"] != "amy@example.com" {
+		t.Errorf("Unexpected message %v", msg)
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	for _, test := range []struct {
+		args []string
+		code int
+	}{
+		{[]string{"help"}, exitOK},
+		{[]string{"help", "track"}, exitOK},
+		{[]string{}, exitUsage},
+		{[]string{"frobnicate"}, exitUsage},
+		{[]string{"track", "12345"}, exitUsage},
+		{[]string{"track", "12345", "Signed Up", "no-equal-sign"}, exitUsage},
+		{[]string{"--token=", "track", "12345", "Signed Up"}, exitConfig},
+		{[]string{"--api-host=http://127.0.0.1:1", "track", "12345", "Signed Up"}, exitNetwork},
+	} {
+		a, _ := newTestApp(t)
+		if code := a.main(test.args); code != test.code {
+			t.Errorf("%v: expected exit status %d got %d: %s", test.args, test.code, code, a.stderr)
+		}
+	}
+}
+
+func TestHelpHidesToken(t *testing.T) {
+	a, _ := newTestApp(t)
+	a.token = "very-secret-token"
+	a.main([]string{"help", "track"})
+	if out := a.stderr.(*bytes.Buffer).String(); strings.Contains(out, a.token) || !strings.Contains(out, "-api-host") {
+		t.Errorf("Unexpected help %q", out)
+	}
+}
+
+func TestTrackStdin(t *testing.T) {
+	a, received := newTestApp(t)
+	a.stdin = strings.NewReader(`{"distinct_id": "u1", "event": "Signed Up", "properties": {"Plan": "Pro"}}
+{"distinct_id": "u2", "event": "Logged In", "time": 1704067200}
+
+not json
+{"distinct_id": "u3", "event": "Logged In", "time": "2024-01-01T00:01:00Z"}
+`)
+	if code := a.main([]string{"track", "--stdin"}); code != exitAPI {
+		t.Errorf("Expected the invalid line to fail the command got %d: %s", code, a.stderr)
+	}
+	if len(*received) != 3 {
+		t.Fatalf("Expected 3 events got %v", *received)
+	}
+	for i, want := range []interface{}{nil, float64(1704067200), float64(1704067260)} {
+		props := (*received)[i]["properties"].(map[string]interface{})
+		if want != nil && props["time"] != want {
+			t.Errorf("Expected time %v got %v", want, props["time"])
+		}
+	}
+	if out := a.stdout.(fmt.Stringer).String(); out != "tracked 3 events, 1 invalid\n" {
+		t.Errorf("Unexpected summary %q", out)
+	}
+	if !strings.Contains(a.stderr.(fmt.Stringer).String(), "line 4: ") {
+		t.Errorf("Expected the invalid line to be reported, got %q", a.stderr)
+	}
+}
+
+func TestGroupCommand(t *testing.T) {
+	a, received := newTestApp(t)
+	if code := a.main([]string{"group", "set", "company", "Acme Inc", "Plan=Enterprise"}); code != exitOK {
+		t.Fatalf("Expected success got %d: %s", code, a.stderr)
+	}
+	msg := (*received)[0]
+	set := msg["$set"].(map[string]interface{})
+	if msg["path"] != "/groups" || msg["$group_key"] != "company" || msg["$group_id"] != "Acme Inc" || set["Plan"] != "Enterprise" {
+		t.Errorf("Unexpected message %v", msg)
+	}
+}
+
+func TestExtractProperties(t *testing.T) {
+	props, err := extractProperties(nil, []string{
+		"n=42", "f=9.99", "zip=01234", "ok=true", "s=hello", "hex=0x10",
+		"at=2024-01-01T10:00:00Z", "tags=[\"a\",\"b\"]", `zip2:="01234"`, `obj:={"k": 1}`, "eq=a=b",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := json.Marshal(props)
+	want := `{"at":"2024-01-01T10:00:00Z","eq":"a=b","f":9.99,"hex":"0x10","n":42,"obj":{"k":1},` +
+		`"ok":true,"s":"hello","tags":["a","b"],"zip":"01234","zip2":"01234"}`
+	if string(got) != want {
+		t.Errorf("Expected %s got %s", want, got)
+	}
+
+	if _, err := extractProperties(nil, []string{"bad:={"}); err == nil {
+		t.Errorf("Expected invalid JSON to be rejected")
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	a, received := newTestApp(t)
+	a.stdin = strings.NewReader(`{"distinct_id": "u1", "event": "Signed Up"}
+not json
+`)
+	if code := a.main([]string{"--output", "json", "track", "--stdin"}); code != exitAPI {
+		t.Errorf("Expected the invalid line to fail the command got %d: %s", code, a.stderr)
+	}
+	var res result
+	if err := json.Unmarshal(a.stdout.(*bytes.Buffer).Bytes(), &res); err != nil {
+		t.Fatalf("Expected a JSON result got %q: %v", a.stdout, err)
+	}
+	if res.Command != "track" || res.Status != "error" || res.ExitCode != exitAPI || res.Error != "1 lines could not be parsed" ||
+		res.Counts["tracked"] != 1 || res.Counts["invalid"] != 1 || res.Counts["sent"] != 1 || len(*received) != 1 ||
+		fmt.Sprint(res.RequestIDs) != fmt.Sprintf("[%s]", (*received)[0]["request_id"]) || (*received)[0]["request_id"] == "" {
+		t.Errorf("Unexpected result %+v", res)
+	}
+	if !strings.Contains(a.stderr.(fmt.Stringer).String(), "tracked 1 events, 1 invalid") {
+		t.Errorf("Expected the summary on stderr, got %q", a.stderr)
+	}
+
+	a, _ = newTestApp(t)
+	a.token = ""
+	a.main([]string{"track", "--output=json", "u1", "Signed Up"})
+	if out := a.stdout.(fmt.Stringer).String(); !strings.Contains(out, `"status":"error","exit_code":3`) {
+		t.Errorf("Expected a configuration error got %q", out)
+	}
+}
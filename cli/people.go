@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+)
+
+var peopleArgs struct {
+	where       string
+	cohort      int64
+	properties  listFlag
+	limit       int
+	format      string
+	file        string
+	fromFile    string
+	ignoreAlias bool
+	yes         bool
+	currency    string
+	refund      bool
+}
+
+func init() {
+	register(peopleCommands()...)
+	register(group("people", "query, export and delete profiles",
+		&command{
+			name:    "list",
+			summary: "list the profiles matching a query",
+			flags:   engageFlags,
+			run:     runPeopleList,
+		},
+		&command{
+			name:    "export",
+			summary: "export the profiles matching a query as JSON lines or CSV",
+			flags: func(fs *flag.FlagSet) {
+				engageFlags(fs)
+				fs.StringVar(&peopleArgs.format, "format", "jsonl", "jsonl or csv")
+				fs.StringVar(&peopleArgs.file, "file", "", "write to this file rather than stdout")
+			},
+			run: runPeopleExport,
+		},
+		&command{
+			name:    "delete",
+			args:    "--from-file <ids.txt>",
+			summary: "delete the profiles listed in a file, one distinct_id per line",
+			flags: func(fs *flag.FlagSet) {
+				fs.StringVar(&peopleArgs.fromFile, "from-file", "", "file listing the distinct_ids to delete, - for stdin")
+				fs.BoolVar(&peopleArgs.ignoreAlias, "ignore-alias", false, "do not delete the profiles the ids are aliases of")
+				fs.BoolVar(&peopleArgs.yes, "yes", false, "do not ask for confirmation")
+			},
+			run: runPeopleDelete,
+		},
+	))
+}
+
+// engageFlags registers the flags selecting profiles.
+func engageFlags(fs *flag.FlagSet) {
+	args := &peopleArgs
+	fs.StringVar(&args.where, "where", "", "segmentation expression the profiles must match")
+	fs.Int64Var(&args.cohort, "cohort", 0, "only the members of this cohort")
+	args.properties = nil
+	fs.Var(&args.properties, "property", "property to output, all by default (repeatable)")
+	fs.IntVar(&args.limit, "limit", 0, "maximum number of profiles")
+}
+
+// engage walks the profiles selected by the engage flags.
+func engage(a *app, each func(*mixpanel.Profile) error) error {
+	q, err := a.queryClient()
+	if err != nil {
+		return err
+	}
+	args := &peopleArgs
+	it := q.Engage(context.Background(), &mixpanel.EngageQuery{
+		Where:            args.where,
+		CohortID:         args.cohort,
+		OutputProperties: args.properties,
+	})
+	for n := 0; (args.limit <= 0 || n < args.limit) && it.Next(); n++ {
+		if err := each(it.Profile()); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
+
+func runPeopleList(a *app, args []string) error {
+	if a.jsonOutput() {
+		profiles := []*mixpanel.Profile{}
+		err := engage(a, func(p *mixpanel.Profile) error {
+			profiles = append(profiles, p)
+			return nil
+		})
+		a.result.Data = profiles
+		a.count("profiles", len(profiles))
+		return err
+	}
+
+	w := tabwriter.NewWriter(a.stdout, 0, 4, 2, ' ', 0)
+	columns := peopleArgs.properties
+	if len(columns) > 0 {
+		fmt.Fprintf(w, "DISTINCT_ID\t%s\n", strings.Join(columns, "\t"))
+	}
+	err := engage(a, func(p *mixpanel.Profile) error {
+		if len(columns) == 0 {
+			props, _ := json.Marshal(p.Properties)
+			_, err := fmt.Fprintf(w, "%s\t%s\n", p.DistinctID, props)
+			return err
+		}
+		row := []string{p.DistinctID}
+		for _, column := range columns {
+			row = append(row, csvValue(p.Properties[column]))
+		}
+		_, err := fmt.Fprintln(w, strings.Join(row, "\t"))
+		return err
+	})
+	w.Flush()
+	return err
+}
+
+func runPeopleExport(a *app, args []string) error {
+	opts := &peopleArgs
+	cmd := commands["people"].subcommands["export"]
+	if opts.format != "jsonl" && opts.format != "csv" {
+		return usagef(cmd, "unknown format %q", opts.format)
+	}
+	if a.jsonOutput() && opts.file == "" {
+		return usagef(cmd, "--output json needs --file")
+	}
+	out := a.stdout
+	if opts.file != "" {
+		f, err := os.Create(opts.file)
+		if err != nil {
+			return &configError{err.Error()}
+		}
+		defer f.Close()
+		out = f
+	}
+	w := bufio.NewWriter(out)
+	defer w.Flush()
+
+	var emit func(*mixpanel.Profile) error
+	if opts.format == "jsonl" {
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		emit = func(p *mixpanel.Profile) error { return enc.Encode(p) }
+	} else {
+		cw := csv.NewWriter(w)
+		defer cw.Flush()
+		cw.Write(append(append([]string{"distinct_id"}, opts.properties...), "properties"))
+		emit = func(p *mixpanel.Profile) error {
+			props := mixpanel.P{}
+			props.Update(&p.Properties)
+			record := []string{p.DistinctID}
+			for _, key := range opts.properties {
+				record = append(record, csvValue(props[key]))
+				delete(props, key)
+			}
+			rest, err := json.Marshal(props)
+			if err != nil {
+				return err
+			}
+			return cw.Write(append(record, string(rest)))
+		}
+	}
+
+	n := 0
+	err := engage(a, func(p *mixpanel.Profile) error {
+		n++
+		return emit(p)
+	})
+	fmt.Fprintf(a.stderr, "exported %d profiles\n", n)
+	a.count("exported", n)
+	return err
+}
+
+func runPeopleDelete(a *app, args []string) error {
+	opts := &peopleArgs
+	cmd := commands["people"].subcommands["delete"]
+	if opts.fromFile == "" {
+		return usagef(cmd, "missing --from-file")
+	}
+	var input io.Reader = a.stdin
+	if opts.fromFile == "-" {
+		if !opts.yes {
+			return usagef(cmd, "reading ids from stdin needs --yes")
+		}
+	} else {
+		f, err := os.Open(opts.fromFile)
+		if err != nil {
+			return &configError{err.Error()}
+		}
+		defer f.Close()
+		input = f
+	}
+	ids, err := readIDs(input)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		fmt.Fprintln(a.stderr, "no profiles to delete")
+		return nil
+	}
+	if !opts.yes {
+		ok, err := a.confirm(fmt.Sprintf("Permanently delete %d profiles?", len(ids)))
+		if err != nil || !ok {
+			return err
+		}
+	}
+
+	mp, err := a.clientWith(mixpanel.NewBuffConsumer(50))
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		update := &mixpanel.P{"$distinct_id": id, "$delete": ""}
+		if opts.ignoreAlias {
+			(*update)["$ignore_alias"] = true
+		}
+		if err := mp.PeopleUpdate(update); err != nil {
+			return err
+		}
+	}
+	if err := mp.Close(context.Background()); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.text(), "deleted %d profiles\n", len(ids)-a.unsent)
+	a.count("deleted", len(ids)-a.unsent)
+	if a.sendErr != nil {
+		return fmt.Errorf("%d profiles could not be deleted: %w", a.unsent, a.sendErr)
+	}
+	return nil
+}
+
+// readIDs reads one distinct_id per line, skipping blank lines and
+// comments.
+func readIDs(r io.Reader) ([]string, error) {
+	var ids []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		id := strings.TrimSpace(scanner.Text())
+		if id == "" || strings.HasPrefix(id, "#") {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, scanner.Err()
+}
+
+// peopleCommands returns the commands updating profiles with key=value
+// properties.
+func peopleCommands() []*command {
+	updates := []struct {
+		name    string
+		summary string
+		update  func(mp *mixpanel.Mixpanel, id string, props *mixpanel.P) error
+	}{
+		{"set", "set profile properties", (*mixpanel.Mixpanel).PeopleSet},
+		{"set_once", "set profile properties that are not set yet", (*mixpanel.Mixpanel).PeopleSetOnce},
+		{"add", "increment numeric profile properties", (*mixpanel.Mixpanel).PeopleIncrement},
+		{"append", "append values to list profile properties", (*mixpanel.Mixpanel).PeopleAppend},
+		{"union", "merge values into list profile properties", (*mixpanel.Mixpanel).PeopleUnion},
+	}
+
+	var cmds []*command
+	for _, u := range updates {
+		u := u
+		cmd := &command{
+			name:    u.name,
+			args:    "<distinct_id> key=value...",
+			summary: u.summary,
+			minArgs: 2,
+		}
+		cmd.run = func(a *app, args []string) error {
+			props, err := extractProperties(cmd, args[1:])
+			if err != nil {
+				return err
+			}
+			mp, err := a.client()
+			if err != nil {
+				return err
+			}
+			return u.update(mp, args[0], props)
+		}
+		cmds = append(cmds, cmd)
+	}
+
+	return append(cmds,
+		&command{
+			name:    "unset",
+			args:    "<distinct_id> <property>...",
+			summary: "remove profile properties",
+			minArgs: 2,
+			run: func(a *app, args []string) error {
+				mp, err := a.client()
+				if err != nil {
+					return err
+				}
+				return mp.PeopleUnset(args[0], args[1:])
+			},
+		},
+		&command{
+			name:    "delete",
+			args:    "<distinct_id>",
+			summary: "delete a profile",
+			minArgs: 1,
+			run: func(a *app, args []string) error {
+				mp, err := a.client()
+				if err != nil {
+					return err
+				}
+				return mp.PeopleDelete(args[0])
+			},
+		},
+		&command{
+			name:    "charge",
+			args:    "<distinct_id> <amount> [key=value...]",
+			summary: "record a charge, or a refund, to a profile",
+			minArgs: 2,
+			flags: func(fs *flag.FlagSet) {
+				fs.StringVar(&peopleArgs.currency, "currency", "", "ISO 4217 currency code of the amount, such as USD")
+				fs.BoolVar(&peopleArgs.refund, "refund", false, "record a refund of the amount")
+			},
+			run: func(a *app, args []string) error {
+				amount, err := strconv.ParseFloat(args[1], 64)
+				if err != nil {
+					return usagef(commands["charge"], "invalid amount %q", args[1])
+				}
+				props, err := extractProperties(commands["charge"], args[2:])
+				if err != nil {
+					return err
+				}
+				mp, err := a.client()
+				if err != nil {
+					return err
+				}
+				charge := mixpanel.Charge{Amount: amount, Currency: peopleArgs.currency, Properties: props}
+				if peopleArgs.refund {
+					return mp.PeopleTrackRefund(args[0], charge)
+				}
+				return mp.PeopleTrackRevenue(args[0], charge)
+			},
+		},
+		&command{
+			name:    "clear-charges",
+			args:    "<distinct_id>",
+			summary: "remove every charge of a profile",
+			minArgs: 1,
+			run: func(a *app, args []string) error {
+				mp, err := a.client()
+				if err != nil {
+					return err
+				}
+				return mp.PeopleClearCharges(args[0])
+			},
+		},
+	)
+}
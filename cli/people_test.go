@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPeopleList(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.URL.Path != "/api/2.0/engage" || r.Form.Get("where") != `properties["Plan"] == "Pro"` {
+			t.Errorf("Unexpected request %s %v", r.URL, r.Form)
+		}
+		w.Write([]byte(`{"page": 0, "page_size": 1000, "total": 2, "results": [
+			{"$distinct_id": "u1", "$properties": {"$email": "a@example.com", "Plan": "Pro"}},
+			{"$distinct_id": "u2", "$properties": {"Plan": "Pro"}}]}`))
+	}))
+	defer ts.Close()
+
+	a, _ := newTestApp(t)
+	a.apiHost = ts.URL
+	a.apiSecret = "secret"
+	if code := a.main([]string{"people", "list", "--where", `properties["Plan"] == "Pro"`, "--property", "$email"}); code != exitOK {
+		t.Fatalf("Expected success got %d: %s", code, a.stderr)
+	}
+	want := "DISTINCT_ID  $email\nu1           a@example.com\nu2           \n"
+	if out := a.stdout.(fmt.Stringer).String(); out != want {
+		t.Errorf("Unexpected output %q", out)
+	}
+}
+
+func TestPeopleDelete(t *testing.T) {
+	ids := filepath.Join(t.TempDir(), "ids.txt")
+	os.WriteFile(ids, []byte("u1\n# comment\n\nu2\n"), 0o644)
+
+	a, received := newTestApp(t)
+	a.stdin = strings.NewReader("n\n")
+	if code := a.main([]string{"people", "delete", "--from-file", ids}); code != exitOK || len(*received) != 0 {
+		t.Fatalf("Expected the deletion to be aborted, got %d and %v", code, *received)
+	}
+
+	a.stdin = strings.NewReader("y\n")
+	if code := a.main([]string{"people", "delete", "--from-file", ids, "--ignore-alias"}); code != exitOK {
+		t.Fatalf("Expected success got %d: %s", code, a.stderr)
+	}
+	if len(*received) != 2 {
+		t.Fatalf("Expected 2 deletions got %v", *received)
+	}
+	for i, msg := range *received {
+		if msg["$distinct_id"] != fmt.Sprintf("u%d", i+1) || msg["$ignore_alias"] != true || msg["path"] != "/engage" {
+			t.Errorf("Unexpected deletion %v", msg)
+		}
+	}
+}
+
+func TestPeopleSetOnce(t *testing.T) {
+	a, received := newTestApp(t)
+	if code := a.main([]string{"set_once", "12345", "First Login=2013-04-01T13:20:00"}); code != exitOK {
+		t.Fatalf("Expected success got %d: %s", code, a.stderr)
+	}
+	if len(*received) != 1 {
+		t.Fatalf("Expected 1 update got %v", *received)
+	}
+	update := (*received)[0]
+	if _, ok := update["$set"]; ok || update["$set_once"] == nil {
+		t.Errorf("Expected a $set_once update, got %v", update)
+	}
+}
+
+func TestPeopleUnknownCommand(t *testing.T) {
+	a, _ := newTestApp(t)
+	if code := a.main([]string{"people", "frobnicate"}); code != exitUsage {
+		t.Errorf("Expected a usage error got %d", code)
+	}
+	if !strings.Contains(a.stderr.(fmt.Stringer).String(), "usage: mixpanel people delete|export|list") {
+		t.Errorf("Expected the usage of the group, got %q", a.stderr)
+	}
+}
+
+func TestPeopleChargeRefund(t *testing.T) {
+	a, received := newTestApp(t)
+	if code := a.main([]string{"charge", "--currency", "EUR", "--refund", "12345", "49.90", "order_id=A-1029"}); code != exitOK {
+		t.Fatalf("Expected success got %d: %s", code, a.stderr)
+	}
+	transaction := (*received)[0]["$append"].(map[string]interface{})["$transactions"].(map[string]interface{})
+	if transaction["$amount"] != -49.9 || transaction["currency"] != "EUR" || transaction["refund"] != true || transaction["order_id"] != "A-1029" {
+		t.Errorf("Unexpected transaction %v", transaction)
+	}
+
+	a, _ = newTestApp(t)
+	if code := a.main([]string{"charge", "--currency", "euro", "12345", "10"}); code == exitOK {
+		t.Error("Expected an invalid currency to fail")
+	}
+}
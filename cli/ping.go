@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+)
+
+func init() {
+	register(&command{
+		name:    "ping",
+		summary: "check that the API answers and accepts the credentials",
+		run:     runPing,
+	})
+}
+
+func runPing(a *app, args []string) error {
+	if a.dryRun {
+		// a preview of the requests would not tell whether the API answers
+		return usagef(commands["ping"], "ping cannot be used with --dry-run")
+	}
+	mp, err := a.client()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if err := mp.Ping(ctx); err != nil {
+		return err
+	}
+	if err := mp.ValidateCredentials(ctx); err != nil {
+		if errors.Is(err, mixpanel.ErrInvalidCredentials) {
+			return &configError{err.Error()}
+		}
+		return err
+	}
+	fmt.Fprintln(a.text(), "ok")
+	return nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPing(t *testing.T) {
+	a, _ := newTestApp(t)
+	a.token = "e919dea023855e3c8e2ea46a38e4032c"
+	if code := a.main([]string{"ping"}); code != exitOK {
+		t.Fatalf("Expected success got %d: %s", code, a.stderr)
+	}
+	if out := a.stdout.(interface{ String() string }).String(); out != "ok\n" {
+		t.Errorf("Unexpected output %q", out)
+	}
+
+	a, _ = newTestApp(t)
+	if code := a.main([]string{"ping"}); code != exitConfig {
+		t.Errorf("Expected a malformed token to be a configuration error got %d", code)
+	}
+	if !strings.Contains(a.stderr.(interface{ String() string }).String(), "malformed project token") {
+		t.Errorf("Unexpected error %s", a.stderr)
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+)
+
+type tailOptions struct {
+	file       string
+	pattern    string
+	event      string
+	distinctID string
+	checkpoint string
+	fromStart  bool
+	noFollow   bool
+	poll       time.Duration
+}
+
+var tailArgs tailOptions
+
+func init() {
+	register(&command{
+		name:    "tail",
+		args:    "--file <app.log> --pattern <regexp>",
+		summary: "follow a log file and track the lines matching a pattern",
+		flags: func(fs *flag.FlagSet) {
+			args := &tailArgs
+			fs.StringVar(&args.file, "file", "", "log file to follow")
+			fs.StringVar(&args.pattern, "pattern", "", "regexp the lines must match; its named groups become properties, "+
+				"the event, distinct_id and time groups set those of the event")
+			fs.StringVar(&args.event, "event", "Log Line", "event name when the pattern has no event group")
+			fs.StringVar(&args.distinctID, "distinct-id", "", "distinct_id when the pattern has no distinct_id group (default the host name)")
+			fs.StringVar(&args.checkpoint, "checkpoint", "", "file keeping the offset reached, to resume after a restart")
+			fs.BoolVar(&args.fromStart, "from-start", false, "start at the beginning of the file rather than its end when there is no checkpoint")
+			fs.BoolVar(&args.noFollow, "no-follow", false, "stop at the end of the file")
+			fs.DurationVar(&args.poll, "poll", time.Second, "how often to look for new lines")
+		},
+		run: runTail,
+	})
+}
+
+func runTail(a *app, args []string) error {
+	cmd := commands["tail"]
+	opts := tailArgs
+	if opts.file == "" || opts.pattern == "" {
+		return usagef(cmd, "missing --file or --pattern")
+	}
+	re, err := regexp.Compile(opts.pattern)
+	if err != nil {
+		return usagef(cmd, "invalid --pattern: %v", err)
+	}
+	if opts.distinctID == "" {
+		opts.distinctID, _ = os.Hostname()
+	}
+	mp, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	t := &tailer{a: a, mp: mp, re: re, opts: &opts}
+	err = t.run(ctx)
+	fmt.Fprintf(a.stderr, "tracked %d lines, %d did not match\n", t.tracked.Load(), t.unmatched.Load())
+	a.count("tracked", int(t.tracked.Load()))
+	a.count("unmatched", int(t.unmatched.Load()))
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// tailer follows a log file, surviving rotation and truncation.
+type tailer struct {
+	a    *app
+	mp   *mixpanel.Mixpanel
+	re   *regexp.Regexp
+	opts *tailOptions
+
+	offset    int64
+	tracked   atomic.Int64
+	unmatched atomic.Int64
+}
+
+func (t *tailer) run(ctx context.Context) error {
+	if err := t.start(); err != nil {
+		return err
+	}
+	for {
+		f, err := os.Open(t.opts.file)
+		if err != nil {
+			return &configError{err.Error()}
+		}
+		err = t.follow(ctx, f)
+		f.Close()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// start sets the offset to resume from.
+func (t *tailer) start() error {
+	info, err := os.Stat(t.opts.file)
+	if err != nil {
+		return &configError{err.Error()}
+	}
+	if !t.opts.fromStart {
+		t.offset = info.Size()
+	}
+	if t.opts.checkpoint == "" {
+		return nil
+	}
+	data, err := os.ReadFile(t.opts.checkpoint)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return &configError{err.Error()}
+	}
+	offset, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return &configError{fmt.Sprintf("invalid checkpoint %s: %v", t.opts.checkpoint, err)}
+	}
+	// a smaller file was rotated or truncated since the checkpoint
+	if offset > info.Size() {
+		offset = 0
+	}
+	t.offset = offset
+	return nil
+}
+
+// follow tracks the lines of f from the offset. It returns nil when the
+// file was rotated or truncated, so that it is opened again, and io.EOF
+// at the end of the file with --no-follow.
+func (t *tailer) follow(ctx context.Context, f *os.File) error {
+	if _, err := f.Seek(t.offset, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReader(f)
+	var partial []byte
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if err == nil {
+			line = append(partial, line...)
+			partial = nil
+			if err := t.line(ctx, line); err != nil {
+				return err
+			}
+			t.offset += int64(len(line))
+			if n%100 == 0 {
+				t.save()
+			}
+			continue
+		}
+		if err != io.EOF {
+			return err
+		}
+		// wait for the rest of a line being written
+		partial = append(partial, line...)
+		t.save()
+		if t.opts.noFollow {
+			return io.EOF
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(t.opts.poll):
+		}
+
+		current, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(t.opts.file)
+		if err != nil {
+			// rotated away and not recreated yet
+			continue
+		}
+		if !os.SameFile(current, info) || info.Size() < t.offset+int64(len(partial)) {
+			t.offset = 0
+			return nil
+		}
+	}
+}
+
+// line tracks a line matching the pattern, retrying with backoff while
+// Mixpanel cannot be reached.
+func (t *tailer) line(ctx context.Context, line []byte) error {
+	match := t.re.FindSubmatch(bytes.TrimRight(line, "\r\n"))
+	if match == nil {
+		t.unmatched.Add(1)
+		return nil
+	}
+	event, distinctID := t.opts.event, t.opts.distinctID
+	props := &mixpanel.P{}
+	for i, name := range t.re.SubexpNames() {
+		if name == "" || match[i] == nil {
+			continue
+		}
+		value := string(match[i])
+		switch name {
+		case "event":
+			event = value
+		case "distinct_id":
+			distinctID = value
+		default:
+			(*props)[name] = parseValue(value)
+		}
+	}
+
+	delay := time.Second
+	for {
+		err := t.mp.Track(distinctID, event, props)
+		var netErr net.Error
+		if err == nil || !errors.As(err, &netErr) {
+			if err != nil {
+				fmt.Fprintf(t.a.stderr, "skipping line: %v\n", err)
+			} else {
+				t.tracked.Add(1)
+			}
+			return nil
+		}
+		fmt.Fprintf(t.a.stderr, "retrying in %v: %v\n", delay, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > time.Minute {
+			delay = time.Minute
+		}
+	}
+}
+
+// save writes the checkpoint.
+func (t *tailer) save() {
+	if t.opts.checkpoint != "" {
+		writeCheckpoint(t.opts.checkpoint, []byte(strconv.FormatInt(t.offset, 10)+"\n"))
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+const tailPattern = `^(?P<level>\w+) user=(?P<distinct_id>\S+) (?P<event>[^:]+): took=(?P<took>\d+)ms`
+
+func TestTailCommand(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "app.log")
+	checkpoint := filepath.Join(dir, "offset")
+	os.WriteFile(log, []byte("INFO user=u1 Checkout: took=12ms\nnoise\nWARN user=u2 Search: took=300ms\n"), 0o644)
+
+	a, received := newTestApp(t)
+	args := []string{"tail", "--file", log, "--pattern", tailPattern, "--checkpoint", checkpoint, "--from-start", "--no-follow"}
+	if code := a.main(args); code != exitOK {
+		t.Fatalf("Expected success got %d: %s", code, a.stderr)
+	}
+	if len(*received) != 2 {
+		t.Fatalf("Expected 2 events got %v", *received)
+	}
+	msg := (*received)[1]
+	props := msg["properties"].(map[string]interface{})
+	if msg["event"] != "Search" || props["distinct_id"] != "u2" || props["level"] != "WARN" || props["took"] != float64(300) {
+		t.Errorf("Unexpected message %v", msg)
+	}
+
+	// only the new lines are tracked from the checkpoint, the last one
+	// once it is complete
+	f, _ := os.OpenFile(log, os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString("INFO user=u3 Checkout: took=8ms\nINFO user=u4 Checkout: took=")
+	f.Close()
+	if code := a.main(args); code != exitOK {
+		t.Fatalf("Expected success got %d: %s", code, a.stderr)
+	}
+	if len(*received) != 3 || (*received)[2]["properties"].(map[string]interface{})["distinct_id"] != "u3" {
+		t.Errorf("Expected only the new line to be tracked, got %v", *received)
+	}
+}
+
+func TestTailFollowsTruncation(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "app.log")
+	os.WriteFile(log, []byte("INFO user=u1 Old: took=1000ms\n"), 0o644)
+
+	a, received := newTestApp(t)
+	mp, err := a.client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tailer := &tailer{a: a, mp: mp, re: regexp.MustCompile(tailPattern), opts: &tailOptions{
+		file:  log,
+		event: "Log Line",
+		poll:  10 * time.Millisecond,
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- tailer.run(ctx) }()
+
+	time.Sleep(50 * time.Millisecond)
+	os.WriteFile(log, []byte("INFO user=u2 New: took=2ms\n"), 0o644)
+	deadline := time.Now().Add(5 * time.Second)
+	for tailer.tracked.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Expected the tail to be canceled got %v", err)
+	}
+	if len(*received) != 1 || (*received)[0]["event"] != "New" {
+		t.Errorf("Expected the line written after the truncation got %v", *received)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+)
+
+func init() {
+	register(
+		&command{
+			name:    "track",
+			args:    "<distinct_id> <event> [key=value...] | --stdin",
+			summary: "track an event, or the events read from stdin",
+			flags: func(fs *flag.FlagSet) {
+				fs.BoolVar(&trackStdin, "stdin", false, "track the JSON events read from stdin, one per line")
+			},
+			run: runTrack,
+		},
+		&command{
+			name:    "alias",
+			args:    "<alias_id> <original_id>",
+			summary: "link a new id to an existing user",
+			minArgs: 2,
+			run:     runAlias,
+		},
+	)
+}
+
+var trackStdin bool
+
+func runTrack(a *app, args []string) error {
+	if trackStdin {
+		return trackLines(a, a.stdin)
+	}
+	if len(args) < 2 {
+		return usagef(commands["track"], "not enough arguments for track")
+	}
+	props, err := extractProperties(commands["track"], args[2:])
+	if err != nil {
+		return err
+	}
+	mp, err := a.client()
+	if err != nil {
+		return err
+	}
+	return mp.Track(args[0], args[1], props)
+}
+
+// stdinEvent is the format of the events read by track --stdin. Time is
+// either a number of seconds since the epoch or an RFC 3339 string.
+type stdinEvent struct {
+	DistinctID string          `json:"distinct_id"`
+	Event      string          `json:"event"`
+	Properties mixpanel.P      `json:"properties"`
+	Time       json.RawMessage `json:"time"`
+}
+
+// trackLines tracks the JSON events read from r in batches. Invalid lines
+// are reported and skipped.
+func trackLines(a *app, r io.Reader) error {
+	mp, err := a.clientWith(mixpanel.NewBuffConsumer(50))
+	if err != nil {
+		return err
+	}
+	tracked, invalid := 0, 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		event, props, err := parseStdinEvent(data)
+		if err != nil {
+			fmt.Fprintf(a.stderr, "line %d: %v\n", line, err)
+			invalid++
+			continue
+		}
+		if err := mp.Track(event.DistinctID, event.Event, props); err != nil {
+			return err
+		}
+		tracked++
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if err := mp.Close(context.Background()); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(a.text(), "tracked %d events, %d invalid\n", tracked-a.unsent, invalid)
+	a.count("tracked", tracked-a.unsent)
+	a.count("invalid", invalid)
+	if a.sendErr != nil {
+		return fmt.Errorf("%d events could not be sent: %w", a.unsent, a.sendErr)
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d lines could not be parsed", invalid)
+	}
+	return nil
+}
+
+func parseStdinEvent(data []byte) (*stdinEvent, *mixpanel.P, error) {
+	var event stdinEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, nil, err
+	}
+	if event.DistinctID == "" || event.Event == "" {
+		return nil, nil, errors.New("missing distinct_id or event")
+	}
+	props := event.Properties
+	if props == nil {
+		props = mixpanel.P{}
+	}
+	if len(event.Time) > 0 {
+		var seconds int64
+		var stamp time.Time
+		if json.Unmarshal(event.Time, &seconds) == nil {
+			props["time"] = seconds
+		} else if json.Unmarshal(event.Time, &stamp) == nil {
+			props["time"] = stamp
+		} else {
+			return nil, nil, fmt.Errorf("invalid time %s", event.Time)
+		}
+	}
+	return &event, &props, nil
+}
+
+func runAlias(a *app, args []string) error {
+	mp, err := a.client()
+	if err != nil {
+		return err
+	}
+	return mp.Alias(args[0], args[1])
+}
@@ -0,0 +1,88 @@
+package mixpanel
+
+import (
+	"time"
+)
+
+/*
+Clock tells the time of the events and updates a Mixpanel object sends
+when their caller does not. WithClock replaces the system clock with
+another, so that tests can produce byte-identical payloads:
+
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mp := NewMixpanel(token, WithClock(ClockFunc(func() time.Time { return at })))
+*/
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc adapts a function to a Clock.
+type ClockFunc func() time.Time
+
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+/*
+IDGenerator generates the random ids a Mixpanel object sends: the
+$insert_id of imported events and the ids of sessions. WithIDGenerator
+replaces the random ids with others, deterministic ones in tests:
+
+	var n int
+	mp := NewMixpanel(token, WithIDGenerator(IDGeneratorFunc(func() string {
+	    n++
+	    return fmt.Sprintf("id-%d", n)
+	})))
+
+Generated $insert_ids must be at most 36 letters, digits and dashes.
+*/
+type IDGenerator interface {
+	NewID() string
+}
+
+// IDGeneratorFunc adapts a function to an IDGenerator.
+type IDGeneratorFunc func() string
+
+func (f IDGeneratorFunc) NewID() string {
+	return f()
+}
+
+// WithClock replaces the system clock, see Clock.
+func WithClock(clock Clock) Option {
+	return func(mp *Mixpanel) {
+		mp.clock = clock
+	}
+}
+
+// WithIDGenerator replaces the random ids, see IDGenerator.
+func WithIDGenerator(ids IDGenerator) Option {
+	return func(mp *Mixpanel) {
+		mp.ids = ids
+	}
+}
+
+// now returns the time of the clock of mp.
+func (mp *Mixpanel) now() time.Time {
+	if mp.clock != nil {
+		return mp.clock.Now()
+	}
+	return time.Now()
+}
+
+// newInsertID returns a new $insert_id, random unless mp has an
+// IDGenerator.
+func (mp *Mixpanel) newInsertID() string {
+	if mp.ids != nil {
+		return mp.ids.NewID()
+	}
+	return newInsertID()
+}
+
+// newSessionID returns a new session id, a random UUID unless mp has an
+// IDGenerator.
+func (mp *Mixpanel) newSessionID() string {
+	if mp.ids != nil {
+		return mp.ids.NewID()
+	}
+	return NewDeviceID()
+}
@@ -0,0 +1,83 @@
+package mixpanel
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClockAndIDGenerator(t *testing.T) {
+	run := func() string {
+		var buf bytes.Buffer
+		at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+		n := 0
+		mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf),
+			WithClock(ClockFunc(func() time.Time { return at })),
+			WithIDGenerator(IDGeneratorFunc(func() string {
+				n++
+				return fmt.Sprintf("id-%d", n)
+			})))
+
+		mp.Track("12345", "Viewed", nil)
+		mp.PeopleSet("12345", &P{"plan": "pro"})
+		mp.Import("12345", "Signed Up", at.Add(-time.Hour), nil)
+		mp.PeopleTrackRevenue("12345", Charge{Amount: 10})
+		s, _ := mp.StartSession("12345", nil)
+		s.End(nil)
+		return buf.String()
+	}
+
+	out := run()
+	if again := run(); again != out {
+		t.Errorf("Expected identical payloads got\n%s\n%s", out, again)
+	}
+	for _, s := range []string{
+		`"time":1704110400`, `"$time":1704110400`, `"$insert_id":"id-1"`,
+		`"$time":"2024-01-01T12:00:00"`, `"session_id":"id-2"`, `"$duration":0`,
+	} {
+		if !bytes.Contains([]byte(out), []byte(s)) {
+			t.Errorf("Expected %s in %s", s, out)
+		}
+	}
+}
+
+func TestDeviceCookieIDs(t *testing.T) {
+	dc := DeviceCookie{IDs: IDGeneratorFunc(func() string { return "device-1" })}
+	w := httptest.NewRecorder()
+	if id := dc.Ensure(w, httptest.NewRequest("GET", "/", nil)); id != "device-1" {
+		t.Errorf("Expected device-1 got %s", id)
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(w.Result().Cookies()[0])
+	if id := dc.DeviceID(r); id != "device-1" {
+		t.Errorf("Expected the cookie to be read back got %q", id)
+	}
+}
+
+func TestImportClock(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code": 200, "num_records_imported": 1, "status": "OK"}`))
+	}))
+	defer ts.Close()
+
+	// 2024 is in the future for the clock, out of the range accepted
+	at := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	mp := NewMixpanel(token, WithAPIHost(ts.URL), WithAPISecret("secret"),
+		WithClock(ClockFunc(func() time.Time { return at })))
+	ctx := context.Background()
+	progress, err := mp.ImportFromReader(ctx, strings.NewReader(
+		`{"event": "Signed Up", "properties": {"time": 1704067200, "distinct_id": "1"}}`), nil)
+	if err != nil || progress.Invalid != 1 {
+		t.Errorf("Expected the event to be invalid got %+v, %v", progress, err)
+	}
+	progress, err = mp.ImportEventsCSV(ctx, strings.NewReader("user,ts\n1,2024-01-01T00:00:00Z\n"),
+		&CSVMapping{Event: "Signed Up", DistinctIDColumn: "user", TimeColumn: "ts"}, nil)
+	if err != nil || progress.Invalid != 1 {
+		t.Errorf("Expected the row to be invalid got %+v, %v", progress, err)
+	}
+}
@@ -0,0 +1,295 @@
+/*
+Command mixpanel-gen generates typed tracking functions from a tracking
+plan, so property names cannot drift between services.
+
+The plan is either a Lexicon schema export (JSON) or a YAML file:
+
+	package: analytics
+	events:
+	  - name: Order Placed
+	    description: A customer completed checkout.
+	    properties:
+	      Order ID: {type: string, required: true}
+	      Total:    {type: number, required: true}
+	      Coupon:   {type: string}
+	      Placed At: {type: string, format: date-time}
+
+For every event it writes a props struct and a Track function:
+
+	func TrackOrderPlaced(mp *mixpanel.Mixpanel, distinctID string, p OrderPlacedProps) error
+
+Use it from go:generate:
+
+	//go:generate go run github.com/Mistobaan/mixpanels-go/cmd/mixpanel-gen -plan plan.yaml -o events_gen.go
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Property is the schema of one event property, a subset of JSON schema.
+type Property struct {
+	Type        string    `json:"type" yaml:"type"`
+	Format      string    `json:"format" yaml:"format"`
+	Description string    `json:"description" yaml:"description"`
+	Required    bool      `json:"-" yaml:"required"`
+	Items       *Property `json:"items" yaml:"items"`
+}
+
+// Event is the schema of one event of the plan.
+type Event struct {
+	Name        string              `yaml:"name"`
+	Description string              `yaml:"description"`
+	Properties  map[string]Property `yaml:"properties"`
+}
+
+// Plan is a tracking plan.
+type Plan struct {
+	Package string  `yaml:"package"`
+	Events  []Event `yaml:"events"`
+}
+
+// lexiconExport is the format of the Lexicon schemas API.
+type lexiconExport struct {
+	Results []struct {
+		EntityType string `json:"entityType"`
+		Name       string `json:"name"`
+		SchemaJSON struct {
+			Description string              `json:"description"`
+			Properties  map[string]Property `json:"properties"`
+			Required    []string            `json:"required"`
+		} `json:"schemaJson"`
+	} `json:"results"`
+}
+
+// ParsePlan reads a plan, as a Lexicon export when it is JSON and as
+// YAML otherwise.
+func ParsePlan(data []byte) (*Plan, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var export lexiconExport
+		if err := json.Unmarshal(trimmed, &export); err != nil {
+			return nil, err
+		}
+		plan := &Plan{}
+		for _, r := range export.Results {
+			if r.EntityType != "" && r.EntityType != "event" {
+				continue
+			}
+			props := r.SchemaJSON.Properties
+			for _, name := range r.SchemaJSON.Required {
+				if p, ok := props[name]; ok {
+					p.Required = true
+					props[name] = p
+				}
+			}
+			plan.Events = append(plan.Events, Event{
+				Name:        r.Name,
+				Description: r.SchemaJSON.Description,
+				Properties:  props,
+			})
+		}
+		return plan, nil
+	}
+	plan := &Plan{}
+	if err := yaml.Unmarshal(data, plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// goType maps a property schema to a Go type.
+func goType(p Property) string {
+	switch p.Type {
+	case "string":
+		if p.Format == "date-time" || p.Format == "date" {
+			return "time.Time"
+		}
+		return "string"
+	case "number":
+		return "float64"
+	case "integer":
+		return "int64"
+	case "boolean":
+		return "bool"
+	case "array", "list":
+		if p.Items != nil {
+			return "[]" + goType(*p.Items)
+		}
+		return "[]interface{}"
+	case "object":
+		return "map[string]interface{}"
+	}
+	return "interface{}"
+}
+
+// identifier turns a Mixpanel name such as "Order Placed" or "$email"
+// into an exported Go identifier.
+func identifier(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if b.Len() == 0 && unicode.IsDigit(r) {
+			b.WriteByte('X')
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	if b.Len() == 0 {
+		return "X"
+	}
+	return b.String()
+}
+
+type genField struct {
+	Name, Property, Type, Doc string
+	OmitEmpty                 bool
+}
+
+type genEvent struct {
+	Ident, Name, Doc string
+	Fields           []genField
+}
+
+var source = template.Must(template.New("source").Parse(`// Code generated by mixpanel-gen from {{.Source}}. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- if .UsesTime}}
+	"time"
+{{end}}
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+)
+
+{{- range .Events}}
+
+// {{.Ident}}Props are the properties of the "{{.Name}}" event.
+type {{.Ident}}Props struct {
+{{- range .Fields}}
+{{- if .Doc}}
+	// {{.Doc}}
+{{- end}}
+	{{.Name}} {{.Type}} ` + "`" + `mixpanel:"{{.Property}}{{if .OmitEmpty}},omitempty{{end}}"` + "`" + `
+{{- end}}
+}
+
+// Track{{.Ident}} tracks the "{{.Name}}" event.{{if .Doc}} {{.Doc}}{{end}}
+func Track{{.Ident}}(mp *mixpanel.Mixpanel, distinctID string, p {{.Ident}}Props) error {
+	return mp.TrackStruct(distinctID, {{printf "%q" .Name}}, &p)
+}
+{{- end}}
+`))
+
+// Generate renders the Go source of plan.
+func Generate(plan *Plan, pkg, sourceName string) ([]byte, error) {
+	if plan.Package != "" && pkg == "" {
+		pkg = plan.Package
+	}
+	if pkg == "" {
+		pkg = "main"
+	}
+	data := struct {
+		Package, Source string
+		UsesTime        bool
+		Events          []genEvent
+	}{Package: pkg, Source: sourceName}
+
+	seen := map[string]bool{}
+	events := append([]Event(nil), plan.Events...)
+	sort.Slice(events, func(i, j int) bool { return events[i].Name < events[j].Name })
+	for _, e := range events {
+		ev := genEvent{Ident: identifier(e.Name), Name: e.Name, Doc: oneLine(e.Description)}
+		if seen[ev.Ident] {
+			return nil, fmt.Errorf("events %q and another event both map to %s", e.Name, ev.Ident)
+		}
+		seen[ev.Ident] = true
+
+		names := make([]string, 0, len(e.Properties))
+		for name := range e.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fieldSeen := map[string]bool{}
+		for _, name := range names {
+			p := e.Properties[name]
+			f := genField{
+				Name:      identifier(name),
+				Property:  name,
+				Type:      goType(p),
+				Doc:       oneLine(p.Description),
+				OmitEmpty: !p.Required,
+			}
+			if fieldSeen[f.Name] {
+				return nil, fmt.Errorf("properties of %q collide on %s", e.Name, f.Name)
+			}
+			fieldSeen[f.Name] = true
+			if strings.Contains(f.Type, "time.Time") {
+				data.UsesTime = true
+			}
+			ev.Fields = append(ev.Fields, f)
+		}
+		data.Events = append(data.Events, ev)
+	}
+
+	var buf bytes.Buffer
+	if err := source.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func main() {
+	planFile := flag.String("plan", "", "tracking plan, a Lexicon JSON export or YAML")
+	output := flag.String("o", "", "output file, stdout when empty")
+	pkg := flag.String("package", os.Getenv("GOPACKAGE"), "package of the generated file")
+	flag.Parse()
+
+	if *planFile == "" {
+		log.Fatal("mixpanel-gen: -plan is required")
+	}
+	data, err := os.ReadFile(*planFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	plan, err := ParsePlan(data)
+	if err != nil {
+		log.Fatalf("mixpanel-gen: %s: %v", *planFile, err)
+	}
+	src, err := Generate(plan, *pkg, filepath.Base(*planFile))
+	if err != nil {
+		log.Fatalf("mixpanel-gen: %v", err)
+	}
+	if *output == "" {
+		os.Stdout.Write(src)
+		return
+	}
+	if err := os.WriteFile(*output, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const yamlPlan = `
+package: analytics
+events:
+  - name: Order Placed
+    description: A customer completed checkout.
+    properties:
+      Order ID: {type: string, required: true}
+      Total: {type: number, required: true}
+      Coupon: {type: string}
+      Placed At: {type: string, format: date-time}
+`
+
+const lexiconPlan = `{"results": [{"entityType": "event", "name": "Order Placed", "schemaJson": {
+	"description": "A customer completed checkout.",
+	"properties": {"Order ID": {"type": "string"}, "Total": {"type": "number"},
+		"Coupon": {"type": "string"}, "Placed At": {"type": "string", "format": "date-time"}},
+	"required": ["Order ID", "Total"]}}]}`
+
+func TestGenerate(t *testing.T) {
+	for name, input := range map[string]string{"yaml": yamlPlan, "lexicon": lexiconPlan} {
+		plan, err := ParsePlan([]byte(input))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		src, err := Generate(plan, "analytics", "plan")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		out := string(src)
+		for _, expected := range []string{
+			"package analytics",
+			`OrderID  string    ` + "`" + `mixpanel:"Order ID"` + "`",
+			`Coupon   string    ` + "`" + `mixpanel:"Coupon,omitempty"` + "`",
+			`PlacedAt time.Time ` + "`" + `mixpanel:"Placed At,omitempty"` + "`",
+			"func TrackOrderPlaced(mp *mixpanel.Mixpanel, distinctID string, p OrderPlacedProps) error {",
+		} {
+			if !strings.Contains(out, expected) {
+				t.Errorf("%s: expected %q in\n%s", name, expected, out)
+			}
+		}
+	}
+}
+
+func TestIdentifier(t *testing.T) {
+	for name, expected := range map[string]string{
+		"Order Placed": "OrderPlaced",
+		"$email":       "Email",
+		"utm_source":   "UtmSource",
+		"3d secure":    "X3dSecure",
+	} {
+		if got := identifier(name); got != expected {
+			t.Errorf("identifier(%q) = %q, expected %q", name, got, expected)
+		}
+	}
+}
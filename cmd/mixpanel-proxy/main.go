@@ -0,0 +1,347 @@
+/*
+Command mixpanel-proxy is a first-party collection endpoint for the
+browser and mobile SDKs of Mixpanel: it accepts their /track, /engage
+and /groups requests on the local network, batches them and forwards
+them to Mixpanel, so that ad blockers blocking the Mixpanel hosts do not
+lose the events.
+
+	mixpanel-proxy -listen :8080 -token $MIXPANEL_TOKEN -metrics :9090
+
+Point the SDKs at it, with mixpanel.init(token, {api_host:
+"https://collect.example.com"}) in the browser for example. The data of
+the requests is read from the data parameter of the query string or of
+a form, base64 or plain JSON, or from a JSON body; it is a message or an
+array of messages. With ip=1 in the query string, which the SDKs set by
+default, the address of the client is added to the messages, since
+Mixpanel would otherwise locate every user at the proxy. The address is
+taken from X-Forwarded-For with -trust-forwarded, when the proxy runs
+behind a load balancer.
+
+Messages are sent in batches of -batch messages, at least every
+-flush; batches failing with a network error, a 429 or a 5xx status are
+retained and retried, up to -max-retained messages per endpoint.
+Messages of other projects than those of -token, comma separated, are
+rejected; any project is accepted without -token.
+
+The counters of the proxy, the messages received, invalid and rejected,
+are published with expvar as "mixpanel_proxy", along with the Stats of
+the consumer as "mixpanel", served on /debug/vars of the -metrics
+address. On SIGINT or SIGTERM the proxy stops accepting requests, and
+delivers the pending batches within -drain.
+*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+)
+
+// maxBody bounds the size of the requests.
+const maxBody = 1 << 20
+
+// errUnknownToken rejects the messages of the projects not proxied.
+var errUnknownToken = errors.New("unknown project token")
+
+// endpoints maps the paths of the proxy to the endpoints of Mixpanel.
+var endpoints = map[string]string{
+	"/track":  "events",
+	"/engage": "people",
+	"/groups": "groups",
+}
+
+// counters are the metrics of the proxy.
+type counters struct {
+	received expvar.Int
+	invalid  expvar.Int
+	rejected expvar.Int
+}
+
+// proxy serves the collection endpoints, sending the messages to c.
+type proxy struct {
+	c              mixpanel.Consumer
+	tokens         map[string]bool
+	allowOrigin    string
+	trustForwarded bool
+	counters       *counters
+}
+
+func (p *proxy) handler() http.Handler {
+	mux := http.NewServeMux()
+	for path := range endpoints {
+		mux.Handle(path, p)
+		mux.Handle(path+"/", p)
+	}
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	return mux
+}
+
+func (p *proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	origin := p.allowOrigin
+	if origin == "" {
+		origin = r.Header.Get("Origin")
+	}
+	if origin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Vary", "Origin")
+		if origin != "*" {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+	}
+	switch r.Method {
+	case http.MethodOptions:
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Requested-With")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case http.MethodGet, http.MethodPost:
+	default:
+		w.Header().Set("Allow", "GET, POST, OPTIONS")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	verbose := r.URL.Query().Get("verbose") == "1"
+	msgs, err := p.messages(w, r)
+	if errors.Is(err, errUnknownToken) {
+		p.counters.rejected.Add(1)
+		writeResult(w, verbose, http.StatusForbidden, err)
+		return
+	} else if err != nil {
+		p.counters.invalid.Add(1)
+		writeResult(w, verbose, http.StatusBadRequest, err)
+		return
+	}
+	p.counters.received.Add(int64(len(msgs)))
+	// the flush a Send may trigger delivers the messages of other
+	// clients, which this one disconnecting must not cancel
+	if err := p.c.Send(context.WithoutCancel(r.Context()), endpoints[strings.TrimSuffix(r.URL.Path, "/")], msgs); err != nil {
+		log.Printf("mixpanel-proxy: %v", err)
+		writeResult(w, verbose, http.StatusServiceUnavailable, errors.New("unavailable"))
+		return
+	}
+	writeResult(w, verbose, http.StatusOK, nil)
+}
+
+// messages returns the messages of r, with the address of the client
+// when asked to.
+func (p *proxy) messages(w http.ResponseWriter, r *http.Request) ([][]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBody)
+	var data []byte
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		data = body
+	} else {
+		if err := r.ParseForm(); err != nil {
+			return nil, err
+		}
+		data = decodeData(r.Form.Get("data"))
+	}
+
+	var raw []json.RawMessage
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("[")) {
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("invalid data: %v", err)
+		}
+	} else {
+		raw = []json.RawMessage{data}
+	}
+	if len(raw) == 0 {
+		return nil, errors.New("no data")
+	}
+
+	ip := ""
+	if r.URL.Query().Get("ip") == "1" {
+		ip = p.clientIP(r)
+	}
+	msgs := make([][]byte, 0, len(raw))
+	for _, msg := range raw {
+		msg, err := p.message(r.URL.Path, msg, ip)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// message checks the token of msg and adds ip to it, if not empty.
+func (p *proxy) message(path string, msg []byte, ip string) ([]byte, error) {
+	var m map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(msg))
+	dec.UseNumber()
+	if err := dec.Decode(&m); err != nil || m == nil {
+		return nil, errors.New("invalid data: not a JSON object")
+	}
+	props := m
+	tokenKey, ipKey := "$token", "$ip"
+	if strings.HasPrefix(path, "/track") {
+		props, _ = m["properties"].(map[string]interface{})
+		if props == nil {
+			return nil, errors.New("invalid data: event without properties")
+		}
+		tokenKey, ipKey = "token", "ip"
+	}
+	if len(p.tokens) > 0 {
+		if token, _ := props[tokenKey].(string); !p.tokens[token] {
+			return nil, errUnknownToken
+		}
+	}
+	if ip == "" {
+		return msg, nil
+	}
+	if _, ok := props[ipKey]; !ok {
+		props[ipKey] = ip
+	}
+	return json.Marshal(m)
+}
+
+// clientIP returns the address of the client of r.
+func (p *proxy) clientIP(r *http.Request) string {
+	if p.trustForwarded {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// decodeData decodes the data parameter of the SDKs, base64 or plain
+// JSON.
+func decodeData(data string) []byte {
+	data = strings.TrimSpace(data)
+	if strings.HasPrefix(data, "{") || strings.HasPrefix(data, "[") {
+		return []byte(data)
+	}
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if decoded, err := enc.DecodeString(data); err == nil {
+			return decoded
+		}
+	}
+	return []byte(data)
+}
+
+// writeResult answers the SDKs as Mixpanel does: 1 or 0, or a JSON
+// status with verbose=1.
+func writeResult(w http.ResponseWriter, verbose bool, code int, err error) {
+	if verbose {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		if err != nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{"status": 0, "error": err.Error()})
+		} else {
+			w.Write([]byte(`{"status": 1, "error": null}` + "\n"))
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(code)
+	if err != nil {
+		w.Write([]byte("0"))
+	} else {
+		w.Write([]byte("1"))
+	}
+}
+
+func main() {
+	listen := flag.String("listen", ":8080", "address of the collection endpoints")
+	tokens := flag.String("token", os.Getenv("MIXPANEL_TOKEN"), "comma separated project tokens accepted, any when empty (default $MIXPANEL_TOKEN)")
+	apiHost := flag.String("api-host", os.Getenv("MIXPANEL_API_HOST"), "ingestion host (default $MIXPANEL_API_HOST)")
+	allowOrigin := flag.String("allow-origin", "", "Access-Control-Allow-Origin of the responses, the origin of the request when empty")
+	trustForwarded := flag.Bool("trust-forwarded", false, "take the address of the clients from X-Forwarded-For")
+	batch := flag.Int("batch", mixpanel.DefaultBatchSize, "messages per request to Mixpanel")
+	flush := flag.Duration("flush", time.Second, "longest wait of an incomplete batch")
+	maxRetained := flag.Int("max-retained", mixpanel.DefaultMaxRetained, "messages per endpoint kept for retry when Mixpanel is unreachable")
+	drain := flag.Duration("drain", mixpanel.DefaultDrainTimeout, "bound of the delivery of the pending batches on shutdown")
+	metrics := flag.String("metrics", "", "address serving the metrics on /debug/vars, e.g. :9090")
+	flag.Parse()
+	if *batch <= 0 || *flush <= 0 {
+		log.Fatal("mixpanel-proxy: -batch and -flush must be positive")
+	}
+
+	bc := mixpanel.NewBuffConsumerWithConfig(mixpanel.BuffConfig{
+		BatchSize:   *batch,
+		MaxLatency:  *flush,
+		MaxRetained: *maxRetained,
+	})
+	if *apiHost != "" {
+		bc.SetAPIHost(*apiHost)
+	}
+	bc.FlushEvery(*flush)
+
+	p := &proxy{c: bc, allowOrigin: *allowOrigin, trustForwarded: *trustForwarded, counters: &counters{}}
+	for _, token := range strings.Split(*tokens, ",") {
+		if token = strings.TrimSpace(token); token != "" {
+			if p.tokens == nil {
+				p.tokens = map[string]bool{}
+			}
+			p.tokens[token] = true
+		}
+	}
+
+	stats := new(expvar.Map).Init()
+	stats.Set("received", &p.counters.received)
+	stats.Set("invalid", &p.counters.invalid)
+	stats.Set("rejected", &p.counters.rejected)
+	expvar.Publish("mixpanel_proxy", stats)
+	expvar.Publish("mixpanel", expvar.Func(func() interface{} {
+		return bc.Stats()
+	}))
+	if *metrics != "" {
+		go func() {
+			log.Fatal(http.ListenAndServe(*metrics, nil))
+		}()
+	}
+
+	srv := &http.Server{
+		Addr:              *listen,
+		Handler:           p.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), *drain)
+		defer cancel()
+		// the requests being served first, then the buffers
+		srv.Shutdown(shutdown)
+		if err := bc.Close(shutdown); err != nil {
+			log.Printf("mixpanel-proxy: %v", err)
+		}
+	}()
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("mixpanel-proxy: %v", err)
+	}
+	<-drained
+}
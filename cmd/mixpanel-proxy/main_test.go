@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+)
+
+func newTestProxy(tokens ...string) (*httptest.Server, *proxy, *bytes.Buffer) {
+	var buf bytes.Buffer
+	p := &proxy{c: mixpanel.NewWriterConsumer(&buf), counters: &counters{}}
+	for _, token := range tokens {
+		if p.tokens == nil {
+			p.tokens = map[string]bool{}
+		}
+		p.tokens[token] = true
+	}
+	return httptest.NewServer(p.handler()), p, &buf
+}
+
+// envelopes returns the messages written by the WriterConsumer to buf.
+func envelopes(t *testing.T, buf *bytes.Buffer) []mixpanel.Envelope {
+	var out []mixpanel.Envelope
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var e mixpanel.Envelope
+		if err := dec.Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+func TestProxyTrack(t *testing.T) {
+	ts, p, buf := newTestProxy("abc")
+	defer ts.Close()
+
+	data := base64.StdEncoding.EncodeToString([]byte(`[{"event":"A","properties":{"token":"abc","n":1}},{"event":"B","properties":{"token":"abc","ip":"10.0.0.1"}}]`))
+	resp, err := http.PostForm(ts.URL+"/track/?ip=1", url.Values{"data": {data}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the events to be accepted, got %s", resp.Status)
+	}
+
+	sent := envelopes(t, buf)
+	if len(sent) != 2 || sent[0].Endpoint != "events" {
+		t.Fatalf("Expected 2 events, got %+v", sent)
+	}
+	if got := string(sent[0].Data); got != `{"event":"A","properties":{"ip":"127.0.0.1","n":1,"token":"abc"}}` {
+		t.Errorf("Expected the address of the client, got %s", got)
+	}
+	if got := string(sent[1].Data); !strings.Contains(got, `"ip":"10.0.0.1"`) {
+		t.Errorf("Expected the ip of the event to be kept, got %s", got)
+	}
+	if p.counters.received.Value() != 2 {
+		t.Errorf("Expected 2 received messages, got %v", &p.counters.received)
+	}
+}
+
+// contextConsumer records the error of the context of the last Send.
+type contextConsumer struct {
+	mixpanel.Consumer
+	err error
+}
+
+func (c *contextConsumer) Send(ctx context.Context, endpoint string, msgs [][]byte) error {
+	c.err = ctx.Err()
+	return c.Consumer.Send(ctx, endpoint, msgs)
+}
+
+func TestProxyClientDisconnects(t *testing.T) {
+	var buf bytes.Buffer
+	c := &contextConsumer{Consumer: mixpanel.NewWriterConsumer(&buf)}
+	p := &proxy{c: c, counters: &counters{}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	data := base64.StdEncoding.EncodeToString([]byte(`{"event":"A","properties":{"token":"abc"}}`))
+	r := httptest.NewRequest("GET", "/track/?data="+url.QueryEscape(data), nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	p.handler().ServeHTTP(w, r)
+	if w.Code != http.StatusOK || c.err != nil {
+		t.Errorf("Expected the delivery not to be cancelled with the request, got %d and %v", w.Code, c.err)
+	}
+}
+
+func TestProxyEngage(t *testing.T) {
+	ts, _, buf := newTestProxy()
+	defer ts.Close()
+
+	body := `{"$token":"abc","$distinct_id":"1","$set":{"Plan":"Pro"}}`
+	resp, err := http.Post(ts.URL+"/engage?verbose=1", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result struct {
+		Status int         `json:"status"`
+		Error  interface{} `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if result.Status != 1 || result.Error != nil {
+		t.Errorf("Expected a verbose success, got %+v", result)
+	}
+	if sent := envelopes(t, buf); len(sent) != 1 || sent[0].Endpoint != "people" || string(sent[0].Data) != body {
+		t.Errorf("Expected the update as is, got %+v", sent)
+	}
+}
+
+func TestProxyRejects(t *testing.T) {
+	ts, p, buf := newTestProxy("abc")
+	defer ts.Close()
+
+	for query, expected := range map[string]int{
+		`{"event":"A","properties":{"token":"other"}}`: http.StatusForbidden,
+		`{"event":"A"}`: http.StatusBadRequest,
+		`not json`:      http.StatusBadRequest,
+	} {
+		resp, err := http.Get(ts.URL + "/track?data=" + url.QueryEscape(query))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != expected {
+			t.Errorf("%s: expected %d, got %s", query, expected, resp.Status)
+		}
+	}
+	if sent := envelopes(t, buf); len(sent) != 0 {
+		t.Errorf("Expected nothing sent, got %+v", sent)
+	}
+	if p.counters.rejected.Value() != 1 || p.counters.invalid.Value() != 2 {
+		t.Errorf("Unexpected counters rejected=%v invalid=%v", &p.counters.rejected, &p.counters.invalid)
+	}
+}
+
+func TestProxyPreflight(t *testing.T) {
+	ts, _, _ := newTestProxy()
+	defer ts.Close()
+
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodOptions, ts.URL+"/track", nil)
+	req.Header.Set("Origin", "https://www.example.com")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent || resp.Header.Get("Access-Control-Allow-Origin") != "https://www.example.com" {
+		t.Errorf("Expected a CORS preflight response, got %s %v", resp.Status, resp.Header)
+	}
+}
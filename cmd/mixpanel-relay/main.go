@@ -0,0 +1,302 @@
+/*
+Command mixpanel-relay forwards the messages queued by applications to
+Mixpanel, so that application pods never talk to Mixpanel directly.
+
+It reads the two queue formats of the library:
+
+  - the spool directories of SpoolConsumer, -spool, typically a volume
+    shared with the applications; spool files are resent every
+    -interval through the import endpoint, and removed once delivered
+  - newline delimited JSON envelopes, {"endpoint": ..., "data": ...}, as
+    written by WriterConsumer, from the files given as arguments or from
+    stdin with "-"; messages queued in Kafka or SQS are relayed by piping
+    them in with the tools of the queue
+
+For example:
+
+	export MIXPANEL_API_SECRET=...
+	mixpanel-relay -spool /var/spool/mixpanel -metrics :9090
+	kcat -C -b kafka:9092 -t mixpanel -u | mixpanel-relay -spool /var/spool/mixpanel -
+
+Envelopes are sent in batches of -batch messages, at least every
+-flush. Batches failing with a network error, a 429 or a 5xx status are
+retried -retries times, waiting -retry-delay and then twice as long
+every time; those still failing with a network error are written to the
+-spool directory, when given, to be resent with the spool files.
+
+The counters of the relay, the envelopes read and invalid, the messages
+sent and failed to send, and the retries, are published with expvar as
+"mixpanel_relay", served on /debug/vars of the -metrics address.
+
+On SIGINT or SIGTERM the relay stops reading, and delivers the pending
+batches within -drain.
+*/
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+)
+
+// config is the configuration of the relay, from the command line.
+type config struct {
+	apiSecret  string
+	apiHost    string
+	spool      string
+	interval   time.Duration
+	batchSize  int
+	flush      time.Duration
+	retries    int
+	retryDelay time.Duration
+	drain      time.Duration
+	metrics    string
+}
+
+// counters are the metrics of the relay.
+type counters struct {
+	read    expvar.Int
+	invalid expvar.Int
+	sent    expvar.Int
+	failed  expvar.Int
+	retried expvar.Int
+}
+
+/*
+retrier sends the batches of the relay, retrying the transient failures,
+see mixpanel.IsTransient, with an exponential backoff.
+*/
+type retrier struct {
+	next     mixpanel.Consumer
+	retries  int
+	delay    time.Duration
+	counters *counters
+}
+
+func (r *retrier) Send(ctx context.Context, endpoint string, msgs [][]byte) error {
+	delay := r.delay
+	for attempt := 0; ; attempt++ {
+		err := r.next.Send(ctx, endpoint, msgs)
+		if err == nil {
+			r.counters.sent.Add(int64(len(msgs)))
+			return nil
+		}
+		if attempt == r.retries || !mixpanel.IsTransient(err) {
+			r.counters.failed.Add(int64(len(msgs)))
+			return err
+		}
+		r.counters.retried.Add(1)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			r.counters.failed.Add(int64(len(msgs)))
+			// the error of the send, for a network error to be spooled
+			return fmt.Errorf("%w (%w)", err, ctx.Err())
+		}
+		delay *= 2
+	}
+}
+
+func (r *retrier) Flush(ctx context.Context) error {
+	return r.next.Flush(ctx)
+}
+
+func (r *retrier) Close(ctx context.Context) error {
+	return r.next.Close(ctx)
+}
+
+// relay batches the envelopes read from its inputs.
+type relay struct {
+	c         mixpanel.Consumer
+	batchSize int
+	batches   map[string][][]byte
+	counters  *counters
+}
+
+// add queues the envelope of line, sending the batch of its endpoint
+// once full.
+func (r *relay) add(ctx context.Context, line []byte) {
+	var envelope mixpanel.Envelope
+	if err := json.Unmarshal(line, &envelope); err != nil || envelope.Endpoint == "" || len(envelope.Data) == 0 {
+		r.counters.invalid.Add(1)
+		log.Printf("mixpanel-relay: invalid envelope %.200q", line)
+		return
+	}
+	r.counters.read.Add(1)
+	batch := append(r.batches[envelope.Endpoint], []byte(envelope.Data))
+	r.batches[envelope.Endpoint] = batch
+	if len(batch) >= r.batchSize {
+		r.send(ctx, envelope.Endpoint)
+	}
+}
+
+// send sends the batch of endpoint.
+func (r *relay) send(ctx context.Context, endpoint string) {
+	batch := r.batches[endpoint]
+	if len(batch) == 0 {
+		return
+	}
+	delete(r.batches, endpoint)
+	if err := r.c.Send(ctx, endpoint, batch); err != nil {
+		log.Printf("mixpanel-relay: lost %d messages to %s: %v", len(batch), endpoint, err)
+	}
+}
+
+// flush sends the batches of all endpoints.
+func (r *relay) flush(ctx context.Context) {
+	for endpoint := range r.batches {
+		r.send(ctx, endpoint)
+	}
+}
+
+// readLines sends the lines of the inputs to lines, then closes it.
+func readLines(inputs []io.Reader, lines chan<- []byte) error {
+	defer close(lines)
+	for _, in := range inputs {
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 64*1024), 16<<20)
+		for scanner.Scan() {
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+			lines <- append([]byte(nil), scanner.Bytes()...)
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+run relays the envelopes of inputs, and the spool files of cfg.spool,
+until ctx is done, or until the inputs end when there is no spool
+directory to watch.
+*/
+func run(ctx context.Context, cfg config, inputs []io.Reader, counters *counters) error {
+	std := mixpanel.NewStdConsumer()
+	std.SetAPISecret(cfg.apiSecret)
+	if cfg.apiHost != "" {
+		std.SetAPIHost(cfg.apiHost)
+	}
+	var c mixpanel.Consumer = &retrier{next: std, retries: cfg.retries, delay: cfg.retryDelay, counters: counters}
+	var sc *mixpanel.SpoolConsumer
+	if cfg.spool != "" {
+		var err error
+		if sc, err = mixpanel.NewSpoolConsumer(c, cfg.spool, cfg.interval); err != nil {
+			return err
+		}
+		c = sc
+		// the files spooled before the relay started
+		go sc.Resend(ctx)
+	}
+
+	r := &relay{c: c, batchSize: cfg.batchSize, batches: map[string][][]byte{}, counters: counters}
+	lines := make(chan []byte)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- readLines(inputs, lines)
+	}()
+	ticker := time.NewTicker(cfg.flush)
+	defer ticker.Stop()
+
+	var err error
+loop:
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				err = <-errs
+				if sc == nil || err != nil {
+					break loop
+				}
+				// keep resending the spool files
+				lines = nil
+				continue
+			}
+			r.add(ctx, line)
+		case <-ticker.C:
+			r.flush(ctx)
+		case <-ctx.Done():
+			break loop
+		}
+	}
+
+	drain, cancel := context.WithTimeout(context.Background(), cfg.drain)
+	defer cancel()
+	r.flush(drain)
+	return errors.Join(err, c.Close(drain))
+}
+
+func main() {
+	var cfg config
+	flag.StringVar(&cfg.apiSecret, "api-secret", os.Getenv("MIXPANEL_API_SECRET"), "project API secret, needed to resend spooled events (default $MIXPANEL_API_SECRET)")
+	flag.StringVar(&cfg.apiHost, "api-host", os.Getenv("MIXPANEL_API_HOST"), "ingestion host (default $MIXPANEL_API_HOST)")
+	flag.StringVar(&cfg.spool, "spool", "", "spool directory of SpoolConsumer to resend, and to spool failed batches to")
+	flag.DurationVar(&cfg.interval, "interval", mixpanel.DefaultResendInterval, "how often to resend the spool files")
+	flag.IntVar(&cfg.batchSize, "batch", mixpanel.DefaultBatchSize, "messages per request")
+	flag.DurationVar(&cfg.flush, "flush", time.Second, "longest wait of an incomplete batch")
+	flag.IntVar(&cfg.retries, "retries", 5, "retries of the batches failing transiently")
+	flag.DurationVar(&cfg.retryDelay, "retry-delay", time.Second, "delay before the first retry, doubled every time")
+	flag.DurationVar(&cfg.drain, "drain", mixpanel.DefaultDrainTimeout, "bound of the delivery of the pending batches on shutdown")
+	flag.StringVar(&cfg.metrics, "metrics", "", "address serving the metrics on /debug/vars, e.g. :9090")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: mixpanel-relay [flags] [file ... | -]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if cfg.spool == "" && flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if cfg.batchSize <= 0 || cfg.flush <= 0 {
+		log.Fatal("mixpanel-relay: -batch and -flush must be positive")
+	}
+
+	var inputs []io.Reader
+	for _, name := range flag.Args() {
+		if name == "-" {
+			inputs = append(inputs, os.Stdin)
+			continue
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		inputs = append(inputs, f)
+	}
+
+	counters := &counters{}
+	stats := new(expvar.Map).Init()
+	stats.Set("read", &counters.read)
+	stats.Set("invalid", &counters.invalid)
+	stats.Set("sent", &counters.sent)
+	stats.Set("failed", &counters.failed)
+	stats.Set("retried", &counters.retried)
+	expvar.Publish("mixpanel_relay", stats)
+	if cfg.metrics != "" {
+		go func() {
+			log.Fatal(http.ListenAndServe(cfg.metrics, nil))
+		}()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := run(ctx, cfg, inputs, counters); err != nil {
+		log.Fatalf("mixpanel-relay: %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+)
+
+// server answers with the statuses of fail first, then records the
+// payloads of the requests by path.
+type server struct {
+	*httptest.Server
+	mu       sync.Mutex
+	fail     []int
+	payloads map[string][]string
+}
+
+func newServer(fail ...int) *server {
+	s := &server{fail: fail, payloads: map[string][]string{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if len(s.fail) > 0 {
+			status := s.fail[0]
+			s.fail = s.fail[1:]
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		if r.URL.Path == "/import" {
+			body, _ := io.ReadAll(r.Body)
+			s.payloads[r.URL.Path] = append(s.payloads[r.URL.Path], string(body))
+			w.Write([]byte(`{"code": 200, "status": "OK", "num_records_imported": 1}`))
+			return
+		}
+		r.ParseForm()
+		data, _ := base64.URLEncoding.DecodeString(r.Form.Get("data"))
+		s.payloads[r.URL.Path] = append(s.payloads[r.URL.Path], string(data))
+		w.Write([]byte(`{"status": 1, "error": null}`))
+	}))
+	return s
+}
+
+func (s *server) received(path string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.payloads[path]...)
+}
+
+func testConfig(s *server) config {
+	return config{
+		apiSecret:  "secret",
+		apiHost:    s.URL,
+		interval:   time.Hour,
+		batchSize:  2,
+		flush:      time.Hour,
+		retries:    2,
+		retryDelay: time.Millisecond,
+		drain:      time.Second,
+	}
+}
+
+func TestRelayEnvelopes(t *testing.T) {
+	s := newServer(http.StatusServiceUnavailable)
+	defer s.Close()
+
+	input := strings.Join([]string{
+		`{"endpoint":"events","data":{"event":"A"}}`,
+		`{"endpoint":"events","data":{"event":"B"}}`,
+		`not an envelope`,
+		`{"endpoint":"people","data":{"$distinct_id":"1"}}`,
+	}, "\n")
+	counters := &counters{}
+	if err := run(context.Background(), testConfig(s), []io.Reader{strings.NewReader(input)}, counters); err != nil {
+		t.Fatal(err)
+	}
+
+	if events := s.received("/track"); len(events) != 1 || events[0] != `[{"event":"A"},{"event":"B"}]` {
+		t.Errorf("Expected the events in a batch retried once, got %q", events)
+	}
+	if people := s.received("/engage"); len(people) != 1 {
+		t.Errorf("Expected the incomplete batch to be sent at the end, got %q", people)
+	}
+	if counters.read.Value() != 3 || counters.invalid.Value() != 1 || counters.sent.Value() != 3 ||
+		counters.failed.Value() != 0 || counters.retried.Value() != 1 {
+		t.Errorf("Unexpected counters read=%v invalid=%v sent=%v failed=%v retried=%v",
+			&counters.read, &counters.invalid, &counters.sent, &counters.failed, &counters.retried)
+	}
+}
+
+func TestRelaySpool(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+
+	dir := t.TempDir()
+	spooled := `{"endpoint":"events","data":{"event":"A","properties":{"time":1700000000}}}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "1.spool"), []byte(spooled), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := testConfig(s)
+	cfg.spool = dir
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- run(ctx, cfg, nil, &counters{})
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(s.received("/import")) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if imported := s.received("/import"); len(imported) != 1 || !strings.Contains(imported[0], `"event":"A"`) {
+		t.Errorf("Expected the spooled event to be imported, got %q", imported)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.spool")); len(files) != 0 {
+		t.Errorf("Expected the delivered spool file to be removed, got %q", files)
+	}
+}
+
+// unreachable fails the sends with a network error, cancelling the relay
+// on the first one.
+type unreachable struct {
+	cancel context.CancelFunc
+}
+
+func (u *unreachable) Send(ctx context.Context, endpoint string, msgs [][]byte) error {
+	u.cancel()
+	return &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+}
+
+func (u *unreachable) Flush(ctx context.Context) error { return nil }
+func (u *unreachable) Close(ctx context.Context) error { return nil }
+
+func TestRetrierSpoolsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &retrier{next: &unreachable{cancel}, retries: 3, delay: time.Hour, counters: &counters{}}
+	dir := t.TempDir()
+	sc, err := mixpanel.NewSpoolConsumer(r, dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close(context.Background())
+
+	if err := sc.Send(ctx, "events", [][]byte{[]byte(`{"event":"A"}`)}); err != nil {
+		t.Fatalf("Expected the batch to be spooled, got %v", err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.spool")); len(files) != 1 {
+		t.Errorf("Expected a spool file, got %q", files)
+	}
+	if err := r.Send(ctx, "events", [][]byte{[]byte(`{"event":"B"}`)}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the cancellation in the error, got %v", err)
+	}
+}
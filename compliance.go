@@ -0,0 +1,246 @@
+package mixpanel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const compliance_endpoint string = "https://mixpanel.com/api/app"
+
+// EUComplianceEndpoint is the compliance API endpoint of the EU
+// residency servers.
+const EUComplianceEndpoint = "https://eu.mixpanel.com/api/app"
+
+// MaxComplianceIDs is the maximum number of distinct_ids of a single
+// deletion or retrieval request.
+const MaxComplianceIDs = 2000
+
+// Regulations under which a compliance request is made.
+const (
+	GDPR = "GDPR"
+	CCPA = "CCPA"
+)
+
+// Statuses of a compliance task.
+const (
+	TaskPending = "PENDING"
+	TaskStaging = "STAGING"
+	TaskStarted = "STARTED"
+	TaskSuccess = "SUCCESS"
+	TaskFailure = "FAILURE"
+)
+
+/*
+ComplianceClient requests the deletion or the retrieval of the data of
+users through the GDPR compliance API. It is authenticated with the
+project token and an OAuth token for GDPR APIs, generated in the
+project settings:
+
+	c := NewComplianceClient(token, gdprToken)
+	task, err := c.RequestRetrieval(ctx, []string{"12345"}, GDPR)
+	if err != nil {
+	    ...
+	}
+	task, err = c.Wait(ctx, task, 30*time.Second)
+	if err == nil && task.Status == TaskSuccess {
+	    err = c.Download(ctx, task, w)
+	}
+*/
+type ComplianceClient struct {
+	// Endpoint is the base URL of the compliance API.
+	Endpoint string
+	// HTTPClient is used for all requests, http.DefaultClient when nil.
+	HTTPClient *http.Client
+
+	token          string
+	oauthToken     string
+	serviceAccount *ServiceAccount
+}
+
+// NewComplianceClient creates a ComplianceClient for the project of
+// token, authenticated with a GDPR OAuth token.
+func NewComplianceClient(token, oauthToken string) *ComplianceClient {
+	return &ComplianceClient{
+		Endpoint:   compliance_endpoint,
+		token:      token,
+		oauthToken: oauthToken,
+	}
+}
+
+// ComplianceTask is a deletion or retrieval processed asynchronously
+// by Mixpanel.
+type ComplianceTask struct {
+	ID     string
+	Status string
+	// Result is the URL of the archive of a successful retrieval.
+	Result string
+
+	// kind is the path of the API, data-deletions or data-retrievals.
+	kind string
+}
+
+// Done reports whether the task succeeded or failed.
+func (t *ComplianceTask) Done() bool {
+	return t.Status == TaskSuccess || t.Status == TaskFailure
+}
+
+// RequestDeletion asks for all the data of distinctIDs to be deleted,
+// under regulation GDPR or CCPA.
+func (c *ComplianceClient) RequestDeletion(ctx context.Context, distinctIDs []string, regulation string) (*ComplianceTask, error) {
+	return c.create(ctx, "data-deletions", distinctIDs, regulation)
+}
+
+// RequestRetrieval asks for an archive of all the data of distinctIDs,
+// under regulation GDPR or CCPA.
+func (c *ComplianceClient) RequestRetrieval(ctx context.Context, distinctIDs []string, regulation string) (*ComplianceTask, error) {
+	return c.create(ctx, "data-retrievals", distinctIDs, regulation)
+}
+
+// DeletionTask returns the deletion task of the given id, to follow a
+// task requested earlier.
+func (c *ComplianceClient) DeletionTask(id string) *ComplianceTask {
+	return &ComplianceTask{ID: id, Status: TaskPending, kind: "data-deletions"}
+}
+
+// RetrievalTask returns the retrieval task of the given id.
+func (c *ComplianceClient) RetrievalTask(id string) *ComplianceTask {
+	return &ComplianceTask{ID: id, Status: TaskPending, kind: "data-retrievals"}
+}
+
+func (c *ComplianceClient) create(ctx context.Context, kind string, distinctIDs []string, regulation string) (*ComplianceTask, error) {
+	if len(distinctIDs) == 0 || len(distinctIDs) > MaxComplianceIDs {
+		return nil, fmt.Errorf("mixpanel: a compliance request needs 1 to %d distinct_ids, got %d", MaxComplianceIDs, len(distinctIDs))
+	}
+	ids, _ := json.Marshal(distinctIDs)
+	form := url.Values{}
+	form.Set("distinct_ids", string(ids))
+	form.Set("compliance_type", regulation)
+	var results struct {
+		TaskID string `json:"task_id"`
+	}
+	if err := c.do(ctx, "POST", kind+"/v3.0/", form, &results); err != nil {
+		return nil, err
+	}
+	return &ComplianceTask{ID: results.TaskID, Status: TaskPending, kind: kind}, nil
+}
+
+// Status refreshes the status of task.
+func (c *ComplianceClient) Status(ctx context.Context, task *ComplianceTask) error {
+	var results struct {
+		Status string `json:"status"`
+		Result string `json:"result"`
+	}
+	if err := c.do(ctx, "GET", task.kind+"/v3.0/"+url.PathEscape(task.ID), nil, &results); err != nil {
+		return err
+	}
+	task.Status, task.Result = results.Status, results.Result
+	return nil
+}
+
+// Wait polls the status of task every interval until it is done or ctx
+// is canceled.
+func (c *ComplianceClient) Wait(ctx context.Context, task *ComplianceTask, interval time.Duration) (*ComplianceTask, error) {
+	for {
+		if err := c.Status(ctx, task); err != nil {
+			return task, err
+		}
+		if task.Done() {
+			return task, nil
+		}
+		select {
+		case <-ctx.Done():
+			return task, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Download copies the archive of a successful retrieval to w.
+func (c *ComplianceClient) Download(ctx context.Context, task *ComplianceTask, w io.Writer) error {
+	if task.Status != TaskSuccess || task.Result == "" {
+		return fmt.Errorf("mixpanel: retrieval %s has no result, its status is %s", task.ID, task.Status)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", task.Result, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("mixpanel: cannot download retrieval %s: HTTP %d", task.ID, resp.StatusCode)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+func (c *ComplianceClient) client() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return c.HTTPClient
+}
+
+// authorize sets the credentials of a request to the compliance API.
+func (c *ComplianceClient) authorize(req *http.Request) {
+	if c.serviceAccount != nil {
+		c.serviceAccount.authorize(req)
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+c.oauthToken)
+}
+
+// do sends a request to the compliance API and decodes the results of
+// its response into v.
+func (c *ComplianceClient) do(ctx context.Context, method, path string, form url.Values, v interface{}) error {
+	endpoint := strings.TrimRight(c.Endpoint, "/") + "/" + path + "?" + url.Values{"token": {c.token}}.Encode()
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	c.authorize(req)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if err != nil {
+		return err
+	}
+	var r struct {
+		Status  string          `json:"status"`
+		Error   string          `json:"error"`
+		Results json.RawMessage `json:"results"`
+	}
+	if err := json.Unmarshal(data, &r); err != nil && resp.StatusCode/100 == 2 {
+		return fmt.Errorf("Cannot interpret Mixpanel compliance response: %v", err)
+	}
+	if resp.StatusCode/100 != 2 || r.Status == "error" {
+		if r.Error == "" {
+			r.Error = strings.TrimSpace(string(data))
+		}
+		return &QueryError{StatusCode: resp.StatusCode, Message: r.Error}
+	}
+	if len(r.Results) == 0 {
+		return fmt.Errorf("Cannot interpret Mixpanel compliance response: no results")
+	}
+	return json.Unmarshal(r.Results, v)
+}
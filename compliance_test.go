@@ -0,0 +1,81 @@
+package mixpanel
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestComplianceRetrieval(t *testing.T) {
+	polls := 0
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/download" && (r.URL.Query().Get("token") != token || r.Header.Get("Authorization") != "Bearer oauth") {
+			t.Errorf("Unexpected authentication %s %v", r.URL, r.Header)
+		}
+		switch r.URL.Path {
+		case "/data-retrievals/v3.0/":
+			r.ParseForm()
+			if r.Method != "POST" || r.PostForm.Get("distinct_ids") != `["u1","u2"]` || r.PostForm.Get("compliance_type") != GDPR {
+				t.Errorf("Unexpected request %s %v", r.Method, r.PostForm)
+			}
+			w.Write([]byte(`{"status": "ok", "results": {"task_id": "42"}}`))
+		case "/data-retrievals/v3.0/42":
+			if polls++; polls < 2 {
+				w.Write([]byte(`{"status": "ok", "results": {"status": "STARTED"}}`))
+				return
+			}
+			w.Write([]byte(`{"status": "ok", "results": {"status": "SUCCESS", "result": "` + ts.URL + `/download"}}`))
+		case "/download":
+			w.Write([]byte("archive"))
+		default:
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewComplianceClient(token, "oauth")
+	c.Endpoint = ts.URL
+	ctx := context.Background()
+	task, err := c.RequestRetrieval(ctx, []string{"u1", "u2"}, GDPR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.ID != "42" || task.Done() {
+		t.Errorf("Unexpected task %+v", task)
+	}
+	if task, err = c.Wait(ctx, task, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if task.Status != TaskSuccess || polls != 2 {
+		t.Errorf("Expected the task to succeed after 2 polls got %+v, %d polls", task, polls)
+	}
+	var archive bytes.Buffer
+	if err := c.Download(ctx, task, &archive); err != nil {
+		t.Fatal(err)
+	}
+	if archive.String() != "archive" {
+		t.Errorf("Unexpected archive %q", archive.String())
+	}
+}
+
+func TestComplianceError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"status": "error", "error": "invalid token"}`))
+	}))
+	defer ts.Close()
+
+	c := NewComplianceClient(token, "oauth")
+	c.Endpoint = ts.URL
+	_, err := c.RequestDeletion(context.Background(), []string{"u1"}, CCPA)
+	if qe, ok := err.(*QueryError); !ok || qe.StatusCode != 401 || qe.Message != "invalid token" {
+		t.Errorf("Expected a QueryError got %v", err)
+	}
+	if _, err := c.RequestDeletion(context.Background(), nil, GDPR); err == nil {
+		t.Errorf("Expected a request without distinct_ids to be rejected")
+	}
+}
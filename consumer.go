@@ -0,0 +1,1128 @@
+package mixpanel
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+Consumer delivers serialized messages to Mixpanel.
+
+Send receives one or more JSON encoded messages for an endpoint
+("events", "people", "groups" or "import"); a consumer may deliver them
+right away or buffer them. Flush delivers anything buffered, and Close
+flushes and releases the consumer. All three honor cancellation of ctx.
+
+A consumer wrapping another one, as AsyncConsumer, SpoolConsumer and
+AuditingConsumer do, returns it from an Unwrap() Consumer method: the
+options look for the setters they call, such as SetAPISecret, along that
+chain of consumers.
+*/
+type Consumer interface {
+	Send(ctx context.Context, endpoint string, msgs [][]byte) error
+	Flush(ctx context.Context) error
+	Close(ctx context.Context) error
+}
+
+// findConsumer returns the first consumer implementing T, among c and
+// the consumers it wraps, see Consumer.
+func findConsumer[T any](c Consumer) (T, bool) {
+	for c != nil {
+		if t, ok := c.(T); ok {
+			return t, true
+		}
+		w, ok := c.(interface{ Unwrap() Consumer })
+		if !ok {
+			break
+		}
+		c = w.Unwrap()
+	}
+	var zero T
+	return zero, false
+}
+
+// LegacyConsumer is the single message interface implemented by
+// consumers written before Consumer supported batching and lifecycle.
+type LegacyConsumer interface {
+	Send(endpoint string, json_msg []byte) error
+}
+
+/*
+AdaptLegacyConsumer wraps a LegacyConsumer into a Consumer. Batches are
+sent one message at a time, and Flush and Close do nothing unless the
+wrapped consumer has a Flush() error method.
+*/
+func AdaptLegacyConsumer(c LegacyConsumer) Consumer {
+	return &legacyConsumer{c}
+}
+
+type legacyConsumer struct {
+	c LegacyConsumer
+}
+
+func (lc *legacyConsumer) Send(ctx context.Context, endpoint string, msgs [][]byte) error {
+	for _, msg := range msgs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := lc.c.Send(endpoint, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (lc *legacyConsumer) Flush(ctx context.Context) error {
+	if f, ok := lc.c.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+func (lc *legacyConsumer) Close(ctx context.Context) error {
+	return lc.Flush(ctx)
+}
+
+const events_endpoint string = "https://api.mixpanel.com/track"
+const people_endpoint string = "https://api.mixpanel.com/engage"
+const import_endpoint string = "https://api.mixpanel.com/import"
+const groups_endpoint string = "https://api.mixpanel.com/groups"
+
+// EUAPIHost is the ingestion host of projects with EU data residency.
+const EUAPIHost = "https://api-eu.mixpanel.com"
+
+// endpointPaths are the paths of the endpoints below an API host.
+var endpointPaths = map[string]string{
+	"events": "/track",
+	"people": "/engage",
+	"import": "/import",
+	"groups": "/groups",
+}
+
+// default_api_host is the ingestion host of projects without data residency.
+const default_api_host = "https://api.mixpanel.com"
+
+// DefaultUserAgent identifies the requests of the library, unless
+// replaced by SetUserAgent.
+const DefaultUserAgent = "mixpanel-go/" + Version
+
+// normalizeHost turns a host name into a base URL, https by default.
+func normalizeHost(host string) string {
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+	return strings.TrimSuffix(host, "/")
+}
+
+func b64(payload []byte) []byte {
+	var b bytes.Buffer
+	encoder := base64.NewEncoder(base64.URLEncoding, &b)
+	encoder.Write(payload)
+	encoder.Close()
+	return b.Bytes()[:b.Len()]
+}
+
+/*
+Response describes the outcome of a request sent by a StdConsumer, as
+given to the OnResponse hook.
+
+RequestID identifies the request, see RequestError. Status and Error
+are the fields of the verbose response body; import requests also
+report NumRecordsImported. Header holds the response headers. Err is the
+error returned to the caller, nil on success.
+*/
+type Response struct {
+	RequestID          string
+	Endpoint           string
+	Messages           int
+	StatusCode         int
+	Duration           time.Duration
+	Status             string
+	Error              string
+	NumRecordsImported int
+	Body               []byte
+	Header             http.Header
+	Err                error
+}
+
+func parseJsonResponse(body []byte, r *Response) error {
+	var response struct {
+		Status interface{} `json:"status"`
+		Error  string      `json:"error"`
+	}
+	if err := unmarshalNumbers(body, &response); err != nil {
+		if r.StatusCode != http.StatusOK {
+			return &statusError{r.StatusCode, string(body)}
+		}
+		return errors.New("Cannot interpret Mixpanel server response: " + string(body))
+	}
+	r.Error = response.Error
+	switch status := response.Status.(type) {
+	case json.Number:
+		r.Status = status.String()
+	case string:
+		r.Status = status
+	case nil:
+		return errors.New("Could not find field 'status' api change ?")
+	}
+	if r.Status != "1" {
+		return errors.New(fmt.Sprintf("Mixpanel error: %s", response.Error))
+	}
+	return nil
+}
+
+// statusError is an HTTP error status answered without a verdict of
+// Mixpanel on the messages, by a proxy or an overloaded server.
+type statusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("Cannot interpret Mixpanel server response (%d): %s", e.StatusCode, e.Body)
+}
+
+func parseImportResponse(body []byte, r *Response) error {
+	var response struct {
+		Code               int    `json:"code"`
+		Status             string `json:"status"`
+		Error              string `json:"error"`
+		NumRecordsImported int    `json:"num_records_imported"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		if r.StatusCode != http.StatusOK {
+			return &statusError{r.StatusCode, string(body)}
+		}
+		return errors.New("Cannot interpret Mixpanel server response: " + string(body))
+	}
+	r.Status = response.Status
+	r.Error = response.Error
+	r.NumRecordsImported = response.NumRecordsImported
+	if r.StatusCode != http.StatusOK || response.Status != "OK" {
+		return &importError{r.StatusCode, response.Error}
+	}
+	return nil
+}
+
+/*
+SendInfo describes a request around which BeforeSend and AfterSend hooks
+are called. RequestID identifies the request, see RequestError. Payload
+is the JSON body of the request, a single message or an array of them.
+Attempt counts the tries of the messages starting at 1: the flushes of a
+BuffConsumer resending the messages retained from failed ones, see
+BuffConfig.MaxRetained, are further attempts. Response is only set for
+AfterSend hooks.
+*/
+type SendInfo struct {
+	RequestID string
+	Endpoint  string
+	Payload   []byte
+	Messages  int
+	Attempt   int
+	Response  *Response
+	Err       error
+}
+
+type attemptKey struct{}
+
+// withAttempt returns a context sending the attempt-th try of messages.
+func withAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, attemptKey{}, attempt)
+}
+
+// attemptOf returns the try of the messages sent with ctx, from 1.
+func attemptOf(ctx context.Context) int {
+	if attempt, ok := ctx.Value(attemptKey{}).(int); ok {
+		return attempt
+	}
+	return 1
+}
+
+// maxResponseBody bounds how much of a response is kept; the rest is
+// discarded so the connection can be reused.
+const maxResponseBody = 1 << 20
+
+type StdConsumer struct {
+	client         Transport
+	endpoints      map[string]string
+	apiSecret      string
+	serviceAccount *ServiceAccount
+	header         http.Header
+	userAgent      string
+	onResponse     func(*Response)
+	beforeSend     []func(*SendInfo)
+	afterSend      []func(*SendInfo)
+	stats          *requestStats
+	encoding       *base64.Encoding
+	legacyKey      string
+	legacySecret   string
+	requestTimeout time.Duration
+	// requestIDHeader is the header carrying the request IDs, if any
+	requestIDHeader string
+	// closed fails the sends after Close
+	closed *atomic.Bool
+}
+
+// Creates a new StdConsumer.
+// Sends one request for every call to Send
+func NewStdConsumer() *StdConsumer {
+	c := new(StdConsumer)
+	c.client = defaultHTTPClient
+	c.requestTimeout = DefaultRequestTimeout
+	c.stats = &requestStats{}
+	c.closed = &atomic.Bool{}
+	c.endpoints = make(map[string]string)
+	c.endpoints["events"] = events_endpoint
+	c.endpoints["people"] = people_endpoint
+	c.endpoints["import"] = import_endpoint
+	c.endpoints["groups"] = groups_endpoint
+	return c
+}
+
+// SetAPISecret sets the project API secret authenticating the "import"
+// endpoint.
+func (c *StdConsumer) SetAPISecret(secret string) {
+	c.apiSecret = secret
+}
+
+// SetHTTPClient replaces the HTTP client, shared by all consumers by
+// default.
+func (c *StdConsumer) SetHTTPClient(client *http.Client) {
+	c.client = client
+}
+
+// SetTransport sends the requests through t rather than an HTTP client,
+// see Transport.
+func (c *StdConsumer) SetTransport(t Transport) {
+	c.client = t
+}
+
+// SetRequestIDHeader sends the ID of every request, see RequestError, in
+// the header name, DefaultRequestIDHeader for example.
+func (c *StdConsumer) SetRequestIDHeader(name string) {
+	c.requestIDHeader = name
+}
+
+// SetRequestTimeout bounds every request by timeout,
+// DefaultRequestTimeout by default, 0 for no bound.
+func (c *StdConsumer) SetRequestTimeout(timeout time.Duration) {
+	c.requestTimeout = timeout
+}
+
+/*
+SetHeader adds a header to every request, such as the authentication
+header of a gateway in front of Mixpanel. It replaces the header of the
+same name the consumer sets, if any. Like the other setters it must be
+called before the consumer is used.
+*/
+func (c *StdConsumer) SetHeader(key, value string) {
+	if c.header == nil {
+		c.header = make(http.Header)
+	}
+	c.header.Set(key, value)
+}
+
+// SetUserAgent replaces DefaultUserAgent as the User-Agent of the
+// requests.
+func (c *StdConsumer) SetUserAgent(userAgent string) {
+	c.userAgent = userAgent
+}
+
+/*
+OnResponse registers a hook called after every request with its
+outcome, for logging and metrics. Since success otherwise collapses to
+a nil error, it is the only way to see the HTTP status, timing and
+verbose response of each request. The hook must not retain the Body.
+*/
+func (c *StdConsumer) OnResponse(f func(*Response)) {
+	c.onResponse = f
+}
+
+/*
+BeforeSend registers a hook called before every request, for example to
+write an audit log or to mirror the traffic to a staging project. Hooks
+run in registration order and must not modify the payload.
+*/
+func (c *StdConsumer) BeforeSend(f func(*SendInfo)) {
+	c.beforeSend = append(c.beforeSend, f)
+}
+
+// AfterSend registers a hook called after every request with its outcome.
+func (c *StdConsumer) AfterSend(f func(*SendInfo)) {
+	c.afterSend = append(c.afterSend, f)
+}
+
+/*
+SetAPIHost routes every endpoint to another API host, such as EUAPIHost
+or a tracking proxy. The scheme defaults to https.
+*/
+func (c *StdConsumer) SetAPIHost(host string) {
+	host = normalizeHost(host)
+	for endpoint, path := range endpointPaths {
+		c.endpoints[endpoint] = host + path
+	}
+}
+
+/*
+SetEndpointURL routes a single endpoint ("events", "people", "groups" or
+"import") to url, such as an internal tracking proxy handling only part
+of the traffic. It overrides SetAPIHost for that endpoint when called
+after it.
+*/
+func (c *StdConsumer) SetEndpointURL(endpoint, url string) error {
+	if _, ok := endpointPaths[endpoint]; !ok {
+		return fmt.Errorf("mixpanel: unknown endpoint '%s'", endpoint)
+	}
+	c.endpoints[endpoint] = url
+	return nil
+}
+
+// Send delivers msgs in a single request, as a JSON array when there is
+// more than one message.
+func (c *StdConsumer) Send(ctx context.Context, endpoint string, msgs [][]byte) error {
+	if c.closed.Load() {
+		return ErrClosed
+	}
+	url, ok := c.endpoints[endpoint]
+	if !ok {
+		return errors.New(fmt.Sprintf("No such endpoint '%s'. Valid endpoints are one of %#v", endpoint, c.endpoints))
+	} else if len(msgs) == 0 {
+		return nil
+	}
+	if c.requestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.requestTimeout)
+		defer cancel()
+	}
+	if endpoint == "import" {
+		return c.writeImport(ctx, endpoint, url, msgs)
+	}
+	return c.write(ctx, endpoint, url, msgs)
+}
+
+// Flush does nothing, StdConsumer does not buffer.
+func (c *StdConsumer) Flush(ctx context.Context) error {
+	return nil
+}
+
+// Close makes the later sends fail with ErrClosed; StdConsumer does not
+// hold resources.
+func (c *StdConsumer) Close(ctx context.Context) error {
+	c.closed.Store(true)
+	return nil
+}
+
+func (c *StdConsumer) write(ctx context.Context, endpoint, endpoint_url string, msgs [][]byte) error {
+	msg := msgs[0]
+	if len(msgs) > 1 {
+		msg = jsonArray(msgs)
+	}
+	enc := c.encoding
+	if enc == nil {
+		enc = base64.URLEncoding
+	}
+	form := url.Values{}
+	form.Set("data", enc.EncodeToString(msg))
+	form.Set("verbose", "1")
+	c.sign(form)
+
+	// posted rather than passed in the query string, which batches of
+	// messages would quickly make too long
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint_url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.do(req, msg, &Response{Endpoint: endpoint, Messages: len(msgs)}, parseJsonResponse)
+}
+
+/*
+writeImport posts a JSON array of events to the import endpoint, which
+accepts events of any age but must be authenticated with the project
+API secret.
+*/
+func (c *StdConsumer) writeImport(ctx context.Context, endpoint, endpoint_url string, msgs [][]byte) error {
+	if c.apiSecret == "" && c.serviceAccount == nil {
+		return errors.New("The import endpoint needs the project API secret, see SetAPISecret")
+	}
+	payload := jsonArray(msgs)
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint_url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.serviceAccount != nil {
+		c.serviceAccount.authorize(req)
+	} else {
+		req.SetBasicAuth(c.apiSecret, "")
+	}
+	return c.do(req, payload, &Response{Endpoint: endpoint, Messages: len(msgs)}, parseImportResponse)
+}
+
+// do sends req, parses the response body and reports the outcome to the
+// hooks.
+func (c *StdConsumer) do(req *http.Request, payload []byte, r *Response, parse func([]byte, *Response) error) error {
+	r.RequestID = newRequestID()
+	info := &SendInfo{
+		RequestID: r.RequestID,
+		Endpoint:  r.Endpoint,
+		Payload:   payload,
+		Messages:  r.Messages,
+		Attempt:   attemptOf(req.Context()),
+	}
+	for _, hook := range c.beforeSend {
+		hook(info)
+	}
+
+	setHeaders(req, c.header, c.userAgent)
+	if c.requestIDHeader != "" {
+		req.Header.Set(c.requestIDHeader, r.RequestID)
+	}
+	start := time.Now()
+	resp, err := c.client.Do(req)
+	if err == nil {
+		r.StatusCode = resp.StatusCode
+		r.Header = resp.Header
+		r.Body, err = io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+		// drain whatever is left so the connection goes back to the pool
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if err == nil {
+			err = parse(r.Body, r)
+		}
+	}
+	r.Duration = time.Since(start)
+	c.stats.record(r.Messages, err)
+	if err != nil {
+		err = &RequestError{RequestID: r.RequestID, StatusCode: r.StatusCode, Err: err}
+	}
+	r.Err = err
+	if c.onResponse != nil {
+		c.onResponse(r)
+	}
+	info.Response = r
+	info.Err = err
+	for _, hook := range c.afterSend {
+		hook(info)
+	}
+	return err
+}
+
+// setHeaders sets the User-Agent, DefaultUserAgent when empty, and the
+// extra headers of a request.
+func setHeaders(req *http.Request, header http.Header, userAgent string) {
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+}
+
+/*
+BuffConfig tunes a BuffConsumer. The messages of an endpoint are flushed
+by whichever comes first: more than BatchSize buffered messages, at
+least MaxBytes buffered bytes, or the oldest of them having waited for
+MaxLatency, which bounds the delay of the events of quiet endpoints.
+BatchSize defaults to DefaultBatchSize; MaxBytes and MaxLatency are
+disabled when 0. A flush sends the buffered messages in requests of
+at most BatchSize messages, and never more than 2000, the limit of the
+ingestion endpoints.
+
+The messages of a flush failing with a transient error, see IsTransient,
+are retained for the next flush, up to MaxRetained messages per endpoint
+beyond which the oldest are dropped. A full buffer with retained
+messages is flushed again once a backoff, doubled after every failed
+flush up to a minute, has elapsed; in the meantime the messages buffered
+beyond MaxRetained plus BatchSize are dropped, the oldest first.
+MaxRetained defaults to DefaultMaxRetained, and a negative MaxRetained
+disables the retention. Example:
+
+	bc := NewBuffConsumerWithConfig(BuffConfig{
+	    BatchSize:   50,
+	    MaxBytes:    1 << 20,
+	    MaxLatency:  2 * time.Second,
+	    MaxRetained: 5000,
+	})
+*/
+type BuffConfig struct {
+	BatchSize   int
+	MaxBytes    int
+	MaxLatency  time.Duration
+	MaxRetained int
+}
+
+// DefaultMaxRetained is the default of BuffConfig.MaxRetained.
+const DefaultMaxRetained = 10000
+
+// maxBatch is the most messages the ingestion endpoints accept in a
+// single request.
+const maxBatch = 2000
+
+// bufferedCallback is the delivery callback of the buffered messages of
+// a Send, up to the end-th message of the buffer.
+type bufferedCallback struct {
+	done func(error)
+	end  int
+}
+
+type BuffConsumer struct {
+	StdConsumer
+	mu         sync.Mutex
+	buffers    map[string][][]byte
+	maxSize    int64
+	maxBytes   int
+	maxLatency time.Duration
+	// bytes is the size of the buffered messages of each endpoint
+	bytes map[string]int
+	// timers flush the endpoints after maxLatency; flushes tells stale
+	// timers, that fired after another flush, from current ones
+	timers  map[string]*time.Timer
+	flushes map[string]int
+	// retained counts the messages of failed flushes kept at the head of
+	// the buffers, at most maxRetained
+	retained    map[string]int
+	maxRetained int
+	// failures counts the failed flushes of the retained messages, and
+	// retryAt is when Send may flush them again
+	failures map[string]int
+	retryAt  map[string]time.Time
+	// sending signals the end of the flush in flight of the endpoints
+	sending map[string]chan struct{}
+	// closed fails the sends after Close, and stops the retention for
+	// its final flush
+	closed    bool
+	stop      chan struct{}
+	lastFlush time.Time
+	errors    errorHandler
+	// callbacks are the delivery callbacks of the buffered messages, run
+	// by complete once their flush is done
+	callbacks   map[string][]bufferedCallback
+	completions []func()
+}
+
+func NewBuffConsumer(maxSize int64) *BuffConsumer {
+	bc := NewBuffConsumerWithConfig(BuffConfig{BatchSize: int(maxSize)})
+	bc.maxSize = maxSize
+	return bc
+}
+
+// NewBuffConsumerWithConfig returns a BuffConsumer flushing as configured
+// by cfg.
+func NewBuffConsumerWithConfig(cfg BuffConfig) *BuffConsumer {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	maxSize := int64(cfg.BatchSize)
+	bc := new(BuffConsumer)
+	bc.StdConsumer = *NewStdConsumer()
+	bc.maxSize = maxSize
+	bc.maxBytes = cfg.MaxBytes
+	bc.maxLatency = cfg.MaxLatency
+	bc.maxRetained = cfg.MaxRetained
+	if bc.maxRetained == 0 {
+		bc.maxRetained = DefaultMaxRetained
+	}
+	bc.bytes = make(map[string]int)
+	bc.timers = make(map[string]*time.Timer)
+	bc.flushes = make(map[string]int)
+	bc.retained = make(map[string]int)
+	bc.failures = make(map[string]int)
+	bc.retryAt = make(map[string]time.Time)
+	bc.sending = make(map[string]chan struct{})
+	bc.callbacks = make(map[string][]bufferedCallback)
+	bc.buffers = make(map[string][][]byte)
+	bc.buffers["people"] = make([][]byte, 0, maxSize)
+	bc.buffers["events"] = make([][]byte, 0, maxSize)
+	bc.buffers["import"] = make([][]byte, 0, maxSize)
+	bc.buffers["groups"] = make([][]byte, 0, maxSize)
+	return bc
+}
+
+func (bc *BuffConsumer) Send(ctx context.Context, endpoint string, msgs [][]byte) error {
+	if isPriorityContext(ctx) {
+		// high priority messages skip the buffer
+		return bc.StdConsumer.Send(ctx, endpoint, msgs)
+	}
+	defer bc.complete()
+	bc.mu.Lock()
+	if bc.closed {
+		bc.mu.Unlock()
+		return ErrClosed
+	}
+	if _, ok := bc.buffers[endpoint]; !ok {
+		bc.mu.Unlock()
+		return errors.New(fmt.Sprintf("No such endpoint '%s'. Valid endpoints are one of %#v", endpoint, bc.buffers))
+	}
+	bc.buffers[endpoint] = append(bc.buffers[endpoint], msgs...)
+	if done := claimDelivery(ctx); done != nil {
+		bc.callbacks[endpoint] = append(bc.callbacks[endpoint], bufferedCallback{done, len(bc.buffers[endpoint])})
+	}
+	for _, msg := range msgs {
+		bc.bytes[endpoint] += len(msg)
+	}
+	full := bc.full(endpoint)
+	// endpoints with retained messages back off, rather than retrying on
+	// every Send during an outage, and a flush in flight delivers the
+	// messages of the endpoint one batch at a time
+	var b *batch
+	if full && !time.Now().Before(bc.retryAt[endpoint]) && bc.sending[endpoint] == nil {
+		b = bc.take(endpoint)
+	} else {
+		bc.schedule(endpoint)
+	}
+	if n := len(bc.buffers[endpoint]) - bc.maxRetained - int(bc.maxSize); bc.maxRetained > 0 && n > 0 {
+		bc.dropOldest(endpoint, n, ErrDropped)
+	}
+	bc.mu.Unlock()
+	// a backlog of retained messages is sent one batch at a time, until
+	// the buffer is no longer full or a batch is retained again
+	for b != nil {
+		if retained, _ := bc.send(ctx, b); retained {
+			break
+		}
+		bc.mu.Lock()
+		b = nil
+		if bc.full(endpoint) && bc.sending[endpoint] == nil {
+			b = bc.take(endpoint)
+		}
+		bc.mu.Unlock()
+	}
+	return nil
+}
+
+// full tells whether the buffer of endpoint holds a batch to flush.
+// bc.mu must be held.
+func (bc *BuffConsumer) full(endpoint string) bool {
+	return len(bc.buffers[endpoint]) > int(bc.maxSize) || bc.maxBytes > 0 && bc.bytes[endpoint] >= bc.maxBytes
+}
+
+// schedule starts the timer flushing endpoint after maxLatency, unless
+// one is running. bc.mu must be held.
+func (bc *BuffConsumer) schedule(endpoint string) {
+	if bc.maxLatency > 0 && bc.timers[endpoint] == nil {
+		flush := bc.flushes[endpoint]
+		bc.timers[endpoint] = time.AfterFunc(bc.maxLatency, func() {
+			bc.expire(endpoint, flush)
+		})
+	}
+}
+
+// expire flushes endpoint, batch after batch, once its oldest message
+// waited for maxLatency, unless it was flushed since. When a flush of
+// endpoint is in flight, the timer is started again once it is done.
+func (bc *BuffConsumer) expire(endpoint string, flush int) {
+	defer bc.complete()
+	bc.mu.Lock()
+	if bc.flushes[endpoint] != flush {
+		bc.mu.Unlock()
+		return
+	}
+	var b *batch
+	if bc.sending[endpoint] == nil {
+		b = bc.take(endpoint)
+	} else {
+		delete(bc.timers, endpoint)
+	}
+	bc.mu.Unlock()
+	for b != nil {
+		if retained, _ := bc.send(context.Background(), b); retained {
+			break
+		}
+		bc.mu.Lock()
+		b = nil
+		if bc.sending[endpoint] == nil {
+			b = bc.take(endpoint)
+		}
+		bc.mu.Unlock()
+	}
+}
+
+/*
+Flush Send all remaining messages to Mixpanel. BufferedConsumers will
+flush automatically when you call Send(), but you will need to call
+Flush() when you are completely done using the consumer (for example,
+when your application exits) to ensure there are no messages remaining
+in memory.
+
+The buffer of every endpoint is sent in batches until it is drained,
+or until a batch fails with a transient error and is retained for the
+next flush. The errors of the endpoints are joined with errors.Join.
+Flush is safe to call concurrently with Send, Flush and Close; it waits
+for the flushes in flight before flushing an endpoint.
+*/
+func (bc *BuffConsumer) Flush(ctx context.Context) error {
+	defer bc.complete()
+	bc.mu.Lock()
+	endpoints := make([]string, 0, len(bc.buffers))
+	for endpoint := range bc.buffers {
+		endpoints = append(endpoints, endpoint)
+	}
+	bc.mu.Unlock()
+	sort.Strings(endpoints)
+	var errs []error
+	for _, endpoint := range endpoints {
+		for {
+			b, err := bc.takeIdle(ctx, endpoint)
+			if err != nil {
+				return errors.Join(append(errs, err)...)
+			}
+			if b == nil {
+				break
+			}
+			retained, err := bc.send(ctx, b)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			if retained {
+				break
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+/*
+FlushEvery flushes the buffers in the background every interval, so
+messages are not held indefinitely on quiet endpoints. It runs until
+Close is called and must be called at most once.
+*/
+func (bc *BuffConsumer) FlushEvery(interval time.Duration) {
+	bc.mu.Lock()
+	bc.stop = make(chan struct{})
+	stop := bc.stop
+	bc.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				bc.Flush(context.Background())
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the background flushes and flushes all remaining messages.
+// The messages failing this final flush are reported as DeliveryErrors
+// rather than retained, and the later sends fail with ErrClosed. It can
+// be called several times, and concurrently.
+func (bc *BuffConsumer) Close(ctx context.Context) error {
+	bc.mu.Lock()
+	bc.closed = true
+	if bc.stop != nil {
+		close(bc.stop)
+		bc.stop = nil
+	}
+	bc.mu.Unlock()
+	err := bc.Flush(ctx)
+	bc.StdConsumer.Close(ctx)
+	return err
+}
+
+func jsonArray(a [][]byte) []byte {
+	sep := ","
+	if len(a) == 0 {
+		return []byte("[]")
+	}
+
+	n := len(sep) * (len(a) - 1)
+	for i := 0; i < len(a); i++ {
+		n += len(a[i])
+	}
+
+	b := make([]byte, n+2)
+	bp := copy(b, []byte{'['})
+	bp += copy(b[bp:], a[0])
+	for _, s := range a[1:] {
+		bp += copy(b[bp:], sep)
+		bp += copy(b[bp:], s)
+	}
+	copy(b[bp:], []byte{']'})
+	return b
+}
+
+// batch is a flush of the messages of an endpoint, taken out of its
+// buffer with their delivery callbacks.
+type batch struct {
+	endpoint  string
+	msgs      [][]byte
+	callbacks []bufferedCallback
+	attempt   int
+}
+
+// take takes the oldest buffered messages of endpoint, at most a batch
+// of them, for send to deliver them out of bc.mu, nil when there are
+// none. bc.mu must be held.
+func (bc *BuffConsumer) take(endpoint string) *batch {
+	msgs := bc.buffers[endpoint]
+	if len(msgs) == 0 {
+		return nil
+	}
+	n := len(msgs)
+	if n > int(bc.maxSize) {
+		n = int(bc.maxSize)
+	}
+	if n > maxBatch {
+		n = maxBatch
+	}
+	b := &batch{
+		endpoint:  endpoint,
+		msgs:      msgs[:n:n],
+		callbacks: bc.takeCallbacks(endpoint, n),
+		attempt:   bc.failures[endpoint] + 1,
+	}
+	for _, msg := range b.msgs {
+		bc.bytes[endpoint] -= len(msg)
+	}
+	if n == len(msgs) {
+		bc.buffers[endpoint] = make([][]byte, 0, bc.maxSize)
+	} else {
+		bc.buffers[endpoint] = msgs[n:]
+	}
+	bc.retained[endpoint] -= n
+	if bc.retained[endpoint] < 0 {
+		bc.retained[endpoint] = 0
+	}
+	bc.flushes[endpoint]++
+	if timer := bc.timers[endpoint]; timer != nil {
+		timer.Stop()
+		delete(bc.timers, endpoint)
+	}
+	bc.sending[endpoint] = make(chan struct{})
+	bc.lastFlush = time.Now()
+	return b
+}
+
+// takeIdle takes the buffered messages of endpoint once the flush of
+// endpoint in flight, if any, is done.
+func (bc *BuffConsumer) takeIdle(ctx context.Context, endpoint string) (*batch, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	for bc.sending[endpoint] != nil {
+		sending := bc.sending[endpoint]
+		bc.mu.Unlock()
+		select {
+		case <-sending:
+		case <-ctx.Done():
+			bc.mu.Lock()
+			return nil, ctx.Err()
+		}
+		bc.mu.Lock()
+	}
+	return bc.take(endpoint), nil
+}
+
+// send delivers b, without holding bc.mu so that the Sends of other
+// messages do not wait for the request, and retains its messages when
+// it fails with a transient error, which it tells with retained.
+func (bc *BuffConsumer) send(ctx context.Context, b *batch) (retained bool, err error) {
+	err = bc.StdConsumer.Send(withAttempt(ctx, b.attempt), b.endpoint, b.msgs)
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	close(bc.sending[b.endpoint])
+	delete(bc.sending, b.endpoint)
+	if len(bc.buffers[b.endpoint]) > 0 {
+		bc.schedule(b.endpoint)
+	}
+	if err != nil && bc.maxRetained > 0 && !bc.closed && IsTransient(err) {
+		bc.failures[b.endpoint]++
+		bc.retryAt[b.endpoint] = time.Now().Add(retainedDelay(bc.failures[b.endpoint]))
+		return true, bc.retain(b, err)
+	}
+	delete(bc.failures, b.endpoint)
+	delete(bc.retryAt, b.endpoint)
+	if err != nil {
+		err = &DeliveryError{Endpoint: b.endpoint, Messages: b.msgs, Err: err}
+		bc.errors.report(err)
+	}
+	bc.completions = append(bc.completions, func() {
+		for _, cb := range b.callbacks {
+			cb.done(err)
+		}
+	})
+	return false, err
+}
+
+// retain puts the messages of b that failed to be sent with err back at
+// the head of the buffer of its endpoint for the next flush, dropping
+// the oldest retained messages over maxRetained.
+func (bc *BuffConsumer) retain(b *batch, err error) error {
+	endpoint, n := b.endpoint, len(b.msgs)
+	callbacks := b.callbacks
+	for _, cb := range bc.callbacks[endpoint] {
+		callbacks = append(callbacks, bufferedCallback{cb.done, cb.end + n})
+	}
+	bc.callbacks[endpoint] = callbacks
+	bc.buffers[endpoint] = append(b.msgs[:n:n], bc.buffers[endpoint]...)
+	for _, msg := range b.msgs {
+		bc.bytes[endpoint] += len(msg)
+	}
+	bc.retained[endpoint] += n
+	var errs []error
+	kept := b.msgs
+	if over := bc.retained[endpoint] - bc.maxRetained; over > 0 {
+		errs = append(errs, bc.dropOldest(endpoint, over, err))
+		if over > n {
+			over = n
+		}
+		kept = b.msgs[over:]
+	}
+	if len(kept) > 0 {
+		retained := &DeliveryError{Endpoint: endpoint, Messages: kept, Err: err, Retained: true}
+		bc.errors.report(retained)
+		errs = append(errs, retained)
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return errors.Join(errs...)
+}
+
+// dropOldest drops the n oldest buffered messages of endpoint, reported
+// as failing with err.
+func (bc *BuffConsumer) dropOldest(endpoint string, n int, err error) *DeliveryError {
+	msgs := bc.buffers[endpoint]
+	dropped := &DeliveryError{Endpoint: endpoint, Messages: msgs[:n:n], Err: err}
+	bc.errors.report(dropped)
+	bc.completeCallbacks(endpoint, n, dropped)
+	for _, msg := range msgs[:n] {
+		bc.bytes[endpoint] -= len(msg)
+	}
+	bc.buffers[endpoint] = msgs[n:]
+	bc.retained[endpoint] -= n
+	if bc.retained[endpoint] < 0 {
+		bc.retained[endpoint] = 0
+	}
+	return dropped
+}
+
+// retainedDelay is the backoff of the messages retained after the given
+// number of failed flushes: retryDelay, doubled after every failure up
+// to a minute.
+func retainedDelay(failures int) time.Duration {
+	delay := retryDelay
+	for i := 1; i < failures && delay < time.Minute; i++ {
+		delay *= 2
+	}
+	if delay > time.Minute {
+		delay = time.Minute
+	}
+	return delay
+}
+
+// takeCallbacks takes the delivery callbacks of endpoint whose messages
+// are all among its first n buffered messages, and shifts the others
+// past them.
+func (bc *BuffConsumer) takeCallbacks(endpoint string, n int) []bufferedCallback {
+	callbacks := bc.callbacks[endpoint]
+	i := 0
+	for i < len(callbacks) && callbacks[i].end <= n {
+		i++
+	}
+	taken := callbacks[:i:i]
+	rest := make([]bufferedCallback, 0, len(callbacks)-i)
+	for _, cb := range callbacks[i:] {
+		rest = append(rest, bufferedCallback{cb.done, cb.end - n})
+	}
+	if len(rest) == 0 {
+		delete(bc.callbacks, endpoint)
+	} else {
+		bc.callbacks[endpoint] = rest
+	}
+	return taken
+}
+
+// completeCallbacks completes with err the delivery callbacks of the
+// first n buffered messages of endpoint, err being nil for a delivery.
+func (bc *BuffConsumer) completeCallbacks(endpoint string, n int, err error) {
+	done := bc.takeCallbacks(endpoint, n)
+	if len(done) == 0 {
+		return
+	}
+	bc.completions = append(bc.completions, func() {
+		for _, cb := range done {
+			cb.done(err)
+		}
+	})
+}
+
+// Len returns the number of buffered messages, for health checks to
+// tell whether bc is backing up. It is safe for concurrent use, as are
+// Bytes, LastFlush and Retained, and does not wait for the flushes in
+// flight.
+func (bc *BuffConsumer) Len() int {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	n := 0
+	for _, msgs := range bc.buffers {
+		n += len(msgs)
+	}
+	return n
+}
+
+// Bytes returns the size of the buffered messages.
+func (bc *BuffConsumer) Bytes() int {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	n := 0
+	for _, size := range bc.bytes {
+		n += size
+	}
+	return n
+}
+
+// LastFlush returns when bc last flushed a buffer, the zero time before
+// the first flush.
+func (bc *BuffConsumer) LastFlush() time.Time {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc.lastFlush
+}
+
+// Retained returns the number of messages of failed flushes waiting for
+// the next flush, to alert on a growing backlog.
+func (bc *BuffConsumer) Retained() int {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	n := 0
+	for _, count := range bc.retained {
+		n += count
+	}
+	return n
+}
+
+// complete runs the delivery callbacks of the flushed messages, outside
+// of the lock since they may track more events.
+func (bc *BuffConsumer) complete() {
+	bc.mu.Lock()
+	completions := bc.completions
+	bc.completions = nil
+	bc.mu.Unlock()
+	for _, fn := range completions {
+		fn()
+	}
+}
+
+// SetErrorHandler hands the errors of the flushes to fn rather than
+// logging them, see WithErrorHandler.
+func (bc *BuffConsumer) SetErrorHandler(fn func(error)) {
+	bc.errors.set(fn)
+}
@@ -0,0 +1,506 @@
+package mixpanel
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// recordingServer answers like the Mixpanel ingestion API and records
+// the decoded payload of every request.
+type recordingServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	payloads []string
+}
+
+func newRecordingServer() *recordingServer {
+	rs := newUnstartedRecordingServer()
+	rs.Start()
+	return rs
+}
+
+func newUnstartedRecordingServer() *recordingServer {
+	rs := &recordingServer{}
+	rs.Server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		data, _ := base64.URLEncoding.DecodeString(r.Form.Get("data"))
+		rs.mu.Lock()
+		rs.payloads = append(rs.payloads, string(data))
+		rs.mu.Unlock()
+		w.Write([]byte(`{"status": 1, "error": null}`))
+	}))
+	return rs
+}
+
+func (rs *recordingServer) Payloads() []string {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return append([]string(nil), rs.payloads...)
+}
+
+func (rs *recordingServer) endpoints() map[string]string {
+	return map[string]string{
+		"events": rs.URL + "/track",
+		"people": rs.URL + "/engage",
+		"groups": rs.URL + "/groups",
+	}
+}
+
+func TestBuffConsumerBatches(t *testing.T) {
+	rs := newRecordingServer()
+	defer rs.Close()
+
+	bc := NewBuffConsumer(2)
+	bc.endpoints = rs.endpoints()
+	ctx := context.Background()
+	for _, msg := range []string{`{"n":1}`, `{"n":2}`, `{"n":3}`, `{"n":4}`} {
+		if err := bc.Send(ctx, "events", [][]byte{[]byte(msg)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bc.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	payloads := rs.Payloads()
+	if len(payloads) != 2 || payloads[0] != `[{"n":1},{"n":2}]` || payloads[1] != `[{"n":3},{"n":4}]` {
+		t.Errorf("Unexpected payloads %q", payloads)
+	}
+	for _, p := range payloads {
+		if !json.Valid([]byte(p)) {
+			t.Errorf("Invalid JSON payload %q", p)
+		}
+	}
+}
+
+func TestBuffConsumerFlushTriggers(t *testing.T) {
+	rs := newRecordingServer()
+	defer rs.Close()
+
+	bc := NewBuffConsumerWithConfig(BuffConfig{BatchSize: 100, MaxBytes: 16, MaxLatency: 50 * time.Millisecond})
+	bc.endpoints = rs.endpoints()
+	ctx := context.Background()
+	bc.Send(ctx, "events", [][]byte{[]byte(`{"n":1}`), []byte(`{"n":2}`), []byte(`{"n":3}`)})
+	if payloads := rs.Payloads(); len(payloads) != 1 || payloads[0] != `[{"n":1},{"n":2},{"n":3}]` {
+		t.Fatalf("Expected a flush on MaxBytes, got %q", payloads)
+	}
+
+	start := time.Now()
+	bc.Send(ctx, "people", [][]byte{[]byte(`{"n":4}`)})
+	for len(rs.Payloads()) < 2 {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("Expected a flush on MaxLatency")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if waited := time.Since(start); waited < 50*time.Millisecond {
+		t.Errorf("Expected the flush after MaxLatency, got it after %v", waited)
+	}
+	bc.Close(ctx)
+	if payloads := rs.Payloads(); len(payloads) != 2 || payloads[1] != `{"n":4}` {
+		t.Errorf("Unexpected payloads %q", payloads)
+	}
+}
+
+func TestBuffConsumerSendsDuringFlush(t *testing.T) {
+	release := make(chan struct{})
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			<-release
+		}
+		w.Write([]byte(`{"status": 1, "error": null}`))
+	}))
+	defer ts.Close()
+	var once sync.Once
+	unblock := func() { once.Do(func() { close(release) }) }
+	defer unblock()
+
+	bc := NewBuffConsumer(1)
+	bc.SetAPIHost(ts.URL)
+	ctx := context.Background()
+	bc.Send(ctx, "events", [][]byte{[]byte(`{"n":1}`)})
+	flushed := make(chan error, 1)
+	go func() {
+		flushed <- bc.Send(ctx, "events", [][]byte{[]byte(`{"n":2}`)})
+	}()
+	for requests.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	sent := make(chan error, 1)
+	go func() {
+		sent <- bc.Send(ctx, "events", [][]byte{[]byte(`{"n":3}`)})
+	}()
+	select {
+	case err := <-sent:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Send not to wait for the flush in flight")
+	}
+	unblock()
+	if err := <-flushed; err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("Expected the messages sent during the flush in batches of their own, got %d requests", n)
+	}
+}
+
+type legacyRecorder struct {
+	msgs    []string
+	flushed bool
+}
+
+func (lr *legacyRecorder) Send(endpoint string, msg []byte) error {
+	lr.msgs = append(lr.msgs, endpoint+" "+string(msg))
+	return nil
+}
+
+func (lr *legacyRecorder) Flush() error {
+	lr.flushed = true
+	return nil
+}
+
+func TestAdaptLegacyConsumer(t *testing.T) {
+	lr := &legacyRecorder{}
+	mp := NewMixpanelWithConsumer(token, AdaptLegacyConsumer(lr))
+	if err := mp.Track("12345", "Signed Up", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := mp.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(lr.msgs) != 1 || !lr.flushed {
+		t.Errorf("Expected one message and a flush, got %q (flushed %v)", lr.msgs, lr.flushed)
+	}
+}
+
+func TestStdConsumerPostsBatches(t *testing.T) {
+	var decoded []map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.RawQuery != "" || r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+			t.Errorf("Expected a form post got %s %s", r.Method, r.URL)
+		}
+		r.ParseForm()
+		data, _ := base64.URLEncoding.DecodeString(r.PostForm.Get("data"))
+		json.Unmarshal(data, &decoded)
+		w.Write([]byte(`{"status": 1, "error": null}`))
+	}))
+	defer ts.Close()
+
+	// a batch far longer than the URLs accepted by most servers and proxies
+	comment := make([]byte, 1000)
+	for i := range comment {
+		comment[i] = 'x'
+	}
+	msgs := make([][]byte, 50)
+	for i := range msgs {
+		msgs[i], _ = json.Marshal(P{"event": "Commented", "properties": P{"Comment": string(comment)}})
+	}
+	c := NewStdConsumer()
+	c.endpoints = map[string]string{"events": ts.URL + "/track"}
+	if err := c.Send(context.Background(), "events", msgs); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 50 {
+		t.Errorf("Expected 50 events got %d", len(decoded))
+	}
+}
+
+func TestSendAfterClose(t *testing.T) {
+	rs := newRecordingServer()
+	defer rs.Close()
+
+	ctx := context.Background()
+	std := NewStdConsumer()
+	std.endpoints = rs.endpoints()
+	bc := NewBuffConsumer(10)
+	bc.endpoints = rs.endpoints()
+	for _, c := range []Consumer{std, bc} {
+		if err := c.Send(ctx, "events", [][]byte{[]byte(`{"n":1}`)}); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Close(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Send(ctx, "events", [][]byte{[]byte(`{"n":2}`)}); err != ErrClosed {
+			t.Errorf("%T: expected ErrClosed got %v", c, err)
+		}
+		if err := c.Send(withPriority(ctx), "events", [][]byte{[]byte(`{"n":3}`)}); err != ErrClosed {
+			t.Errorf("%T: expected ErrClosed for a priority message got %v", c, err)
+		}
+	}
+	if payloads := rs.Payloads(); len(payloads) != 2 {
+		t.Errorf("Expected the messages sent before Close only, got %q", payloads)
+	}
+}
+
+func TestOnResponse(t *testing.T) {
+	rs := newRecordingServer()
+	defer rs.Close()
+
+	var responses []*Response
+	c := NewStdConsumer()
+	c.endpoints = rs.endpoints()
+	c.OnResponse(func(r *Response) {
+		responses = append(responses, r)
+	})
+	if err := c.Send(context.Background(), "people", [][]byte{[]byte(`{"a":1}`), []byte(`{"b":2}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != 1 {
+		t.Fatalf("Expected one response, got %d", len(responses))
+	}
+	r := responses[0]
+	if r.Endpoint != "people" || r.Messages != 2 || r.StatusCode != 200 || r.Status != "1" || r.Err != nil || r.Duration <= 0 {
+		t.Errorf("Unexpected response %+v", r)
+	}
+}
+
+func TestSendHooks(t *testing.T) {
+	rs := newRecordingServer()
+	defer rs.Close()
+
+	var events []string
+	bc := NewBuffConsumer(10)
+	bc.endpoints = rs.endpoints()
+	bc.BeforeSend(func(info *SendInfo) {
+		events = append(events, "before "+info.Endpoint+" "+string(info.Payload))
+	})
+	bc.AfterSend(func(info *SendInfo) {
+		if info.Response == nil || info.Attempt != 1 {
+			t.Errorf("Unexpected send info %+v", info)
+		}
+		events = append(events, "after "+info.Endpoint)
+	})
+	ctx := context.Background()
+	bc.Send(ctx, "events", [][]byte{[]byte(`{"n":1}`)})
+	if len(events) != 0 {
+		t.Errorf("Expected no request before flushing, got %q", events)
+	}
+	bc.Flush(ctx)
+	if len(events) != 2 || events[0] != `before events {"n":1}` || events[1] != "after events" {
+		t.Errorf("Unexpected hook calls %q", events)
+	}
+}
+
+// countingServer is a recordingServer counting the connections opened.
+func countingServer() (*recordingServer, *atomic.Int64) {
+	rs := newUnstartedRecordingServer()
+	conns := new(atomic.Int64)
+	rs.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	rs.Start()
+	return rs, conns
+}
+
+func TestStdConsumerReusesConnections(t *testing.T) {
+	rs, conns := countingServer()
+	defer rs.Close()
+
+	c := NewStdConsumer()
+	c.endpoints = rs.endpoints()
+	for i := 0; i < 20; i++ {
+		if err := c.Send(context.Background(), "events", [][]byte{[]byte(`{"n":1}`)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := conns.Load(); n != 1 {
+		t.Errorf("Expected a single reused connection, got %d", n)
+	}
+}
+
+func BenchmarkStdConsumerSend(b *testing.B) {
+	rs, conns := countingServer()
+	defer rs.Close()
+
+	c := NewStdConsumer()
+	c.endpoints = rs.endpoints()
+	msg := [][]byte{[]byte(`{"event":"Signed Up","properties":{"distinct_id":"12345"}}`)}
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := c.Send(context.Background(), "events", msg); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.ReportMetric(float64(conns.Load()), "conns")
+}
+
+func TestHeaders(t *testing.T) {
+	var headers []http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header.Clone())
+		if r.URL.Path == "/import" {
+			w.Write([]byte(`{"code": 200, "status": "OK", "num_records_imported": 1}`))
+			return
+		}
+		w.Write([]byte(`{"status": 1, "error": null}`))
+	}))
+	defer ts.Close()
+
+	mp := NewMixpanel(token, WithAPIHost(ts.URL), WithAPISecret("secret"))
+	if err := mp.Track("12345", "Viewed", nil); err != nil {
+		t.Fatal(err)
+	}
+	mp = NewMixpanel(token, WithAPIHost(ts.URL), WithAPISecret("secret"),
+		WithHeader("X-Gateway-Key", "k1"), WithUserAgent("shop/2.1"))
+	if err := mp.Track("12345", "Viewed", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := mp.Import("12345", "Viewed", time.Now(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mp.ImportFromReader(context.Background(), strings.NewReader(`{"event": "Viewed", "properties": {"distinct_id": "12345", "time": 1700000000}}`), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(headers) != 4 {
+		t.Fatalf("Expected 4 requests got %d", len(headers))
+	}
+	if ua := headers[0].Get("User-Agent"); ua != DefaultUserAgent || headers[0].Get("X-Gateway-Key") != "" {
+		t.Errorf("Unexpected default headers %v", headers[0])
+	}
+	for i, h := range headers[1:] {
+		if h.Get("User-Agent") != "shop/2.1" || h.Get("X-Gateway-Key") != "k1" {
+			t.Errorf("Request %d: unexpected headers %v", i+1, h)
+		}
+	}
+}
+
+func TestOptionsReachWrappedConsumer(t *testing.T) {
+	var mu sync.Mutex
+	var headers []http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers = append(headers, r.Header.Clone())
+		mu.Unlock()
+		w.Write([]byte(`{"status": 1, "error": null}`))
+	}))
+	defer ts.Close()
+
+	sc, err := NewSpoolConsumer(NewStdConsumer(), t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ac, err := NewAsyncConsumer(NewAuditingConsumer(sc, NewJSONAuditLog(io.Discard)), AsyncConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mp := NewMixpanelWithConsumer(token, ac, WithAPIHost(ts.URL),
+		WithHeader("X-Gateway-Key", "k1"), WithUserAgent("shop/2.1"))
+	if err := mp.Track("12345", "Viewed", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := mp.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(headers) != 1 {
+		t.Fatalf("Expected 1 request got %d", len(headers))
+	}
+	if h := headers[0]; h.Get("User-Agent") != "shop/2.1" || h.Get("X-Gateway-Key") != "k1" {
+		t.Errorf("Unexpected headers %v", h)
+	}
+}
+
+type countingTransport struct {
+	next     http.RoundTripper
+	requests atomic.Int32
+}
+
+func (ct *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ct.requests.Add(1)
+	return ct.next.RoundTrip(req)
+}
+
+func TestWithRoundTripper(t *testing.T) {
+	rs := newRecordingServer()
+	defer rs.Close()
+
+	ct := &countingTransport{next: NewTransport()}
+	mp := NewMixpanel(token, WithAPIHost(rs.URL), WithHTTPClient(&http.Client{Timeout: time.Minute}), WithRoundTripper(ct))
+	if err := mp.Track("12345", "Viewed", nil); err != nil {
+		t.Fatal(err)
+	}
+	if ct.requests.Load() != 1 || mp.client.Timeout != time.Minute {
+		t.Errorf("Expected the request through the transport, got %d requests and client %+v", ct.requests.Load(), mp.client)
+	}
+}
+
+func TestWithProxy(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		w.Write([]byte(`{"status": 1, "error": null}`))
+	}))
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	mp := NewMixpanel(token, WithAPIHost("http://mixpanel.invalid"), WithProxy(proxyURL))
+	if err := mp.Track("12345", "Viewed", nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(proxied) != 1 || proxied[0] != "http://mixpanel.invalid/track" {
+		t.Errorf("Expected the request through the proxy got %v", proxied)
+	}
+}
+
+func TestWithEndpointURL(t *testing.T) {
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if strings.HasSuffix(r.URL.Path, "import") {
+			w.Write([]byte(`{"code": 200, "status": "OK", "num_records_imported": 1}`))
+			return
+		}
+		w.Write([]byte(`{"status": 1, "error": null}`))
+	}))
+	defer ts.Close()
+
+	mp := NewMixpanel(token, WithAPIHost(ts.URL), WithAPISecret("secret"),
+		WithEndpointURL("events", ts.URL+"/proxy/track"),
+		WithEndpointURL("import", ts.URL+"/proxy/import"))
+	mp.Track("12345", "Viewed", nil)
+	mp.PeopleSet("12345", &P{"plan": "pro"})
+	mp.Import("12345", "Viewed", time.Now(), nil)
+	mp.ImportFromReader(context.Background(), strings.NewReader(`{"event": "Viewed", "properties": {"distinct_id": "12345", "time": 1700000000}}`), nil)
+
+	want := []string{"/proxy/track", "/engage", "/proxy/import", "/proxy/import"}
+	if strings.Join(paths, " ") != strings.Join(want, " ") {
+		t.Errorf("Expected requests to %v got %v", want, paths)
+	}
+
+	if err := NewStdConsumer().SetEndpointURL("event", ts.URL); err == nil {
+		t.Error("Expected an error for an unknown endpoint")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected WithEndpointURL to panic on an unknown endpoint")
+		}
+	}()
+	WithEndpointURL("event", ts.URL)
+}
@@ -0,0 +1,107 @@
+package mixpanel
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrNoContextClient is returned by the methods of a nil ContextClient,
+// what FromContext returns for a context without client.
+var ErrNoContextClient = errors.New("mixpanel: no client in the context, see NewContext")
+
+type contextKey struct{}
+
+/*
+ContextClient is a client bound to a distinct_id, carried by a context
+so that request handlers can track events without threading the client
+and the user through every call:
+
+	ctx = mixpanel.NewContext(ctx, mp, userID)
+	...
+	mixpanel.FromContext(ctx).Track("Checkout", &mixpanel.P{"items": 3})
+
+Its methods act on the bound distinct_id. They are safe on a nil
+ContextClient, where they return ErrNoContextClient, and for concurrent
+use.
+*/
+type ContextClient struct {
+	mp *Mixpanel
+
+	mu          sync.RWMutex
+	distinct_id string
+}
+
+// NewContext returns a copy of ctx carrying mp bound to distinct_id.
+func NewContext(ctx context.Context, mp *Mixpanel, distinct_id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, &ContextClient{mp: mp, distinct_id: distinct_id})
+}
+
+// FromContext returns the client carried by ctx, nil if there is none.
+func FromContext(ctx context.Context) *ContextClient {
+	c, _ := ctx.Value(contextKey{}).(*ContextClient)
+	return c
+}
+
+// Client returns the bound client.
+func (c *ContextClient) Client() *Mixpanel {
+	if c == nil {
+		return nil
+	}
+	return c.mp
+}
+
+// DistinctID returns the bound distinct_id.
+func (c *ContextClient) DistinctID() string {
+	if c == nil {
+		return ""
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.distinct_id
+}
+
+// SetDistinctID binds another distinct_id, once the user logged in for
+// example. Every holder of the context sees the change.
+func (c *ContextClient) SetDistinctID(distinct_id string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.distinct_id = distinct_id
+	c.mu.Unlock()
+}
+
+// Track tracks an event of the bound distinct_id.
+func (c *ContextClient) Track(event string, prop *P) error {
+	if c == nil {
+		return ErrNoContextClient
+	}
+	return c.mp.Track(c.DistinctID(), event, prop)
+}
+
+// PeopleSet sets properties of the profile of the bound distinct_id.
+func (c *ContextClient) PeopleSet(properties *P) error {
+	if c == nil {
+		return ErrNoContextClient
+	}
+	return c.mp.PeopleSet(c.DistinctID(), properties)
+}
+
+// PeopleSetOnce sets properties of the profile of the bound distinct_id
+// that are not set yet.
+func (c *ContextClient) PeopleSetOnce(properties *P) error {
+	if c == nil {
+		return ErrNoContextClient
+	}
+	return c.mp.PeopleSetOnce(c.DistinctID(), properties)
+}
+
+// PeopleIncrement increments numeric properties of the profile of the
+// bound distinct_id.
+func (c *ContextClient) PeopleIncrement(properties *P) error {
+	if c == nil {
+		return ErrNoContextClient
+	}
+	return c.mp.PeopleIncrement(c.DistinctID(), properties)
+}
@@ -0,0 +1,68 @@
+package mixpanel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestContextClient(t *testing.T) {
+	var buf bytes.Buffer
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf))
+
+	ctx := NewContext(context.Background(), mp, "anonymous")
+	c := FromContext(ctx)
+	if c.Client() != mp || c.DistinctID() != "anonymous" {
+		t.Fatalf("Unexpected client %v bound to %q", c.Client(), c.DistinctID())
+	}
+	if err := c.Track("Viewed", nil); err != nil {
+		t.Fatal(err)
+	}
+	child, cancel := context.WithCancel(ctx)
+	defer cancel()
+	FromContext(child).SetDistinctID("12345")
+	if err := c.Track("Logged In", &P{"method": "password"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.PeopleSet(&P{"plan": "pro"}); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 messages, got %s", buf.String())
+	}
+	want := []string{"anonymous", "12345", "12345"}
+	for i, line := range lines {
+		var msg struct {
+			Data struct {
+				DistinctID string `json:"$distinct_id"`
+				Properties struct {
+					DistinctID string `json:"distinct_id"`
+				} `json:"properties"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			t.Fatal(err)
+		}
+		if got := msg.Data.DistinctID + msg.Data.Properties.DistinctID; got != want[i] {
+			t.Errorf("Message %d: expected distinct_id %q, got %q", i, want[i], got)
+		}
+	}
+}
+
+func TestContextClientMissing(t *testing.T) {
+	c := FromContext(context.Background())
+	if c != nil {
+		t.Fatalf("Expected no client, got %v", c)
+	}
+	if err := c.Track("Viewed", nil); err != ErrNoContextClient {
+		t.Errorf("Expected ErrNoContextClient, got %v", err)
+	}
+	if c.DistinctID() != "" || c.Client() != nil {
+		t.Error("Expected a nil client to be empty")
+	}
+	c.SetDistinctID("12345")
+}
@@ -0,0 +1,486 @@
+package mixpanel
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+CSVMapping describes how the rows of a CSV file become events or
+profile updates. The first row of the file is a header naming the
+columns.
+
+Every column without a special meaning becomes a property named after
+its header, or after the name Columns maps it to; columns mapped to "-"
+are left out. Values are strings unless Types gives the column one of
+"int", "float", "bool", "time" or "list". Empty cells are left out.
+Example:
+
+	mapping := &CSVMapping{
+	    EventColumn:      "action",
+	    DistinctIDColumn: "user",
+	    TimeColumn:       "ts",
+	    TimeLayout:       "unix_ms",
+	    Columns:          map[string]string{"plan_name": "Plan", "internal_id": "-"},
+	    Types:            map[string]string{"price": "float", "tags": "list"},
+	}
+*/
+type CSVMapping struct {
+	// Event names every event, unless EventColumn is set.
+	Event       string
+	EventColumn string
+	// DistinctIDColumn is required.
+	DistinctIDColumn string
+	// TimeColumn is required for events, and sets $time for profiles.
+	TimeColumn string
+	// TimeLayout is "unix", "unix_ms" or a time.Parse layout, used for
+	// TimeColumn and the columns of type "time". time.RFC3339 by default.
+	TimeLayout string
+	// Location is used for layouts without a time zone, UTC by default.
+	Location *time.Location
+	// InsertIDColumn holds the $insert_id of the events. Without it one
+	// is derived from the row, so that importing a file twice does not
+	// create duplicates.
+	InsertIDColumn string
+	Columns        map[string]string
+	Types          map[string]string
+	// ListSeparator splits the values of "list" columns, "," by default.
+	ListSeparator string
+}
+
+// csvRow is a CSV record mapped by a CSVMapping.
+type csvRow struct {
+	event      string
+	distinctID string
+	insertID   string
+	time       time.Time
+	hasTime    bool
+	properties P
+}
+
+/*
+ImportEventsCSV imports the events of a CSV file through the import
+endpoint, batched and deduplicated like ImportFromReader. It needs the
+project API secret or a service account, see WithAPISecret and
+WithServiceAccount. Example:
+
+	f, _ := os.Open("orders.csv")
+	progress, err := mp.ImportEventsCSV(ctx, f, &CSVMapping{
+	    Event:            "Order Completed",
+	    DistinctIDColumn: "customer_id",
+	    TimeColumn:       "created_at",
+	    Types:            map[string]string{"total": "float"},
+	}, nil)
+
+Rows that cannot be mapped are counted as invalid and handed to
+opts.OnInvalid along with their line number; the rows of the events
+Mixpanel rejected are handed to opts.OnFailed the same way.
+*/
+func (mp *Mixpanel) ImportEventsCSV(ctx context.Context, r io.Reader, mapping *CSVMapping, opts *ImportOptions) (*ImportProgress, error) {
+	if opts == nil {
+		opts = &ImportOptions{}
+	}
+	if !mp.canImport() {
+		return nil, errors.New("mixpanel: importing needs the project API secret or a service account, see WithAPISecret")
+	}
+	if mapping.Event == "" && mapping.EventColumn == "" {
+		return nil, errors.New("mixpanel: CSV mapping needs an Event or an EventColumn")
+	}
+	if mapping.TimeColumn == "" {
+		return nil, errors.New("mixpanel: CSV mapping needs a TimeColumn to import events")
+	}
+
+	progress := &ImportProgress{}
+	send := func(batch [][]byte) (int, []FailedRecord, string, error) {
+		return mp.postImport(ctx, batch, opts.Strict)
+	}
+	encode := func(row *csvRow, record []string) ([]byte, error) {
+		if row.event == "" {
+			return nil, errors.New("missing event name")
+		}
+		if !row.hasTime {
+			return nil, errors.New("missing time")
+		}
+		if err := checkImportTime(row.time, mp.now()); err != nil {
+			return nil, err
+		}
+		properties := row.properties
+		properties["token"] = mp.GetToken()
+		properties["distinct_id"] = row.distinctID
+		properties["time"] = row.time
+		mp.setLib(properties)
+		if row.insertID == "" {
+			sum := sha1.Sum([]byte(strings.Join(record, "\x00")))
+			row.insertID = hex.EncodeToString(sum[:16])
+		}
+		properties[PropInsertID] = row.insertID
+		return mp.eventRecord("import", row.distinctID, row.event, &properties)
+	}
+	return progress, mp.importCSV(ctx, r, mapping, opts, progress, send, encode)
+}
+
+/*
+ImportProfilesCSV sets the properties of the profiles listed in a CSV
+file, one profile per row, sending the updates to the consumer in
+batches. When TimeColumn is set it gives the $time of the updates.
+*/
+func (mp *Mixpanel) ImportProfilesCSV(ctx context.Context, r io.Reader, mapping *CSVMapping, opts *ImportOptions) (*ImportProgress, error) {
+	if opts == nil {
+		opts = &ImportOptions{}
+	}
+
+	progress := &ImportProgress{}
+	send := func(batch [][]byte) (int, []FailedRecord, string, error) {
+		// the consumer reports the IDs of its own requests
+		if err := mp.sendBatch(ctx, "people", batch); err != nil {
+			return 0, nil, "", err
+		}
+		return len(batch), nil, "", nil
+	}
+	encode := func(row *csvRow, record []string) ([]byte, error) {
+		update := &P{
+			"$distinct_id": row.distinctID,
+			"$set":         &row.properties,
+		}
+		if row.hasTime {
+			(*update)["$time"] = row.time
+		}
+		return mp.peopleRecord(update)
+	}
+	return progress, mp.importCSV(ctx, r, mapping, opts, progress, send, encode)
+}
+
+// importCSV maps the rows of r, encodes them and sends them in batches.
+func (mp *Mixpanel) importCSV(ctx context.Context, r io.Reader, mapping *CSVMapping, opts *ImportOptions,
+	progress *ImportProgress, send func([][]byte) (int, []FailedRecord, string, error), encode func(*csvRow, []string) ([]byte, error)) error {
+	if mapping.DistinctIDColumn == "" {
+		return errors.New("mixpanel: CSV mapping needs a DistinctIDColumn")
+	}
+
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("mixpanel: cannot read CSV header: %v", err)
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+	for _, column := range []string{mapping.DistinctIDColumn, mapping.EventColumn, mapping.TimeColumn, mapping.InsertIDColumn} {
+		if column != "" && indexOf(header, column) < 0 {
+			return fmt.Errorf("mixpanel: CSV header has no %q column", column)
+		}
+	}
+
+	b := newBatcher(ctx, opts, progress, send)
+	source := func(record []string) []byte {
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.Write(record)
+		w.Flush()
+		return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+	}
+	invalid := func(line int, record []string, err error) {
+		b.invalid(line, source(record), err)
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return b.abort(err)
+		}
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if blankRecord(record) {
+			// blank lines, of spaces or empty cells, are not records
+			continue
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return b.abort(err)
+			}
+			if b.read() {
+				invalid(parseErr.Line, record, err)
+			}
+			continue
+		}
+		if !b.read() {
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+
+		row, err := mapping.row(header, record)
+		if err != nil {
+			invalid(line, record, err)
+			continue
+		}
+		data, err := encode(row, record)
+		if err != nil {
+			invalid(line, record, err)
+			continue
+		}
+		if data == nil {
+			// skipped by middleware
+			continue
+		}
+		if err := b.add(line, data, source(record)); err != nil {
+			return b.abort(err)
+		}
+	}
+	return b.close()
+}
+
+// blankRecord reports whether record, read from a line of spaces or of
+// empty cells only, has no value.
+func blankRecord(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return len(record) > 0
+}
+
+// row maps a CSV record according to the header.
+func (m *CSVMapping) row(header, record []string) (*csvRow, error) {
+	row := &csvRow{
+		event:      m.Event,
+		properties: make(P, len(record)),
+	}
+	for i, value := range record {
+		column := header[i]
+		// the columns left unset must not match the empty header cells
+		switch {
+		case m.DistinctIDColumn != "" && column == m.DistinctIDColumn:
+			row.distinctID = value
+			continue
+		case m.EventColumn != "" && column == m.EventColumn:
+			row.event = value
+			continue
+		case m.InsertIDColumn != "" && column == m.InsertIDColumn:
+			row.insertID = value
+			continue
+		case m.TimeColumn != "" && column == m.TimeColumn:
+			if value == "" {
+				continue
+			}
+			t, err := m.parseTime(value)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %v", column, err)
+			}
+			row.time, row.hasTime = t, true
+			continue
+		}
+
+		name := column
+		if renamed, ok := m.Columns[column]; ok {
+			name = renamed
+		}
+		if name == "-" || value == "" {
+			continue
+		}
+		v, err := m.coerce(m.Types[column], value)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %v", column, err)
+		}
+		row.properties[name] = v
+	}
+	if row.distinctID == "" {
+		return nil, errors.New("missing distinct_id")
+	}
+	return row, nil
+}
+
+// coerce converts a CSV value to the given type.
+func (m *CSVMapping) coerce(typ, value string) (interface{}, error) {
+	switch typ {
+	case "", "string":
+		return value, nil
+	case "int":
+		return strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	case "float":
+		return strconv.ParseFloat(strings.TrimSpace(value), 64)
+	case "bool":
+		return strconv.ParseBool(strings.TrimSpace(value))
+	case "time":
+		return m.parseTime(value)
+	case "list":
+		sep := m.ListSeparator
+		if sep == "" {
+			sep = ","
+		}
+		list := strings.Split(value, sep)
+		for i := range list {
+			list[i] = strings.TrimSpace(list[i])
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("unknown type %q", typ)
+}
+
+// parseTime parses a CSV value according to TimeLayout.
+func (m *CSVMapping) parseTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	switch m.TimeLayout {
+	case "unix":
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.UnixMilli(int64(seconds * 1000)).UTC(), nil
+	case "unix_ms":
+		ms, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.UnixMilli(ms).UTC(), nil
+	}
+	layout := m.TimeLayout
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	location := m.Location
+	if location == nil {
+		location = time.UTC
+	}
+	return time.ParseInLocation(layout, value, location)
+}
+
+func indexOf(list []string, s string) int {
+	for i, item := range list {
+		if item == s {
+			return i
+		}
+	}
+	return -1
+}
+
+/*
+ProfilesCSVOptions selects the profiles written by ExportProfilesCSV and
+their columns.
+
+Columns names the properties written after the distinct_id, in order;
+nested properties are named by their path, "address.city" for example.
+Headers, when set, gives the header of each column in place of its
+name. Query filters the profiles, all of them when nil.
+*/
+type ProfilesCSVOptions struct {
+	Columns []string
+	Headers []string
+	Query   *EngageQuery
+}
+
+/*
+ExportProfilesCSV writes the profiles matching opts.Query to w as CSV,
+one row per profile, with a header row and a column for the distinct_id
+and for each of opts.Columns. It pages through the engage query API,
+asking only for the selected properties, and returns the number of
+profiles written. Example:
+
+	n, err := q.ExportProfilesCSV(ctx, f, &ProfilesCSVOptions{
+	    Columns: []string{"$email", "$name", "Plan", "address.city"},
+	    Headers: []string{"Email", "Name", "Plan", "City"},
+	    Query:   &EngageQuery{Where: `properties["Plan"] == "Pro"`},
+	})
+
+Strings, numbers and booleans are written as is, times in TimeLayout;
+lists and objects are written as JSON and missing properties as empty
+cells.
+*/
+func (q *QueryClient) ExportProfilesCSV(ctx context.Context, w io.Writer, opts *ProfilesCSVOptions) (int, error) {
+	if len(opts.Columns) == 0 {
+		return 0, errors.New("mixpanel: ExportProfilesCSV needs Columns")
+	}
+	if opts.Headers != nil && len(opts.Headers) != len(opts.Columns) {
+		return 0, errors.New("mixpanel: ExportProfilesCSV needs a header for every column")
+	}
+	query := EngageQuery{}
+	if opts.Query != nil {
+		query = *opts.Query
+	}
+	if query.OutputProperties == nil {
+		seen := map[string]bool{}
+		for _, column := range opts.Columns {
+			top := strings.SplitN(column, ".", 2)[0]
+			if !seen[top] {
+				seen[top] = true
+				query.OutputProperties = append(query.OutputProperties, top)
+			}
+		}
+	}
+
+	cw := csv.NewWriter(w)
+	headers := opts.Headers
+	if headers == nil {
+		headers = opts.Columns
+	}
+	cw.Write(append([]string{"distinct_id"}, headers...))
+	n := 0
+	it := q.Engage(ctx, &query)
+	record := make([]string, len(opts.Columns)+1)
+	for it.Next() {
+		p := it.Profile()
+		record[0] = p.DistinctID
+		for i, column := range opts.Columns {
+			record[i+1] = csvCell(lookupPath(p.Properties, column))
+		}
+		if err := cw.Write(record); err != nil {
+			return n, err
+		}
+		n++
+	}
+	cw.Flush()
+	if err := it.Err(); err != nil {
+		return n, err
+	}
+	return n, cw.Error()
+}
+
+// lookupPath returns the property of p at path, a property name or the
+// dotted path of a nested property.
+func lookupPath(p P, path string) interface{} {
+	if v, ok := p[path]; ok {
+		return v
+	}
+	head, rest, found := strings.Cut(path, ".")
+	if !found {
+		return nil
+	}
+	switch v := p[head].(type) {
+	case P:
+		return lookupPath(v, rest)
+	case map[string]interface{}:
+		return lookupPath(P(v), rest)
+	}
+	return nil
+}
+
+// csvCell formats a property for a CSV cell.
+func csvCell(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.UTC().Format(TimeLayout)
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
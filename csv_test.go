@@ -0,0 +1,180 @@
+package mixpanel
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestImportEventsCSV(t *testing.T) {
+	var events []Event
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var batch []Event
+		if err := json.NewDecoder(gz).Decode(&batch); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, batch...)
+		fmt.Fprintf(w, `{"code": 200, "num_records_imported": %d, "status": "OK"}`, len(batch))
+	}))
+	defer ts.Close()
+
+	input := "user,action,ts,price,tags,internal\n" +
+		"u1,Purchase,1704067200000,9.99,\"a, b\",x\n" +
+		"u2,Refund,1704067260000,oops,,y\n" +
+		"\n" +
+		" ,,,,,\n" +
+		",Purchase,1704067320000,1,,z\n" +
+		"u3,Purchase,1704067380000,,c,w\n"
+	mp := NewMixpanel(token, WithAPIHost(ts.URL), WithAPISecret("secret"))
+	var invalid []int
+	progress, err := mp.ImportEventsCSV(context.Background(), strings.NewReader(input), &CSVMapping{
+		EventColumn:      "action",
+		DistinctIDColumn: "user",
+		TimeColumn:       "ts",
+		TimeLayout:       "unix_ms",
+		Columns:          map[string]string{"price": "Price", "internal": "-"},
+		Types:            map[string]string{"price": "float", "tags": "list"},
+	}, &ImportOptions{
+		OnInvalid: func(line int, data []byte, err error) { invalid = append(invalid, line) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.Read != 4 || progress.Imported != 2 || progress.Invalid != 2 || fmt.Sprint(invalid) != "[3 6]" {
+		t.Errorf("Unexpected progress %+v, invalid lines %v", progress, invalid)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events got %v", events)
+	}
+	props := *events[0].Properties
+	if events[0].Event != "Purchase" || props["distinct_id"] != "u1" || props["time"] != float64(1704067200) ||
+		props["Price"] != 9.99 || fmt.Sprint(props["tags"]) != "[a b]" {
+		t.Errorf("Unexpected event %v %v", events[0].Event, props)
+	}
+	if _, ok := props["internal"]; ok {
+		t.Errorf("Expected the ignored column to be left out, got %v", props)
+	}
+	if props[PropInsertID] == nil || props[PropInsertID] == (*events[1].Properties)[PropInsertID] {
+		t.Errorf("Expected distinct insert ids, got %v", props[PropInsertID])
+	}
+}
+
+func TestImportEventsCSVEmptyHeader(t *testing.T) {
+	var events []Event
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gz, _ := gzip.NewReader(r.Body)
+		var batch []Event
+		json.NewDecoder(gz).Decode(&batch)
+		events = append(events, batch...)
+		fmt.Fprintf(w, `{"code": 200, "num_records_imported": %d, "status": "OK"}`, len(batch))
+	}))
+	defer ts.Close()
+
+	// a trailing comma leaves an empty header cell
+	input := "user,ts,\n" +
+		"u1,1704067200000,\n"
+	mp := NewMixpanel(token, WithAPIHost(ts.URL), WithAPISecret("secret"))
+	progress, err := mp.ImportEventsCSV(context.Background(), strings.NewReader(input), &CSVMapping{
+		Event:            "Signed Up",
+		DistinctIDColumn: "user",
+		TimeColumn:       "ts",
+		TimeLayout:       "unix_ms",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.Imported != 1 || len(events) != 1 || events[0].Event != "Signed Up" {
+		t.Errorf("Expected the fixed event, got %+v and %v", progress, events)
+	}
+}
+
+func TestImportProfilesCSV(t *testing.T) {
+	rs := newRecordingServer()
+	defer rs.Close()
+	c := NewStdConsumer()
+	c.endpoints = rs.endpoints()
+	mp := NewMixpanelWithConsumer(token, c)
+
+	input := "\ufeffid,name,age,vip,signed_up\n" +
+		"u1,Ada,36,true,2024-01-01 10:00\n" +
+		"u2,Bob,,false,2024-02-01 11:30\n"
+	progress, err := mp.ImportProfilesCSV(context.Background(), strings.NewReader(input), &CSVMapping{
+		DistinctIDColumn: "id",
+		Columns:          map[string]string{"name": PropName},
+		Types:            map[string]string{"age": "int", "vip": "bool", "signed_up": "time"},
+		TimeLayout:       "2006-01-02 15:04",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.Imported != 2 || progress.Batches != 1 {
+		t.Errorf("Unexpected progress %+v", progress)
+	}
+
+	payloads := rs.Payloads()
+	if len(payloads) != 1 {
+		t.Fatalf("Expected a single batch got %v", payloads)
+	}
+	var updates []map[string]interface{}
+	if err := json.Unmarshal([]byte(payloads[0]), &updates); err != nil {
+		t.Fatal(err)
+	}
+	set := updates[0]["$set"].(map[string]interface{})
+	if updates[0]["$distinct_id"] != "u1" || set[PropName] != "Ada" || set["age"] != float64(36) ||
+		set["vip"] != true || set["signed_up"] != "2024-01-01T10:00:00" {
+		t.Errorf("Unexpected update %v", updates[0])
+	}
+	if _, ok := updates[1]["$set"].(map[string]interface{})["age"]; ok {
+		t.Errorf("Expected empty cells to be left out, got %v", updates[1])
+	}
+}
+
+func TestExportProfilesCSV(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("output_properties") != `["$email","Plan","address"]` {
+			t.Errorf("Unexpected output_properties %q", r.Form.Get("output_properties"))
+		}
+		switch r.Form.Get("page") {
+		case "":
+			fmt.Fprint(w, `{"page": 0, "page_size": 1, "session_id": "s1", "total": 2, "results": [
+				{"$distinct_id": "a", "$properties": {"$email": "a@example.com", "Plan": "Pro, yearly",
+					"address": {"city": "Paris"}}}]}`)
+		case "1":
+			fmt.Fprint(w, `{"page": 1, "page_size": 1000, "session_id": "s1", "total": 2, "results": [
+				{"$distinct_id": "b", "$properties": {"Plan": ["Free"], "address": {}}}]}`)
+		default:
+			t.Errorf("Unexpected page %s", r.Form.Get("page"))
+		}
+	}))
+	defer ts.Close()
+
+	q := NewQueryClient("secret")
+	q.Endpoint = ts.URL
+	var buf strings.Builder
+	n, err := q.ExportProfilesCSV(context.Background(), &buf, &ProfilesCSVOptions{
+		Columns: []string{"$email", "Plan", "address.city"},
+		Headers: []string{"Email", "Plan", "City"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "distinct_id,Email,Plan,City\n" +
+		"a,a@example.com,\"Pro, yearly\",Paris\n" +
+		"b,,\"[\"\"Free\"\"]\",\n"
+	if n != 2 || buf.String() != expected {
+		t.Errorf("Expected 2 profiles\n%s\ngot %d\n%s", expected, n, buf.String())
+	}
+	if _, err := q.ExportProfilesCSV(context.Background(), &buf, &ProfilesCSVOptions{}); err == nil {
+		t.Error("Expected an error without columns")
+	}
+}
@@ -0,0 +1,93 @@
+package mixpanel
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+/*
+WithDedupe drops the events already tracked within the last window, so
+that at-least-once pipelines redelivering an event do not track it
+twice, even without the strict mode of the import endpoint.
+
+Events with a $insert_id are the same when their name, distinct_id and
+$insert_id are. Other events are compared by content: the same name,
+distinct_id and properties, their time and token aside. Dropped events
+are not reported as errors. Example:
+
+	mp := NewMixpanel(token, WithDedupe(10*time.Minute))
+
+The events of the window are remembered in memory, by a hash of their
+key, and expire by the clock of WithClock. An event counts as seen once
+it went through the middleware, even when its delivery then fails:
+retry failed calls at the consumer level.
+*/
+func WithDedupe(window time.Duration) Option {
+	d := &deduper{window: window, seen: make(map[[sha256.Size]byte]struct{})}
+	return func(mp *Mixpanel) {
+		mp.middleware = append(mp.middleware, func(msg *Message) error {
+			if !msg.IsEvent() {
+				return nil
+			}
+			if d.seenBefore(dedupeKey(msg), mp.now()) {
+				return ErrSkipped
+			}
+			return nil
+		})
+	}
+}
+
+// dedupeKey returns the hash identifying msg for WithDedupe.
+func dedupeKey(msg *Message) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write([]byte(msg.Event + "\x00" + msg.DistinctID + "\x00"))
+	if id, ok := (*msg.Properties)[PropInsertID]; ok && id != "" {
+		json.NewEncoder(h).Encode(id)
+	} else {
+		props := make(P, len(*msg.Properties))
+		for key, value := range *msg.Properties {
+			if key != PropTime && key != PropToken {
+				props[key] = value
+			}
+		}
+		// maps are encoded with sorted keys
+		json.NewEncoder(h).Encode(props)
+	}
+	var key [sha256.Size]byte
+	h.Sum(key[:0])
+	return key
+}
+
+// deduper remembers the keys seen within a window, expiring them in the
+// order they were seen.
+type deduper struct {
+	window time.Duration
+
+	mu    sync.Mutex
+	seen  map[[sha256.Size]byte]struct{}
+	queue []dedupeEntry
+}
+
+type dedupeEntry struct {
+	key     [sha256.Size]byte
+	expires time.Time
+}
+
+// seenBefore records key at now and reports whether it was already seen
+// within the window.
+func (d *deduper) seenBefore(key [sha256.Size]byte, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for len(d.queue) > 0 && !d.queue[0].expires.After(now) {
+		delete(d.seen, d.queue[0].key)
+		d.queue = d.queue[1:]
+	}
+	if _, ok := d.seen[key]; ok {
+		return true
+	}
+	d.seen[key] = struct{}{}
+	d.queue = append(d.queue, dedupeEntry{key, now.Add(d.window)})
+	return false
+}
@@ -0,0 +1,81 @@
+package mixpanel
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithDedupe(t *testing.T) {
+	var buf bytes.Buffer
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf), WithDedupe(time.Minute))
+
+	for _, call := range []struct {
+		id, event string
+		props     *P
+	}{
+		{"u1", "Purchase", &P{PropInsertID: "a1", "amount": 10}},
+		{"u1", "Purchase", &P{PropInsertID: "a1", "amount": 12}},
+		{"u1", "Purchase", &P{PropInsertID: "a2", "amount": 10}},
+		{"u1", "Viewed", &P{"page": "/", "time": 1}},
+		{"u1", "Viewed", &P{"page": "/", "time": 2}},
+		{"u2", "Viewed", &P{"page": "/"}},
+		{"u1", "Viewed", &P{"page": "/pricing"}},
+	} {
+		if err := mp.Track(call.id, call.event, call.props); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mp.PeopleSet("u1", &P{"plan": "pro"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := mp.PeopleSet("u1", &P{"plan": "pro"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 7 {
+		t.Errorf("Expected 5 events and 2 people updates got %s", buf.String())
+	}
+}
+
+func TestDeduperWindow(t *testing.T) {
+	d := &deduper{window: time.Minute, seen: make(map[[32]byte]struct{})}
+	now := time.Now()
+	a, b := [32]byte{1}, [32]byte{2}
+	for _, step := range []struct {
+		key  [32]byte
+		at   time.Duration
+		want bool
+	}{
+		{a, 0, false},
+		{a, 30 * time.Second, true},
+		{b, 45 * time.Second, false},
+		{a, time.Minute, false},
+		{b, 90 * time.Second, true},
+		{b, 105 * time.Second, false},
+	} {
+		if got := d.seenBefore(step.key, now.Add(step.at)); got != step.want {
+			t.Errorf("%x at %v: expected %v got %v", step.key[0], step.at, step.want, got)
+		}
+	}
+	if len(d.seen) != 2 || len(d.queue) != 2 {
+		t.Errorf("Expected the expired keys to be forgotten got %d keys and %d entries", len(d.seen), len(d.queue))
+	}
+}
+
+func TestWithDedupeClock(t *testing.T) {
+	var buf bytes.Buffer
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf), WithDedupe(time.Minute),
+		WithClock(ClockFunc(func() time.Time { return now })))
+
+	for _, advance := range []time.Duration{0, 30 * time.Second, time.Minute} {
+		now = now.Add(advance)
+		if err := mp.Track("u1", "Purchase", &P{PropInsertID: "a1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 2 {
+		t.Errorf("Expected the event again once the clock passed the window, got %s", buf.String())
+	}
+}
@@ -0,0 +1,100 @@
+package mixpanel
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// ErrNoDefault is returned by the package-level functions before Init.
+var ErrNoDefault = errors.New("mixpanel: no default client, call Init first")
+
+var defaultClient atomic.Pointer[Mixpanel]
+
+/*
+Init creates the default client used by the package-level functions,
+Track, PeopleSet and friends, for small programs that do not want to
+hand a client around:
+
+	func main() {
+	    mixpanel.Init(token, mixpanel.WithSignalFlush(0, true))
+	    defer mixpanel.Close(context.Background())
+	    mixpanel.Track("12345", "Signed Up", nil)
+	}
+
+The package-level functions are safe for concurrent use, including with
+Init; a client replaced by Init is not closed.
+*/
+func Init(token string, opts ...Option) *Mixpanel {
+	mp := NewMixpanel(token, opts...)
+	SetDefault(mp)
+	return mp
+}
+
+// SetDefault replaces the default client, for one built with
+// NewMixpanelWithConsumer for example.
+func SetDefault(mp *Mixpanel) {
+	defaultClient.Store(mp)
+}
+
+// Default returns the default client, nil before Init.
+func Default() *Mixpanel {
+	return defaultClient.Load()
+}
+
+// Track tracks an event with the default client, see Mixpanel.Track.
+func Track(distinct_id, event string, prop *P) error {
+	mp := Default()
+	if mp == nil {
+		return ErrNoDefault
+	}
+	return mp.Track(distinct_id, event, prop)
+}
+
+// PeopleSet sets properties of a profile with the default client, see
+// Mixpanel.PeopleSet.
+func PeopleSet(id string, properties *P) error {
+	mp := Default()
+	if mp == nil {
+		return ErrNoDefault
+	}
+	return mp.PeopleSet(id, properties)
+}
+
+// PeopleSetOnce sets properties of a profile, unless they are set, with
+// the default client, see Mixpanel.PeopleSetOnce.
+func PeopleSetOnce(id string, properties *P) error {
+	mp := Default()
+	if mp == nil {
+		return ErrNoDefault
+	}
+	return mp.PeopleSetOnce(id, properties)
+}
+
+// PeopleIncrement increments properties of a profile with the default
+// client, see Mixpanel.PeopleIncrement.
+func PeopleIncrement(id string, properties *P) error {
+	mp := Default()
+	if mp == nil {
+		return ErrNoDefault
+	}
+	return mp.PeopleIncrement(id, properties)
+}
+
+// Flush flushes the consumer of the default client.
+func Flush(ctx context.Context) error {
+	mp := Default()
+	if mp == nil {
+		return ErrNoDefault
+	}
+	return mp.Flush(ctx)
+}
+
+// Close closes the consumer of the default client.
+func Close(ctx context.Context) error {
+	mp := Default()
+	if mp == nil {
+		return ErrNoDefault
+	}
+	return mp.Close(ctx)
+}
@@ -0,0 +1,37 @@
+package mixpanel
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDefault(t *testing.T) {
+	defer SetDefault(nil)
+
+	SetDefault(nil)
+	if err := Track("13793", "Signed Up", nil); err != ErrNoDefault {
+		t.Errorf("Expected ErrNoDefault, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	SetDefault(NewMixpanelWithConsumer(token, NewWriterConsumer(&buf)))
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Track("13793", "Signed Up", nil)
+			PeopleIncrement("13793", &P{"Logins": 1})
+		}()
+	}
+	wg.Wait()
+	if n := strings.Count(buf.String(), "\n"); n != 20 {
+		t.Errorf("Expected 20 messages, got %d", n)
+	}
+
+	if mp := Init(token); Default() != mp {
+		t.Error("Expected Init to replace the default client")
+	}
+}
@@ -0,0 +1,207 @@
+package mixpanel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+DeliveryError is the error of messages a consumer failed to deliver in
+the background, where no caller gets the error back: the flushes of a
+BuffConsumer and the deliveries of an AsyncConsumer. Messages are the
+JSON payloads that were lost, which applications can store to resend
+them later. Err is the error of the request, see errors.As:
+
+	mp := NewMixpanelWithConsumer(token, NewBuffConsumer(50), WithErrorHandler(func(err error) {
+	    var de *DeliveryError
+	    if errors.As(err, &de) {
+	        alert("lost %d messages to %s: %v", len(de.Messages), de.Endpoint, de.Err)
+	    }
+	}))
+*/
+type DeliveryError struct {
+	Endpoint string
+	Messages [][]byte
+	Err      error
+	// Retained reports that the messages were kept to be sent again by
+	// the next flush, as BuffConsumer does on transient failures, rather
+	// than lost.
+	Retained bool
+}
+
+func (e *DeliveryError) Error() string {
+	if e.Retained {
+		return fmt.Sprintf("mixpanel: failed to deliver %d messages to %s, retained for the next flush: %v", len(e.Messages), e.Endpoint, e.Err)
+	}
+	return fmt.Sprintf("mixpanel: failed to deliver %d messages to %s: %v", len(e.Messages), e.Endpoint, e.Err)
+}
+
+func (e *DeliveryError) Unwrap() error {
+	return e.Err
+}
+
+// deliveryErrors splits err, as joined by BuffConsumer.Flush, into its
+// DeliveryErrors and the other errors.
+func deliveryErrors(err error) (delivery []*DeliveryError, other []error) {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, err := range joined.Unwrap() {
+			d, o := deliveryErrors(err)
+			delivery, other = append(delivery, d...), append(other, o...)
+		}
+		return delivery, other
+	}
+	var de *DeliveryError
+	if errors.As(err, &de) {
+		return []*DeliveryError{de}, nil
+	}
+	if err != nil {
+		other = append(other, err)
+	}
+	return delivery, other
+}
+
+/*
+WithErrorHandler hands the errors of the background deliveries of the
+consumer to fn, rather than logging them, so that applications can
+alert on lost messages. It is handed to the consumer when it has a
+SetErrorHandler method, as BuffConsumer and AsyncConsumer do; fn is
+called with *DeliveryError errors, from the goroutine delivering the
+messages, and must not block for long.
+*/
+func WithErrorHandler(fn func(err error)) Option {
+	return func(mp *Mixpanel) {
+		if c, ok := findConsumer[interface{ SetErrorHandler(func(error)) }](mp.c); ok {
+			c.SetErrorHandler(fn)
+		}
+	}
+}
+
+// errorHandler holds the handler of the background errors of a
+// consumer, logging them when there is none.
+type errorHandler struct {
+	fn atomic.Pointer[func(error)]
+}
+
+func (h *errorHandler) set(fn func(error)) {
+	if fn == nil {
+		h.fn.Store(nil)
+		return
+	}
+	h.fn.Store(&fn)
+}
+
+func (h *errorHandler) report(err error) {
+	if fn := h.fn.Load(); fn != nil {
+		(*fn)(err)
+		return
+	}
+	log.Print(err)
+}
+
+// Delivery results of the messages that did not reach Mixpanel, given to
+// the callbacks of TrackWithCallback.
+var (
+	// ErrDropped is the result of messages an AsyncConsumer discarded as
+	// its queue was full, or a BuffConsumer as its buffer grew beyond
+	// BuffConfig.MaxRetained during an outage.
+	ErrDropped = errors.New("mixpanel: message dropped, the queue is full")
+	// ErrSpooled is the result of messages written to disk by a
+	// SpoolConsumer or an AsyncConsumer, to be resent later.
+	ErrSpooled = errors.New("mixpanel: message spooled to be resent later")
+)
+
+/*
+TrackWithCallback tracks an event like Track, and calls done with the
+outcome of its delivery, once known: nil when Mixpanel accepted it, the
+error of the request otherwise, or ErrDropped or ErrSpooled. With a
+BuffConsumer or an AsyncConsumer that is after the event has been
+flushed, from the goroutine flushing it, so that critical events such as
+purchases can be confirmed or escalated:
+
+	mp.TrackWithCallback(userID, "Purchase", &P{"Amount": 49.9}, func(err error) {
+	    if err != nil {
+	        escalate(orderID, err)
+	    }
+	})
+
+done is called exactly once, right away for events dropped by the
+middleware, with nil, or failing before being sent; it must not block
+for long, as deliveries wait for it. Behind a MultiConsumer, the outcome
+is the one of the first consumer buffering the event, if any.
+*/
+func (mp *Mixpanel) TrackWithCallback(distinct_id, event string, prop *P, done func(err error)) error {
+	data, err := mp.eventRecord("events", distinct_id, event, mp.eventProperties(distinct_id, prop))
+	if data == nil || !mp.Enabled() {
+		done(err)
+		return err
+	}
+	ctx := context.Background()
+	if mp.isPriority(event) {
+		ctx = withPriority(ctx)
+	}
+	return sendWithDelivery(ctx, mp.c, "events", [][]byte{data}, done)
+}
+
+type deliveryKey struct{}
+
+// delivery is the callback of the messages of a call to Send, which the
+// first consumer keeping them for later claims, to call it once they
+// are delivered.
+type delivery struct {
+	claimed atomic.Bool
+	done    func(error)
+}
+
+/*
+sendWithDelivery sends msgs to c and calls done with the outcome of
+their delivery: the error of Send, unless a consumer claimed the
+callback to call it later, see claimDelivery.
+*/
+func sendWithDelivery(ctx context.Context, c Consumer, endpoint string, msgs [][]byte, done func(error)) error {
+	if done == nil {
+		return c.Send(ctx, endpoint, msgs)
+	}
+	d := &delivery{done: done}
+	err := c.Send(context.WithValue(ctx, deliveryKey{}, d), endpoint, msgs)
+	if d.claimed.CompareAndSwap(false, true) {
+		done(err)
+	}
+	return err
+}
+
+// claimDelivery returns the delivery callback of the messages sent with
+// ctx, nil when there is none or another consumer claimed it. The caller
+// must call it exactly once.
+func claimDelivery(ctx context.Context) func(error) {
+	d, _ := ctx.Value(deliveryKey{}).(*delivery)
+	if d == nil || !d.claimed.CompareAndSwap(false, true) {
+		return nil
+	}
+	return d.done
+}
+
+// countdown returns a callback calling done, when not nil, once it has
+// been called n times, with the first error.
+func countdown(done func(error), n int) func(error) {
+	if done == nil {
+		return nil
+	}
+	var mu sync.Mutex
+	var first error
+	return func(err error) {
+		mu.Lock()
+		n--
+		if first == nil {
+			first = err
+		}
+		last := n == 0
+		mu.Unlock()
+		if last {
+			done(first)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package mixpanel
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBuffConsumerErrorHandler(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": 0, "error": "invalid data"}`))
+	}))
+	defer ts.Close()
+
+	var errs []error
+	mp := NewMixpanelWithConsumer(token, NewBuffConsumer(1), WithAPIHost(ts.URL), WithErrorHandler(func(err error) {
+		errs = append(errs, err)
+	}))
+	mp.Track("13793", "Signed Up", nil)
+	mp.Track("13793", "Logged In", nil)
+
+	if len(errs) != 1 {
+		t.Fatalf("Expected 1 delivery error, got %v", errs)
+	}
+	var de *DeliveryError
+	if !errors.As(errs[0], &de) {
+		t.Fatalf("Expected a *DeliveryError, got %T", errs[0])
+	}
+	if de.Endpoint != "events" || len(de.Messages) != 1 || !strings.Contains(string(de.Messages[0]), `"Signed Up"`) {
+		t.Errorf("Unexpected delivery error %+v", de)
+	}
+}
+
+func TestBuffConsumerFlushErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": 0, "error": "invalid data"}`))
+	}))
+	defer ts.Close()
+
+	bc := NewBuffConsumer(10)
+	bc.SetAPIHost(ts.URL)
+	bc.SetErrorHandler(func(error) {})
+	ctx := context.Background()
+	bc.Send(ctx, "events", [][]byte{[]byte(`{"n":1}`)})
+	bc.Send(ctx, "people", [][]byte{[]byte(`{"n":2}`), []byte(`{"n":3}`)})
+
+	err := bc.Flush(ctx)
+	if err == nil {
+		t.Fatal("Expected the errors of the endpoints")
+	}
+	var errs []*DeliveryError
+	for _, err := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var de *DeliveryError
+		if !errors.As(err, &de) {
+			t.Fatalf("Expected a *DeliveryError, got %v", err)
+		}
+		errs = append(errs, de)
+	}
+	if len(errs) != 2 || errs[0].Endpoint != "events" || len(errs[0].Messages) != 1 ||
+		errs[1].Endpoint != "people" || len(errs[1].Messages) != 2 {
+		t.Fatalf("Expected an error per endpoint, got %v", err)
+	}
+	if errs[0].Retained || errs[1].Retained {
+		t.Errorf("Expected the rejected messages to be dropped, got %v", err)
+	}
+	if err := bc.Close(ctx); err != nil {
+		t.Errorf("Expected nothing left to flush, got %v", err)
+	}
+}
+
+func TestBuffConsumerRetainsFailedBatches(t *testing.T) {
+	var requests atomic.Int32
+	var data []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		r.ParseForm()
+		payload, _ := base64.URLEncoding.DecodeString(r.Form.Get("data"))
+		data = append(data, string(payload))
+		w.Write([]byte(`{"status": 1, "error": null}`))
+	}))
+	defer ts.Close()
+
+	bc := NewBuffConsumer(10)
+	bc.SetAPIHost(ts.URL)
+	bc.SetErrorHandler(func(error) {})
+	var attempts []int
+	bc.AfterSend(func(info *SendInfo) {
+		attempts = append(attempts, info.Attempt)
+	})
+	ctx := context.Background()
+	bc.Send(ctx, "events", [][]byte{[]byte(`{"n":1}`)})
+
+	var de *DeliveryError
+	if err := bc.Flush(ctx); !errors.As(err, &de) || !de.Retained || de.Endpoint != "events" {
+		t.Fatalf("Expected the batch to be retained, got %v", err)
+	}
+	bc.Send(ctx, "events", [][]byte{[]byte(`{"n":2}`)})
+	if err := bc.Flush(ctx); err != nil {
+		t.Fatalf("Expected the retry to succeed, got %v", err)
+	}
+	if len(data) != 1 || data[0] != `[{"n":1},{"n":2}]` {
+		t.Errorf("Expected the retained message before the new one, got %q", data)
+	}
+	bc.Send(ctx, "events", [][]byte{[]byte(`{"n":3}`)})
+	bc.Flush(ctx)
+	if !reflect.DeepEqual(attempts, []int{1, 2, 1}) {
+		t.Errorf("Expected the retry to be the second attempt, got %v", attempts)
+	}
+}
+
+func TestBuffConsumerFlushesRetainedInBatches(t *testing.T) {
+	var requests atomic.Int32
+	var batches [][]json.RawMessage
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		r.ParseForm()
+		payload, _ := base64.URLEncoding.DecodeString(r.Form.Get("data"))
+		var msgs []json.RawMessage
+		if json.Unmarshal(payload, &msgs) != nil {
+			msgs = []json.RawMessage{payload}
+		}
+		batches = append(batches, msgs)
+		w.Write([]byte(`{"status": 1, "error": null}`))
+	}))
+	defer ts.Close()
+
+	bc := NewBuffConsumerWithConfig(BuffConfig{BatchSize: 5})
+	bc.SetAPIHost(ts.URL)
+	bc.SetErrorHandler(func(error) {})
+	ctx := context.Background()
+	for i := 0; i < 23; i++ {
+		bc.Send(ctx, "events", [][]byte{[]byte(fmt.Sprintf(`{"n":%d}`, i))})
+	}
+	if n := bc.Retained(); n != 5 {
+		t.Fatalf("Expected the failed batch to be retained, got %d retained messages", n)
+	}
+	if err := bc.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	for _, batch := range batches {
+		if len(batch) > 5 {
+			t.Errorf("Expected batches of at most 5 messages, got %d", len(batch))
+		}
+		for _, msg := range batch {
+			if want := fmt.Sprintf(`{"n":%d}`, n); string(msg) != want {
+				t.Fatalf("Expected %s, got %s", want, msg)
+			}
+			n++
+		}
+	}
+	if n != 23 || bc.Len() != 0 {
+		t.Errorf("Expected the buffer to be drained, got %d messages delivered and %d buffered", n, bc.Len())
+	}
+}
+
+func TestBuffConsumerRetentionLimit(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	bc := NewBuffConsumerWithConfig(BuffConfig{BatchSize: 10, MaxRetained: 2})
+	bc.SetAPIHost(ts.URL)
+	bc.SetErrorHandler(func(error) {})
+	ctx := context.Background()
+	results := make([]error, 3)
+	for i := range results {
+		i := i
+		msg := []byte(fmt.Sprintf(`{"n":%d}`, i))
+		sendWithDelivery(ctx, bc, "events", [][]byte{msg}, func(err error) {
+			results[i] = err
+		})
+	}
+
+	if err := bc.Flush(ctx); err == nil {
+		t.Fatal("Expected the flush to fail")
+	}
+	if n := bc.Retained(); n != 2 {
+		t.Errorf("Expected 2 retained messages, got %d", n)
+	}
+	if s := bc.Stats(); s.Retained != 2 || s.Queued != 2 {
+		t.Errorf("Expected the retained messages in the stats, got %+v", s)
+	}
+	var de *DeliveryError
+	if !errors.As(results[0], &de) || de.Retained || string(de.Messages[0]) != `{"n":0}` {
+		t.Errorf("Expected the oldest message to be dropped, got %v", results[0])
+	}
+	if results[1] != nil || results[2] != nil {
+		t.Errorf("Expected the retained messages to be pending, got %v", results[1:])
+	}
+}
+
+func TestBuffConsumerBacksOffAfterFailure(t *testing.T) {
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = time.Millisecond
+	var requests, received atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		r.ParseForm()
+		payload, _ := base64.URLEncoding.DecodeString(r.Form.Get("data"))
+		var msgs []json.RawMessage
+		if json.Unmarshal(payload, &msgs) != nil {
+			msgs = []json.RawMessage{payload}
+		}
+		received.Add(int32(len(msgs)))
+		w.Write([]byte(`{"status": 1, "error": null}`))
+	}))
+	defer ts.Close()
+
+	bc := NewBuffConsumerWithConfig(BuffConfig{BatchSize: 10, MaxRetained: 20})
+	bc.SetAPIHost(ts.URL)
+	var dropped atomic.Int32
+	bc.SetErrorHandler(func(err error) {
+		var de *DeliveryError
+		if errors.As(err, &de) && !de.Retained {
+			dropped.Add(int32(len(de.Messages)))
+		}
+	})
+	ctx := context.Background()
+	for i := 0; i < 5000; i++ {
+		bc.Send(ctx, "events", [][]byte{[]byte(fmt.Sprintf(`{"n":%d}`, i))})
+		if n := bc.Len(); n > 30 {
+			t.Fatalf("Expected at most 30 buffered messages after %d sends, got %d", i+1, n)
+		}
+	}
+	if n := requests.Load(); n < 2 {
+		t.Errorf("Expected the delivery to resume before Close, got %d requests", n)
+	}
+	if err := bc.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := received.Load() + dropped.Load(); n != 5000 {
+		t.Errorf("Expected every message delivered or dropped, got %d delivered and %d dropped", received.Load(), dropped.Load())
+	}
+}
+
+func TestAsyncConsumerErrorHandler(t *testing.T) {
+	errs := make(chan error, 1)
+	mp := NewMixpanelWithConsumer(token, &failingConsumer{}, WithAsync(AsyncConfig{}), WithErrorHandler(func(err error) {
+		errs <- err
+	}))
+	mp.Track("13793", "Signed Up", nil)
+	mp.Close(context.Background())
+
+	var de *DeliveryError
+	if err := <-errs; !errors.As(err, &de) || de.Err.Error() != "unavailable" {
+		t.Fatalf("Expected a *DeliveryError wrapping the send error, got %v", err)
+	}
+	if len(de.Messages) != 1 || !strings.Contains(string(de.Messages[0]), `"Signed Up"`) {
+		t.Errorf("Expected the lost event, got %q", de.Messages)
+	}
+}
+
+func TestTrackWithCallback(t *testing.T) {
+	rs := newRecordingServer()
+	defer rs.Close()
+
+	results := map[string]error{}
+	record := func(name string) func(error) {
+		return func(err error) {
+			if _, ok := results[name]; ok {
+				t.Errorf("Callback of %s called twice", name)
+			}
+			results[name] = err
+		}
+	}
+
+	mp := NewMixpanel(token, WithAPIHost(rs.URL))
+	mp.TrackWithCallback("13793", "Purchase", nil, record("std"))
+
+	mp = NewMixpanel(token, WithMiddleware(func(msg *Message) error { return ErrSkipped }))
+	mp.TrackWithCallback("13793", "Purchase", nil, record("skipped"))
+
+	mp = NewMixpanelWithConsumer(token, &failingConsumer{})
+	mp.TrackWithCallback("13793", "Purchase", nil, record("failing"))
+
+	mp = NewMixpanelWithConsumer(token, NewBuffConsumer(10), WithAPIHost(rs.URL))
+	mp.TrackWithCallback("13793", "Purchase", nil, record("buffered"))
+	if _, ok := results["buffered"]; ok {
+		t.Fatal("Expected the buffered event to be confirmed by the flush")
+	}
+	mp.Flush(context.Background())
+
+	if results["std"] != nil || results["skipped"] != nil || results["buffered"] != nil {
+		t.Errorf("Expected delivered events, got %v", results)
+	}
+	if err := results["failing"]; err == nil || err.Error() != "unavailable" {
+		t.Errorf("Expected the send error, got %v", err)
+	}
+	if len(rs.Payloads()) != 2 {
+		t.Errorf("Expected 2 requests, got %q", rs.Payloads())
+	}
+}
+
+func TestTrackWithCallbackAsync(t *testing.T) {
+	results := make(chan error, 3)
+	done := func(err error) { results <- err }
+
+	mp := NewMixpanelWithConsumer(token, &failingConsumer{}, WithAsync(AsyncConfig{}))
+	mp.TrackWithCallback("13793", "Purchase", nil, done)
+	mp.Close(context.Background())
+	if err := <-results; err == nil || err.Error() != "unavailable" {
+		t.Errorf("Expected the send error, got %v", err)
+	}
+
+	var buf strings.Builder
+	mp = NewMixpanelWithConsumer(token, NewWriterConsumer(&buf), WithAsync(AsyncConfig{}))
+	mp.TrackWithCallback("13793", "Purchase", nil, done)
+	mp.Close(context.Background())
+	if err := <-results; err != nil {
+		t.Errorf("Expected a delivered event, got %v", err)
+	}
+
+	gate := make(chan struct{})
+	ac, _ := NewAsyncConsumer(&gatedConsumer{gate: gate}, AsyncConfig{QueueSize: 1, BatchSize: 1, Overflow: DropOldest})
+	mp = NewMixpanelWithConsumer(token, ac)
+	mp.Track("13793", "Sent", nil)
+	// wait for the worker to pick up the first event
+	for ac.Len() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	mp.TrackWithCallback("13793", "Purchase", nil, done)
+	mp.Track("13793", "Logged Out", nil)
+	if err := <-results; err != ErrDropped {
+		t.Errorf("Expected ErrDropped, got %v", err)
+	}
+	close(gate)
+	mp.Close(context.Background())
+}
@@ -0,0 +1,154 @@
+package mixpanel
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Defaults of DeviceCookie.
+const (
+	DefaultDeviceCookie    = "mp_device_id"
+	DefaultDeviceCookieAge = 365 * 24 * time.Hour
+)
+
+// NewDeviceID returns a random (version 4) UUID for an anonymous device.
+func NewDeviceID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// isDeviceID reports whether id looks like a UUID minted by NewDeviceID.
+func isDeviceID(id string) bool {
+	if len(id) != 36 {
+		return false
+	}
+	for i, c := range id {
+		switch {
+		case i == 8 || i == 13 || i == 18 || i == 23:
+			if c != '-' {
+				return false
+			}
+		case !('0' <= c && c <= '9' || 'a' <= c && c <= 'f'):
+			return false
+		}
+	}
+	return true
+}
+
+/*
+DeviceCookie keeps the anonymous $device_id of a visitor in a cookie, so
+that server-rendered applications can track visitors before they sign
+up, then tie their anonymous history to their account:
+
+	var devices mixpanel.DeviceCookie
+
+	func page(w http.ResponseWriter, r *http.Request) {
+	    device := devices.Ensure(w, r)
+	    mp.Track(device, "Page Viewed", &mixpanel.P{mixpanel.PropDeviceID: device})
+	}
+
+	func signup(w http.ResponseWriter, r *http.Request) {
+	    user := createUser(r)
+	    devices.Identify(mp, r, user.ID)
+	}
+
+The zero value stores the cookie under DefaultDeviceCookie for
+DefaultDeviceCookieAge; Name, Domain and MaxAge override these. The
+cookie is HTTP only, so it never reaches scripts, and Secure adds the
+Secure attribute. IDs mints the ids instead of NewDeviceID when set.
+*/
+type DeviceCookie struct {
+	Name   string
+	Domain string
+	MaxAge time.Duration
+	Secure bool
+	IDs    IDGenerator
+}
+
+func (dc DeviceCookie) name() string {
+	if dc.Name == "" {
+		return DefaultDeviceCookie
+	}
+	return dc.Name
+}
+
+// DeviceID returns the $device_id of the cookie of r, an empty string if
+// there is none or it is not a UUID (any value goes when IDs is set).
+func (dc DeviceCookie) DeviceID(r *http.Request) string {
+	c, err := r.Cookie(dc.name())
+	if err != nil || c.Value == "" || (dc.IDs == nil && !isDeviceID(c.Value)) {
+		return ""
+	}
+	return c.Value
+}
+
+// Ensure returns the $device_id of the cookie of r, minting one and
+// setting the cookie on w when r has none. It must be called before the
+// response header is written.
+func (dc DeviceCookie) Ensure(w http.ResponseWriter, r *http.Request) string {
+	if id := dc.DeviceID(r); id != "" {
+		return id
+	}
+	id := NewDeviceID()
+	if dc.IDs != nil {
+		id = dc.IDs.NewID()
+	}
+	maxAge := dc.MaxAge
+	if maxAge == 0 {
+		maxAge = DefaultDeviceCookieAge
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     dc.name(),
+		Value:    id,
+		Path:     "/",
+		Domain:   dc.Domain,
+		MaxAge:   int(maxAge / time.Second),
+		Secure:   dc.Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return id
+}
+
+// Identify ties the $device_id of the cookie of r to user_id, see
+// Mixpanel.Identify. It does nothing when r has no $device_id.
+func (dc DeviceCookie) Identify(mp *Mixpanel, r *http.Request, user_id string) error {
+	device_id := dc.DeviceID(r)
+	if device_id == "" {
+		return nil
+	}
+	return mp.Identify(user_id, device_id)
+}
+
+/*
+Identify tells Mixpanel that the anonymous anon_id, a $device_id for
+example, is user_id, once a visitor signed up or logged in. The events
+tracked with either distinct_id are then those of the same user.
+Example:
+
+	mp.Identify("12345", deviceID)
+*/
+func (mp *Mixpanel) Identify(user_id, anon_id string) error {
+	return mp.Track(user_id, "$identify", &P{
+		"$identified_id": user_id,
+		"$anon_id":       anon_id,
+	})
+}
+
+/*
+Merge merges the users of two distinct_ids, which Identify does not do
+for two identified ids. It goes through the import endpoint and needs
+the project API secret, see WithAPISecret. Example:
+
+	mp.Merge("12345", "amy@mixpanel.com")
+*/
+func (mp *Mixpanel) Merge(distinct_id1, distinct_id2 string) error {
+	return mp.Import(distinct_id1, "$merge", mp.now(), &P{
+		"$distinct_ids": []string{distinct_id1, distinct_id2},
+	})
+}
@@ -0,0 +1,96 @@
+package mixpanel
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewDeviceID(t *testing.T) {
+	id := NewDeviceID()
+	if !isDeviceID(id) || id[14] != '4' || !strings.ContainsRune("89ab", rune(id[19])) {
+		t.Errorf("Expected a version 4 UUID got %s", id)
+	}
+	if NewDeviceID() == id {
+		t.Error("Expected different ids")
+	}
+	for _, id := range []string{"", "not-a-uuid", strings.ToUpper(id), id + "0"} {
+		if isDeviceID(id) {
+			t.Errorf("Expected %q to be invalid", id)
+		}
+	}
+}
+
+func TestDeviceCookie(t *testing.T) {
+	dc := DeviceCookie{Name: "did", Secure: true}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	id := dc.Ensure(w, r)
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "did" || cookies[0].Value != id || !cookies[0].HttpOnly ||
+		!cookies[0].Secure || cookies[0].MaxAge != int(DefaultDeviceCookieAge.Seconds()) {
+		t.Fatalf("Unexpected cookies %v", cookies)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(cookies[0])
+	if got := dc.Ensure(w, r); got != id || len(w.Result().Cookies()) != 0 {
+		t.Errorf("Expected the existing id %s got %s and cookies %v", id, got, w.Result().Cookies())
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: "did", Value: "forged"})
+	if got := dc.DeviceID(r); got != "" {
+		t.Errorf("Expected an invalid cookie to be ignored got %s", got)
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	var buf bytes.Buffer
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf))
+	dc := DeviceCookie{}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	if err := dc.Identify(mp, r, "12345"); err != nil || buf.Len() != 0 {
+		t.Fatalf("Expected nothing without device got %v %s", err, buf.String())
+	}
+	device := NewDeviceID()
+	r.AddCookie(&http.Cookie{Name: DefaultDeviceCookie, Value: device})
+	if err := dc.Identify(mp, r, "12345"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mp.Merge("12345", "amy@mixpanel.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	type message struct {
+		Endpoint string `json:"endpoint"`
+		Data     Event  `json:"data"`
+	}
+	var msgs []message
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var msg message
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("Expected 2 messages got %s", buf.String())
+	}
+	props := *msgs[0].Data.Properties
+	if msgs[0].Endpoint != "events" || msgs[0].Data.Event != "$identify" || props["distinct_id"] != "12345" ||
+		props["$identified_id"] != "12345" || props["$anon_id"] != device {
+		t.Errorf("Unexpected identify %v", msgs[0])
+	}
+	props = *msgs[1].Data.Properties
+	ids, _ := props["$distinct_ids"].([]interface{})
+	if msgs[1].Endpoint != "import" || msgs[1].Data.Event != "$merge" || len(ids) != 2 || ids[1] != "amy@mixpanel.com" {
+		t.Errorf("Unexpected merge %v", msgs[1])
+	}
+}
@@ -0,0 +1,404 @@
+package mixpanel
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// encoder is a json.Encoder bound to its own buffer, pooled to spare the
+// allocations of a fresh buffer and encoder for every message. scratch
+// and keys are the buffers of marshalEvent and marshalProps.
+type encoder struct {
+	buf     bytes.Buffer
+	enc     *json.Encoder
+	scratch []byte
+	keys    []string
+}
+
+var encoderPool = sync.Pool{
+	New: func() interface{} {
+		e := &encoder{}
+		e.enc = json.NewEncoder(&e.buf)
+		return e
+	},
+}
+
+// maxPooledBuffer keeps unusually large messages from pinning memory in
+// the pool.
+const maxPooledBuffer = 64 << 10
+
+/*
+marshal is json.Marshal on a pooled encoder. The result is copied out
+of the pooled buffer, since consumers may keep messages around.
+*/
+func marshal(v interface{}) ([]byte, error) {
+	e := encoderPool.Get().(*encoder)
+	e.buf.Reset()
+	var data []byte
+	err := e.enc.Encode(v)
+	if err == nil {
+		// Encode terminates the value with a newline
+		b := e.buf.Bytes()
+		data = append(make([]byte, 0, len(b)-1), b[:len(b)-1]...)
+	}
+	if e.buf.Cap() <= maxPooledBuffer {
+		encoderPool.Put(e)
+	}
+	return data, err
+}
+
+/*
+marshalEvent serializes an event like marshal(&Event{event,
+formatTimes(props, "time")}) does, byte for byte, without going through
+reflection for the property types of the library: strings, numbers,
+booleans, times and the maps and lists of those. Other values are
+handed to json.Marshal.
+*/
+func marshalEvent(event string, props *P) ([]byte, error) {
+	e := encoderPool.Get().(*encoder)
+	b := append(e.scratch[:0], `{"event":`...)
+	b = appendString(b, event)
+	b = append(b, `,"properties":`...)
+	b, err := e.appendProps(b, props, PropTime)
+	b = append(b, '}')
+	return e.release(b, err)
+}
+
+// marshalProps serializes props like marshal(formatTimes(props,
+// epochKey)) does, see marshalEvent.
+func marshalProps(props *P, epochKey string) ([]byte, error) {
+	e := encoderPool.Get().(*encoder)
+	b, err := e.appendProps(e.scratch[:0], props, epochKey)
+	return e.release(b, err)
+}
+
+// release copies the result out of the scratch buffer b and returns e
+// to the pool.
+func (e *encoder) release(b []byte, err error) ([]byte, error) {
+	var data []byte
+	if err == nil {
+		data = append(make([]byte, 0, len(b)), b...)
+	}
+	if cap(b) <= maxPooledBuffer {
+		e.scratch = b
+		encoderPool.Put(e)
+	}
+	return data, err
+}
+
+func (e *encoder) appendProps(b []byte, props *P, epochKey string) ([]byte, error) {
+	if props == nil {
+		return append(b, "null"...), nil
+	}
+	return e.appendMap(b, *props, epochKey)
+}
+
+// appendMap appends m with sorted keys, as encoding/json does. The keys
+// of nested maps are stacked after those of m in e.keys.
+func (e *encoder) appendMap(b []byte, m map[string]interface{}, epochKey string) ([]byte, error) {
+	start := len(e.keys)
+	for key := range m {
+		e.keys = append(e.keys, key)
+	}
+	sortStrings(e.keys[start:])
+	defer func() { e.keys = e.keys[:start] }()
+
+	b = append(b, '{')
+	for i := start; i < start+len(m); i++ {
+		key := e.keys[i]
+		if i > start {
+			b = append(b, ',')
+		}
+		b = appendString(b, key)
+		b = append(b, ':')
+		var err error
+		if key == epochKey {
+			b, err = e.appendEpoch(b, m[key])
+		} else {
+			b, err = e.appendValue(b, m[key])
+		}
+		if err != nil {
+			return b, err
+		}
+	}
+	return append(b, '}'), nil
+}
+
+// appendEpoch appends the epochKey property, in epoch seconds when it is
+// a time.
+func (e *encoder) appendEpoch(b []byte, v interface{}) ([]byte, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return strconv.AppendInt(b, t.Unix(), 10), nil
+	case *time.Time:
+		if t != nil {
+			return strconv.AppendInt(b, t.Unix(), 10), nil
+		}
+	}
+	return e.appendValue(b, v)
+}
+
+func (e *encoder) appendValue(b []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(b, "null"...), nil
+	case string:
+		return appendString(b, v), nil
+	case bool:
+		return strconv.AppendBool(b, v), nil
+	case int:
+		return strconv.AppendInt(b, int64(v), 10), nil
+	case int8:
+		return strconv.AppendInt(b, int64(v), 10), nil
+	case int16:
+		return strconv.AppendInt(b, int64(v), 10), nil
+	case int32:
+		return strconv.AppendInt(b, int64(v), 10), nil
+	case int64:
+		return strconv.AppendInt(b, v, 10), nil
+	case uint:
+		return strconv.AppendUint(b, uint64(v), 10), nil
+	case uint8:
+		return strconv.AppendUint(b, uint64(v), 10), nil
+	case uint16:
+		return strconv.AppendUint(b, uint64(v), 10), nil
+	case uint32:
+		return strconv.AppendUint(b, uint64(v), 10), nil
+	case uint64:
+		return strconv.AppendUint(b, v, 10), nil
+	case float64:
+		if !math.IsNaN(v) && !math.IsInf(v, 0) {
+			return appendFloat(b, v, 64), nil
+		}
+	case float32:
+		if f := float64(v); !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return appendFloat(b, f, 32), nil
+		}
+	case json.Number:
+		if v == "" {
+			return append(b, '0'), nil
+		}
+		if isNumber(string(v)) {
+			return append(b, v...), nil
+		}
+	case time.Time:
+		return e.appendTime(b, v), nil
+	case *time.Time:
+		if v == nil {
+			return append(b, "null"...), nil
+		}
+		return e.appendTime(b, *v), nil
+	case P:
+		if v == nil {
+			return append(b, "null"...), nil
+		}
+		return e.appendMap(b, v, "")
+	case *P:
+		if v == nil {
+			return append(b, "null"...), nil
+		}
+		return e.appendProps(b, v, "")
+	case map[string]interface{}:
+		if v == nil {
+			return append(b, "null"...), nil
+		}
+		return e.appendMap(b, v, "")
+	case []interface{}:
+		if v == nil {
+			return append(b, "null"...), nil
+		}
+		b = append(b, '[')
+		for i, item := range v {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			var err error
+			if b, err = e.appendValue(b, item); err != nil {
+				return b, err
+			}
+		}
+		return append(b, ']'), nil
+	case []P:
+		if v == nil {
+			return append(b, "null"...), nil
+		}
+		b = append(b, '[')
+		for i, item := range v {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			var err error
+			if b, err = e.appendValue(b, item); err != nil {
+				return b, err
+			}
+		}
+		return append(b, ']'), nil
+	case []map[string]interface{}:
+		if v == nil {
+			return append(b, "null"...), nil
+		}
+		b = append(b, '[')
+		for i, item := range v {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			var err error
+			if b, err = e.appendValue(b, item); err != nil {
+				return b, err
+			}
+		}
+		return append(b, ']'), nil
+	case []time.Time:
+		if v == nil {
+			return append(b, "null"...), nil
+		}
+		b = append(b, '[')
+		for i, t := range v {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = e.appendTime(b, t)
+		}
+		return append(b, ']'), nil
+	case []string:
+		if v == nil {
+			return append(b, "null"...), nil
+		}
+		b = append(b, '[')
+		for i, item := range v {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = appendString(b, item)
+		}
+		return append(b, ']'), nil
+	}
+	// other types, and the NaN and infinite floats json.Marshal rejects
+	data, err := json.Marshal(v)
+	return append(b, data...), err
+}
+
+func (e *encoder) appendTime(b []byte, t time.Time) []byte {
+	b = append(b, '"')
+	b = t.UTC().AppendFormat(b, TimeLayout)
+	return append(b, '"')
+}
+
+// appendFloat appends f as encoding/json does.
+func appendFloat(b []byte, f float64, bits int) []byte {
+	abs := math.Abs(f)
+	format := byte('f')
+	if abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+	b = strconv.AppendFloat(b, f, format, -1, bits)
+	if format == 'e' {
+		// clean up e-09 to e-9
+		n := len(b)
+		if n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return b
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendString appends s as a JSON string, escaped as encoding/json does
+// with HTML escaping on.
+func appendString(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '\\', '"':
+				b = append(b, '\\', c)
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, s[start:i]...)
+			b = append(b, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			b = append(b, s[start:i]...)
+			b = append(b, '\\', 'u', '2', '0', '2', hexDigits[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
+
+/*
+unmarshalNumbers is json.Unmarshal decoding numbers to json.Number
+rather than float64, so that integers such as ids and epoch times in
+milliseconds survive a round trip through interface{} values.
+*/
+func unmarshalNumbers(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("invalid character after top-level value")
+	}
+	return nil
+}
+
+// isNumber reports whether s is a JSON number.
+func isNumber(s string) bool {
+	if s == "" || s[0] != '-' && (s[0] < '0' || s[0] > '9') {
+		return false
+	}
+	return json.Valid([]byte(s))
+}
+
+// sortStrings sorts the few keys of a message without the allocation of
+// sort.Strings.
+func sortStrings(keys []string) {
+	if len(keys) > 16 {
+		sort.Strings(keys)
+		return
+	}
+	for i := 1; i < len(keys); i++ {
+		for j := i; j > 0 && keys[j] < keys[j-1]; j-- {
+			keys[j], keys[j-1] = keys[j-1], keys[j]
+		}
+	}
+}
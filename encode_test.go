@@ -0,0 +1,141 @@
+package mixpanel
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMarshalEventMatchesEncodingJSON(t *testing.T) {
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.FixedZone("CET", 3600))
+	props := &P{
+		"time":        at,
+		"distinct_id": "12345",
+		"html":        "<a href=\"x\">&</a>",
+		"control":     "tab\there\nline\x01 \xff",
+		"unicode":     "héllo 世界",
+		"int":         -42,
+		"int64":       int64(math.MaxInt64),
+		"uint8":       uint8(200),
+		"float":       3.14,
+		"small":       1e-7,
+		"large":       1e21,
+		"float32":     float32(0.1),
+		"bool":        true,
+		"nil":         nil,
+		"when":        at,
+		"when_ptr":    &at,
+		"nil_time":    (*time.Time)(nil),
+		"nested":      P{"at": at, "list": []interface{}{at, 1, "x"}},
+		"nested_ptr":  &P{"b": 2, "a": 1},
+		"map":         map[string]interface{}{"z": []string{"a", "b"}},
+		"nil_list":    []string(nil),
+		"struct":      struct{ X int }{1},
+		"ints":        []int{1, 2},
+	}
+	expected, err := marshal(&Event{Event: "Signed <Up>", Properties: formatTimes(props, "time")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := marshalEvent("Signed <Up>", props)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, expected) {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, got)
+	}
+
+	expected, _ = marshal(formatTimes(props, "$time"))
+	got, _ = marshalProps(props, "$time")
+	if !bytes.Equal(got, expected) {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, got)
+	}
+}
+
+func TestMarshalEventTimes(t *testing.T) {
+	at := time.Date(2024, 3, 1, 10, 30, 0, 0, time.FixedZone("CET", 3600))
+	for name, value := range map[string]interface{}{
+		"time":         at,
+		"times":        []time.Time{at, at.Add(time.Hour)},
+		"nil times":    []time.Time(nil),
+		"list":         []interface{}{at, []interface{}{at}},
+		"props":        P{"at": at, "times": []time.Time{at}},
+		"props list":   []P{{"at": at}, {"n": 1}},
+		"nil props":    []P(nil),
+		"maps list":    []map[string]interface{}{{"at": &at}},
+		"mixed nested": map[string]interface{}{"l": []interface{}{P{"at": at}}},
+	} {
+		props := &P{"value": value}
+		expected, err := json.Marshal(&Event{Event: "Viewed", Properties: formatTimes(props, "time")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := marshalEvent("Viewed", props)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, expected) {
+			t.Errorf("%s: expected\n%s\ngot\n%s", name, expected, got)
+		}
+		if bytes.Contains(got, []byte("+01:00")) {
+			t.Errorf("%s: expected the times in UTC, got %s", name, got)
+		}
+	}
+}
+
+func TestMarshalEventUnsupportedValue(t *testing.T) {
+	if _, err := marshalEvent("Viewed", &P{"nan": math.NaN()}); err == nil {
+		t.Error("Expected an error for NaN")
+	}
+}
+
+func BenchmarkTrack(b *testing.B) {
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(io.Discard))
+	props := &P{"Plan": "Pro", "Seats": 5, "Trial": true}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := mp.Track("13793", "Signed Up", props); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPeopleSet(b *testing.B) {
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(io.Discard))
+	props := &P{"$email": "john@example.com", "Plan": "Pro"}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := mp.PeopleSet("13793", props); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestLargeIntegersRoundTrip(t *testing.T) {
+	line := []byte(`{"event":"Purchase","properties":{"distinct_id":"u1","time":1704067200123,"order_id":9007199254740993}}`)
+	data, err := importLine(line, &ImportOptions{}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{`"order_id":9007199254740993`, `"time":1704067200123`} {
+		if !bytes.Contains(data, []byte(s)) {
+			t.Errorf("Expected %s in %s", s, data)
+		}
+	}
+
+	data, err = marshalEvent("Purchase", &P{"order_id": json.Number("9007199254740993"), "empty": json.Number("")})
+	if err != nil || !bytes.Contains(data, []byte(`"order_id":9007199254740993`)) || !bytes.Contains(data, []byte(`"empty":0`)) {
+		t.Errorf("Unexpected %s, %v", data, err)
+	}
+	if _, err := marshalEvent("Purchase", &P{"order_id": json.Number("12abc")}); err == nil {
+		t.Error("Expected an error for an invalid json.Number")
+	}
+
+	msg := &Message{Endpoint: "events", Event: "Purchase", Properties: &P{"order_id": json.Number("12abc")}}
+	if err := (&Validator{}).Validate(msg); err == nil {
+		t.Error("Expected the validator to reject an invalid json.Number")
+	}
+}
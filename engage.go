@@ -0,0 +1,225 @@
+package mixpanel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+)
+
+// Cohort describes a saved cohort.
+type Cohort struct {
+	ID          int64  `json:"id"`
+	ProjectID   int64  `json:"project_id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Count       int64  `json:"count"`
+	IsVisible   int    `json:"is_visible"`
+	Created     string `json:"created"`
+}
+
+// CohortsList returns the cohorts saved in the project.
+func (q *QueryClient) CohortsList(ctx context.Context) ([]Cohort, error) {
+	var cohorts []Cohort
+	if err := q.post(ctx, "/cohorts/list", url.Values{}, &cohorts); err != nil {
+		return nil, err
+	}
+	return cohorts, nil
+}
+
+// Profile is a people record as returned by the engage query API.
+type Profile struct {
+	DistinctID string `json:"$distinct_id"`
+	Properties P      `json:"$properties"`
+}
+
+/*
+EngageQuery selects the profiles returned by Engage.
+
+Where is a segmentation expression over profile properties, CohortID
+restricts the results to the members of a cohort and DistinctIDs to a
+fixed set of users. OutputProperties limits the properties returned
+for each profile, which makes large exports much faster.
+*/
+type EngageQuery struct {
+	Where            string
+	CohortID         int64
+	DistinctIDs      []string
+	OutputProperties []string
+}
+
+/*
+ProfileIterator walks the pages of an engage query, fetching the next
+page only once the current one has been consumed:
+
+	it := q.EngageByCohort(ctx, 1234)
+	for it.Next() {
+	    fmt.Println(it.Profile().DistinctID)
+	}
+	if err := it.Err(); err != nil {
+	    ...
+	}
+*/
+type ProfileIterator struct {
+	ctx    context.Context
+	q      *QueryClient
+	params url.Values
+
+	page      []Profile
+	pos       int
+	pageNum   int
+	pageSize  int
+	sessionID string
+	total     int
+	done      bool
+	err       error
+}
+
+// Engage returns an iterator over the profiles matching query.
+func (q *QueryClient) Engage(ctx context.Context, query *EngageQuery) *ProfileIterator {
+	it := &ProfileIterator{ctx: ctx, q: q, params: url.Values{}, pos: -1}
+	if query.Where != "" {
+		it.params.Set("where", query.Where)
+	}
+	if query.CohortID != 0 {
+		it.params.Set("filter_by_cohort", `{"id":`+strconv.FormatInt(query.CohortID, 10)+`}`)
+	}
+	if len(query.DistinctIDs) > 0 {
+		ids, _ := json.Marshal(query.DistinctIDs)
+		it.params.Set("distinct_ids", string(ids))
+	}
+	if len(query.OutputProperties) > 0 {
+		props, _ := json.Marshal(query.OutputProperties)
+		it.params.Set("output_properties", string(props))
+	}
+	return it
+}
+
+// EngageByCohort returns an iterator over the members of a cohort.
+func (q *QueryClient) EngageByCohort(ctx context.Context, cohortID int64) *ProfileIterator {
+	return q.Engage(ctx, &EngageQuery{CohortID: cohortID})
+}
+
+// Next advances to the next profile, fetching a new page when needed.
+// It returns false when there are no more profiles or an error occurred.
+func (it *ProfileIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	it.pos++
+	if it.pos < len(it.page) {
+		return true
+	}
+	if it.done {
+		return false
+	}
+	if err := it.fetch(); err != nil {
+		it.err = err
+		return false
+	}
+	return it.pos < len(it.page)
+}
+
+// Profile returns the current profile.
+func (it *ProfileIterator) Profile() *Profile {
+	return &it.page[it.pos]
+}
+
+// Total returns the number of profiles matching the query, known once
+// the first page has been fetched.
+func (it *ProfileIterator) Total() int {
+	return it.total
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *ProfileIterator) Err() error {
+	return it.err
+}
+
+func (it *ProfileIterator) fetch() error {
+	params := url.Values{}
+	for k, v := range it.params {
+		params[k] = v
+	}
+	if it.sessionID != "" {
+		params.Set("session_id", it.sessionID)
+		params.Set("page", strconv.Itoa(it.pageNum+1))
+	}
+
+	var response struct {
+		Page      int       `json:"page"`
+		PageSize  int       `json:"page_size"`
+		SessionID string    `json:"session_id"`
+		Total     int       `json:"total"`
+		Results   []Profile `json:"results"`
+	}
+	if err := it.q.post(it.ctx, "/engage", params, &response); err != nil {
+		return err
+	}
+	it.page = response.Results
+	it.pos = 0
+	it.pageNum = response.Page
+	it.sessionID = response.SessionID
+	it.total = response.Total
+	// a query without a session cannot be paginated
+	if it.sessionID == "" || response.PageSize == 0 || len(response.Results) < response.PageSize {
+		it.done = true
+	}
+	return nil
+}
+
+// ErrProfileNotFound is returned by PeopleGet for distinct_ids without a
+// profile.
+var ErrProfileNotFound = errors.New("mixpanel: profile not found")
+
+// PeopleGet returns the profile of distinct_id, or ErrProfileNotFound.
+func (q *QueryClient) PeopleGet(ctx context.Context, distinct_id string) (*Profile, error) {
+	it := q.Engage(ctx, &EngageQuery{DistinctIDs: []string{distinct_id}})
+	for it.Next() {
+		if p := it.Profile(); p.DistinctID == distinct_id {
+			return p, nil
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return nil, ErrProfileNotFound
+}
+
+/*
+PeopleGet returns the profile of distinct_id, or ErrProfileNotFound,
+read through the engage query API with the API secret or the service
+account of mp, for support tools to show the state of a user:
+
+	p, err := mp.PeopleGet(ctx, "12345")
+	if err == nil {
+	    fmt.Println(p.Properties["$email"])
+	}
+*/
+func (mp *Mixpanel) PeopleGet(ctx context.Context, distinct_id string) (*Profile, error) {
+	q, err := mp.queryClient()
+	if err != nil {
+		return nil, err
+	}
+	return q.PeopleGet(ctx, distinct_id)
+}
+
+// queryClient returns a QueryClient with the credentials and the HTTP
+// client of mp, on the EU servers when mp sends to EUAPIHost.
+func (mp *Mixpanel) queryClient() (*QueryClient, error) {
+	var q *QueryClient
+	switch {
+	case mp.serviceAccount != nil:
+		q = NewQueryClientWithServiceAccount(*mp.serviceAccount)
+	case mp.apiSecret != "":
+		q = NewQueryClient(mp.apiSecret)
+	default:
+		return nil, errors.New("mixpanel: querying needs the project API secret or a service account, see WithAPISecret")
+	}
+	if mp.apiHost == EUAPIHost {
+		q.Endpoint, q.ExportEndpoint = EUQueryEndpoint, EUExportEndpoint
+	}
+	q.HTTPClient = mp.client
+	return q, nil
+}
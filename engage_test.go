@@ -0,0 +1,91 @@
+package mixpanel
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEngageByCohortPagination(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("filter_by_cohort") != `{"id":42}` {
+			t.Errorf("Unexpected cohort filter %q", r.Form.Get("filter_by_cohort"))
+		}
+		switch r.Form.Get("page") {
+		case "":
+			fmt.Fprint(w, `{"page": 0, "page_size": 2, "session_id": "s1", "total": 3, "results": [
+				{"$distinct_id": "a", "$properties": {"$email": "a@example.com"}},
+				{"$distinct_id": "b", "$properties": {}}]}`)
+		case "1":
+			if r.Form.Get("session_id") != "s1" {
+				t.Errorf("Expected session_id s1 got %q", r.Form.Get("session_id"))
+			}
+			fmt.Fprint(w, `{"page": 1, "page_size": 2, "session_id": "s1", "total": 3, "results": [
+				{"$distinct_id": "c", "$properties": {}}]}`)
+		default:
+			t.Errorf("Unexpected page %s", r.Form.Get("page"))
+		}
+	}))
+	defer ts.Close()
+
+	q := NewQueryClient("secret")
+	q.Endpoint = ts.URL
+	it := q.EngageByCohort(context.Background(), 42)
+	var ids []string
+	for it.Next() {
+		ids = append(ids, it.Profile().DistinctID)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(ids) != "[a b c]" || it.Total() != 3 {
+		t.Errorf("Expected [a b c] got %v (total %d)", ids, it.Total())
+	}
+}
+
+// redirectTransport sends every request to the server at host.
+type redirectTransport struct {
+	host string
+}
+
+func (rt redirectTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme, r.URL.Host = "http", rt.host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestPeopleGet(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if user, _, _ := r.BasicAuth(); r.URL.Path != "/api/2.0/engage" || user != "secret" {
+			t.Errorf("Unexpected request %s by %q", r.URL, user)
+		}
+		switch r.Form.Get("distinct_ids") {
+		case `["12345"]`:
+			fmt.Fprint(w, `{"page": 0, "page_size": 1000, "total": 1, "results": [
+				{"$distinct_id": "12345", "$properties": {"$email": "john@example.com"}}]}`)
+		default:
+			fmt.Fprint(w, `{"page": 0, "page_size": 1000, "total": 0, "results": []}`)
+		}
+	}))
+	defer ts.Close()
+
+	host := ts.Listener.Addr().String()
+	mp := NewMixpanel(token, WithAPISecret("secret"), WithRoundTripper(redirectTransport{host}))
+	p, err := mp.PeopleGet(context.Background(), "12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.DistinctID != "12345" || p.Properties["$email"] != "john@example.com" {
+		t.Errorf("Unexpected profile %+v", p)
+	}
+	if _, err := mp.PeopleGet(context.Background(), "unknown"); err != ErrProfileNotFound {
+		t.Errorf("Expected ErrProfileNotFound got %v", err)
+	}
+	if _, err := NewMixpanel(token).PeopleGet(context.Background(), "12345"); err == nil {
+		t.Error("Expected an error without credentials")
+	}
+}
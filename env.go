@@ -0,0 +1,104 @@
+package mixpanel
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+/*
+NewMixpanelFromEnv creates a Mixpanel object configured from the
+environment, for services that want zero code configuration:
+
+	MIXPANEL_TOKEN           project token, required
+	MIXPANEL_API_SECRET      project API secret
+	MIXPANEL_API_HOST        ingestion host, e.g. a tracking proxy
+	MIXPANEL_EU              "true" to use the EU residency host
+	MIXPANEL_CA_BUNDLE       PEM file of additional certificate authorities, see NewCertPool
+	MIXPANEL_BATCH_SIZE      buffer messages and send them in batches
+	MIXPANEL_FLUSH_INTERVAL  flush buffered messages periodically, e.g. "5s"
+	MIXPANEL_DISABLED        "true" to send nothing, see Mixpanel.Disable
+	MIXPANEL_EVENT_ALLOWLIST comma separated events to track, see WithEventAllowlist
+	MIXPANEL_EVENT_DENYLIST  comma separated events to drop, see WithEventDenylist
+
+A BuffConsumer is used when MIXPANEL_BATCH_SIZE or MIXPANEL_FLUSH_INTERVAL
+is set, a StdConsumer otherwise. opts are applied after the environment.
+*/
+func NewMixpanelFromEnv(opts ...Option) (*Mixpanel, error) {
+	token := os.Getenv("MIXPANEL_TOKEN")
+	if token == "" {
+		return nil, fmt.Errorf("mixpanel: MIXPANEL_TOKEN is not set")
+	}
+
+	host := os.Getenv("MIXPANEL_API_HOST")
+	if eu, err := envBool("MIXPANEL_EU"); err != nil {
+		return nil, err
+	} else if eu && host == "" {
+		host = EUAPIHost
+	}
+
+	batchSize := int64(0)
+	if s := os.Getenv("MIXPANEL_BATCH_SIZE"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("mixpanel: invalid MIXPANEL_BATCH_SIZE '%s'", s)
+		}
+		batchSize = n
+	}
+	interval := time.Duration(0)
+	if s := os.Getenv("MIXPANEL_FLUSH_INTERVAL"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("mixpanel: invalid MIXPANEL_FLUSH_INTERVAL '%s'", s)
+		}
+		interval = d
+	}
+
+	var c Consumer
+	if batchSize > 0 || interval > 0 {
+		if batchSize == 0 {
+			batchSize = 50
+		}
+		bc := NewBuffConsumer(batchSize)
+		if interval > 0 {
+			bc.FlushEvery(interval)
+		}
+		c = bc
+	} else {
+		c = NewStdConsumer()
+	}
+
+	if host != "" {
+		opts = append([]Option{WithAPIHost(host)}, opts...)
+	}
+	if file := os.Getenv("MIXPANEL_CA_BUNDLE"); file != "" {
+		pool, err := NewCertPool(file)
+		if err != nil {
+			return nil, fmt.Errorf("mixpanel: invalid MIXPANEL_CA_BUNDLE: %v", err)
+		}
+		opts = append([]Option{WithRootCAs(pool)}, opts...)
+	}
+	if secret := os.Getenv("MIXPANEL_API_SECRET"); secret != "" {
+		opts = append([]Option{WithAPISecret(secret)}, opts...)
+	}
+	if s := os.Getenv("MIXPANEL_EVENT_ALLOWLIST"); s != "" {
+		opts = append([]Option{WithEventAllowlist(splitList(s)...)}, opts...)
+	}
+	if s := os.Getenv("MIXPANEL_EVENT_DENYLIST"); s != "" {
+		opts = append([]Option{WithEventDenylist(splitList(s)...)}, opts...)
+	}
+	return NewMixpanelWithConsumer(token, c, opts...), nil
+}
+
+func envBool(name string) (bool, error) {
+	s := os.Getenv(name)
+	if s == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("mixpanel: invalid %s '%s'", name, s)
+	}
+	return b, nil
+}
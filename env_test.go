@@ -0,0 +1,40 @@
+package mixpanel
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNewMixpanelFromEnv(t *testing.T) {
+	t.Setenv("MIXPANEL_TOKEN", "")
+	if _, err := NewMixpanelFromEnv(); err == nil {
+		t.Error("Expected an error without MIXPANEL_TOKEN")
+	}
+
+	t.Setenv("MIXPANEL_TOKEN", token)
+	t.Setenv("MIXPANEL_EU", "true")
+	t.Setenv("MIXPANEL_BATCH_SIZE", "10")
+	t.Setenv("MIXPANEL_FLUSH_INTERVAL", "1m")
+	t.Setenv("MIXPANEL_API_SECRET", "secret")
+	mp, err := NewMixpanelFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mp.Close(context.Background())
+
+	bc, ok := mp.c.(*BuffConsumer)
+	if !ok {
+		t.Fatalf("Expected a BuffConsumer got %T", mp.c)
+	}
+	if bc.maxSize != 10 || bc.endpoints["events"] != EUAPIHost+"/track" {
+		t.Errorf("Unexpected consumer configuration %d %v", bc.maxSize, bc.endpoints)
+	}
+	if mp.GetToken() != token || mp.apiSecret != "secret" {
+		t.Error("Expected token and api secret from the environment")
+	}
+
+	t.Setenv("MIXPANEL_FLUSH_INTERVAL", "soon")
+	if _, err := NewMixpanelFromEnv(); err == nil {
+		t.Error("Expected an error for an invalid flush interval")
+	}
+}
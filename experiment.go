@@ -0,0 +1,39 @@
+package mixpanel
+
+// ExperimentStartedEvent is the event of the exposures to experiments
+// read by the Mixpanel Experiments report.
+const ExperimentStartedEvent = "$experiment_started"
+
+// Properties of the exposures to experiments.
+const (
+	PropExperimentName = "Experiment name"
+	PropVariantName    = "Variant name"
+)
+
+/*
+ExperimentProperties returns the properties naming an experiment and the
+variant a user is assigned, ready to be merged into the properties of
+other events to segment them by variant:
+
+	props := ExperimentProperties("new-checkout", "B").Update(&P{"amount": 30})
+	mp.Track("12345", "Purchase", props)
+*/
+func ExperimentProperties(experiment, variant string) *P {
+	return &P{
+		PropExperimentName: experiment,
+		PropVariantName:    variant,
+	}
+}
+
+/*
+TrackExperimentStarted records that distinct_id was exposed to the
+variant of an experiment, with the $experiment_started event of the
+Mixpanel Experiments report. Track it when the user first sees the
+variant rather than when the variant is assigned. Example:
+
+	mp.TrackExperimentStarted("12345", "new-checkout", "B", nil)
+*/
+func (mp *Mixpanel) TrackExperimentStarted(distinct_id, experiment, variant string, prop *P) error {
+	properties := (&P{}).Update(prop).Update(ExperimentProperties(experiment, variant))
+	return mp.Track(distinct_id, ExperimentStartedEvent, properties)
+}
@@ -0,0 +1,26 @@
+package mixpanel
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestTrackExperimentStarted(t *testing.T) {
+	var buf bytes.Buffer
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf))
+	if err := mp.TrackExperimentStarted("12345", "new-checkout", "B", &P{"Variant name": "A", "page": "/cart"}); err != nil {
+		t.Fatal(err)
+	}
+	var msg struct {
+		Data Event `json:"data"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &msg); err != nil {
+		t.Fatal(err)
+	}
+	props := *msg.Data.Properties
+	if msg.Data.Event != "$experiment_started" || props["Experiment name"] != "new-checkout" ||
+		props["Variant name"] != "B" || props["page"] != "/cart" || props["distinct_id"] != "12345" {
+		t.Errorf("Unexpected event %s %v", msg.Data.Event, props)
+	}
+}
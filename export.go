@@ -0,0 +1,321 @@
+package mixpanel
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+/*
+ExportQuery selects the raw events returned by Export.
+
+From and To are required and inclusive. Events restricts the export to
+some event names, Where is a segmentation expression over event
+properties and Limit caps the number of events returned.
+
+Concurrency, when above 1, splits the export into one request per day
+and sends up to Concurrency of them at once, which cuts long exports
+down; the events still come day after day, in the order of a single
+request. It is ignored when Limit is set. Mind the rate limits of the
+export API, 60 requests per hour: a year long export takes 365.
+*/
+type ExportQuery struct {
+	From        time.Time
+	To          time.Time
+	Events      []string
+	Where       string
+	Limit       int
+	Concurrency int
+}
+
+// exportShardBuffer is the number of events a day of a parallel export
+// reads ahead of the consumer.
+const exportShardBuffer = 1024
+
+/*
+EventIterator streams the events of a raw export, decoding them one at
+a time so that exports of any size can be processed. Numeric properties
+are decoded as json.Number, which keeps large integers such as ids
+exact:
+
+	it := q.Export(ctx, &ExportQuery{From: from, To: to})
+	defer it.Close()
+	for it.Next() {
+	    e := it.Event()
+	    fmt.Println(e.Event, (*e.Properties)["distinct_id"])
+	}
+	if err := it.Err(); err != nil {
+	    ...
+	}
+
+The response is read as the events are consumed, so a slow consumer
+slows the download down rather than piling the events up in memory, and
+canceling ctx stops the export. Scan decodes the events into another
+type, such as a struct holding only the properties of interest:
+
+	var e struct {
+	    Event      string
+	    Properties struct {
+	        DistinctID string `json:"distinct_id"`
+	        Time       int64  `json:"time"`
+	    }
+	}
+	for it.Next() {
+	    if err := it.Scan(&e); err != nil {
+	        ...
+	    }
+	}
+*/
+type EventIterator struct {
+	ctx    context.Context
+	q      *QueryClient
+	params url.Values
+
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+	line    []byte
+	event   Event
+	decoded bool
+	started bool
+	err     error
+
+	// parallel exports
+	from, to    time.Time
+	concurrency int
+	shards      chan *exportShard
+	shard       *exportShard
+	cancel      context.CancelFunc
+}
+
+// exportShard is the export of a single day of a parallel export. err
+// is set before lines is closed.
+type exportShard struct {
+	lines chan []byte
+	err   error
+}
+
+// Export returns an iterator over the raw events matching query. The
+// request is sent by the first call to Next.
+func (q *QueryClient) Export(ctx context.Context, query *ExportQuery) *EventIterator {
+	params := url.Values{}
+	params.Set("from_date", query.From.Format(dateLayout))
+	params.Set("to_date", query.To.Format(dateLayout))
+	if len(query.Events) > 0 {
+		events, _ := json.Marshal(query.Events)
+		params.Set("event", string(events))
+	}
+	if query.Where != "" {
+		params.Set("where", query.Where)
+	}
+	if query.Limit > 0 {
+		params.Set("limit", strconv.Itoa(query.Limit))
+	}
+	it := &EventIterator{ctx: ctx, q: q, params: params}
+	if query.Concurrency > 1 && query.Limit <= 0 && query.To.After(query.From) {
+		it.from, it.to = query.From, query.To
+		it.concurrency = query.Concurrency
+	}
+	return it
+}
+
+// Next decodes the next event. It returns false at the end of the
+// export or when an error occurred.
+func (it *EventIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		if it.concurrency > 1 {
+			it.startShards()
+		} else {
+			resp, err := it.q.request(it.ctx, "GET", it.q.ExportEndpoint+"/export", it.params)
+			if err != nil {
+				it.err = err
+				return false
+			}
+			it.body = resp.Body
+			it.scanner = newExportScanner(resp.Body)
+		}
+	}
+	if it.shards != nil {
+		return it.nextSharded()
+	}
+	if it.body == nil {
+		return false
+	}
+	for it.scanner.Scan() {
+		if err := it.ctx.Err(); err != nil {
+			it.err = err
+			it.Close()
+			return false
+		}
+		line := it.scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		it.line = line
+		it.decoded = false
+		return true
+	}
+	it.err = it.scanner.Err()
+	if it.err == nil {
+		it.err = it.ctx.Err()
+	}
+	it.Close()
+	return false
+}
+
+// newExportScanner returns a scanner over the lines of an export.
+func newExportScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	return scanner
+}
+
+// startShards starts the requests of a parallel export, one per day, no
+// more than it.concurrency at once. The days are handed to Next in
+// order, through it.shards.
+func (it *EventIterator) startShards() {
+	ctx, cancel := context.WithCancel(it.ctx)
+	it.cancel = cancel
+	it.shards = make(chan *exportShard, it.concurrency)
+	go func(shards chan<- *exportShard) {
+		defer close(shards)
+		running := make(chan struct{}, it.concurrency)
+		// step over the calendar days, From's time of day may be later
+		// than To's
+		y, m, d := it.from.Date()
+		last := it.to.Format(dateLayout)
+		for day := time.Date(y, m, d, 0, 0, 0, 0, it.from.Location()); day.Format(dateLayout) <= last; day = day.AddDate(0, 0, 1) {
+			select {
+			case running <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			shard := &exportShard{lines: make(chan []byte, exportShardBuffer)}
+			select {
+			case shards <- shard:
+			case <-ctx.Done():
+				return
+			}
+			params := url.Values{}
+			for k, v := range it.params {
+				params[k] = v
+			}
+			params.Set("from_date", day.Format(dateLayout))
+			params.Set("to_date", day.Format(dateLayout))
+			go func() {
+				defer func() { <-running }()
+				shard.fetch(ctx, it.q, params)
+			}()
+		}
+	}(it.shards)
+}
+
+// fetch sends the lines of the export of params to s.lines.
+func (s *exportShard) fetch(ctx context.Context, q *QueryClient, params url.Values) {
+	defer close(s.lines)
+	resp, err := q.request(ctx, "GET", q.ExportEndpoint+"/export", params)
+	if err != nil {
+		s.err = err
+		return
+	}
+	defer resp.Body.Close()
+	scanner := newExportScanner(resp.Body)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		select {
+		case s.lines <- append([]byte(nil), scanner.Bytes()...):
+		case <-ctx.Done():
+			s.err = ctx.Err()
+			return
+		}
+	}
+	s.err = scanner.Err()
+}
+
+// nextSharded is Next for parallel exports.
+func (it *EventIterator) nextSharded() bool {
+	for {
+		if err := it.ctx.Err(); err != nil {
+			it.err = err
+			it.Close()
+			return false
+		}
+		if it.shard == nil {
+			shard, ok := <-it.shards
+			if !ok {
+				it.Close()
+				return false
+			}
+			it.shard = shard
+		}
+		if line, ok := <-it.shard.lines; ok {
+			it.line = line
+			it.decoded = false
+			return true
+		}
+		if err := it.shard.err; err != nil {
+			it.err = err
+			it.Close()
+			return false
+		}
+		it.shard = nil
+	}
+}
+
+// Event returns the current event. It returns an empty event when the
+// line cannot be decoded, and sets the error returned by Err.
+func (it *EventIterator) Event() *Event {
+	if !it.decoded {
+		it.decoded = true
+		it.event = Event{}
+		if err := it.Scan(&it.event); err != nil {
+			it.err = err
+		}
+	}
+	return &it.event
+}
+
+// Scan decodes the current event into v, with json.Number for the
+// numbers decoded into interface values.
+func (it *EventIterator) Scan(v interface{}) error {
+	if err := unmarshalNumbers(it.line, v); err != nil {
+		return fmt.Errorf("Cannot interpret Mixpanel export line: %v", err)
+	}
+	return nil
+}
+
+// Raw returns the JSON of the current event. It is only valid until the
+// next call to Next.
+func (it *EventIterator) Raw() json.RawMessage {
+	return it.line
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *EventIterator) Err() error {
+	return it.err
+}
+
+// Close releases the connection of an export that is not read to the
+// end, and stops the requests of a parallel export.
+func (it *EventIterator) Close() error {
+	if it.cancel != nil {
+		it.cancel()
+		it.shards, it.shard = nil, nil
+	}
+	if it.body == nil {
+		return nil
+	}
+	err := it.body.Close()
+	it.body = nil
+	return err
+}
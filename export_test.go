@@ -0,0 +1,217 @@
+package mixpanel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/export" || q.Get("from_date") != "2024-01-01" || q.Get("event") != `["Signed Up"]` {
+			t.Errorf("Unexpected request %s", r.URL)
+		}
+		w.Write([]byte(`{"event": "Signed Up", "properties": {"distinct_id": "u1", "time": 1704067200}}
+{"event": "Signed Up", "properties": {"distinct_id": "u2", "time": 1704067260}}
+`))
+	}))
+	defer ts.Close()
+
+	q := NewQueryClient("secret")
+	q.ExportEndpoint = ts.URL
+	it := q.Export(context.Background(), &ExportQuery{
+		From:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:     time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC),
+		Events: []string{"Signed Up"},
+	})
+	defer it.Close()
+	var ids []interface{}
+	for it.Next() {
+		ids = append(ids, (*it.Event().Properties)["distinct_id"])
+		if tm, ok := (*it.Event().Properties)["time"].(json.Number); !ok || len(tm) != 10 {
+			t.Errorf("Expected the time as a json.Number got %#v", (*it.Event().Properties)["time"])
+		}
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[0] != "u1" || ids[1] != "u2" {
+		t.Errorf("Unexpected events %v", ids)
+	}
+	if it.Next() {
+		t.Errorf("Expected the iterator to stay done")
+	}
+}
+
+func TestExportError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": "to_date cannot be later than today"}`))
+	}))
+	defer ts.Close()
+
+	q := NewQueryClient("secret")
+	q.ExportEndpoint = ts.URL
+	it := q.Export(context.Background(), &ExportQuery{})
+	if it.Next() {
+		t.Fatal("Expected no events")
+	}
+	if qe, ok := it.Err().(*QueryError); !ok || qe.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected a QueryError got %v", it.Err())
+	}
+}
+
+func TestExportScan(t *testing.T) {
+	proceed := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"event": "Signed Up", "properties": {"distinct_id": "u1", "time": 1704067200, "Plan": "Pro"}}` + "\n"))
+		w.(http.Flusher).Flush()
+		<-proceed
+		w.Write([]byte(`{"event": "Signed Up", "properties": {"distinct_id": "u2", "time": 1704067260}}` + "\n"))
+	}))
+	defer ts.Close()
+	defer close(proceed)
+
+	q := NewQueryClient("secret")
+	q.ExportEndpoint = ts.URL
+	ctx, cancel := context.WithCancel(context.Background())
+	it := q.Export(ctx, &ExportQuery{})
+	defer it.Close()
+	if !it.Next() {
+		t.Fatal(it.Err())
+	}
+	var e struct {
+		Properties struct {
+			DistinctID string `json:"distinct_id"`
+			Time       int64  `json:"time"`
+		}
+	}
+	if err := it.Scan(&e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Properties.DistinctID != "u1" || e.Properties.Time != 1704067200 {
+		t.Errorf("Unexpected event %+v", e)
+	}
+	if !json.Valid(it.Raw()) {
+		t.Errorf("Unexpected raw event %s", it.Raw())
+	}
+
+	cancel()
+	if it.Next() {
+		t.Error("Expected the export to stop once canceled")
+	}
+	if err := it.Err(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled got %v", err)
+	}
+}
+
+func TestExportConcurrency(t *testing.T) {
+	var running, most int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("from_date") != q.Get("to_date") || q.Get("where") != `properties["Plan"] == "Pro"` {
+			t.Errorf("Unexpected request %s", r.URL)
+		}
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for m := atomic.LoadInt32(&most); n > m && !atomic.CompareAndSwapInt32(&most, m, n); m = atomic.LoadInt32(&most) {
+		}
+		day, _ := time.Parse(dateLayout, q.Get("from_date"))
+		// the first days take the longest
+		time.Sleep(time.Duration(10-day.Day()) * 5 * time.Millisecond)
+		for i := 0; i < 2; i++ {
+			fmt.Fprintf(w, `{"event": "Signed Up", "properties": {"distinct_id": "%s-%d"}}`+"\n", q.Get("from_date")[8:], i)
+		}
+	}))
+	defer ts.Close()
+
+	q := NewQueryClient("secret")
+	q.ExportEndpoint = ts.URL
+	it := q.Export(context.Background(), &ExportQuery{
+		From:        time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:          time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC),
+		Where:       `properties["Plan"] == "Pro"`,
+		Concurrency: 3,
+	})
+	defer it.Close()
+	var ids []string
+	for it.Next() {
+		ids = append(ids, (*it.Event().Properties)["distinct_id"].(string))
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	expected := "[01-0 01-1 02-0 02-1 03-0 03-1 04-0 04-1 05-0 05-1 06-0 06-1 07-0 07-1]"
+	if fmt.Sprint(ids) != expected {
+		t.Errorf("Expected %s got %v", expected, ids)
+	}
+	if most < 2 || most > 3 {
+		t.Errorf("Expected up to 3 requests at once got %d", most)
+	}
+}
+
+func TestExportConcurrencyDays(t *testing.T) {
+	var mu sync.Mutex
+	var days []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		days = append(days, r.URL.Query().Get("from_date"))
+		mu.Unlock()
+	}))
+	defer ts.Close()
+
+	q := NewQueryClient("secret")
+	q.ExportEndpoint = ts.URL
+	it := q.Export(context.Background(), &ExportQuery{
+		From:        time.Date(2024, 1, 1, 15, 0, 0, 0, time.UTC),
+		To:          time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC),
+		Concurrency: 2,
+	})
+	defer it.Close()
+	for it.Next() {
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(days)
+	expected := "[2024-01-01 2024-01-02 2024-01-03]"
+	if fmt.Sprint(days) != expected {
+		t.Errorf("Expected %s got %v", expected, days)
+	}
+}
+
+func TestExportConcurrencyError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("from_date") == "2024-01-02" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "invalid where"}`))
+			return
+		}
+		w.Write([]byte(`{"event": "Signed Up", "properties": {"distinct_id": "u1"}}` + "\n"))
+	}))
+	defer ts.Close()
+
+	q := NewQueryClient("secret")
+	q.ExportEndpoint = ts.URL
+	it := q.Export(context.Background(), &ExportQuery{
+		From:        time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:          time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC),
+		Concurrency: 2,
+	})
+	n := 0
+	for it.Next() {
+		n++
+	}
+	if n != 1 || it.Err() == nil {
+		t.Errorf("Expected the first day then an error got %d events and %v", n, it.Err())
+	}
+}
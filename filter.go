@@ -0,0 +1,87 @@
+package mixpanel
+
+import (
+	"regexp"
+	"strings"
+)
+
+/*
+WithEventAllowlist tracks only the events whose name matches one of
+patterns, exact names or globs where * matches any text and ? any single
+character; the other events are dropped silently, like middleware
+returning ErrSkipped. People and group updates are not filtered.
+Example:
+
+	mp := NewMixpanel(token, WithEventAllowlist("Signed Up", "Purchase*"))
+
+See also MIXPANEL_EVENT_ALLOWLIST in NewMixpanelFromEnv.
+*/
+func WithEventAllowlist(patterns ...string) Option {
+	allowed := compileEventPatterns(patterns)
+	return WithMiddleware(func(msg *Message) error {
+		if msg.IsEvent() && !allowed.MatchString(msg.Event) {
+			return ErrSkipped
+		}
+		return nil
+	})
+}
+
+/*
+WithEventDenylist drops the events whose name matches one of patterns,
+as for WithEventAllowlist, to suppress noisy or deprecated events.
+Example:
+
+	mp := NewMixpanel(token, WithEventDenylist("Heartbeat", "Debug *"))
+
+See also MIXPANEL_EVENT_DENYLIST in NewMixpanelFromEnv.
+*/
+func WithEventDenylist(patterns ...string) Option {
+	denied := compileEventPatterns(patterns)
+	return WithMiddleware(func(msg *Message) error {
+		if msg.IsEvent() && denied.MatchString(msg.Event) {
+			return ErrSkipped
+		}
+		return nil
+	})
+}
+
+// compileEventPatterns returns a regexp matching the names matched by
+// one of the glob patterns, none when there are no patterns.
+func compileEventPatterns(patterns []string) *regexp.Regexp {
+	alternatives := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		alternatives[i] = globRegexp(pattern)
+	}
+	if len(alternatives) == 0 {
+		// matches nothing
+		return regexp.MustCompile(`[^\s\S]`)
+	}
+	return regexp.MustCompile(`^(?:` + strings.Join(alternatives, "|") + `)$`)
+}
+
+// globRegexp returns the regexp of a glob pattern.
+func globRegexp(pattern string) string {
+	var b strings.Builder
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(`(?s:.*)`)
+		case '?':
+			b.WriteString(`(?s:.)`)
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	return b.String()
+}
+
+// splitList splits a comma separated list, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
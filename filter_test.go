@@ -0,0 +1,51 @@
+package mixpanel
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestEventAllowDenylist(t *testing.T) {
+	var buf bytes.Buffer
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf),
+		WithEventAllowlist("Signed Up", "Purchase*", "Page ?"),
+		WithEventDenylist("Purchase Test*"))
+	for _, event := range []string{"Signed Up", "Signed Up Again", "Purchase", "Purchase Completed",
+		"Purchase Test", "Page A", "Page AB", "Page /", "Heartbeat"} {
+		if err := mp.Track("12345", event, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mp.PeopleSet("12345", &P{"Plan": "Pro"})
+
+	var tracked []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if strings.Contains(line, `"endpoint":"people"`) {
+			tracked = append(tracked, "people")
+			continue
+		}
+		tracked = append(tracked, line[strings.Index(line, `"event":"`)+9:strings.Index(line, `","properties"`)])
+	}
+	expected := "Signed Up,Purchase,Purchase Completed,Page A,Page /,people"
+	if strings.Join(tracked, ",") != expected {
+		t.Errorf("Expected %s got %s", expected, strings.Join(tracked, ","))
+	}
+}
+
+func TestEventDenylistFromEnv(t *testing.T) {
+	t.Setenv("MIXPANEL_TOKEN", token)
+	t.Setenv("MIXPANEL_EVENT_DENYLIST", "Heartbeat, Debug *")
+	mp, err := NewMixpanelFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &Message{Endpoint: "events", Event: "Debug Cache Miss", Properties: &P{}}
+	if err := mp.process(msg); err != ErrSkipped {
+		t.Errorf("Expected the event to be dropped got %v", err)
+	}
+	msg = &Message{Endpoint: "events", Event: "Signed Up", Properties: &P{}}
+	if err := mp.process(msg); err != nil {
+		t.Errorf("Expected the event to be kept got %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package mixpanel
+
+import (
+	"context"
+	"sync"
+)
+
+// PropFirstTime marks the first occurrence of an event for a distinct_id,
+// see WithFirstTime.
+const PropFirstTime = "$first_time"
+
+/*
+FirstTimeStore remembers the events each distinct_id already did.
+
+MarkFirst records that distinct_id did event and reports whether it is
+the first time, atomically so that concurrent calls for the same pair
+report a single first time. NewMemoryFirstTimeStore keeps the pairs in
+memory; the mixpanelredis package shares them between processes.
+*/
+type FirstTimeStore interface {
+	MarkFirst(ctx context.Context, distinct_id, event string) (bool, error)
+}
+
+/*
+WithFirstTime stamps events with a $first_time property, true the first
+time their distinct_id does them and false afterwards, as remembered by
+store. Only the given events are stamped, or every event when none is
+given; people updates and events without distinct_id never are.
+Example:
+
+	mp := NewMixpanel(token, WithFirstTime(NewMemoryFirstTimeStore(), "Purchase"))
+
+Events are tracked without $first_time when the store fails, rather than
+failing the call.
+*/
+func WithFirstTime(store FirstTimeStore, events ...string) Option {
+	var only map[string]bool
+	if len(events) > 0 {
+		only = make(map[string]bool, len(events))
+		for _, event := range events {
+			only[event] = true
+		}
+	}
+	return WithMiddleware(func(msg *Message) error {
+		if !msg.IsEvent() || msg.DistinctID == "" || (only != nil && !only[msg.Event]) {
+			return nil
+		}
+		first, err := store.MarkFirst(context.Background(), msg.DistinctID, msg.Event)
+		if err == nil {
+			(*msg.Properties)[PropFirstTime] = first
+		}
+		return nil
+	})
+}
+
+/*
+MemoryFirstTimeStore is a FirstTimeStore in memory, for a single
+process. It grows with the number of distinct pairs of distinct_id and
+event, and forgets them all on restart: long running or replicated
+services should rather share a store such as mixpanelredis.
+*/
+type MemoryFirstTimeStore struct {
+	mu   sync.Mutex
+	seen map[[2]string]struct{}
+}
+
+// NewMemoryFirstTimeStore returns an empty MemoryFirstTimeStore.
+func NewMemoryFirstTimeStore() *MemoryFirstTimeStore {
+	return &MemoryFirstTimeStore{seen: make(map[[2]string]struct{})}
+}
+
+func (s *MemoryFirstTimeStore) MarkFirst(ctx context.Context, distinct_id, event string) (bool, error) {
+	key := [2]string{distinct_id, event}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.seen[key]; ok {
+		return false, nil
+	}
+	s.seen[key] = struct{}{}
+	return true, nil
+}
@@ -0,0 +1,64 @@
+package mixpanel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type brokenFirstTimeStore struct{}
+
+func (brokenFirstTimeStore) MarkFirst(ctx context.Context, distinct_id, event string) (bool, error) {
+	return false, errors.New("unavailable")
+}
+
+func TestWithFirstTime(t *testing.T) {
+	var buf bytes.Buffer
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf), WithFirstTime(NewMemoryFirstTimeStore(), "Purchase"))
+
+	for _, call := range []struct{ id, event string }{
+		{"u1", "Purchase"},
+		{"u1", "Purchase"},
+		{"u2", "Purchase"},
+		{"u1", "Viewed"},
+	} {
+		if err := mp.Track(call.id, call.event, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mp.PeopleSet("u1", &P{"plan": "pro"}); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("Expected 5 messages got %s", buf.String())
+	}
+	for i, want := range []interface{}{true, false, true, nil, nil} {
+		var msg struct {
+			Data P `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(lines[i]), &msg); err != nil {
+			t.Fatal(err)
+		}
+		var got interface{}
+		if props, ok := msg.Data["properties"].(map[string]interface{}); ok {
+			got = props[PropFirstTime]
+		}
+		if got != want {
+			t.Errorf("Message %d: expected $first_time %v got %v", i, want, got)
+		}
+	}
+
+	buf.Reset()
+	mp = NewMixpanelWithConsumer(token, NewWriterConsumer(&buf), WithFirstTime(brokenFirstTimeStore{}))
+	if err := mp.Track("u1", "Purchase", nil); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), PropFirstTime) {
+		t.Errorf("Expected no $first_time got %s", buf.String())
+	}
+}
@@ -0,0 +1,122 @@
+package mixpanel
+
+import (
+	"reflect"
+)
+
+// DefaultFlattenSeparator joins the keys of flattened properties when
+// Flattener.Separator is empty.
+const DefaultFlattenSeparator = "."
+
+/*
+Flattener turns nested objects into top-level properties named after
+their path, which the Mixpanel reports handle far better than objects:
+
+	{"Plan": {"Name": "Pro", "Limits": {"Seats": 5}}}
+
+becomes
+
+	{"Plan.Name": "Pro", "Plan.Limits.Seats": 5}
+
+Objects are maps with string keys, P values and structs other than
+time.Time, converted following the rules of TrackStruct; lists are left
+as is. MaxDepth, when above 0, bounds the levels flattened, deeper
+objects stay nested: with a MaxDepth of 1 the example becomes
+{"Plan.Name": "Pro", "Plan.Limits": {"Seats": 5}}. Empty objects
+disappear, and a flattened property never replaces a top-level property
+of the same name. Example:
+
+	mp := NewMixpanel(token, WithFlattener(&Flattener{Separator: "_", MaxDepth: 2}))
+*/
+type Flattener struct {
+	Separator string
+	MaxDepth  int
+}
+
+// WithFlattener flattens the properties of every event, and the
+// properties set by people and group updates.
+func WithFlattener(f *Flattener) Option {
+	return WithMiddleware(func(msg *Message) error {
+		if msg.IsEvent() {
+			msg.Properties = f.Flatten(msg.Properties)
+			return nil
+		}
+		for _, op := range []string{"$set", "$set_once"} {
+			if m, ok := objectValue((*msg.Properties)[op]); ok {
+				p := P(m)
+				(*msg.Properties)[op] = f.Flatten(&p)
+			}
+		}
+		return nil
+	})
+}
+
+// Flatten returns a flattened copy of p.
+func (f *Flattener) Flatten(p *P) *P {
+	if p == nil {
+		return nil
+	}
+	flat := make(P, len(*p))
+	for key, value := range *p {
+		f.flatten(flat, *p, key, value, 1)
+	}
+	return &flat
+}
+
+func (f *Flattener) flatten(flat, top P, key string, value interface{}, depth int) {
+	if m, ok := objectValue(value); ok && (f.MaxDepth <= 0 || depth <= f.MaxDepth) {
+		separator := f.Separator
+		if separator == "" {
+			separator = DefaultFlattenSeparator
+		}
+		for k, v := range m {
+			f.flatten(flat, top, key+separator+k, v, depth+1)
+		}
+		return
+	}
+	if _, ok := top[key]; ok && depth > 1 {
+		return
+	}
+	flat[key] = value
+}
+
+// objectValue returns the properties of the objects Flattener flattens.
+func objectValue(value interface{}) (map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case nil:
+		return nil, false
+	case P:
+		return v, true
+	case *P:
+		if v == nil {
+			return nil, false
+		}
+		return *v, true
+	case map[string]interface{}:
+		return v, true
+	case map[string]string:
+		m := make(map[string]interface{}, len(v))
+		for k, s := range v {
+			m[k] = s
+		}
+		return m, true
+	}
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, false
+		}
+		rv = rv.Elem()
+	}
+	switch {
+	case rv.Kind() == reflect.Struct && rv.Type() != timeType:
+		return *structProps(rv), true
+	case rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String:
+		m := make(map[string]interface{}, rv.Len())
+		for it := rv.MapRange(); it.Next(); {
+			m[it.Key().String()] = it.Value().Interface()
+		}
+		return m, true
+	}
+	return nil, false
+}
@@ -0,0 +1,66 @@
+package mixpanel
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFlattener(t *testing.T) {
+	type limits struct {
+		Seats int
+	}
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	props := &P{
+		"Plan":       P{"Name": "Pro", "Limits": &limits{Seats: 5}, "Tags": []string{"a"}},
+		"Plan.Name":  "Legacy",
+		"Empty":      map[string]interface{}{},
+		"Counts":     map[string]int{"views": 3},
+		"Renewed At": at,
+	}
+	flat := (&Flattener{}).Flatten(props)
+	expected := &P{
+		"Plan.Name":         "Legacy",
+		"Plan.Limits.Seats": 5,
+		"Plan.Tags":         []string{"a"},
+		"Counts.views":      3,
+		"Renewed At":        at,
+	}
+	if !reflect.DeepEqual(flat, expected) {
+		t.Errorf("Expected %v got %v", expected, flat)
+	}
+	if _, ok := (*props)["Plan"]; !ok {
+		t.Error("Expected the properties to be left as is")
+	}
+
+	flat = (&Flattener{Separator: "_", MaxDepth: 1}).Flatten(&P{"Plan": P{"Limits": P{"Seats": 5}}})
+	if !reflect.DeepEqual(flat, &P{"Plan_Limits": P{"Seats": 5}}) {
+		t.Errorf("Expected a single level flattened got %v", flat)
+	}
+}
+
+func TestWithFlattener(t *testing.T) {
+	var buf bytes.Buffer
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf), WithFlattener(&Flattener{}))
+	mp.Track("12345", "Signed Up", &P{"Address": P{"City": "Paris"}})
+	mp.PeopleSet("12345", &P{"Address": P{"City": "Paris"}})
+
+	dec := json.NewDecoder(&buf)
+	var event, update struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := dec.Decode(&event); err != nil {
+		t.Fatal(err)
+	}
+	if city := event.Data["properties"].(map[string]interface{})["Address.City"]; city != "Paris" {
+		t.Errorf("Expected Address.City got %v", event.Data)
+	}
+	if err := dec.Decode(&update); err != nil {
+		t.Fatal(err)
+	}
+	if city := update.Data["$set"].(map[string]interface{})["Address.City"]; city != "Paris" {
+		t.Errorf("Expected Address.City got %v", update.Data)
+	}
+}
@@ -0,0 +1,158 @@
+package mixpanel
+
+import (
+	"fmt"
+	"reflect"
+)
+
+/*
+GroupUpdate sends a generic update to a group profile of Group
+Analytics. Like PeopleUpdate, the caller formats the update, which must
+hold $group_key and $group_id along with a single operation:
+
+	mp.GroupUpdate(&P{
+	    "$group_key": "company",
+	    "$group_id":  "Acme Inc",
+	    "$set":       &P{"Plan": "Enterprise"},
+	})
+*/
+func (mp *Mixpanel) GroupUpdate(properties *P) error {
+	record := &P{
+		"$token": mp.GetToken(),
+	}
+	record.Update(properties)
+
+	msg := &Message{
+		Endpoint:   "groups",
+		Properties: record,
+	}
+	if err := mp.process(msg); err != nil {
+		return skipped(err)
+	}
+
+	data, err := marshalProps(msg.Properties, "")
+	if err != nil {
+		return err
+	}
+	return mp.send("groups", data)
+}
+
+func (mp *Mixpanel) groupUpdate(group_key, group_id, operation string, value interface{}) error {
+	return mp.GroupUpdate(&P{
+		"$group_key": group_key,
+		"$group_id":  group_id,
+		operation:    value,
+	})
+}
+
+/*
+GroupSet sets properties of a group profile, creating it if needed.
+Example:
+
+	mp.GroupSet("company", "Acme Inc", &P{"Plan": "Enterprise"})
+*/
+func (mp *Mixpanel) GroupSet(group_key, group_id string, properties *P) error {
+	return mp.groupUpdate(group_key, group_id, "$set", properties)
+}
+
+// GroupSetOnce sets properties of a group profile that are not set yet.
+func (mp *Mixpanel) GroupSetOnce(group_key, group_id string, properties *P) error {
+	return mp.groupUpdate(group_key, group_id, "$set_once", properties)
+}
+
+/*
+GroupUnion merges values into list properties of a group profile,
+ignoring the values already in the lists.
+Example:
+
+	mp.GroupUnion("company", "Acme Inc", &P{"Products": []string{"Analytics"}})
+*/
+func (mp *Mixpanel) GroupUnion(group_key, group_id string, properties *P) error {
+	return mp.groupUpdate(group_key, group_id, "$union", properties)
+}
+
+// GroupRemove removes values from list properties of a group profile.
+func (mp *Mixpanel) GroupRemove(group_key, group_id string, properties *P) error {
+	return mp.groupUpdate(group_key, group_id, "$remove", properties)
+}
+
+// GroupUnset removes properties from a group profile.
+func (mp *Mixpanel) GroupUnset(group_key, group_id string, properties []string) error {
+	return mp.groupUpdate(group_key, group_id, "$unset", properties)
+}
+
+// GroupDelete permanently deletes a group profile.
+func (mp *Mixpanel) GroupDelete(group_key, group_id string) error {
+	return mp.groupUpdate(group_key, group_id, "$delete", "")
+}
+
+/*
+WithGroups attaches every event to the groups of groups, keyed by group
+key, the way Mixpanel expects: a group ID, or a list of them for events
+of several groups. Events already carrying a group key keep their value.
+Example:
+
+	mp := NewMixpanel(token, WithGroups(P{"company_id": "acme"}))
+
+Group IDs given as []string, or any other list, are sent as lists of
+strings; a single ID is sent as is.
+*/
+func WithGroups(groups P) Option {
+	normalized := make(P, len(groups))
+	for key, ids := range groups {
+		normalized[key] = groupIDs(ids)
+	}
+	return WithMiddleware(func(msg *Message) error {
+		if !msg.IsEvent() || msg.Properties == nil {
+			return nil
+		}
+		for key, ids := range normalized {
+			if _, ok := (*msg.Properties)[key]; !ok {
+				(*msg.Properties)[key] = ids
+			}
+		}
+		return nil
+	})
+}
+
+// groupIDs returns ids as a single group ID, or as a list of strings.
+func groupIDs(ids interface{}) interface{} {
+	rv := reflect.ValueOf(ids)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return ids
+	}
+	list := make([]string, rv.Len())
+	for i := range list {
+		list[i] = fmt.Sprint(rv.Index(i).Interface())
+	}
+	return list
+}
+
+/*
+PeopleSetGroup makes the profile id a member of the groups groupIDs of
+groupKey, and of no other group of groupKey. Mixpanel expects the group
+key of a profile to be a list, even of a single group:
+
+	mp.PeopleSetGroup("12345", "company_id", []string{"acme"})
+*/
+func (mp *Mixpanel) PeopleSetGroup(id, groupKey string, groupIDs []string) error {
+	if groupIDs == nil {
+		groupIDs = []string{}
+	}
+	return mp.PeopleSet(id, &P{groupKey: groupIDs})
+}
+
+// PeopleAddGroup adds the profile id to the group groupID of groupKey,
+// keeping its other groups.
+func (mp *Mixpanel) PeopleAddGroup(id, groupKey, groupID string) error {
+	return mp.PeopleUnion(id, &P{groupKey: []string{groupID}})
+}
+
+// PeopleRemoveGroup removes the profile id from the group groupID of
+// groupKey.
+func (mp *Mixpanel) PeopleRemoveGroup(id, groupKey, groupID string) error {
+	return mp.PeopleUpdate(&P{
+		"$distinct_id": id,
+		"$remove":      P{groupKey: groupID},
+	})
+}
@@ -0,0 +1,110 @@
+package mixpanel
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestGroupUpdates(t *testing.T) {
+	rs := newRecordingServer()
+	defer rs.Close()
+	c := NewStdConsumer()
+	c.endpoints = rs.endpoints()
+	mp := NewMixpanelWithConsumer(token, c)
+
+	mp.GroupSet("company", "Acme Inc", &P{"Plan": "Enterprise"})
+	mp.GroupSetOnce("company", "Acme Inc", &P{"Founded": 1999})
+	mp.GroupUnset("company", "Acme Inc", []string{"Trial"})
+	mp.GroupDelete("company", "Acme Inc")
+
+	payloads := rs.Payloads()
+	if len(payloads) != 4 {
+		t.Fatalf("Expected 4 updates got %v", payloads)
+	}
+	for i, op := range []string{"$set", "$set_once", "$unset", "$delete"} {
+		var update map[string]interface{}
+		if err := json.Unmarshal([]byte(payloads[i]), &update); err != nil {
+			t.Fatal(err)
+		}
+		if update["$token"] != token || update["$group_key"] != "company" || update["$group_id"] != "Acme Inc" {
+			t.Errorf("Unexpected update %v", update)
+		}
+		if _, ok := update[op]; !ok {
+			t.Errorf("Expected a %s operation got %v", op, update)
+		}
+	}
+}
+
+func TestWithGroups(t *testing.T) {
+	var buf bytes.Buffer
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf),
+		WithGroups(P{"company_id": "acme", "team_id": []string{"red", "blue"}}))
+
+	mp.Track("12345", "Signed Up", nil)
+	mp.Track("12345", "Invited", &P{"company_id": "globex"})
+	mp.PeopleSet("12345", &P{"Plan": "Pro"})
+
+	var events []map[string]interface{}
+	dec := json.NewDecoder(&buf)
+	for {
+		var envelope Envelope
+		if err := dec.Decode(&envelope); err != nil {
+			break
+		}
+		var msg map[string]interface{}
+		if err := json.Unmarshal(envelope.Data, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if envelope.Endpoint != "events" {
+			if _, ok := msg["company_id"]; ok {
+				t.Errorf("Expected no group on profile updates got %v", msg)
+			}
+			continue
+		}
+		events = append(events, msg["properties"].(map[string]interface{}))
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events got %v", events)
+	}
+	if events[0]["company_id"] != "acme" || !reflect.DeepEqual(events[0]["team_id"], []interface{}{"red", "blue"}) {
+		t.Errorf("Unexpected groups %v", events[0])
+	}
+	if events[1]["company_id"] != "globex" {
+		t.Errorf("Expected the group of the event to be kept got %v", events[1])
+	}
+}
+
+func TestPeopleGroups(t *testing.T) {
+	rs := newRecordingServer()
+	defer rs.Close()
+	c := NewStdConsumer()
+	c.endpoints = rs.endpoints()
+	mp := NewMixpanelWithConsumer(token, c)
+
+	mp.PeopleSetGroup("12345", "company_id", []string{"acme"})
+	mp.PeopleAddGroup("12345", "company_id", "globex")
+	mp.PeopleRemoveGroup("12345", "company_id", "acme")
+
+	payloads := rs.Payloads()
+	if len(payloads) != 3 {
+		t.Fatalf("Expected 3 updates got %v", payloads)
+	}
+	expected := []map[string]interface{}{
+		{"$set": map[string]interface{}{"company_id": []interface{}{"acme"}}},
+		{"$union": map[string]interface{}{"company_id": []interface{}{"globex"}}},
+		{"$remove": map[string]interface{}{"company_id": "acme"}},
+	}
+	for i, want := range expected {
+		var update map[string]interface{}
+		if err := json.Unmarshal([]byte(payloads[i]), &update); err != nil {
+			t.Fatal(err)
+		}
+		for op, value := range want {
+			if !reflect.DeepEqual(update[op], value) {
+				t.Errorf("Expected %s %v got %v", op, value, update)
+			}
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package mixpanel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrInvalidCredentials is wrapped by the errors of ValidateCredentials
+// for credentials Mixpanel rejects.
+var ErrInvalidCredentials = errors.New("mixpanel: invalid credentials")
+
+// endpointURL returns the URL of an endpoint of mp, see WithAPIHost and
+// WithEndpointURL.
+func (mp *Mixpanel) endpointURL(endpoint string) string {
+	if url, ok := mp.endpoints[endpoint]; ok {
+		return url
+	}
+	host := mp.apiHost
+	if host == "" {
+		host = default_api_host
+	}
+	return host + endpointPaths[endpoint]
+}
+
+// httpClient returns the client of the requests mp makes itself.
+func (mp *Mixpanel) httpClient() *http.Client {
+	if mp.client == nil {
+		return defaultHTTPClient
+	}
+	return mp.client
+}
+
+/*
+Ping checks that the ingestion API answers, through the same host,
+proxy and headers as the events. It posts an empty batch of events,
+which tracks nothing, and fails unless the response is a verbose
+response of the API. Example:
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := mp.Ping(ctx); err != nil {
+	    log.Fatalf("Mixpanel is unreachable: %v", err)
+	}
+*/
+func (mp *Mixpanel) Ping(ctx context.Context) error {
+	form := url.Values{}
+	form.Set("data", string(b64([]byte("[]"))))
+	form.Set("verbose", "1")
+	req, id, err := mp.newRequest(ctx, "POST", mp.endpointURL("events"), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := mp.httpClient().Do(req)
+	if err != nil {
+		return &RequestError{RequestID: id, Err: err}
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if err != nil {
+		return &RequestError{RequestID: id, StatusCode: resp.StatusCode, Err: err}
+	}
+	if resp.StatusCode >= 500 {
+		err = fmt.Errorf("mixpanel: ping failed with HTTP %d", resp.StatusCode)
+		return &RequestError{RequestID: id, StatusCode: resp.StatusCode, Err: err}
+	}
+	// an empty batch is rejected, but by the API itself
+	var r Response
+	if err := parseJsonResponse(body, &r); err != nil && r.Status == "" {
+		err = fmt.Errorf("mixpanel: ping got an unexpected response (HTTP %d): %.100s", resp.StatusCode, body)
+		return &RequestError{RequestID: id, StatusCode: resp.StatusCode, Err: err}
+	}
+	return nil
+}
+
+/*
+ValidateCredentials checks the credentials of mp, so that services can
+fail fast at startup: the token must look like a project token, and the
+API secret or the service account, when set, must be accepted by the
+import endpoint, to which it posts an empty batch that imports nothing.
+Errors for rejected credentials wrap ErrInvalidCredentials; others,
+network errors for example, do not.
+*/
+func (mp *Mixpanel) ValidateCredentials(ctx context.Context) error {
+	if !isProjectToken(mp.GetToken()) {
+		return fmt.Errorf("%w: malformed project token", ErrInvalidCredentials)
+	}
+	if !mp.canImport() {
+		return nil
+	}
+	_, _, _, err := mp.postImport(ctx, nil, true)
+	var ie *importError
+	if errors.As(err, &ie) && (ie.StatusCode == http.StatusUnauthorized || ie.StatusCode == http.StatusForbidden) {
+		return fmt.Errorf("%w: import credentials rejected: %s", ErrInvalidCredentials, ie.Message)
+	}
+	return err
+}
+
+// isProjectToken reports whether token looks like a project token, 32
+// hexadecimal digits.
+func isProjectToken(token string) bool {
+	if len(token) != 32 {
+		return false
+	}
+	for _, c := range token {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
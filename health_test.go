@@ -0,0 +1,73 @@
+package mixpanel
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPing(t *testing.T) {
+	var data string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		data = r.Form.Get("data")
+		w.Write([]byte(`{"status": 0, "error": "data, missing or empty"}`))
+	}))
+	defer ts.Close()
+
+	mp := NewMixpanel(token, WithAPIHost(ts.URL))
+	if err := mp.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if data != string(b64([]byte("[]"))) {
+		t.Errorf("Expected an empty batch got %q", data)
+	}
+
+	for _, handler := range []http.HandlerFunc{
+		func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("<html>gateway</html>")) },
+		func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusBadGateway) },
+	} {
+		ts := httptest.NewServer(handler)
+		mp := NewMixpanel(token, WithAPIHost(ts.URL))
+		if err := mp.Ping(context.Background()); err == nil {
+			t.Error("Expected an error")
+		}
+		ts.Close()
+	}
+}
+
+func TestValidateCredentials(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if secret, _, _ := r.BasicAuth(); secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"code": 401, "status": "Unauthorized", "error": "Invalid API secret"}`))
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"code": 400, "status": "Bad Request", "num_records_imported": 0, "error": "no data"}`))
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	for _, test := range []struct {
+		token, secret string
+		invalid       bool
+	}{
+		{token, "", false},
+		{token, "secret", false},
+		{token, "wrong", true},
+		{"not-a-token", "", true},
+	} {
+		mp := NewMixpanel(test.token, WithAPIHost(ts.URL), WithAPISecret(test.secret))
+		if err := mp.ValidateCredentials(ctx); errors.Is(err, ErrInvalidCredentials) != test.invalid {
+			t.Errorf("%s/%s: unexpected error %v", test.token, test.secret, err)
+		}
+	}
+
+	mp := NewMixpanel(token, WithAPIHost("http://127.0.0.1:1"), WithAPISecret("secret"))
+	if err := mp.ValidateCredentials(ctx); err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected a network error got %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package mixpanel
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+/*
+Import records an event that happened at a given time, through the
+import endpoint. Unlike Track it accepts events of any age, which makes
+it the right call for backfills and for delivering events late. It
+needs the project API secret or a service account, see WithAPISecret
+and WithServiceAccount.
+
+Imported events get a random $insert_id, unless prop has one, so that
+Mixpanel discards duplicates when an import is retried. Times out of
+the range of MinImportTime and MaxImportClockSkew are rejected. Example:
+
+	mp.Import("12345", "Signed Up", signupTime, &P{"Plan": "Pro"})
+*/
+func (mp *Mixpanel) Import(distinct_id, event string, at time.Time, prop *P) error {
+	if err := checkImportTime(at, mp.now()); err != nil {
+		return fmt.Errorf("mixpanel: %v", err)
+	}
+	properties := &P{
+		"token":       mp.GetToken(),
+		"distinct_id": distinct_id,
+	}
+	mp.setLib(*properties)
+	properties.Update(prop)
+	(*properties)["time"] = at.Unix()
+	if _, ok := (*properties)[PropInsertID]; !ok {
+		(*properties)[PropInsertID] = mp.newInsertID()
+	}
+
+	return mp.sendEvent("import", distinct_id, event, properties)
+}
+
+// newInsertID returns a random $insert_id.
+func newInsertID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,636 @@
+package mixpanel
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Limits of a single request to the import endpoint.
+const (
+	MaxImportBatch      = 2000
+	MaxImportBatchBytes = 10 << 20
+)
+
+// MinImportTime and MaxImportClockSkew bound the times of the events the
+// import endpoint accepts: events before MinImportTime, or later than
+// MaxImportClockSkew in the future, are rejected as invalid rather than
+// sent to be dropped.
+var MinImportTime = time.Date(1971, 1, 1, 0, 0, 0, 0, time.UTC)
+
+const MaxImportClockSkew = time.Hour
+
+// TimeUnit is the unit of numeric event times, see ImportOptions.
+type TimeUnit int
+
+const (
+	// AutoTimeUnit reads times from 1e11 on as milliseconds, and smaller
+	// ones as seconds.
+	AutoTimeUnit TimeUnit = iota
+	Seconds
+	Milliseconds
+)
+
+/*
+ImportOptions tunes ImportFromReader and the CSV importers.
+
+BatchSize and BatchBytes bound each request, and default to and are
+capped by the limits of the import endpoint. Concurrency is the number
+of requests sent at once, 1 by default. Strict asks Mixpanel to
+validate every event and to report the invalid ones instead of silently
+dropping them, to OnFailed. Progress is called after every batch,
+OnInvalid for every line that cannot be imported, and OnFailed for
+every event Mixpanel rejected, with its line; calls are never
+concurrent.
+
+Rate caps the records sent per second. A batch failing with a network
+error, a 429 or a 5xx status is retried up to MaxRetries times, with an
+exponential backoff.
+
+A long import can be resumed: Checkpoint is called with the number of
+records of the input that were processed, the batches of all of them
+having been sent, and Skip ignores that many records at the start of
+the input of the next attempt.
+
+The time of the events read by ImportFromReader is a number of TimeUnit
+since the epoch, or a string: RFC 3339 times keep their UTC offset, and
+times in TimeLayout or "2006-01-02 15:04:05", without an offset, are in
+Location, the timezone of the project for example, UTC by default.
+Events out of the range of MinImportTime and MaxImportClockSkew are
+invalid.
+*/
+type ImportOptions struct {
+	BatchSize   int
+	BatchBytes  int
+	Concurrency int
+	Strict      bool
+	Progress    func(ImportProgress)
+	OnInvalid   func(line int, data []byte, err error)
+	OnFailed    func(line int, data []byte, record FailedRecord)
+
+	Rate       float64
+	MaxRetries int
+	Skip       int
+	Checkpoint func(records int)
+
+	TimeUnit TimeUnit
+	Location *time.Location
+}
+
+/*
+FailedRecord is an event of a batch that the import endpoint rejected in
+strict mode. Index is its position in the batch, Field names the invalid
+property, such as "properties.time", and Message tells why.
+*/
+type FailedRecord struct {
+	Index    int    `json:"index"`
+	InsertID string `json:"$insert_id"`
+	Field    string `json:"field"`
+	Message  string `json:"message"`
+}
+
+func (r FailedRecord) Error() string {
+	return fmt.Sprintf("%s: %s", r.Field, r.Message)
+}
+
+// ImportProgress counts the events processed so far by an import.
+type ImportProgress struct {
+	// Records read from the input, blank lines aside.
+	Read int
+	// Events accepted by Mixpanel.
+	Imported int
+	// Events rejected by Mixpanel in strict mode.
+	Failed int
+	// Lines that could not be parsed or lack required properties.
+	Invalid int
+	// Requests sent.
+	Batches int
+	// Records skipped at the start of the input, see ImportOptions.Skip.
+	Skipped int
+	// IDs of the requests sent, retries included, see RequestError.
+	RequestIDs []string
+}
+
+/*
+ImportFromReader imports the newline delimited JSON events read from r,
+each in the format of the import endpoint:
+
+	{"event": "Signed Up", "properties": {"time": 1704067200, "distinct_id": "12345"}}
+
+Events are validated, batched, gzipped and posted to the import
+endpoint, which needs the project API secret or a service account, see
+WithServiceAccount. Events without a
+$insert_id get one derived from their content so that a retried import
+does not create duplicates.
+
+It returns the final counts along with the first error that stopped the
+import; invalid lines and events rejected by Mixpanel do not stop it.
+*/
+func (mp *Mixpanel) ImportFromReader(ctx context.Context, r io.Reader, opts *ImportOptions) (*ImportProgress, error) {
+	if opts == nil {
+		opts = &ImportOptions{}
+	}
+	if !mp.canImport() {
+		return nil, errors.New("mixpanel: importing needs the project API secret or a service account, see WithAPISecret")
+	}
+	progress := &ImportProgress{}
+	b := newBatcher(ctx, opts, progress, func(batch [][]byte) (int, []FailedRecord, string, error) {
+		return mp.postImport(ctx, batch, opts.Strict)
+	})
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), MaxImportBatchBytes)
+	for n := 1; scanner.Scan(); n++ {
+		if err := ctx.Err(); err != nil {
+			return progress, b.abort(err)
+		}
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			// blank lines are not records
+			continue
+		}
+		if !b.read() {
+			continue
+		}
+		data, err := importLine(line, opts, mp.now())
+		if err != nil {
+			b.invalid(n, line, err)
+			continue
+		}
+		if err := b.add(n, data, data); err != nil {
+			return progress, b.abort(err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return progress, b.abort(err)
+	}
+	return progress, b.close()
+}
+
+// retryDelay is the delay before the first retry of a batch, doubled
+// for every further one.
+var retryDelay = time.Second
+
+/*
+batcher groups messages into requests bounded in count and size, and
+sends up to Concurrency of them at once. It keeps the progress of an
+import, which is only safe to read once close or abort returned.
+*/
+type batcher struct {
+	ctx        context.Context
+	maxSize    int
+	maxBytes   int
+	send       func([][]byte) (int, []FailedRecord, string, error)
+	onInvalid  func(line int, data []byte, err error)
+	onFailed   func(line int, data []byte, record FailedRecord)
+	report     func(ImportProgress)
+	rate       float64
+	maxRetries int
+	skip       int
+	checkpoint func(records int)
+
+	batch [][]byte
+	// lines are the line numbers of the messages of batch, and sources
+	// the input they were read from, handed to onFailed
+	lines   []int
+	sources [][]byte
+	bytes   int
+	// records is the number of records read, skipped ones included, and
+	// last the position of the last record added to the batch.
+	records int
+	last    int
+
+	// sem bounds the requests in flight when sending concurrently
+	sem chan struct{}
+	wg  sync.WaitGroup
+
+	mu       sync.Mutex
+	progress *ImportProgress
+	err      error
+	// pending lists the batches in flight, in the order of the input
+	pending []*pendingBatch
+	// next is when the rate allows the next batch to be sent
+	next time.Time
+}
+
+// pendingBatch is a batch in flight ending with the record at position
+// end of the input.
+type pendingBatch struct {
+	end  int
+	done bool
+}
+
+// newBatcher returns a batcher handing batches to send, which returns
+// the number of messages accepted, the rejected ones and the ID of the
+// request, if any.
+func newBatcher(ctx context.Context, opts *ImportOptions, progress *ImportProgress, send func([][]byte) (int, []FailedRecord, string, error)) *batcher {
+	b := &batcher{
+		ctx:        ctx,
+		maxSize:    opts.BatchSize,
+		maxBytes:   opts.BatchBytes,
+		send:       send,
+		onInvalid:  opts.OnInvalid,
+		onFailed:   opts.OnFailed,
+		report:     opts.Progress,
+		rate:       opts.Rate,
+		maxRetries: opts.MaxRetries,
+		skip:       opts.Skip,
+		checkpoint: opts.Checkpoint,
+		progress:   progress,
+	}
+	if b.maxSize <= 0 || b.maxSize > MaxImportBatch {
+		b.maxSize = MaxImportBatch
+	}
+	if b.maxBytes <= 0 || b.maxBytes > MaxImportBatchBytes {
+		b.maxBytes = MaxImportBatchBytes
+	}
+	if opts.Concurrency > 1 {
+		b.sem = make(chan struct{}, opts.Concurrency)
+	}
+	return b
+}
+
+// read counts a record read from the input and reports whether it is
+// to be imported, false for the records skipped to resume an import.
+func (b *batcher) read() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.records++
+	if b.records <= b.skip {
+		b.progress.Skipped++
+		return false
+	}
+	b.progress.Read++
+	return true
+}
+
+// invalid counts a record that cannot be imported and reports it.
+func (b *batcher) invalid(line int, data []byte, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.progress.Invalid++
+	if b.onInvalid != nil {
+		b.onInvalid(line, data, err)
+	}
+}
+
+// add adds the message data, read from source at line, to the batch.
+func (b *batcher) add(line int, data, source []byte) error {
+	if len(b.batch) == b.maxSize || b.bytes+len(data)+1 > b.maxBytes {
+		if err := b.flush(); err != nil {
+			return err
+		}
+	}
+	b.batch = append(b.batch, data)
+	b.lines = append(b.lines, line)
+	b.sources = append(b.sources, source)
+	b.bytes += len(data) + 1
+	b.last = b.records
+	return nil
+}
+
+// flush sends the pending batch, in the background when sending
+// concurrently. It returns the first error of any batch.
+func (b *batcher) flush() error {
+	if len(b.batch) == 0 {
+		return b.error()
+	}
+	batch, lines, sources := b.batch, b.lines, b.sources
+	b.batch, b.lines, b.sources, b.bytes = nil, nil, nil, 0
+	b.mu.Lock()
+	pending := &pendingBatch{end: b.last}
+	b.pending = append(b.pending, pending)
+	b.mu.Unlock()
+	if b.sem == nil {
+		imported, failed, err := b.transmit(batch)
+		return b.sent(batch, lines, sources, pending, imported, failed, err)
+	}
+
+	b.sem <- struct{}{}
+	if err := b.error(); err != nil {
+		<-b.sem
+		return err
+	}
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		imported, failed, err := b.transmit(batch)
+		b.sent(batch, lines, sources, pending, imported, failed, err)
+		<-b.sem
+	}()
+	return nil
+}
+
+// transmit sends a batch once the rate allows it, retrying it on
+// transient errors.
+func (b *batcher) transmit(batch [][]byte) (int, []FailedRecord, error) {
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		if err := sleep(b.ctx, b.throttle(len(batch))); err != nil {
+			return 0, nil, err
+		}
+		imported, failed, id, err := b.send(batch)
+		b.requested(id)
+		if err == nil || attempt >= b.maxRetries || !IsTransient(err) {
+			return imported, failed, err
+		}
+		if err := sleep(b.ctx, delay); err != nil {
+			return 0, nil, err
+		}
+		delay *= 2
+	}
+}
+
+// requested records the ID of a request sent, if any.
+func (b *batcher) requested(id string) {
+	if id == "" {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.progress.RequestIDs = append(b.progress.RequestIDs, id)
+}
+
+// throttle reserves n records of the rate and returns how long to wait
+// before sending them.
+func (b *batcher) throttle(n int) time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if b.next.Before(now) {
+		b.next = now
+	}
+	wait := b.next.Sub(now)
+	b.next = b.next.Add(time.Duration(float64(n) / b.rate * float64(time.Second)))
+	return wait
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// sent records the outcome of a batch read from sources at lines.
+func (b *batcher) sent(batch [][]byte, lines []int, sources [][]byte, pending *pendingBatch, imported int, failed []FailedRecord, err error) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err != nil {
+		if b.err == nil {
+			b.err = err
+		}
+		return err
+	}
+	b.progress.Imported += imported
+	b.progress.Failed += len(batch) - imported
+	b.progress.Batches++
+	if b.onFailed != nil {
+		for _, record := range failed {
+			if record.Index >= 0 && record.Index < len(batch) {
+				b.onFailed(lines[record.Index], sources[record.Index], record)
+			}
+		}
+	}
+	if b.report != nil {
+		b.report(*b.progress)
+	}
+
+	// checkpoint the batches sent without a gap before them
+	pending.done = true
+	end := -1
+	for len(b.pending) > 0 && b.pending[0].done {
+		end = b.pending[0].end
+		b.pending = b.pending[1:]
+	}
+	if end >= 0 && b.checkpoint != nil && b.err == nil {
+		b.checkpoint(end)
+	}
+	return nil
+}
+
+func (b *batcher) error() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+// close sends the pending batch and waits for the requests in flight.
+func (b *batcher) close() error {
+	err := b.flush()
+	b.wg.Wait()
+	if err == nil {
+		err = b.error()
+	}
+	if err == nil && b.checkpoint != nil {
+		b.checkpoint(b.records)
+	}
+	return err
+}
+
+// abort waits for the requests in flight and returns err.
+func (b *batcher) abort(err error) error {
+	b.wg.Wait()
+	return err
+}
+
+// importLine validates an event read by ImportFromReader, read at now,
+// converts its string time to milliseconds and adds a $insert_id when it
+// has none.
+func importLine(line []byte, opts *ImportOptions, now time.Time) ([]byte, error) {
+	var event Event
+	if err := unmarshalNumbers(line, &event); err != nil {
+		return nil, err
+	}
+	if event.Event == "" {
+		return nil, errors.New("missing event name")
+	}
+	if event.Properties == nil {
+		return nil, errors.New("missing properties")
+	}
+	props := *event.Properties
+	at, ms, err := importTime(props["time"], opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkImportTime(at, now); err != nil {
+		return nil, err
+	}
+	if _, ok := props["distinct_id"]; !ok {
+		return nil, errors.New("missing distinct_id")
+	}
+	_, hasInsertID := props[PropInsertID]
+	if hasInsertID && ms == "" {
+		return append([]byte(nil), line...), nil
+	}
+	if ms != "" {
+		props["time"] = ms
+	}
+	if hasInsertID {
+		return marshal(&event)
+	}
+	sum := sha1.Sum(line)
+	props[PropInsertID] = hex.EncodeToString(sum[:16])
+	return marshal(&event)
+}
+
+// importTime reads the time of an imported event. String times are also
+// returned in milliseconds, as sent to Mixpanel.
+func importTime(v interface{}, opts *ImportOptions) (time.Time, json.Number, error) {
+	switch v := v.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return time.Time{}, "", fmt.Errorf("invalid time %s", v)
+		}
+		if opts.TimeUnit == Milliseconds || opts.TimeUnit == AutoTimeUnit && math.Abs(f) >= 1e11 {
+			return time.UnixMilli(int64(f)), "", nil
+		}
+		return time.UnixMilli(int64(f * 1000)), "", nil
+	case string:
+		location := opts.Location
+		if location == nil {
+			location = time.UTC
+		}
+		for _, layout := range []string{time.RFC3339Nano, TimeLayout, "2006-01-02 15:04:05"} {
+			if at, err := time.ParseInLocation(layout, v, location); err == nil {
+				return at, json.Number(strconv.FormatInt(at.UnixMilli(), 10)), nil
+			}
+		}
+		return time.Time{}, "", fmt.Errorf("invalid time %q", v)
+	}
+	return time.Time{}, "", errors.New("missing time")
+}
+
+// checkImportTime returns an error for times the import endpoint rejects,
+// at now.
+func checkImportTime(at, now time.Time) error {
+	if at.Before(MinImportTime) || at.After(now.Add(MaxImportClockSkew)) {
+		return fmt.Errorf("time %s out of the range accepted by Mixpanel", at.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// postImport sends a gzipped batch to the import endpoint and returns the
+// number of events imported, in strict mode those rejected, and the ID
+// of the request. Its errors are RequestErrors once the request is sent.
+func (mp *Mixpanel) postImport(ctx context.Context, batch [][]byte, strict bool) (int, []FailedRecord, string, error) {
+	if !mp.Enabled() {
+		return len(batch), nil, "", nil
+	}
+	var body bytes.Buffer
+	gz := gzip.NewWriter(&body)
+	gz.Write(jsonArray(batch))
+	if err := gz.Close(); err != nil {
+		return 0, nil, "", err
+	}
+
+	req, id, err := mp.newRequest(ctx, "POST", mp.endpointURL("import"), &body)
+	if err != nil {
+		return 0, nil, "", err
+	}
+	if strict {
+		// added to the query the endpoint URL may already have
+		query := req.URL.Query()
+		query.Set("strict", "1")
+		req.URL.RawQuery = query.Encode()
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	mp.authorizeImport(req)
+
+	imported, failed, status, err := mp.doImport(req, strict)
+	if err != nil {
+		err = &RequestError{RequestID: id, StatusCode: status, Err: err}
+	}
+	return imported, failed, id, err
+}
+
+// doImport sends the import request req of postImport, and returns the
+// HTTP status of the response along with its outcome.
+func (mp *Mixpanel) doImport(req *http.Request, strict bool) (int, []FailedRecord, int, error) {
+	resp, err := mp.httpClient().Do(req)
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	io.Copy(io.Discard, resp.Body)
+	if err != nil {
+		return 0, nil, resp.StatusCode, err
+	}
+
+	var response struct {
+		NumRecordsImported int            `json:"num_records_imported"`
+		Status             string         `json:"status"`
+		Error              string         `json:"error"`
+		FailedRecords      []FailedRecord `json:"failed_records"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			// answered by a gateway rather than by Mixpanel
+			return 0, nil, resp.StatusCode, &statusError{resp.StatusCode, string(data)}
+		}
+		return 0, nil, resp.StatusCode, fmt.Errorf("Cannot interpret Mixpanel server response: %s", data)
+	}
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return response.NumRecordsImported, nil, resp.StatusCode, nil
+	case resp.StatusCode == http.StatusBadRequest && strict:
+		// the valid events of the batch were imported
+		return response.NumRecordsImported, response.FailedRecords, resp.StatusCode, nil
+	}
+	return 0, nil, resp.StatusCode, &importError{resp.StatusCode, response.Error}
+}
+
+// importError is an error status of the import endpoint.
+type importError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *importError) Error() string {
+	return fmt.Sprintf("Mixpanel import error (%d): %s", e.StatusCode, e.Message)
+}
+
+// IsTransient reports whether a request failing with err is worth
+// retrying: the network failed, or Mixpanel is overloaded or rate
+// limiting the requests.
+func IsTransient(err error) bool {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.StatusCode == http.StatusTooManyRequests || se.StatusCode >= 500
+	}
+	var ie *importError
+	if errors.As(err, &ie) {
+		return ie.StatusCode == http.StatusTooManyRequests || ie.StatusCode >= 500
+	}
+	var qe *QueryError
+	if errors.As(err, &qe) {
+		return qe.StatusCode == http.StatusTooManyRequests || qe.StatusCode >= 500
+	}
+	return isNetworkError(err)
+}
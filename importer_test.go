@@ -0,0 +1,305 @@
+package mixpanel
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestImportFromReader(t *testing.T) {
+	var batches []int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "gzip" || r.URL.Query().Get("strict") != "1" {
+			t.Errorf("Unexpected request %s %v", r.URL, r.Header)
+		}
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var events []Event
+		if err := json.NewDecoder(gz).Decode(&events); err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range events {
+			if _, ok := (*e.Properties)[PropInsertID]; !ok {
+				t.Errorf("Expected an $insert_id in %v", e.Properties)
+			}
+		}
+		batches = append(batches, len(events))
+		fmt.Fprintf(w, `{"code": 200, "num_records_imported": %d, "status": "OK"}`, len(events))
+	}))
+	defer ts.Close()
+
+	var input strings.Builder
+	for i := 0; i < 5; i++ {
+		fmt.Fprintf(&input, `{"event": "Signed Up", "properties": {"time": %d, "distinct_id": "user-%d"}}`+"\n", 1704067200+i, i)
+	}
+	input.WriteString("\n  \n")
+	input.WriteString("not json\n")
+	input.WriteString(`{"event": "Signed Up", "properties": {"distinct_id": "no time"}}` + "\n")
+
+	mp := NewMixpanel(token, WithAPIHost(ts.URL), WithAPISecret("secret"))
+	var invalid []int
+	var updates int
+	progress, err := mp.ImportFromReader(context.Background(), strings.NewReader(input.String()), &ImportOptions{
+		BatchSize: 2,
+		Strict:    true,
+		Progress:  func(ImportProgress) { updates++ },
+		OnInvalid: func(line int, data []byte, err error) { invalid = append(invalid, line) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(batches) != "[2 2 1]" || updates != 3 {
+		t.Errorf("Expected batches [2 2 1] got %v (%d updates)", batches, updates)
+	}
+	if progress.Read != 7 || progress.Imported != 5 || progress.Invalid != 2 || fmt.Sprint(invalid) != "[8 9]" {
+		t.Errorf("Unexpected progress %+v, invalid lines %v", progress, invalid)
+	}
+}
+
+func TestImportStrictEndpointQuery(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if query := r.URL.Query(); query.Get("strict") != "1" || query.Get("project_id") != "1" {
+			t.Errorf("Unexpected query %q", r.URL.RawQuery)
+		}
+		w.Write([]byte(`{"code": 200, "num_records_imported": 1, "status": "OK"}`))
+	}))
+	defer ts.Close()
+
+	mp := NewMixpanel(token, WithEndpointURL("import", ts.URL+"/import?project_id=1"), WithAPISecret("secret"))
+	input := `{"event": "Signed Up", "properties": {"time": 1704067200, "distinct_id": "12345"}}`
+	if _, err := mp.ImportFromReader(context.Background(), strings.NewReader(input), &ImportOptions{Strict: true}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportFromReaderConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	var inFlight, maxInFlight, events int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+
+		gz, _ := gzip.NewReader(r.Body)
+		var batch []Event
+		json.NewDecoder(gz).Decode(&batch)
+		mu.Lock()
+		inFlight--
+		events += len(batch)
+		mu.Unlock()
+		fmt.Fprintf(w, `{"code": 200, "num_records_imported": %d, "status": "OK"}`, len(batch))
+	}))
+	defer ts.Close()
+
+	var input strings.Builder
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&input, `{"event": "Signed Up", "properties": {"time": %d, "distinct_id": "user-%d"}}`+"\n", 1704067200+i, i)
+	}
+	mp := NewMixpanel(token, WithAPIHost(ts.URL), WithAPISecret("secret"))
+	progress, err := mp.ImportFromReader(context.Background(), strings.NewReader(input.String()), &ImportOptions{
+		BatchSize:   5,
+		Concurrency: 4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.Imported != 40 || progress.Batches != 8 || events != 40 {
+		t.Errorf("Unexpected progress %+v, %d events received", progress, events)
+	}
+	if maxInFlight < 2 || maxInFlight > 4 {
+		t.Errorf("Expected between 2 and 4 requests in flight got %d", maxInFlight)
+	}
+}
+
+func TestImportRetriesAndResumes(t *testing.T) {
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = time.Millisecond
+
+	var requests int
+	var imported []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		gz, _ := gzip.NewReader(r.Body)
+		var batch []Event
+		json.NewDecoder(gz).Decode(&batch)
+		// the second batch is rate limited once, then the third one fails
+		switch {
+		case requests == 2:
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"code": 429, "error": "too many requests", "status": "Error"}`))
+			return
+		case len(imported) == 4 && requests < 10:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code": 400, "error": "invalid", "status": "Error"}`))
+			return
+		}
+		for _, e := range batch {
+			imported = append(imported, (*e.Properties)["distinct_id"].(string))
+		}
+		fmt.Fprintf(w, `{"code": 200, "num_records_imported": %d, "status": "OK"}`, len(batch))
+	}))
+	defer ts.Close()
+
+	var input strings.Builder
+	for i := 0; i < 6; i++ {
+		fmt.Fprintf(&input, `{"event": "Signed Up", "properties": {"time": %d, "distinct_id": "u%d"}}`+"\n", 1704067200+i, i)
+	}
+	mp := NewMixpanel(token, WithAPIHost(ts.URL), WithAPISecret("secret"))
+	checkpoint := 0
+	opts := &ImportOptions{
+		BatchSize:  2,
+		MaxRetries: 1,
+		Checkpoint: func(records int) { checkpoint = records },
+	}
+	if _, err := mp.ImportFromReader(context.Background(), strings.NewReader(input.String()), opts); err == nil {
+		t.Fatalf("Expected the invalid batch to stop the import")
+	}
+	if checkpoint != 4 || len(imported) != 4 {
+		t.Fatalf("Expected a checkpoint after 4 records got %d, imported %v", checkpoint, imported)
+	}
+
+	requests = 10
+	opts.Skip = checkpoint
+	progress, err := mp.ImportFromReader(context.Background(), strings.NewReader(input.String()), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.Skipped != 4 || progress.Read != 2 || checkpoint != 6 || fmt.Sprint(imported) != "[u0 u1 u2 u3 u4 u5]" {
+		t.Errorf("Unexpected resumed import %+v, checkpoint %d, imported %v", progress, checkpoint, imported)
+	}
+}
+
+func TestImportRetriesGatewayErrors(t *testing.T) {
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = time.Millisecond
+
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests++; requests < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte(`<html><body>502 Bad Gateway</body></html>`))
+			return
+		}
+		w.Write([]byte(`{"code": 200, "num_records_imported": 1, "status": "OK"}`))
+	}))
+	defer ts.Close()
+
+	mp := NewMixpanel(token, WithAPIHost(ts.URL), WithAPISecret("secret"))
+	input := `{"event": "Signed Up", "properties": {"time": 1704067200, "distinct_id": "12345"}}`
+	progress, err := mp.ImportFromReader(context.Background(), strings.NewReader(input), &ImportOptions{MaxRetries: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests != 3 || progress.Imported != 1 {
+		t.Errorf("Expected the gateway errors to be retried, got %d requests and %+v", requests, progress)
+	}
+	if err := parseImportResponse([]byte(`<html></html>`), &Response{StatusCode: http.StatusServiceUnavailable}); !IsTransient(err) {
+		t.Errorf("Expected a transient error for the import endpoint got %v", err)
+	}
+}
+
+func TestImportRate(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code": 200, "num_records_imported": 10, "status": "OK"}`))
+	}))
+	defer ts.Close()
+
+	var input strings.Builder
+	for i := 0; i < 30; i++ {
+		fmt.Fprintf(&input, `{"event": "Signed Up", "properties": {"time": %d, "distinct_id": "u%d"}}`+"\n", 1704067200+i, i)
+	}
+	mp := NewMixpanel(token, WithAPIHost(ts.URL), WithAPISecret("secret"))
+	start := time.Now()
+	// the first batch goes right away, the next two wait 50ms each
+	_, err := mp.ImportFromReader(context.Background(), strings.NewReader(input.String()), &ImportOptions{BatchSize: 10, Rate: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Expected the rate to slow the import down, took %v", elapsed)
+	}
+}
+
+func TestImportTimes(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	paris, _ := time.LoadLocation("Europe/Paris")
+	for _, c := range []struct {
+		time     string
+		opts     ImportOptions
+		expected string
+	}{
+		{`1704067200`, ImportOptions{}, `"time": 1704067200}`},
+		{`1704067200123`, ImportOptions{}, `"time": 1704067200123}`},
+		{`1704067200123`, ImportOptions{TimeUnit: Seconds}, "out of the range"},
+		{`1704067200`, ImportOptions{TimeUnit: Milliseconds}, "out of the range"},
+		{`"2024-01-01T01:00:00+01:00"`, ImportOptions{Location: paris}, `"time":1704067200000`},
+		{`"2024-01-01T01:00:00"`, ImportOptions{Location: paris}, `"time":1704067200000`},
+		{`"2024-01-01 00:00:00"`, ImportOptions{}, `"time":1704067200000`},
+		{`"yesterday"`, ImportOptions{}, "invalid time"},
+		{`0`, ImportOptions{}, "out of the range"},
+		{`1717203000`, ImportOptions{}, `"time": 1717203000}`},
+		{`1717300000`, ImportOptions{}, "out of the range"},
+		{`true`, ImportOptions{}, "missing time"},
+	} {
+		line := `{"event": "Signed Up", "properties": {"distinct_id": "12345", "$insert_id": "a", "time": ` + c.time + `}}`
+		data, err := importLine([]byte(line), &c.opts, now)
+		got := string(data)
+		if err != nil {
+			got = err.Error()
+		}
+		if !strings.Contains(got, c.expected) {
+			t.Errorf("%s %+v: expected %s got %s", c.time, c.opts, c.expected, got)
+		}
+	}
+}
+
+func TestImportFailedRecords(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"code": 400, "num_records_imported": 2, "status": "Bad Request",
+			"error": "some data points in the request failed validation",
+			"failed_records": [{"index": 1, "$insert_id": "b", "field": "properties.time", "message": "'properties.time' is invalid"}]}`))
+	}))
+	defer ts.Close()
+
+	input := `{"event": "A", "properties": {"time": 1704067200, "distinct_id": "1", "$insert_id": "a"}}
+
+{"event": "B", "properties": {"time": 1704067200, "distinct_id": "2", "$insert_id": "b"}}
+{"event": "C", "properties": {"time": 1704067200, "distinct_id": "3", "$insert_id": "c"}}
+`
+	mp := NewMixpanel(token, WithAPIHost(ts.URL), WithAPISecret("secret"))
+	var lines []int
+	var records []FailedRecord
+	progress, err := mp.ImportFromReader(context.Background(), strings.NewReader(input), &ImportOptions{
+		Strict: true,
+		OnFailed: func(line int, data []byte, record FailedRecord) {
+			if !strings.Contains(string(data), `"event": "B"`) {
+				t.Errorf("Expected the rejected event got %s", data)
+			}
+			lines = append(lines, line)
+			records = append(records, record)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.Imported != 2 || progress.Failed != 1 {
+		t.Errorf("Unexpected progress %+v", progress)
+	}
+	if fmt.Sprint(lines) != "[3]" || len(records) != 1 || records[0].InsertID != "b" || records[0].Field != "properties.time" {
+		t.Errorf("Unexpected failed records %v at lines %v", records, lines)
+	}
+}
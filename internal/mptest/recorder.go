@@ -0,0 +1,40 @@
+// Package mptest holds the test support shared by the packages of the
+// library.
+package mptest
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+)
+
+// Recorder is a consumer keeping the events it is given.
+type Recorder struct {
+	mu     sync.Mutex
+	events []mixpanel.Event
+}
+
+func (rc *Recorder) Send(ctx context.Context, endpoint string, msgs [][]byte) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	for _, msg := range msgs {
+		var e mixpanel.Event
+		if err := json.Unmarshal(msg, &e); err != nil {
+			return err
+		}
+		rc.events = append(rc.events, e)
+	}
+	return nil
+}
+
+func (rc *Recorder) Flush(ctx context.Context) error { return nil }
+func (rc *Recorder) Close(ctx context.Context) error { return nil }
+
+// Events returns the events recorded so far.
+func (rc *Recorder) Events() []mixpanel.Event {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]mixpanel.Event(nil), rc.events...)
+}
@@ -0,0 +1,47 @@
+package mixpanel
+
+import (
+	"os"
+	"strconv"
+)
+
+// DisableEnv is the environment variable disabling every client, see
+// Disable.
+const DisableEnv = "MIXPANEL_DISABLED"
+
+/*
+Disable turns every call sending to Mixpanel into a no-op returning nil,
+until Enable: tracking, profile and group updates, imports. Messages are
+still validated and go through the middleware, so that disabled clients
+behave like enabled ones in tests and local development. Messages the
+consumer buffered before still go out with the next Flush.
+
+Clients created while MIXPANEL_DISABLED is set to anything but a false
+value ("false", "0"...) are disabled for good, whatever Enable; use it
+to switch tracking off without touching the code. Clients obtained by
+WithToken share the switch of their parent. It is safe for concurrent
+use.
+*/
+func (mp *Mixpanel) Disable() {
+	mp.disabled.Store(true)
+}
+
+// Enable undoes Disable.
+func (mp *Mixpanel) Enable() {
+	mp.disabled.Store(false)
+}
+
+// Enabled reports whether mp sends to Mixpanel, see Disable.
+func (mp *Mixpanel) Enabled() bool {
+	return !mp.disabledByEnv && !mp.disabled.Load()
+}
+
+// disabledByEnv reports whether MIXPANEL_DISABLED disables the clients.
+func disabledByEnv() bool {
+	s := os.Getenv(DisableEnv)
+	if s == "" {
+		return false
+	}
+	b, err := strconv.ParseBool(s)
+	return err != nil || b
+}
@@ -0,0 +1,72 @@
+package mixpanel
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDisable(t *testing.T) {
+	var buf bytes.Buffer
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf), WithValidation(nil))
+	tenant := mp.WithToken("tenant")
+
+	mp.Disable()
+	if mp.Enabled() || tenant.Enabled() {
+		t.Fatal("Expected the clients to be disabled")
+	}
+	if err := mp.Track("12345", "Viewed", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := tenant.PeopleSet("12345", &P{"plan": "pro"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := mp.Track("12345", "", nil); err == nil {
+		t.Error("Expected disabled clients to still validate events")
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("Expected nothing sent got %s", buf.String())
+	}
+
+	mp.Enable()
+	if err := tenant.Track("12345", "Viewed", nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"token":"tenant"`) {
+		t.Errorf("Expected the event once enabled got %s", buf.String())
+	}
+}
+
+func TestDisableImport(t *testing.T) {
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer ts.Close()
+
+	mp := NewMixpanel(token, WithAPIHost(ts.URL), WithAPISecret("secret"))
+	mp.Disable()
+	progress, err := mp.ImportFromReader(context.Background(), strings.NewReader(
+		`{"event": "Signed Up", "properties": {"distinct_id": "12345", "time": 1700000000}}`+"\n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.Imported != 1 || requests.Load() != 0 {
+		t.Errorf("Expected a silent import got %+v and %d requests", progress, requests.Load())
+	}
+}
+
+func TestDisabledByEnv(t *testing.T) {
+	for value, disabled := range map[string]bool{"": false, "false": false, "0": false, "true": true, "1": true, "yes": true} {
+		t.Setenv(DisableEnv, value)
+		mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&bytes.Buffer{}))
+		mp.Enable()
+		if mp.Enabled() == disabled {
+			t.Errorf("%s=%q: expected disabled %v", DisableEnv, value, disabled)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package mixpanel
+
+// Version is the version of the library, sent as the $lib_version of
+// the events and in DefaultUserAgent. It is bumped with every release,
+// to match the tag of the release.
+const Version = "0.2.0"
+
+// DefaultLib is the mp_lib of the events, see WithLib.
+const DefaultLib = "go"
+
+/*
+WithLib replaces the mp_lib and $lib_version of the events, so that
+SDKs wrapping this library report themselves rather than it. Empty
+values keep DefaultLib and Version. Example:
+
+	mp := NewMixpanel(token, WithLib("acme-go", acme.Version))
+*/
+func WithLib(name, version string) Option {
+	return func(mp *Mixpanel) {
+		mp.lib = name
+		mp.libVersion = version
+	}
+}
+
+/*
+WithProcessingTime sets the mp_processing_time_ms of the events to the
+time, in milliseconds, at which they go through the middleware, so that
+the delay between an event and its processing can be measured, by
+comparing it to the time of imported events for example. Middleware
+added before it sees events without it.
+*/
+func WithProcessingTime() Option {
+	return func(mp *Mixpanel) {
+		mp.middleware = append(mp.middleware, func(msg *Message) error {
+			if msg.IsEvent() {
+				(*msg.Properties)[PropProcessingTime] = mp.now().UnixMilli()
+			}
+			return nil
+		})
+	}
+}
+
+// setLib sets the mp_lib and $lib_version of properties.
+func (mp *Mixpanel) setLib(properties P) {
+	properties[PropLib], properties[PropLibVersion] = mp.libProperties()
+}
+
+// libProperties returns the mp_lib and $lib_version of mp.
+func (mp *Mixpanel) libProperties() (lib, version string) {
+	lib, version = DefaultLib, Version
+	if mp.lib != "" {
+		lib = mp.lib
+	}
+	if mp.libVersion != "" {
+		version = mp.libVersion
+	}
+	return lib, version
+}
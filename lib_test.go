@@ -0,0 +1,45 @@
+package mixpanel
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLibProperties(t *testing.T) {
+	var buf bytes.Buffer
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf))
+	mp.Track("12345", "Viewed", nil)
+	if s := `"$lib_version":"` + Version + `"`; !strings.Contains(buf.String(), s) || !strings.Contains(buf.String(), `"mp_lib":"go"`) {
+		t.Errorf("Expected %s and the default mp_lib got %s", s, buf.String())
+	}
+
+	buf.Reset()
+	mp = NewMixpanelWithConsumer(token, NewWriterConsumer(&buf), WithLib("acme-go", "1.2.3"))
+	mp.Track("12345", "Viewed", nil)
+	mp.WithToken(token).Import("12345", "Signed Up", time.Now(), nil)
+	if got := strings.Count(buf.String(), `"mp_lib":"acme-go"`); got != 2 {
+		t.Errorf("Expected mp_lib acme-go on both events got %s", buf.String())
+	}
+	if got := strings.Count(buf.String(), `"$lib_version":"1.2.3"`); got != 2 {
+		t.Errorf("Expected $lib_version 1.2.3 on both events got %s", buf.String())
+	}
+}
+
+func TestWithProcessingTime(t *testing.T) {
+	var buf bytes.Buffer
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf),
+		WithClock(ClockFunc(func() time.Time { return at })), WithProcessingTime())
+	mp.Track("12345", "Viewed", nil)
+	mp.PeopleSet("12345", &P{"plan": "pro"})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if !strings.Contains(lines[0], `"mp_processing_time_ms":1704110400000`) {
+		t.Errorf("Expected the processing time on the event got %s", lines[0])
+	}
+	if strings.Contains(lines[1], "mp_processing_time_ms") {
+		t.Errorf("Expected no processing time on the profile update got %s", lines[1])
+	}
+}
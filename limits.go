@@ -0,0 +1,233 @@
+package mixpanel
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// Mixpanel limits enforced by Limits when its fields are zero.
+const (
+	DefaultMaxStringLength = 255
+	DefaultMaxProperties   = 255
+	DefaultMaxListLength   = 255
+)
+
+// LimitAction is what Limits does with the values over a limit.
+type LimitAction int
+
+const (
+	// TruncateOverLimit shortens long strings and lists, and leaves out
+	// the extra properties, last in sorted order.
+	TruncateOverLimit LimitAction = iota
+	// DropOverLimit leaves out long strings and lists, and drops the
+	// messages with too many properties.
+	DropOverLimit
+	// RejectOverLimit fails the call with a *ValidationError.
+	RejectOverLimit
+)
+
+// propertyOperations are the operations of people and group updates
+// whose value is an object of properties.
+var propertyOperations = []string{"$set", "$set_once", "$add", "$append", "$union", "$remove"}
+
+/*
+Limits enforces the limits of Mixpanel on the properties of events and
+of people and group updates, rather than leaving Mixpanel to truncate or
+reject them: strings of at most MaxStringLength characters, lists of at
+most MaxListLength items, including the strings in lists, and at most
+MaxProperties properties. Action chooses what happens to the values over
+a limit. The reserved properties, see KeyNormalizer, are left as is.
+Example:
+
+	limits := &Limits{Action: TruncateOverLimit}
+	mp := NewMixpanel(token, WithLimits(limits))
+	...
+	hits := limits.Hits()
+
+Hits counts how often each limit was hit, for metrics.
+*/
+type Limits struct {
+	MaxStringLength int
+	MaxProperties   int
+	MaxListLength   int
+	Action          LimitAction
+
+	longStrings  atomic.Uint64
+	longLists    atomic.Uint64
+	tooManyProps atomic.Uint64
+}
+
+// LimitHits counts the values found over the limits of a Limits.
+type LimitHits struct {
+	LongStrings       uint64
+	LongLists         uint64
+	TooManyProperties uint64
+}
+
+// WithLimits enforces l on every event and people and group update.
+func WithLimits(l *Limits) Option {
+	return WithMiddleware(l.Enforce)
+}
+
+// Hits returns the counts of values found over the limits.
+func (l *Limits) Hits() LimitHits {
+	return LimitHits{
+		LongStrings:       l.longStrings.Load(),
+		LongLists:         l.longLists.Load(),
+		TooManyProperties: l.tooManyProps.Load(),
+	}
+}
+
+// Enforce implements Middleware.
+func (l *Limits) Enforce(msg *Message) error {
+	if msg.Properties == nil {
+		return nil
+	}
+	if msg.IsEvent() {
+		props, err := l.limit(msg, *msg.Properties)
+		if err != nil {
+			return err
+		}
+		msg.Properties = &props
+		return nil
+	}
+	update := make(P, len(*msg.Properties))
+	for key, value := range *msg.Properties {
+		update[key] = value
+	}
+	for _, op := range propertyOperations {
+		if m, ok := objectValue(update[op]); ok {
+			props, err := l.limit(msg, m)
+			if err != nil {
+				return err
+			}
+			update[op] = props
+		}
+	}
+	msg.Properties = &update
+	return nil
+}
+
+// limit returns a copy of props within the limits.
+func (l *Limits) limit(msg *Message, props P) (P, error) {
+	limited := make(P, len(props))
+	for key, value := range props {
+		value, keep, err := l.limitValue(msg, key, value)
+		if err != nil {
+			return nil, err
+		}
+		if keep {
+			limited[key] = value
+		}
+	}
+
+	max := l.MaxProperties
+	if max <= 0 {
+		max = DefaultMaxProperties
+	}
+	if len(limited) <= max {
+		return limited, nil
+	}
+	l.tooManyProps.Add(1)
+	switch l.Action {
+	case DropOverLimit:
+		return nil, ErrSkipped
+	case RejectOverLimit:
+		return nil, &ValidationError{Event: msg.Event, Reason: fmt.Sprintf("more than %d properties", max)}
+	}
+	var extra []string
+	for key := range limited {
+		if !reservedKey(key) {
+			extra = append(extra, key)
+		}
+	}
+	sort.Strings(extra)
+	for len(limited) > max && len(extra) > 0 {
+		delete(limited, extra[len(extra)-1])
+		extra = extra[:len(extra)-1]
+	}
+	return limited, nil
+}
+
+// limitValue returns value within the limits, or false to leave it out.
+func (l *Limits) limitValue(msg *Message, key string, value interface{}) (interface{}, bool, error) {
+	maxString := l.MaxStringLength
+	if maxString <= 0 {
+		maxString = DefaultMaxStringLength
+	}
+	maxList := l.MaxListLength
+	if maxList <= 0 {
+		maxList = DefaultMaxListLength
+	}
+	over := func(counter *atomic.Uint64, reason string) (interface{}, bool, error) {
+		counter.Add(1)
+		if l.Action == RejectOverLimit {
+			return nil, false, &ValidationError{Event: msg.Event, Property: key, Reason: reason}
+		}
+		return nil, false, nil
+	}
+
+	if reservedKey(key) {
+		return value, true, nil
+	}
+	if s, ok := value.(string); ok {
+		if utf8.RuneCountInString(s) <= maxString {
+			return s, true, nil
+		}
+		if l.Action != TruncateOverLimit {
+			return over(&l.longStrings, fmt.Sprintf("string longer than %d characters", maxString))
+		}
+		l.longStrings.Add(1)
+		return truncateString(s, maxString), true, nil
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array || rv.Type().Elem().Kind() == reflect.Uint8 {
+		return value, true, nil
+	}
+	n := rv.Len()
+	longItem := false
+	for i := 0; i < n && i < maxList; i++ {
+		if s, ok := rv.Index(i).Interface().(string); ok && utf8.RuneCountInString(s) > maxString {
+			longItem = true
+			break
+		}
+	}
+	if n <= maxList && !longItem {
+		return value, true, nil
+	}
+	if n > maxList {
+		if l.Action != TruncateOverLimit {
+			return over(&l.longLists, fmt.Sprintf("list longer than %d items", maxList))
+		}
+		l.longLists.Add(1)
+		n = maxList
+	}
+	list := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		item := rv.Index(i).Interface()
+		if s, ok := item.(string); ok && utf8.RuneCountInString(s) > maxString {
+			if l.Action != TruncateOverLimit {
+				return over(&l.longStrings, fmt.Sprintf("string longer than %d characters", maxString))
+			}
+			l.longStrings.Add(1)
+			item = truncateString(s, maxString)
+		}
+		list = append(list, item)
+	}
+	return list, true, nil
+}
+
+// truncateString returns the first n characters of s.
+func truncateString(s string, n int) string {
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
@@ -0,0 +1,72 @@
+package mixpanel
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	long := strings.Repeat("é", 300)
+	props := func() *P {
+		p := &P{
+			"Note":   long,
+			"Tags":   []string{"a", long, "c"},
+			"Search": "fine",
+		}
+		for i := 0; i < 8; i++ {
+			(*p)[fmt.Sprintf("Z Extra %d", i)] = i
+		}
+		return p
+	}
+
+	limits := &Limits{MaxProperties: 10, MaxListLength: 2}
+	msg := &Message{Endpoint: "events", Event: "Search", DistinctID: "12345", Properties: props()}
+	(*msg.Properties)["distinct_id"] = "12345"
+	if err := limits.Enforce(msg); err != nil {
+		t.Fatal(err)
+	}
+	p := *msg.Properties
+	if len(p) != 10 || p["distinct_id"] != "12345" || p["Z Extra 0"] != 0 || p["Z Extra 7"] != nil {
+		t.Errorf("Expected 10 properties, the reserved ones kept, got %v", p)
+	}
+	if s := p["Note"].(string); s != long[:2*255] {
+		t.Errorf("Expected Note truncated to 255 characters got %d", len([]rune(s)))
+	}
+	if tags := p["Tags"].([]interface{}); len(tags) != 2 || tags[1] != long[:2*255] {
+		t.Errorf("Unexpected Tags %v", tags)
+	}
+	if hits := limits.Hits(); hits != (LimitHits{LongStrings: 2, LongLists: 1, TooManyProperties: 1}) {
+		t.Errorf("Unexpected hits %+v", hits)
+	}
+
+	limits = &Limits{Action: DropOverLimit}
+	msg = &Message{Endpoint: "events", Event: "Search", DistinctID: "12345", Properties: props()}
+	if err := limits.Enforce(msg); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := (*msg.Properties)["Note"]; ok || len(*msg.Properties) != 9 {
+		t.Errorf("Expected Note and Tags to be dropped got %v", *msg.Properties)
+	}
+
+	limits = &Limits{Action: RejectOverLimit}
+	msg = &Message{Endpoint: "events", Event: "Search", DistinctID: "12345", Properties: props()}
+	var verr *ValidationError
+	if err := limits.Enforce(msg); !errors.As(err, &verr) {
+		t.Errorf("Expected a ValidationError got %v", err)
+	}
+}
+
+func TestWithLimitsPeople(t *testing.T) {
+	var buf bytes.Buffer
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf), WithLimits(&Limits{MaxStringLength: 3}))
+	set := &P{"Plan": "Enterprise"}
+	if err := mp.PeopleSet("12345", set); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"Plan":"Ent"`) || (*set)["Plan"] != "Enterprise" {
+		t.Errorf("Expected a truncated copy of the properties got %s", buf.String())
+	}
+}
@@ -0,0 +1,64 @@
+package mixpanel
+
+import (
+	"errors"
+)
+
+/*
+Message is a payload on its way to the consumer, before serialization.
+
+For events Properties holds the event properties, including token and
+distinct_id. For people and group updates it holds the whole update
+record ($token, $distinct_id or $group_key and $group_id, and the
+operation). Middleware may rewrite both Event and Properties.
+*/
+type Message struct {
+	Endpoint   string
+	Event      string
+	DistinctID string
+	Properties *P
+}
+
+// IsEvent reports whether the message is a tracked or imported event.
+func (m *Message) IsEvent() bool {
+	return m.Endpoint == "events" || m.Endpoint == "import"
+}
+
+// Middleware inspects or rewrites every message before it is serialized.
+// Returning ErrSkipped drops the message without reporting an error to
+// the caller; any other error aborts the call.
+type Middleware func(msg *Message) error
+
+// ErrSkipped is returned by middleware to drop a message silently.
+var ErrSkipped = errors.New("mixpanel: message skipped")
+
+// WithMiddleware appends middleware to the processing chain.
+func WithMiddleware(mw ...Middleware) Option {
+	return func(mp *Mixpanel) {
+		mp.middleware = append(mp.middleware, mw...)
+	}
+}
+
+// Use appends middleware to the processing chain. It must not be called
+// concurrently with tracking.
+func (mp *Mixpanel) Use(mw ...Middleware) {
+	mp.middleware = append(mp.middleware, mw...)
+}
+
+// process runs the middleware chain in order, stopping at the first error.
+func (mp *Mixpanel) process(msg *Message) error {
+	for _, mw := range mp.middleware {
+		if err := mw(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipped turns ErrSkipped into a successful call.
+func skipped(err error) error {
+	if errors.Is(err, ErrSkipped) {
+		return nil
+	}
+	return err
+}
@@ -12,15 +12,11 @@ customize the IO characteristics of their tracking.
 package mixpanel
 
 import (
-	"bytes"
-	"encoding/base64"
-	"encoding/json"
-	"errors"
-	"fmt"
-	"io"
+	"context"
 	"net/http"
 	"net/url"
-	"strconv"
+	"regexp"
+	"sync/atomic"
 	"time"
 )
 
@@ -42,35 +38,54 @@ type Event struct {
 	Properties *P     `json:"properties"`
 }
 
-type Consumer interface {
-	Send(endpoint string, json_msg []byte) error
-}
-
 type Mixpanel struct {
-	Token   string `json:token`
-	verbose bool
-	c       Consumer
+	// Token is the token the Mixpanel object was created with.
+	//
+	// Deprecated: use GetToken, which reflects SetToken and is safe for
+	// concurrent use.
+	Token string `json:"token"`
+	token atomic.Pointer[string]
+	config
 }
 
-const events_endpoint string = "https://api.mixpanel.com/track"
-const people_endpoint string = "https://api.mixpanel.com/engage"
-
-func b64(payload []byte) []byte {
-	var b bytes.Buffer
-	encoder := base64.NewEncoder(base64.URLEncoding, &b)
-	encoder.Write(payload)
-	encoder.Close()
-	return b.Bytes()[:b.Len()]
+// config is the configuration of a Mixpanel object, copied as is by
+// WithToken.
+type config struct {
+	apiSecret       string
+	serviceAccount  *ServiceAccount
+	apiHost         string
+	endpoints       map[string]string
+	client          *http.Client
+	header          http.Header
+	userAgent       string
+	requestIDHeader string
+	verbose         bool
+	c               Consumer
+	middleware      []Middleware
+	priority        []*regexp.Regexp
+	shutdown        *shutdown
+	flushTimeout    time.Duration
+	optOut          *optOut
+	clock           Clock
+	ids             IDGenerator
+	lib             string
+	libVersion      string
+	// disabled is shared with the clones of WithToken.
+	disabled      *atomic.Bool
+	disabledByEnv bool
 }
 
+// Option configures optional behavior of a Mixpanel object.
+type Option func(mp *Mixpanel)
+
 /*
 NewMixpanel Creates a new Mixpanel object, which can be used for all tracking.
 
 To use mixpanel, create a new Mixpanel object using your
 token.  Takes in a user token and uses a StdConsumer
 */
-func NewMixpanel(token string) *Mixpanel {
-	return NewMixpanelWithConsumer(token, NewStdConsumer())
+func NewMixpanel(token string, opts ...Option) *Mixpanel {
+	return NewMixpanelWithConsumer(token, NewStdConsumer(), opts...)
 }
 
 /*
@@ -82,12 +97,198 @@ anything else with a send() method). If no consumer is
 provided, Mixpanel will use the default Consumer, which
 communicates one synchronous request for every message.
 */
-func NewMixpanelWithConsumer(token string, c Consumer) *Mixpanel {
-	return &Mixpanel{
-		Token:   token,
-		verbose: true,
-		c:       c,
+func NewMixpanelWithConsumer(token string, c Consumer, opts ...Option) *Mixpanel {
+	mp := &Mixpanel{
+		Token: token,
+		config: config{
+			verbose:       true,
+			c:             c,
+			disabled:      &atomic.Bool{},
+			disabledByEnv: disabledByEnv(),
+		},
+	}
+	mp.token.Store(&token)
+	for _, opt := range opts {
+		opt(mp)
+	}
+	return mp
+}
+
+// WithAPISecret sets the project API secret, needed by the endpoints
+// that are not authenticated by the token alone such as Import. It is
+// handed to the consumer when it has a SetAPISecret method.
+func WithAPISecret(secret string) Option {
+	return func(mp *Mixpanel) {
+		mp.apiSecret = secret
+		if c, ok := findConsumer[interface{ SetAPISecret(string) }](mp.c); ok {
+			c.SetAPISecret(secret)
+		}
+	}
+}
+
+// WithAPIHost sends to another API host, such as EUAPIHost or a tracking
+// proxy. It is handed to the consumer when it has a SetAPIHost method.
+func WithAPIHost(host string) Option {
+	return func(mp *Mixpanel) {
+		mp.apiHost = normalizeHost(host)
+		mp.endpoints = nil
+		if c, ok := findConsumer[interface{ SetAPIHost(string) }](mp.c); ok {
+			c.SetAPIHost(host)
+		}
+	}
+}
+
+/*
+WithEndpointURL routes a single endpoint ("events", "people", "groups"
+or "import") to url, rather than to the API host; a later WithAPIHost
+routes it back to that host. It is handed to the consumer when it has a
+SetEndpointURL method, and panics on unknown endpoints. Example:
+
+	mp := NewMixpanel(token, WithEndpointURL("events", "https://track.internal/mixpanel/track"))
+*/
+func WithEndpointURL(endpoint, url string) Option {
+	if _, ok := endpointPaths[endpoint]; !ok {
+		panic("mixpanel: unknown endpoint '" + endpoint + "'")
+	}
+	return func(mp *Mixpanel) {
+		endpoints := map[string]string{endpoint: url}
+		for e, u := range mp.endpoints {
+			if e != endpoint {
+				endpoints[e] = u
+			}
+		}
+		mp.endpoints = endpoints
+		if c, ok := findConsumer[interface{ SetEndpointURL(string, string) error }](mp.c); ok {
+			c.SetEndpointURL(endpoint, url)
+		}
+	}
+}
+
+// WithHTTPClient sends the requests made by the Mixpanel object itself,
+// such as imports, through client. It is handed to the consumer when it
+// has a SetHTTPClient method.
+func WithHTTPClient(client *http.Client) Option {
+	return func(mp *Mixpanel) {
+		mp.client = client
+		if c, ok := findConsumer[interface{ SetHTTPClient(*http.Client) }](mp.c); ok {
+			c.SetHTTPClient(client)
+		}
+	}
+}
+
+/*
+WithRoundTripper sends the requests through rt, to wrap them with
+authentication or monitoring for example, keeping the other settings of
+the HTTP client of WithHTTPClient if any. It is handed to the consumer
+like WithHTTPClient.
+*/
+func WithRoundTripper(rt http.RoundTripper) Option {
+	return func(mp *Mixpanel) {
+		client := &http.Client{}
+		if mp.client != nil {
+			*client = *mp.client
+		}
+		client.Transport = rt
+		WithHTTPClient(client)(mp)
+	}
+}
+
+// WithProxy sends the requests through the proxy at proxyURL, rather
+// than the one of the HTTP_PROXY and HTTPS_PROXY environment variables.
+// It adds up with the TLS options, see WithTLSConfig.
+func WithProxy(proxyURL *url.URL) Option {
+	return withTransport(func(t *http.Transport) {
+		t.Proxy = http.ProxyURL(proxyURL)
+	})
+}
+
+// WithHeader adds a header to the requests made by the Mixpanel object
+// itself, such as imports. It is handed to the consumer when it has a
+// SetHeader method.
+func WithHeader(key, value string) Option {
+	return func(mp *Mixpanel) {
+		if mp.header == nil {
+			mp.header = make(http.Header)
+		}
+		mp.header.Set(key, value)
+		if c, ok := findConsumer[interface{ SetHeader(string, string) }](mp.c); ok {
+			c.SetHeader(key, value)
+		}
+	}
+}
+
+// WithUserAgent replaces DefaultUserAgent as the User-Agent of the
+// requests made by the Mixpanel object itself, such as imports. It is
+// handed to the consumer when it has a SetUserAgent method.
+func WithUserAgent(userAgent string) Option {
+	return func(mp *Mixpanel) {
+		mp.userAgent = userAgent
+		if c, ok := findConsumer[interface{ SetUserAgent(string) }](mp.c); ok {
+			c.SetUserAgent(userAgent)
+		}
+	}
+}
+
+// GetToken returns the project token currently in use.
+func (mp *Mixpanel) GetToken() string {
+	return *mp.token.Load()
+}
+
+/*
+SetToken atomically replaces the project token, so that long running
+services can rotate it without restarting. Calls in flight keep the
+token they started with.
+*/
+func (mp *Mixpanel) SetToken(token string) {
+	mp.token.Store(&token)
+}
+
+/*
+WithToken returns a Mixpanel object sending to another project through
+the same consumer and middleware, for dispatchers picking the project
+per request:
+
+	mp.WithToken(tenant.MixpanelToken).Track(userID, "Signed Up", nil)
+
+It is cheap enough to be called for every event.
+*/
+func (mp *Mixpanel) WithToken(token string) *Mixpanel {
+	clone := &Mixpanel{Token: token, config: mp.config}
+	clone.token.Store(&token)
+	return clone
+}
+
+// send hands a single serialized message to the consumer.
+func (mp *Mixpanel) send(endpoint string, msg []byte) error {
+	return mp.sendBatch(context.Background(), endpoint, [][]byte{msg})
+}
+
+// sendBatch hands serialized messages to the consumer, unless mp is
+// disabled.
+func (mp *Mixpanel) sendBatch(ctx context.Context, endpoint string, msgs [][]byte) error {
+	if !mp.Enabled() {
+		return nil
 	}
+	return mp.c.Send(ctx, endpoint, msgs)
+}
+
+/*
+Flush delivers the messages buffered by the consumer. Call it before
+your application exits when using a buffering consumer. It is bounded
+by DefaultFlushTimeout, see WithTimeouts.
+*/
+func (mp *Mixpanel) Flush(ctx context.Context) error {
+	ctx, cancel := mp.flushContext(ctx)
+	defer cancel()
+	return mp.c.Flush(ctx)
+}
+
+// Close flushes and releases the consumer. The Mixpanel object must not
+// be used afterwards. Like Flush, it is bounded by DefaultFlushTimeout.
+func (mp *Mixpanel) Close(ctx context.Context) error {
+	ctx, cancel := mp.flushContext(ctx)
+	defer cancel()
+	return mp.c.Close(ctx)
 }
 
 /*
@@ -102,34 +303,60 @@ mp.Track("12345", "Credit Card Declined", nil)
 
 // Properties describe the circumstances of the event,
 // or aspects of the source or user associated with the event
-mp.Track("12345", "Welcome Email Sent", &P{
-  "Email Template" : "Pretty Pink Welcome",
-  "User Sign-up Cohort" : "July 2013",
- })
+
+	mp.Track("12345", "Welcome Email Sent", &P{
+	  "Email Template" : "Pretty Pink Welcome",
+	  "User Sign-up Cohort" : "July 2013",
+	 })
 */
 func (mp *Mixpanel) Track(distinct_id, event string, prop *P) error {
-	properties := &P{
-		"token":        mp.Token,
-		"distinct_id":  distinct_id,
-		"time":         strconv.FormatInt(time.Now().UTC().Unix(), 10),
-		"mp_lib":       "go",
-		"$lib_version": "0.1",
-	}
-	if prop == nil {
-		prop = &P{}
-	}
+	return mp.sendEvent("events", distinct_id, event, mp.eventProperties(distinct_id, prop))
+}
 
+// eventProperties returns the properties of a tracked event: the token,
+// distinct_id, time and library properties, and prop.
+func (mp *Mixpanel) eventProperties(distinct_id string, prop *P) *P {
+	n := 5
+	if prop != nil {
+		n += len(*prop)
+	}
+	// a single map sized for the user properties, filled in place
+	properties := make(P, n)
+	properties["token"] = mp.GetToken()
+	properties["distinct_id"] = distinct_id
+	properties["time"] = mp.now().Unix()
+	mp.setLib(properties)
 	properties.Update(prop)
+	return &properties
+}
+
+// sendEvent runs an event through the middleware, serializes it and
+// hands it to the consumer.
+func (mp *Mixpanel) sendEvent(endpoint, distinct_id, event string, properties *P) error {
+	data, err := mp.eventRecord(endpoint, distinct_id, event, properties)
+	if data == nil {
+		return err
+	}
+	if endpoint == "events" && mp.isPriority(event) {
+		return mp.sendBatch(withPriority(context.Background()), endpoint, [][]byte{data})
+	}
+	return mp.send(endpoint, data)
+}
 
-	data, err := json.Marshal(&Event{
+// eventRecord runs an event through the middleware and serializes it.
+// It returns no data for events skipped by middleware.
+func (mp *Mixpanel) eventRecord(endpoint, distinct_id, event string, properties *P) ([]byte, error) {
+	msg := &Message{
+		Endpoint:   endpoint,
 		Event:      event,
+		DistinctID: distinct_id,
 		Properties: properties,
-	})
-	if err != nil {
-		return err
+	}
+	if err := mp.process(msg); err != nil {
+		return nil, skipped(err)
 	}
 
-	return mp.c.Send("events", data)
+	return marshalEvent(msg.Event, msg.Properties)
 }
 
 /*
@@ -139,7 +366,8 @@ Alias sends an update to our servers linking an existing distinct_id
 with a new id, so that events and profile updates associated with the
 new id will be associated with the existing user's profile and behavior.
 Example:
-    mp.Alias("amy@mixpanel.com", "13793")
+
+	mp.Alias("amy@mixpanel.com", "13793")
 */
 func (mp *Mixpanel) Alias(alias_id, original_id string) error {
 	return mp.Track(original_id, "$create_alias", &P{
@@ -159,17 +387,36 @@ The Mixpanel HTTP tracking API is documented at
 https://mixpanel.com/help/reference/http
 */
 func (mp *Mixpanel) PeopleUpdate(properties *P) error {
-	record := &P{
-		"$token": mp.Token,
-		"$time":  int(time.Now().UTC().Unix()),
+	data, err := mp.peopleRecord(properties)
+	if data == nil {
+		return err
+	}
+	return mp.send("people", data)
+}
+
+// peopleRecord runs a people update through the middleware and
+// serializes it. It returns no data for updates skipped by middleware.
+func (mp *Mixpanel) peopleRecord(properties *P) ([]byte, error) {
+	n := 2
+	if properties != nil {
+		n += len(*properties)
 	}
+	record := make(P, n)
+	record["$token"] = mp.GetToken()
+	record["$time"] = mp.now().Unix()
 	record.Update(properties)
 
-	data, err := json.Marshal(record)
-	if err != nil {
-		return err
+	id, _ := record["$distinct_id"].(string)
+	msg := &Message{
+		Endpoint:   "people",
+		DistinctID: id,
+		Properties: &record,
+	}
+	if err := mp.process(msg); err != nil {
+		return nil, skipped(err)
 	}
-	return mp.c.Send("people", data)
+
+	return marshalProps(msg.Properties, "$time")
 }
 
 /*
@@ -178,8 +425,9 @@ PeopleSet set properties of a people record.
 PeopleSet sets properties of a people record given in JSON object. If the profile
 does not exist, creates new profile with these properties.
 Example:
-    mp.PeopleSet("12345", &P{"Address": "1313 Mockingbird Lane",
-                            "Birthday": "1948-01-01"})
+
+	mp.PeopleSet("12345", &P{"Address": "1313 Mockingbird Lane",
+	                        "Birthday": "1948-01-01"})
 */
 func (mp *Mixpanel) PeopleSet(id string, properties *P) error {
 	return mp.PeopleUpdate(&P{
@@ -195,12 +443,13 @@ PeopleSetOnce sets properties of a people record given in JSON object. If the pr
 does not exist, creates new profile with these properties. Does not
 overwrite existing property values.
 Example:
-    mp.PeopleSetOnce("12345", &P{"First Login": "2013-04-01T13:20:00"})
+
+	mp.PeopleSetOnce("12345", &P{"First Login": "2013-04-01T13:20:00"})
 */
 func (mp *Mixpanel) PeopleSetOnce(id string, properties *P) error {
 	return mp.PeopleUpdate(&P{
 		"$distinct_id": id,
-		"$set":         properties,
+		"$set_once":    properties,
 	})
 }
 
@@ -211,7 +460,8 @@ Takes in JSON object with keys and numerical values. Adds numerical
 values to current property of profile. If property doesn't exist adds
 value to zero. Takes in negative values for subtraction.
 Example:
-    mp.PeopleIncrement("12345", &P{"Coins Gathered": 12})
+
+	mp.PeopleIncrement("12345", &P{"Coins Gathered": 12})
 */
 func (mp *Mixpanel) PeopleIncrement(id string, properties *P) error {
 	return mp.PeopleUpdate(&P{
@@ -228,7 +478,8 @@ list associated with the corresponding property name. $appending to a
 property that doesn't exist will result in assigning a list with one
 element to that property.
 Example:
-    mp.PeopleAppend("12345", &P{ "Power Ups": "Bubble Lead" })
+
+	mp.PeopleAppend("12345", &P{ "Power Ups": "Bubble Lead" })
 */
 func (mp *Mixpanel) PeopleAppend(id string, properties *P) error {
 	return mp.PeopleUpdate(&P{
@@ -244,7 +495,8 @@ Takes a JSON object containing keys and list values. The list values in
 the request are merged with the existing list on the user profile,
 ignoring duplicate list values.
 Example:
-    mp.PeopleUnion("12345", &P{ "Items purchased": ["socks", "shirts"] } )
+
+	mp.PeopleUnion("12345", &P{ "Items purchased": ["socks", "shirts"] } )
 */
 func (mp *Mixpanel) PeopleUnion(id string, properties *P) error {
 	return mp.PeopleUpdate(&P{
@@ -259,7 +511,8 @@ PeopleUnset removes properties from a profile.
 Takes a JSON list of string property names, and permanently removes the
 properties and their values from a profile.
 Example:
-    mp.PeopleUnset("12345", ["Days Overdue"])
+
+	mp.PeopleUnset("12345", ["Days Overdue"])
 */
 func (mp *Mixpanel) PeopleUnset(id string, properties []string) error {
 	return mp.PeopleUpdate(&P{
@@ -274,7 +527,8 @@ PeopleDelete permanently deletes a profile.
 Permanently delete the profile from Mixpanel, along with all of its
 properties.
 Example:
-    mp.PeopleDelete("12345")
+
+	mp.PeopleDelete("12345")
 */
 func (mp *Mixpanel) PeopleDelete(id string) error {
 	return mp.PeopleUpdate(&P{
@@ -290,11 +544,12 @@ Record that you have charged the current user a certain amount of
 money. Charges recorded with track_charge will appear in the Mixpanel
 revenue report.
 Example:
-    //tracks a charge of $50 to user '1234'
-    mp.PeopleTrackCharge("1234", 50, nil)
 
-    //tracks a charge of $50 to user '1234' at a specific time
-    mp.PeopleTrackCharge("1234", 50, {"$time": "2013-04-01T09:02:00"})
+	//tracks a charge of $50 to user '1234'
+	mp.PeopleTrackCharge("1234", 50, nil)
+
+	//tracks a charge of $50 to user '1234' at a specific time
+	mp.PeopleTrackCharge("1234", 50, {"$time": "2013-04-01T09:02:00"})
 */
 func (mp *Mixpanel) PeopleTrackCharge(id string, amount float64, prop *P) error {
 	if prop == nil {
@@ -305,135 +560,3 @@ func (mp *Mixpanel) PeopleTrackCharge(id string, amount float64, prop *P) error
 		"$transactions": prop,
 	})
 }
-
-func parseJsonResponse(resp *http.Response) error {
-	type jsonResponseT map[string]interface{}
-	var response jsonResponseT
-	var buff bytes.Buffer
-	io.Copy(&buff, resp.Body)
-
-	if err := json.Unmarshal(buff.Bytes(), &response); err == nil {
-		if value, ok := response["status"]; ok {
-			if value.(float64) == 1 {
-				return nil
-			} else {
-				return errors.New(fmt.Sprintf("Mixpanel error: %s", response["error"]))
-			}
-		} else {
-			return errors.New("Could not find field 'status' api change ?")
-		}
-	}
-	return errors.New("Cannot interpret Mixpanel server response: " + buff.String())
-}
-
-type StdConsumer struct {
-	endpoints map[string]string
-}
-
-// Creates a new StdConsumer.
-// Sends one message at a time
-func NewStdConsumer() *StdConsumer {
-	c := new(StdConsumer)
-	c.endpoints = make(map[string]string)
-	c.endpoints["events"] = events_endpoint
-	c.endpoints["people"] = people_endpoint
-	return c
-}
-
-func (c *StdConsumer) Send(endpoint string, msg []byte) error {
-
-	if url, ok := c.endpoints[endpoint]; !ok {
-		return errors.New(fmt.Sprintf("No such endpoint '%s'. Valid endpoints are one of %#v", endpoint, c.endpoints))
-	} else {
-		return c.write(url, msg)
-	}
-}
-
-func (c *StdConsumer) write(endpoint string, msg []byte) error {
-	track_url, err := url.Parse(endpoint)
-	if err != nil {
-		return err
-	}
-
-	q := track_url.Query()
-	q.Add("data", string(b64(msg)))
-	q.Add("verbose", "1")
-
-	track_url.RawQuery = q.Encode()
-
-	resp, err := http.Get(track_url.String())
-
-	if err != nil {
-		return err
-	}
-
-	return parseJsonResponse(resp)
-}
-
-type BuffConsumer struct {
-	StdConsumer
-	buffers map[string][][]byte
-	maxSize int64
-}
-
-func NewBuffConsumer(maxSize int64) *BuffConsumer {
-	bc := new(BuffConsumer)
-	bc.StdConsumer = *NewStdConsumer()
-	bc.maxSize = maxSize
-	bc.buffers = make(map[string][][]byte)
-	bc.buffers["people"] = make([][]byte, 0, maxSize)
-	bc.buffers["events"] = make([][]byte, 0, maxSize)
-	return bc
-}
-
-func (bc *BuffConsumer) Send(endpoint string, msg []byte) error {
-	if _, ok := bc.buffers[endpoint]; !ok {
-		return errors.New(fmt.Sprintf("No such endpoint '%s'. Valid endpoints are one of %#v", endpoint, bc.buffers))
-	}
-	bc.buffers[endpoint] = append(bc.buffers[endpoint], msg)
-	if len(bc.buffers[endpoint]) > int(bc.maxSize) {
-		bc.flushEndpoint(endpoint)
-	}
-	return nil
-}
-
-/*
-Flush Send all remaining messages to Mixpanel. BufferedConsumers will
-flush automatically when you call Send(), but you will need to call
-Flush() when you are completely done using the consumer (for example,
-when your application exits) to ensure there are no messages remaining
-in memory.
-*/
-func (bc *BuffConsumer) Flush() error {
-	for endpoint := range bc.buffers {
-		bc.flushEndpoint(endpoint)
-	}
-	return nil
-}
-
-func jsonArray(a [][]byte) []byte {
-	sep := ","
-	if len(a) == 0 {
-		return []byte("[]")
-	}
-
-	n := len(sep) * (len(a) - 1)
-	for i := 0; i < len(a); i++ {
-		n += len(a[i])
-	}
-
-	b := make([]byte, n+2)
-	bp := copy(b, []byte{'['})
-	bp += copy(b[bp:], a[0])
-	for _, s := range a[1:] {
-		bp += copy(b[bp:], sep)
-		bp += copy(b[bp:], s)
-	}
-	copy(b[bp:], []byte{']'})
-	return b
-}
-
-func (bc *BuffConsumer) flushEndpoint(endpoint string) error {
-	msg := jsonArray(bc.buffers[endpoint])
-	return bc.StdConsumer.Send(endpoint, msg)
-}
@@ -1,7 +1,13 @@
 package mixpanel
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 const token string = "e919dea023855e3c8e2ea46a38e4032c"
@@ -13,7 +19,7 @@ func TestUpdate(t *testing.T) {
 	})
 
 	if _, ok := (*p)["Test"]; !ok {
-		t.Error("Expected Test got %*v", *p)
+		t.Errorf("Expected Test got %v", *p)
 	}
 
 }
@@ -47,7 +53,7 @@ func TestSmoke(t *testing.T){
 	Smoke(t, NewMixpanelWithConsumer(token, NewBuffConsumer(1)))
 	mp := NewBuffConsumer(2)
 	Smoke(t, NewMixpanelWithConsumer(token, mp))
-	mp.Flush()
+	mp.Flush(context.Background())
 }
 
 
@@ -138,3 +144,58 @@ func Smoke(t *testing.T, mp *Mixpanel) {
 		t.Error(err)
 	}
 }
+
+func TestPropsBuilder(t *testing.T) {
+	signup := time.Date(2024, 3, 1, 10, 30, 0, 0, time.FixedZone("CET", 3600))
+	p := NewProps().
+		Str("Plan", "Pro").
+		Int("Seats", 5).
+		Bool("Trial", false).
+		Time("Signed Up", signup)
+
+	expected := P{"Plan": "Pro", "Seats": int64(5), "Trial": false, "Signed Up": "2024-03-01T09:30:00"}
+	if !reflect.DeepEqual(*p, expected) {
+		t.Errorf("Expected %v got %v", expected, *p)
+	}
+}
+
+func TestTimeProperties(t *testing.T) {
+	var buf bytes.Buffer
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf))
+	at := time.Date(2024, 3, 1, 10, 30, 0, 0, time.FixedZone("CET", 3600))
+
+	mp.Track("12345", "Signed Up", &P{
+		"time":       at,
+		"Trial Ends": at,
+		"Billing":    P{"Renews": &at},
+	})
+	out := buf.String()
+	for _, expected := range []string{`"time":1709285400`, `"Trial Ends":"2024-03-01T09:30:00"`, `"Renews":"2024-03-01T09:30:00"`} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected %s in %s", expected, out)
+		}
+	}
+
+	buf.Reset()
+	mp.PeopleSet("12345", &P{"$created": at})
+	if !strings.Contains(buf.String(), `"$created":"2024-03-01T09:30:00"`) {
+		t.Errorf("Expected a formatted $created in %s", buf.String())
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	v := &Event{Event: "Signed Up", Properties: &P{"a": "<b>", "n": 1.5}}
+	expected, _ := json.Marshal(v)
+	for i := 0; i < 3; i++ {
+		data, err := marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, expected) {
+			t.Errorf("Expected %s got %s", expected, data)
+		}
+	}
+	if _, err := marshal(&P{"c": make(chan int)}); err == nil {
+		t.Error("Expected an error for an unsupported value")
+	}
+}
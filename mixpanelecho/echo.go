@@ -0,0 +1,109 @@
+/*
+Package mixpanelecho adapts the mixpanelhttp middleware to Echo:
+
+	e := echo.New()
+	e.Use(mixpanelecho.Middleware(mp, &mixpanelhttp.Options{Cookie: "uid"}))
+	e.POST("/login", func(c echo.Context) error {
+	    user := login(c)
+	    mixpanelecho.SetDistinctID(c, user.ID)
+	    return mixpanelecho.Track(c, "Logged In", nil)
+	})
+
+The middleware stashes the client and the distinct_id of the request in
+the Echo context, for handlers to track their own events; a distinct_id
+set by a handler is also the one of the request event.
+*/
+package mixpanelecho
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+	"github.com/Mistobaan/mixpanels-go/mixpanelhttp"
+	"github.com/labstack/echo/v4"
+)
+
+// Keys of the client and the distinct_id in the Echo context.
+const (
+	ClientKey     = "mixpanel.client"
+	DistinctIDKey = "mixpanel.distinct_id"
+)
+
+// ErrNoClient is returned by Track outside of the middleware.
+var ErrNoClient = errors.New("mixpanel: no client in the Echo context, see Middleware")
+
+// Middleware returns an Echo middleware tracking the requests it serves,
+// like mixpanelhttp.Middleware.
+func Middleware(mp *mixpanel.Mixpanel, opts *mixpanelhttp.Options) echo.MiddlewareFunc {
+	if opts == nil {
+		opts = &mixpanelhttp.Options{}
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			c.Set(ClientKey, mp)
+			if opts.Skip != nil && opts.Skip(c.Request()) {
+				return next(c)
+			}
+			if id := mixpanelhttp.DistinctID(opts, c.Request()); id != "" {
+				SetDistinctID(c, id)
+			}
+			start := time.Now()
+			defer func() {
+				p := recover()
+				status := responseStatus(c, err)
+				if p != nil {
+					status = http.StatusInternalServerError
+				}
+				mixpanelhttp.Track(mp, opts, c.Request(), DistinctID(c), status, start)
+				if p != nil {
+					panic(p)
+				}
+			}()
+			return next(c)
+		}
+	}
+}
+
+// responseStatus returns the status of the response to a handler that
+// returned err, which Echo writes only once the middlewares returned.
+func responseStatus(c echo.Context, err error) int {
+	if err == nil || c.Response().Committed {
+		return c.Response().Status
+	}
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		return he.Code
+	}
+	return http.StatusInternalServerError
+}
+
+// Client returns the client stashed by the middleware, nil outside of it.
+func Client(c echo.Context) *mixpanel.Mixpanel {
+	mp, _ := c.Get(ClientKey).(*mixpanel.Mixpanel)
+	return mp
+}
+
+// SetDistinctID sets the distinct_id of the request, once the user is
+// known for example.
+func SetDistinctID(c echo.Context, distinctID string) {
+	c.Set(DistinctIDKey, distinctID)
+}
+
+// DistinctID returns the distinct_id of the request, found by the
+// middleware or set by SetDistinctID.
+func DistinctID(c echo.Context) string {
+	id, _ := c.Get(DistinctIDKey).(string)
+	return id
+}
+
+// Track tracks an event of the distinct_id of the request with the
+// client stashed by the middleware.
+func Track(c echo.Context, event string, props *mixpanel.P) error {
+	mp := Client(c)
+	if mp == nil {
+		return ErrNoClient
+	}
+	return mp.Track(DistinctID(c), event, props)
+}
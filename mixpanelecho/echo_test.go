@@ -0,0 +1,65 @@
+package mixpanelecho
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+	"github.com/Mistobaan/mixpanels-go/internal/mptest"
+	"github.com/Mistobaan/mixpanels-go/mixpanelhttp"
+	"github.com/labstack/echo/v4"
+)
+
+func TestMiddleware(t *testing.T) {
+	rc := &mptest.Recorder{}
+	mp := mixpanel.NewMixpanelWithConsumer("token", rc)
+	e := echo.New()
+	e.Use(Middleware(mp, &mixpanelhttp.Options{Cookie: "uid"}))
+	e.POST("/login", func(c echo.Context) error {
+		SetDistinctID(c, "u1")
+		if err := Track(c, "Logged In", nil); err != nil {
+			return err
+		}
+		return c.NoContent(http.StatusCreated)
+	})
+	e.GET("/forbidden", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusForbidden)
+	})
+	e.GET("/broken", func(c echo.Context) error {
+		return errors.New("broken")
+	})
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest("POST", "/login", nil),
+		httptest.NewRequest("GET", "/forbidden", nil),
+		httptest.NewRequest("GET", "/broken", nil),
+	} {
+		req.AddCookie(&http.Cookie{Name: "uid", Value: "anon"})
+		e.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	events := rc.Events()
+	if len(events) != 4 {
+		t.Fatalf("Expected 4 events got %v", events)
+	}
+	for i, want := range []struct {
+		event, distinctID string
+		status            interface{}
+	}{
+		{"Logged In", "u1", nil},
+		{mixpanelhttp.DefaultEvent, "u1", float64(201)},
+		{mixpanelhttp.DefaultEvent, "anon", float64(403)},
+		{mixpanelhttp.DefaultEvent, "anon", float64(500)},
+	} {
+		props := *events[i].Properties
+		if events[i].Event != want.event || props["distinct_id"] != want.distinctID || props["status"] != want.status {
+			t.Errorf("Unexpected event %s %v", events[i].Event, props)
+		}
+	}
+
+	if err := Track(e.NewContext(nil, nil), "Logged In", nil); err != ErrNoClient {
+		t.Errorf("Expected ErrNoClient got %v", err)
+	}
+}
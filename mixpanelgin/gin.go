@@ -0,0 +1,94 @@
+/*
+Package mixpanelgin adapts the mixpanelhttp middleware to Gin:
+
+	r := gin.New()
+	r.Use(mixpanelgin.Middleware(mp, &mixpanelhttp.Options{Cookie: "uid"}))
+	r.POST("/login", func(c *gin.Context) {
+	    user := login(c)
+	    mixpanelgin.SetDistinctID(c, user.ID)
+	    mixpanelgin.Track(c, "Logged In", nil)
+	})
+
+The middleware stashes the client and the distinct_id of the request in
+the Gin context, for handlers to track their own events; a distinct_id
+set by a handler is also the one of the request event.
+*/
+package mixpanelgin
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+	"github.com/Mistobaan/mixpanels-go/mixpanelhttp"
+	"github.com/gin-gonic/gin"
+)
+
+// Keys of the client and the distinct_id in the Gin context.
+const (
+	ClientKey     = "mixpanel.client"
+	DistinctIDKey = "mixpanel.distinct_id"
+)
+
+// ErrNoClient is returned by Track outside of the middleware.
+var ErrNoClient = errors.New("mixpanel: no client in the Gin context, see Middleware")
+
+// Middleware returns a Gin middleware tracking the requests it serves,
+// like mixpanelhttp.Middleware.
+func Middleware(mp *mixpanel.Mixpanel, opts *mixpanelhttp.Options) gin.HandlerFunc {
+	if opts == nil {
+		opts = &mixpanelhttp.Options{}
+	}
+	return func(c *gin.Context) {
+		c.Set(ClientKey, mp)
+		if opts.Skip != nil && opts.Skip(c.Request) {
+			c.Next()
+			return
+		}
+		if id := mixpanelhttp.DistinctID(opts, c.Request); id != "" {
+			SetDistinctID(c, id)
+		}
+		start := time.Now()
+		defer func() {
+			status := c.Writer.Status()
+			p := recover()
+			if p != nil {
+				status = http.StatusInternalServerError
+			}
+			mixpanelhttp.Track(mp, opts, c.Request, c.GetString(DistinctIDKey), status, start)
+			if p != nil {
+				panic(p)
+			}
+		}()
+		c.Next()
+	}
+}
+
+// Client returns the client stashed by the middleware, nil outside of it.
+func Client(c *gin.Context) *mixpanel.Mixpanel {
+	mp, _ := c.Value(ClientKey).(*mixpanel.Mixpanel)
+	return mp
+}
+
+// SetDistinctID sets the distinct_id of the request, once the user is
+// known for example.
+func SetDistinctID(c *gin.Context, distinctID string) {
+	c.Set(DistinctIDKey, distinctID)
+}
+
+// DistinctID returns the distinct_id of the request, found by the
+// middleware or set by SetDistinctID.
+func DistinctID(c *gin.Context) string {
+	return c.GetString(DistinctIDKey)
+}
+
+// Track tracks an event of the distinct_id of the request with the
+// client stashed by the middleware.
+func Track(c *gin.Context, event string, props *mixpanel.P) error {
+	mp := Client(c)
+	if mp == nil {
+		return ErrNoClient
+	}
+	return mp.Track(DistinctID(c), event, props)
+}
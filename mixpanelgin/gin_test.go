@@ -0,0 +1,55 @@
+package mixpanelgin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+	"github.com/Mistobaan/mixpanels-go/internal/mptest"
+	"github.com/Mistobaan/mixpanels-go/mixpanelhttp"
+	"github.com/gin-gonic/gin"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rc := &mptest.Recorder{}
+	mp := mixpanel.NewMixpanelWithConsumer("token", rc)
+	r := gin.New()
+	r.Use(Middleware(mp, &mixpanelhttp.Options{Header: "X-Anonymous-Id"}))
+	r.POST("/login", func(c *gin.Context) {
+		SetDistinctID(c, "u1")
+		if err := Track(c, "Logged In", nil); err != nil {
+			t.Error(err)
+		}
+		c.Status(http.StatusCreated)
+	})
+
+	for _, path := range []string{"/login", "/missing"} {
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set("X-Anonymous-Id", "anon")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	events := rc.Events()
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events got %v", events)
+	}
+	for i, want := range []struct {
+		event, distinctID string
+		status            interface{}
+	}{
+		{"Logged In", "u1", nil},
+		{mixpanelhttp.DefaultEvent, "u1", float64(201)},
+		{mixpanelhttp.DefaultEvent, "anon", float64(404)},
+	} {
+		props := *events[i].Properties
+		if events[i].Event != want.event || props["distinct_id"] != want.distinctID || props["status"] != want.status {
+			t.Errorf("Unexpected event %s %v", events[i].Event, props)
+		}
+	}
+
+	if err := Track(&gin.Context{}, "Logged In", nil); err != ErrNoClient {
+		t.Errorf("Expected ErrNoClient got %v", err)
+	}
+}
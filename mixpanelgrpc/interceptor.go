@@ -0,0 +1,165 @@
+/*
+Package mixpanelgrpc tracks the calls served by a gRPC server as
+Mixpanel events:
+
+	mp := mixpanel.NewMixpanelWithConsumer(token, mixpanel.NewBuffConsumer(50))
+	opts := &mixpanelgrpc.Options{Metadata: "x-user-id"}
+	server := grpc.NewServer(
+	    grpc.ChainUnaryInterceptor(mixpanelgrpc.UnaryServerInterceptor(mp, opts)),
+	    grpc.ChainStreamInterceptor(mixpanelgrpc.StreamServerInterceptor(mp, opts)),
+	)
+
+Every call becomes an event with its service, method, status code and
+duration in milliseconds; streaming calls are tracked once the stream
+ended. Like the mixpanelhttp middleware, it tracks through the consumer
+of mp, which should buffer so that calls never wait on Mixpanel.
+
+Handlers find the client bound to the distinct_id of the call with
+mixpanel.FromContext(ctx); a distinct_id they bind is also the one of
+the call event.
+*/
+package mixpanelgrpc
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultEvent is the name of the events when Options.Event is empty.
+const DefaultEvent = "RPC"
+
+/*
+Options tunes the interceptors.
+
+The distinct_id of a call is read from the Metadata key of its incoming
+metadata; DistinctID replaces it when set, to read it from the
+authentication of the call for example. Calls without a distinct_id are
+tracked with an empty one. Skip excludes methods, given by their full
+name such as "/grpc.health.v1.Health/Check".
+
+Properties is called with the properties of each event, once the call
+returned, to add or change some of them. OnError is called when an event
+cannot be tracked; errors are ignored when it is nil.
+*/
+type Options struct {
+	Event      string
+	Metadata   string
+	DistinctID func(ctx context.Context, fullMethod string) string
+	Skip       func(fullMethod string) bool
+	Properties func(ctx context.Context, fullMethod string, props *mixpanel.P)
+	OnError    func(err error)
+}
+
+// UnaryServerInterceptor returns an interceptor tracking unary calls.
+func UnaryServerInterceptor(mp *mixpanel.Mixpanel, opts *Options) grpc.UnaryServerInterceptor {
+	t := newTracker(mp, opts)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		if t.opts.Skip != nil && t.opts.Skip(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		ctx = mixpanel.NewContext(ctx, mp, t.distinctID(ctx, info.FullMethod))
+		defer t.track(ctx, info.FullMethod, false, time.Now(), &err)
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns an interceptor tracking streaming
+// calls.
+func StreamServerInterceptor(mp *mixpanel.Mixpanel, opts *Options) grpc.StreamServerInterceptor {
+	t := newTracker(mp, opts)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		if t.opts.Skip != nil && t.opts.Skip(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		ctx := mixpanel.NewContext(ss.Context(), mp, t.distinctID(ss.Context(), info.FullMethod))
+		defer t.track(ctx, info.FullMethod, true, time.Now(), &err)
+		return handler(srv, &boundStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// boundStream is a stream whose context carries the bound client.
+type boundStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *boundStream) Context() context.Context {
+	return s.ctx
+}
+
+type tracker struct {
+	mp    *mixpanel.Mixpanel
+	opts  *Options
+	event string
+}
+
+func newTracker(mp *mixpanel.Mixpanel, opts *Options) *tracker {
+	if opts == nil {
+		opts = &Options{}
+	}
+	t := &tracker{mp: mp, opts: opts, event: opts.Event}
+	if t.event == "" {
+		t.event = DefaultEvent
+	}
+	return t
+}
+
+// track tracks a call that started at start and ended with *err. It is
+// deferred by the interceptors, so that panicking handlers are tracked
+// as internal errors before the panic goes on.
+func (t *tracker) track(ctx context.Context, fullMethod string, stream bool, start time.Time, err *error) {
+	code := status.Code(*err)
+	p := recover()
+	if p != nil {
+		code = codes.Internal
+	}
+	service, method := splitMethod(fullMethod)
+	props := &mixpanel.P{
+		"time":        start,
+		"service":     service,
+		"method":      method,
+		"code":        code.String(),
+		"stream":      stream,
+		"duration_ms": float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if t.opts.Properties != nil {
+		t.opts.Properties(ctx, fullMethod, props)
+	}
+	if err := t.mp.Track(mixpanel.FromContext(ctx).DistinctID(), t.event, props); err != nil && t.opts.OnError != nil {
+		t.opts.OnError(err)
+	}
+	if p != nil {
+		panic(p)
+	}
+}
+
+// distinctID extracts the distinct_id of a call.
+func (t *tracker) distinctID(ctx context.Context, fullMethod string) string {
+	if t.opts.DistinctID != nil {
+		return t.opts.DistinctID(ctx, fullMethod)
+	}
+	if t.opts.Metadata == "" {
+		return ""
+	}
+	if values := metadata.ValueFromIncomingContext(ctx, t.opts.Metadata); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// splitMethod splits "/package.Service/Method" into its service and
+// method names.
+func splitMethod(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "", fullMethod
+}
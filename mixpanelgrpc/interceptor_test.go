@@ -0,0 +1,83 @@
+package mixpanelgrpc
+
+import (
+	"context"
+	"testing"
+
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+	"github.com/Mistobaan/mixpanels-go/internal/mptest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// stream is a server stream carrying a context.
+type stream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *stream) Context() context.Context { return s.ctx }
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	rc := &mptest.Recorder{}
+	mp := mixpanel.NewMixpanelWithConsumer("token", rc)
+	interceptor := UnaryServerInterceptor(mp, &Options{
+		Metadata: "x-user-id",
+		Skip:     func(method string) bool { return method == "/grpc.health.v1.Health/Check" },
+	})
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-user-id", "u1"))
+
+	for _, method := range []string{"/shop.v1.Orders/Place", "/grpc.health.v1.Health/Check"} {
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, status.Error(codes.NotFound, "no such order")
+		})
+		if status.Code(err) != codes.NotFound {
+			t.Errorf("Expected the error of the handler got %v", err)
+		}
+	}
+	events := rc.Events()
+	if len(events) != 1 {
+		t.Fatalf("Expected one event got %v", events)
+	}
+	props := *events[0].Properties
+	if events[0].Event != DefaultEvent || props["distinct_id"] != "u1" || props["service"] != "shop.v1.Orders" ||
+		props["method"] != "Place" || props["code"] != "NotFound" || props["stream"] != false {
+		t.Errorf("Unexpected event %v", props)
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	rc := &mptest.Recorder{}
+	mp := mixpanel.NewMixpanelWithConsumer("token", rc)
+	interceptor := StreamServerInterceptor(mp, &Options{
+		Event:      "Stream",
+		DistinctID: func(ctx context.Context, method string) string { return "u2" },
+	})
+	ss := &stream{ctx: context.Background()}
+	info := &grpc.StreamServerInfo{FullMethod: "/shop.v1.Orders/Watch", IsServerStream: true}
+
+	if err := interceptor(nil, ss, info, func(srv interface{}, ss grpc.ServerStream) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Expected the panic to go through")
+			}
+		}()
+		interceptor(nil, ss, info, func(srv interface{}, ss grpc.ServerStream) error { panic("boom") })
+	}()
+
+	events := rc.Events()
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events got %v", events)
+	}
+	for i, code := range []string{"OK", "Internal"} {
+		props := *events[i].Properties
+		if events[i].Event != "Stream" || props["distinct_id"] != "u2" || props["code"] != code || props["stream"] != true {
+			t.Errorf("Unexpected event %v", props)
+		}
+	}
+}
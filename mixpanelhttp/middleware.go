@@ -0,0 +1,198 @@
+/*
+Package mixpanelhttp tracks the requests served by a net/http server as
+Mixpanel events:
+
+	mp := mixpanel.NewMixpanelWithConsumer(token, mixpanel.NewBuffConsumer(50))
+	track := mixpanelhttp.Middleware(mp, &mixpanelhttp.Options{
+	    Cookie: "uid",
+	    Skip:   func(r *http.Request) bool { return r.URL.Path == "/healthz" },
+	})
+	http.ListenAndServe(":8080", track(mux))
+
+Every request becomes an event with its path, method, status and
+duration in milliseconds, along with the utm_* parameters of its URL and
+its referrer (see mixpanel.RequestProperties). Events are tracked once
+the handler returned, through the consumer of mp: use a buffered or
+asynchronous consumer so that requests never wait on Mixpanel.
+
+Handlers find the client bound to the distinct_id of the request with
+mixpanel.FromContext(r.Context()); a distinct_id they bind is also the
+one of the request event.
+*/
+package mixpanelhttp
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+)
+
+// DefaultEvent is the name of the events when Options.Event is empty.
+const DefaultEvent = "HTTP Request"
+
+/*
+Options tunes Middleware.
+
+The distinct_id of a request is read from the Cookie cookie, or else
+from the Header header; DistinctID replaces both when set. Requests
+without a distinct_id are tracked with an empty one.
+
+Properties is called with the properties of each event, once the
+handler returned, to add or change some of them. OnError is called when
+an event cannot be tracked; errors are ignored when it is nil.
+
+TrackPanics also tracks the panics of the handler as "Application
+Error" events, see Mixpanel.TrackPanic, with the path, method and
+referrer of the request, before panicking again.
+*/
+type Options struct {
+	Event      string
+	Cookie     string
+	Header     string
+	DistinctID func(r *http.Request) string
+	Skip       func(r *http.Request) bool
+	Properties func(r *http.Request, props *mixpanel.P)
+	OnError    func(err error)
+
+	TrackPanics bool
+}
+
+// Middleware returns a middleware tracking the requests served by the
+// handler it wraps.
+func Middleware(mp *mixpanel.Mixpanel, opts *Options) func(http.Handler) http.Handler {
+	if opts == nil {
+		opts = &Options{}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if opts.Skip != nil && opts.Skip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			start := time.Now()
+			r = r.WithContext(mixpanel.NewContext(r.Context(), mp, DistinctID(opts, r)))
+			rec := &statusRecorder{ResponseWriter: w}
+			served := false
+			defer func() {
+				status := rec.status
+				var p interface{}
+				switch {
+				case !served:
+					// the handler panicked; the panic is only recovered to
+					// be tracked, the others keep their original stack
+					status = http.StatusInternalServerError
+					if opts.TrackPanics {
+						p = recover()
+					}
+				case status == 0:
+					status = http.StatusOK
+				}
+				distinctID := mixpanel.FromContext(r.Context()).DistinctID()
+				if p != nil && p != http.ErrAbortHandler {
+					props := mixpanel.RequestProperties(r).Update(&mixpanel.P{
+						"path":   r.URL.Path,
+						"method": r.Method,
+					})
+					if err := mp.TrackPanic(distinctID, p, props); err != nil && opts.OnError != nil {
+						opts.OnError(err)
+					}
+				}
+				Track(mp, opts, r, distinctID, status, start)
+				if p != nil {
+					panic(p)
+				}
+			}()
+			next.ServeHTTP(rec, r)
+			served = true
+		})
+	}
+}
+
+/*
+Track tracks the event of a request that started at start and was
+answered with status, the distinct_id being found by opts unless
+distinctID is given. It lets the middlewares of other frameworks track
+the same events as Middleware.
+*/
+func Track(mp *mixpanel.Mixpanel, opts *Options, r *http.Request, distinctID string, status int, start time.Time) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	event := opts.Event
+	if event == "" {
+		event = DefaultEvent
+	}
+	if distinctID == "" {
+		distinctID = DistinctID(opts, r)
+	}
+	props := requestProperties(r, status, start)
+	if opts.Properties != nil {
+		opts.Properties(r, props)
+	}
+	if err := mp.Track(distinctID, event, props); err != nil && opts.OnError != nil {
+		opts.OnError(err)
+	}
+}
+
+// DistinctID extracts the distinct_id of r as configured by opts.
+func DistinctID(opts *Options, r *http.Request) string {
+	if opts.DistinctID != nil {
+		return opts.DistinctID(r)
+	}
+	if opts.Cookie != "" {
+		if c, err := r.Cookie(opts.Cookie); err == nil && c.Value != "" {
+			return c.Value
+		}
+	}
+	if opts.Header != "" {
+		return strings.TrimSpace(r.Header.Get(opts.Header))
+	}
+	return ""
+}
+
+// requestProperties returns the properties of the event of a request
+// answered with status.
+func requestProperties(r *http.Request, status int, start time.Time) *mixpanel.P {
+	return mixpanel.RequestProperties(r).Update(&mixpanel.P{
+		"time":        start,
+		"path":        r.URL.Path,
+		"method":      r.Method,
+		"status":      status,
+		"duration_ms": float64(time.Since(start).Microseconds()) / 1000,
+	})
+}
+
+// statusRecorder records the status of a response, 200 unless the
+// handler wrote another one.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(data []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(data)
+}
+
+// Flush lets streaming handlers flush through the recorder.
+func (rec *statusRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the wrapped writer.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
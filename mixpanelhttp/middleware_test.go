@@ -0,0 +1,127 @@
+package mixpanelhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+	"github.com/Mistobaan/mixpanels-go/internal/mptest"
+)
+
+func TestMiddleware(t *testing.T) {
+	rc := &mptest.Recorder{}
+	mp := mixpanel.NewMixpanelWithConsumer("token", rc)
+	handler := Middleware(mp, &Options{
+		Cookie: "uid",
+		Header: "X-User-Id",
+		Skip:   func(r *http.Request) bool { return r.URL.Path == "/healthz" },
+		Properties: func(r *http.Request, props *mixpanel.P) {
+			(*props)["host"] = r.Host
+		},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+		}
+	}))
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest("GET", "/pricing?utm_source=newsletter&utm_campaign=spring&page=2", nil),
+		httptest.NewRequest("POST", "/missing", nil),
+		httptest.NewRequest("GET", "/healthz", nil),
+	} {
+		req.AddCookie(&http.Cookie{Name: "uid", Value: "u1"})
+		req.Header.Set("X-User-Id", "u2")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	events := rc.Events()
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events got %v", events)
+	}
+	props := *events[0].Properties
+	if events[0].Event != DefaultEvent || props["distinct_id"] != "u1" || props["path"] != "/pricing" || props["method"] != "GET" ||
+		props["status"] != float64(200) || props["utm_source"] != "newsletter" || props["utm_campaign"] != "spring" ||
+		props["host"] != "example.com" || props["page"] != nil {
+		t.Errorf("Unexpected event %v", props)
+	}
+	if _, ok := props["duration_ms"].(float64); !ok {
+		t.Errorf("Expected a duration got %v", props["duration_ms"])
+	}
+	if status := (*events[1].Properties)["status"]; status != float64(404) {
+		t.Errorf("Expected status 404 got %v", status)
+	}
+}
+
+func TestMiddlewareTracksPanics(t *testing.T) {
+	rc := &mptest.Recorder{}
+	mp := mixpanel.NewMixpanelWithConsumer("token", rc)
+	handler := Middleware(mp, &Options{
+		DistinctID: func(r *http.Request) string { return "u3" },
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Expected the panic to go through")
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}()
+	events := rc.Events()
+	if len(events) != 1 || (*events[0].Properties)["status"] != float64(500) || (*events[0].Properties)["distinct_id"] != "u3" {
+		t.Errorf("Expected the panic to be tracked as a 500 got %v", events)
+	}
+}
+
+func TestMiddlewareTrackPanics(t *testing.T) {
+	rc := &mptest.Recorder{}
+	mp := mixpanel.NewMixpanelWithConsumer("token", rc)
+	handler := Middleware(mp, &Options{
+		DistinctID:  func(r *http.Request) string { return "u3" },
+		TrackPanics: true,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Expected the panic to go through")
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/checkout", nil))
+	}()
+	events := rc.Events()
+	if len(events) != 2 {
+		t.Fatalf("Expected the panic and the request events, got %v", events)
+	}
+	props := *events[0].Properties
+	if events[0].Event != mixpanel.PanicEvent || props["distinct_id"] != "u3" || props["Error"] != "boom" ||
+		props["path"] != "/checkout" || props["method"] != "POST" || props["Stack Hash"] == nil {
+		t.Errorf("Unexpected panic event %v", events[0])
+	}
+}
+
+func TestMiddlewareBindsContext(t *testing.T) {
+	rc := &mptest.Recorder{}
+	mp := mixpanel.NewMixpanelWithConsumer("token", rc)
+	handler := Middleware(mp, &Options{Header: "X-User-Id"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := mixpanel.FromContext(r.Context())
+		if err := c.Track("Viewed", nil); err != nil {
+			t.Error(err)
+		}
+		c.SetDistinctID("u2")
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-User-Id", "u1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	events := rc.Events()
+	if len(events) != 2 || events[0].Event != "Viewed" || (*events[0].Properties)["distinct_id"] != "u1" ||
+		(*events[1].Properties)["distinct_id"] != "u2" {
+		t.Errorf("Unexpected events %v", events)
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Package mixpanellogrus provides a logrus hook tracking log entries as
+Mixpanel events, so that error rates can be charted alongside user
+behavior:
+
+	mp := mixpanel.NewMixpanel(token, mixpanel.WithAsync(mixpanel.AsyncConfig{}))
+	logrus.AddHook(mixpanellogrus.NewHook(mp, logrus.ErrorLevel, &mixpanellogrus.Options{
+	    DistinctIDField: "user_id",
+	    SampleRate:      0.1,
+	}))
+
+Each entry at or above the level becomes a "Log Entry" event carrying
+its Level, Message and Caller, and its fields as properties. Use an
+asynchronous consumer: the hook tracks from the logging goroutine.
+*/
+package mixpanellogrus
+
+import (
+	"fmt"
+	"math/rand"
+
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultEvent is the event of the log entries when Options.Event is
+// empty.
+const DefaultEvent = "Log Entry"
+
+// Options configures a Hook.
+type Options struct {
+	// Event names the tracked events, DefaultEvent when empty.
+	Event string
+	// DistinctIDField is the field holding the distinct_id of an entry;
+	// entries without it are tracked with DistinctID.
+	DistinctIDField string
+	DistinctID      string
+	// SampleRate, between 0 and 1, is the fraction of the entries
+	// tracked, all of them when 0. Tracked entries have a $sample_rate.
+	SampleRate float64
+}
+
+// Hook is a logrus.Hook tracking log entries.
+type Hook struct {
+	mp     *mixpanel.Mixpanel
+	levels []logrus.Level
+	opts   Options
+}
+
+var _ logrus.Hook = (*Hook)(nil)
+
+// NewHook returns a Hook tracking the entries at or above level with mp.
+func NewHook(mp *mixpanel.Mixpanel, level logrus.Level, opts *Options) *Hook {
+	h := &Hook{mp: mp}
+	if opts != nil {
+		h.opts = *opts
+	}
+	if h.opts.Event == "" {
+		h.opts.Event = DefaultEvent
+	}
+	for _, l := range logrus.AllLevels {
+		if l <= level {
+			h.levels = append(h.levels, l)
+		}
+	}
+	return h
+}
+
+// Levels implements logrus.Hook.
+func (h *Hook) Levels() []logrus.Level {
+	return h.levels
+}
+
+// Fire implements logrus.Hook.
+func (h *Hook) Fire(entry *logrus.Entry) error {
+	rate := h.opts.SampleRate
+	if rate > 0 && rate < 1 && rand.Float64() >= rate {
+		return nil
+	}
+	props := make(mixpanel.P, len(entry.Data)+5)
+	distinct_id := h.opts.DistinctID
+	for key, value := range entry.Data {
+		if key == h.opts.DistinctIDField {
+			distinct_id = fmt.Sprint(value)
+			continue
+		}
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		props[key] = value
+	}
+	props["Level"] = entry.Level.String()
+	props["Message"] = entry.Message
+	props["time"] = entry.Time.Unix()
+	if entry.HasCaller() {
+		props["Caller"] = fmt.Sprintf("%s:%d", entry.Caller.File, entry.Caller.Line)
+	}
+	if rate > 0 && rate < 1 {
+		props["$sample_rate"] = rate
+	}
+	return h.mp.Track(distinct_id, h.opts.Event, &props)
+}
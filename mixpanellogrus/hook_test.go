@@ -0,0 +1,58 @@
+package mixpanellogrus
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+	"github.com/sirupsen/logrus"
+)
+
+func TestHook(t *testing.T) {
+	var buf bytes.Buffer
+	mp := mixpanel.NewMixpanelWithConsumer("token", mixpanel.NewWriterConsumer(&buf))
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	logger.AddHook(NewHook(mp, logrus.WarnLevel, &Options{DistinctIDField: "user_id"}))
+
+	logger.Info("started")
+	logger.WithFields(logrus.Fields{"user_id": "13793", "order": 42}).WithError(errors.New("declined")).Error("payment failed")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expected 1 event, got %q", lines)
+	}
+	var e mixpanel.Envelope
+	json.Unmarshal([]byte(lines[0]), &e)
+	var event mixpanel.Event
+	json.Unmarshal(e.Data, &event)
+	props := *event.Properties
+	if event.Event != DefaultEvent || props["distinct_id"] != "13793" || props["Level"] != "error" ||
+		props["Message"] != "payment failed" || props["order"] != 42.0 || props["error"] != "declined" {
+		t.Errorf("Unexpected event %+v", event)
+	}
+	if _, ok := props["user_id"]; ok {
+		t.Error("Expected the distinct_id field to be left out of the properties")
+	}
+}
+
+func TestHookSampling(t *testing.T) {
+	var buf bytes.Buffer
+	mp := mixpanel.NewMixpanelWithConsumer("token", mixpanel.NewWriterConsumer(&buf))
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	logger.AddHook(NewHook(mp, logrus.ErrorLevel, &Options{SampleRate: 0.2}))
+	for i := 0; i < 1000; i++ {
+		logger.Error("failed")
+	}
+	if n := strings.Count(buf.String(), "\n"); n < 100 || n > 300 {
+		t.Errorf("Expected about 200 events, got %d", n)
+	}
+	if !strings.Contains(buf.String(), `"$sample_rate":0.2`) {
+		t.Error("Expected a $sample_rate")
+	}
+}
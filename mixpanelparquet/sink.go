@@ -0,0 +1,113 @@
+/*
+Package mixpanelparquet writes exported events as Parquet files, to load
+them into BigQuery, Athena or Spark:
+
+	f, err := os.Create("events.parquet")
+	...
+	n, err := q.ExportTo(ctx, query, mixpanelparquet.NewSink(f))
+
+or, to write a Parquet file per day:
+
+	sink := &mixpanel.PartitionedSink{
+	    Dir: "export",
+	    Path: func(day time.Time) string {
+	        return "date=" + day.Format("2006-01-02") + "/events.parquet"
+	    },
+	    NewSink: func(w io.Writer) mixpanel.ExportSink { return mixpanelparquet.NewSink(w) },
+	}
+*/
+package mixpanelparquet
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+	"github.com/parquet-go/parquet-go"
+)
+
+/*
+Row is the schema of the Parquet files: the name, distinct_id, time and
+$insert_id of the events have their own columns, and their other
+properties are a JSON column. Times are those of the export, in
+milliseconds.
+*/
+type Row struct {
+	Event      string    `parquet:"event,dict"`
+	DistinctID string    `parquet:"distinct_id"`
+	Time       time.Time `parquet:"time,timestamp(millisecond)"`
+	InsertID   string    `parquet:"insert_id"`
+	Properties string    `parquet:"properties,json"`
+}
+
+// rowGroupSize is the number of events buffered before a row group is
+// written.
+const rowGroupSize = 8192
+
+// Sink is a mixpanel.ExportSink writing a Parquet file.
+type Sink struct {
+	w    *parquet.GenericWriter[Row]
+	rows []Row
+}
+
+// NewSink returns a sink writing the events to w as a Parquet file,
+// complete once the sink is closed.
+func NewSink(w io.Writer) *Sink {
+	return &Sink{w: parquet.NewGenericWriter[Row](w, parquet.Compression(&parquet.Zstd))}
+}
+
+func (s *Sink) WriteEvent(raw json.RawMessage) error {
+	var event mixpanel.Event
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&event); err != nil {
+		return fmt.Errorf("Cannot interpret Mixpanel export line: %v", err)
+	}
+	row := Row{Event: event.Event}
+	props := mixpanel.P{}
+	if event.Properties != nil {
+		props = *event.Properties
+	}
+	row.DistinctID, _ = props[mixpanel.PropDistinctID].(string)
+	row.InsertID, _ = props[mixpanel.PropInsertID].(string)
+	if t, ok := props[mixpanel.PropTime].(json.Number); ok {
+		if seconds, err := t.Float64(); err == nil {
+			row.Time = time.UnixMilli(int64(seconds * 1000)).UTC()
+		}
+	}
+	delete(props, mixpanel.PropDistinctID)
+	delete(props, mixpanel.PropInsertID)
+	delete(props, mixpanel.PropTime)
+	data, err := json.Marshal(props)
+	if err != nil {
+		return err
+	}
+	row.Properties = string(data)
+
+	s.rows = append(s.rows, row)
+	if len(s.rows) >= rowGroupSize {
+		return s.flush()
+	}
+	return nil
+}
+
+func (s *Sink) flush() error {
+	if _, err := s.w.Write(s.rows); err != nil {
+		return err
+	}
+	s.rows = s.rows[:0]
+	return s.w.Flush()
+}
+
+// Close writes the buffered events and the footer of the file.
+func (s *Sink) Close() error {
+	if len(s.rows) > 0 {
+		if err := s.flush(); err != nil {
+			return err
+		}
+	}
+	return s.w.Close()
+}
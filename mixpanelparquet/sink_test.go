@@ -0,0 +1,44 @@
+package mixpanelparquet
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+	"github.com/parquet-go/parquet-go"
+)
+
+var _ mixpanel.ExportSink = (*Sink)(nil)
+
+func TestSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewSink(&buf)
+	for _, raw := range []string{
+		`{"event": "Signed Up", "properties": {"distinct_id": "u1", "time": 1704067200, "$insert_id": "a1"}}`,
+		`{"event": "Purchase", "properties": {"distinct_id": "u1", "time": 1704067260, "Amount": 12.5, "Id": 9007199254740993}}`,
+	} {
+		if err := sink.WriteEvent(json.RawMessage(raw)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := parquet.Read[Row](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 rows got %d", len(rows))
+	}
+	if r := rows[0]; r.Event != "Signed Up" || r.DistinctID != "u1" || r.InsertID != "a1" ||
+		!r.Time.Equal(time.Unix(1704067200, 0)) || r.Properties != "{}" {
+		t.Errorf("Unexpected row %+v", r)
+	}
+	if r := rows[1]; r.Properties != `{"Amount":12.5,"Id":9007199254740993}` {
+		t.Errorf("Unexpected properties %s", r.Properties)
+	}
+}
@@ -0,0 +1,40 @@
+/*
+Package mixpanelredis keeps the state of the client in Redis, to share
+it between the processes of a service:
+
+	rdb := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	store := &mixpanelredis.FirstTimeStore{Client: rdb, TTL: 90 * 24 * time.Hour}
+	mp := mixpanel.NewMixpanel(token, mixpanel.WithFirstTime(store, "Purchase"))
+*/
+package mixpanelredis
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultPrefix prefixes the keys of FirstTimeStore when Prefix is empty.
+const DefaultPrefix = "mixpanel:first:"
+
+/*
+FirstTimeStore is a mixpanel.FirstTimeStore in Redis, with a key per
+pair of event and distinct_id, separated by a NUL byte.
+
+Keys expire after TTL, after which an event counts as a first time
+again; they never expire when TTL is zero.
+*/
+type FirstTimeStore struct {
+	Client redis.Cmdable
+	Prefix string
+	TTL    time.Duration
+}
+
+func (s *FirstTimeStore) MarkFirst(ctx context.Context, distinct_id, event string) (bool, error) {
+	prefix := s.Prefix
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	return s.Client.SetNX(ctx, prefix+event+"\x00"+distinct_id, 1, s.TTL).Result()
+}
@@ -0,0 +1,45 @@
+package mixpanelredis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+var _ mixpanel.FirstTimeStore = (*FirstTimeStore)(nil)
+
+func TestFirstTimeStore(t *testing.T) {
+	srv := miniredis.RunT(t)
+	store := &FirstTimeStore{Client: redis.NewClient(&redis.Options{Addr: srv.Addr()}), TTL: time.Hour}
+	ctx := context.Background()
+
+	for i, want := range []bool{true, false} {
+		first, err := store.MarkFirst(ctx, "u1", "Purchase")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first != want {
+			t.Errorf("Call %d: expected %v got %v", i, want, first)
+		}
+	}
+	if first, _ := store.MarkFirst(ctx, "u2", "Purchase"); !first {
+		t.Error("Expected a first time for another distinct_id")
+	}
+	if ttl := srv.TTL(DefaultPrefix + "Purchase\x00u1"); ttl != time.Hour {
+		t.Errorf("Expected a TTL of 1h got %v", ttl)
+	}
+
+	srv.FastForward(2 * time.Hour)
+	if first, _ := store.MarkFirst(ctx, "u1", "Purchase"); !first {
+		t.Error("Expected a first time once the key expired")
+	}
+
+	srv.Close()
+	if _, err := store.MarkFirst(ctx, "u3", "Purchase"); err == nil {
+		t.Error("Expected an error without server")
+	}
+}
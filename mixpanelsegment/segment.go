@@ -0,0 +1,83 @@
+/*
+Package mixpanelsegment implements the analytics.Client interface of the
+Segment analytics-go library on top of a Mixpanel client, so that code
+written against Segment moves to Mixpanel by changing its constructor:
+
+	// client := analytics.New(writeKey)
+	client := mixpanelsegment.New(mixpanel.NewMixpanel(token))
+	defer client.Close()
+
+	client.Enqueue(analytics.Track{
+	    UserId: "13793",
+	    Event:  "Signed Up",
+	    Properties: analytics.NewProperties().Set("plan", "pro"),
+	})
+
+The messages are converted by Mixpanel.SendSegment; group messages are
+not supported and fail.
+*/
+package mixpanelsegment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+	"github.com/segmentio/analytics-go/v3"
+)
+
+// Client is an analytics.Client sending the messages to Mixpanel.
+type Client struct {
+	mp *mixpanel.Mixpanel
+}
+
+var _ analytics.Client = (*Client)(nil)
+
+// New returns a Client sending the messages with mp. Use a buffering
+// consumer for mp, see mixpanel.WithAsync, to batch them as analytics-go
+// does.
+func New(mp *mixpanel.Mixpanel) *Client {
+	return &Client{mp: mp}
+}
+
+// Enqueue validates msg, an analytics.Track, Page, Screen, Identify or
+// Alias or a pointer to one, and sends it to Mixpanel.
+func (c *Client) Enqueue(msg analytics.Message) error {
+	var typ string
+	switch msg.(type) {
+	case analytics.Track, *analytics.Track:
+		typ = "track"
+	case analytics.Page, *analytics.Page:
+		typ = "page"
+	case analytics.Screen, *analytics.Screen:
+		typ = "screen"
+	case analytics.Identify, *analytics.Identify:
+		typ = "identify"
+	case analytics.Alias, *analytics.Alias:
+		typ = "alias"
+	case analytics.Group, *analytics.Group:
+		typ = "group"
+	default:
+		return fmt.Errorf("mixpanel: messages with custom types cannot be enqueued: %T", msg)
+	}
+	if err := msg.Validate(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	var sm mixpanel.SegmentMessage
+	if err := json.Unmarshal(data, &sm); err != nil {
+		return err
+	}
+	sm.Type = typ
+	return c.mp.SendSegment(&sm)
+}
+
+// Close flushes and closes the Mixpanel client.
+func (c *Client) Close() error {
+	return c.mp.Close(context.Background())
+}
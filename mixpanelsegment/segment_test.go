@@ -0,0 +1,57 @@
+package mixpanelsegment
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+	"github.com/segmentio/analytics-go/v3"
+)
+
+func TestClient(t *testing.T) {
+	var buf bytes.Buffer
+	client := New(mixpanel.NewMixpanelWithConsumer("token", mixpanel.NewWriterConsumer(&buf)))
+
+	for _, msg := range []analytics.Message{
+		analytics.Track{
+			UserId:     "13793",
+			MessageId:  "m-1",
+			Event:      "Signed Up",
+			Properties: analytics.NewProperties().Set("plan", "pro"),
+			Context:    &analytics.Context{IP: net.ParseIP("1.2.3.4"), OS: analytics.OSInfo{Name: "iOS"}},
+		},
+		&analytics.Page{AnonymousId: "d-1", Name: "Pricing"},
+		analytics.Identify{UserId: "13793", Traits: analytics.NewTraits().SetEmail("amy@mixpanel.com")},
+	} {
+		if err := client.Enqueue(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := client.Enqueue(analytics.Track{UserId: "13793"}); err == nil {
+		t.Error("Expected an error for a track without event")
+	}
+	if err := client.Enqueue(analytics.Group{UserId: "13793", GroupId: "acme"}); err == nil {
+		t.Error("Expected an error for a group call")
+	}
+	client.Close()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 messages, got %q", lines)
+	}
+	var e mixpanel.Envelope
+	json.Unmarshal([]byte(lines[0]), &e)
+	var event mixpanel.Event
+	json.Unmarshal(e.Data, &event)
+	props := *event.Properties
+	if event.Event != "Signed Up" || props["distinct_id"] != "13793" || props["plan"] != "pro" ||
+		props["$insert_id"] != "m-1" || props["ip"] != "1.2.3.4" || props["$os"] != "iOS" {
+		t.Errorf("Unexpected event %+v", event)
+	}
+	if !strings.Contains(lines[1], `"Viewed Pricing Page"`) || !strings.Contains(lines[2], `"$email":"amy@mixpanel.com"`) {
+		t.Errorf("Unexpected messages %q", lines[1:])
+	}
+}
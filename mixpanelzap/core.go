@@ -0,0 +1,121 @@
+/*
+Package mixpanelzap provides a zap core tracking log entries as Mixpanel
+events, so that error rates can be charted alongside user behavior. Tee
+it with the core of a logger:
+
+	mp := mixpanel.NewMixpanel(token, mixpanel.WithAsync(mixpanel.AsyncConfig{}))
+	logger := zap.New(zapcore.NewTee(
+	    core,
+	    mixpanelzap.NewCore(mp, zapcore.ErrorLevel, &mixpanelzap.Options{
+	        DistinctIDField: "user_id",
+	        SampleRate:      0.1,
+	    }),
+	))
+
+Each entry at or above the level becomes a "Log Entry" event carrying
+its Level, Message, Logger and Caller, and its fields as properties.
+Use an asynchronous consumer: the core tracks from the logging
+goroutine.
+*/
+package mixpanelzap
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+	"go.uber.org/zap/zapcore"
+)
+
+// DefaultEvent is the event of the log entries when Options.Event is
+// empty.
+const DefaultEvent = "Log Entry"
+
+// Options configures a core.
+type Options struct {
+	// Event names the tracked events, DefaultEvent when empty.
+	Event string
+	// DistinctIDField is the field holding the distinct_id of an entry;
+	// entries without it are tracked with DistinctID.
+	DistinctIDField string
+	DistinctID      string
+	// SampleRate, between 0 and 1, is the fraction of the entries
+	// tracked, all of them when 0. Tracked entries have a $sample_rate.
+	SampleRate float64
+}
+
+type core struct {
+	zapcore.LevelEnabler
+	mp     *mixpanel.Mixpanel
+	opts   *Options
+	fields []zapcore.Field
+}
+
+// NewCore returns a zapcore.Core tracking the entries enabled by level
+// with mp.
+func NewCore(mp *mixpanel.Mixpanel, level zapcore.LevelEnabler, opts *Options) zapcore.Core {
+	c := &core{LevelEnabler: level, mp: mp, opts: &Options{}}
+	if opts != nil {
+		*c.opts = *opts
+	}
+	if c.opts.Event == "" {
+		c.opts.Event = DefaultEvent
+	}
+	return c
+}
+
+func (c *core) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.fields = append(c.fields[:len(c.fields):len(c.fields)], fields...)
+	return &clone
+}
+
+func (c *core) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *core) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	rate := c.opts.SampleRate
+	if rate > 0 && rate < 1 && rand.Float64() >= rate {
+		return nil
+	}
+	enc := zapcore.NewMapObjectEncoder()
+	for _, field := range c.fields {
+		field.AddTo(enc)
+	}
+	for _, field := range fields {
+		field.AddTo(enc)
+	}
+
+	props := make(mixpanel.P, len(enc.Fields)+6)
+	distinct_id := c.opts.DistinctID
+	for key, value := range enc.Fields {
+		if key == c.opts.DistinctIDField {
+			distinct_id = fmt.Sprint(value)
+			continue
+		}
+		props[key] = value
+	}
+	props["Level"] = entry.Level.String()
+	props["Message"] = entry.Message
+	props["time"] = entry.Time.Unix()
+	if entry.LoggerName != "" {
+		props["Logger"] = entry.LoggerName
+	}
+	if entry.Caller.Defined {
+		props["Caller"] = entry.Caller.TrimmedPath()
+	}
+	if rate > 0 && rate < 1 {
+		props["$sample_rate"] = rate
+	}
+	return c.mp.Track(distinct_id, c.opts.Event, &props)
+}
+
+// Sync flushes the Mixpanel client.
+func (c *core) Sync() error {
+	return c.mp.Flush(context.Background())
+}
@@ -0,0 +1,37 @@
+package mixpanelzap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	mixpanel "github.com/Mistobaan/mixpanels-go"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestCore(t *testing.T) {
+	var buf bytes.Buffer
+	mp := mixpanel.NewMixpanelWithConsumer("token", mixpanel.NewWriterConsumer(&buf))
+	logger := zap.New(NewCore(mp, zapcore.WarnLevel, &Options{DistinctIDField: "user_id"})).Named("billing")
+
+	logger.Info("started")
+	logger.With(zap.String("user_id", "13793")).Error("payment failed", zap.Int("order", 42), zap.Error(errors.New("declined")))
+	logger.Sync()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expected 1 event, got %q", lines)
+	}
+	var e mixpanel.Envelope
+	json.Unmarshal([]byte(lines[0]), &e)
+	var event mixpanel.Event
+	json.Unmarshal(e.Data, &event)
+	props := *event.Properties
+	if event.Event != DefaultEvent || props["distinct_id"] != "13793" || props["Level"] != "error" || props["Logger"] != "billing" ||
+		props["Message"] != "payment failed" || props["order"] != 42.0 || props["error"] != "declined" {
+		t.Errorf("Unexpected event %+v", event)
+	}
+}
@@ -0,0 +1,154 @@
+package mixpanel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"sync"
+)
+
+// ErrorPolicy decides what a MultiConsumer does with the error of one of
+// its consumers: the returned error, if any, is reported to the caller.
+type ErrorPolicy func(err error) error
+
+// FailOnError reports the consumer's errors to the caller.
+func FailOnError(err error) error {
+	return err
+}
+
+// IgnoreErrors discards the consumer's errors, typically for shadow
+// traffic that must never affect the primary pipeline.
+func IgnoreErrors(err error) error {
+	return nil
+}
+
+// LogErrors returns a policy that logs the consumer's errors with logger
+// (the standard logger when nil) and otherwise ignores them.
+func LogErrors(name string, logger *log.Logger) ErrorPolicy {
+	return func(err error) error {
+		if logger == nil {
+			log.Printf("mixpanel: consumer %s: %v", name, err)
+		} else {
+			logger.Printf("mixpanel: consumer %s: %v", name, err)
+		}
+		return nil
+	}
+}
+
+type multiTarget struct {
+	c      Consumer
+	policy ErrorPolicy
+}
+
+/*
+MultiConsumer forwards every message to several consumers, for example
+to send to Mixpanel while mirroring traffic to a local file:
+
+	mc := NewMultiConsumer().
+	    Add(NewBuffConsumer(50), FailOnError).
+	    Add(NewWriterConsumer(auditFile), LogErrors("audit", nil))
+	mp := NewMixpanelWithConsumer(token, mc)
+
+Every consumer receives every message even when another one fails; the
+errors kept by their policies are joined together.
+*/
+type MultiConsumer struct {
+	targets []multiTarget
+}
+
+// NewMultiConsumer creates an empty MultiConsumer.
+func NewMultiConsumer() *MultiConsumer {
+	return &MultiConsumer{}
+}
+
+// Add registers a consumer with the policy applied to its errors.
+func (m *MultiConsumer) Add(c Consumer, policy ErrorPolicy) *MultiConsumer {
+	if policy == nil {
+		policy = FailOnError
+	}
+	m.targets = append(m.targets, multiTarget{c, policy})
+	return m
+}
+
+func (m *MultiConsumer) each(f func(c Consumer) error) error {
+	var errs []error
+	for _, t := range m.targets {
+		if err := f(t.c); err != nil {
+			if err = t.policy(err); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m *MultiConsumer) Send(ctx context.Context, endpoint string, msgs [][]byte) error {
+	return m.each(func(c Consumer) error {
+		return c.Send(ctx, endpoint, msgs)
+	})
+}
+
+func (m *MultiConsumer) Flush(ctx context.Context) error {
+	return m.each(func(c Consumer) error {
+		return c.Flush(ctx)
+	})
+}
+
+func (m *MultiConsumer) Close(ctx context.Context) error {
+	return m.each(func(c Consumer) error {
+		return c.Close(ctx)
+	})
+}
+
+// Envelope is a message along with the endpoint it is destined to, as
+// written by WriterConsumer.
+type Envelope struct {
+	Endpoint string          `json:"endpoint"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// WriterConsumer writes every message as a newline delimited JSON
+// Envelope, for auditing or replaying traffic later.
+type WriterConsumer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterConsumer creates a WriterConsumer writing to w. Close closes w
+// when it is an io.Closer.
+func NewWriterConsumer(w io.Writer) *WriterConsumer {
+	return &WriterConsumer{w: w}
+}
+
+func (wc *WriterConsumer) Send(ctx context.Context, endpoint string, msgs [][]byte) error {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	enc := json.NewEncoder(wc.w)
+	for _, msg := range msgs {
+		if err := enc.Encode(&Envelope{Endpoint: endpoint, Data: msg}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (wc *WriterConsumer) Flush(ctx context.Context) error {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	if f, ok := wc.w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+func (wc *WriterConsumer) Close(ctx context.Context) error {
+	if err := wc.Flush(ctx); err != nil {
+		return err
+	}
+	if c, ok := wc.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
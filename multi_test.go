@@ -0,0 +1,49 @@
+package mixpanel
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type failingConsumer struct {
+	calls int
+}
+
+func (fc *failingConsumer) Send(ctx context.Context, endpoint string, msgs [][]byte) error {
+	fc.calls++
+	return errors.New("unavailable")
+}
+
+func (fc *failingConsumer) Flush(ctx context.Context) error { return nil }
+
+func (fc *failingConsumer) Close(ctx context.Context) error { return nil }
+
+func TestMultiConsumer(t *testing.T) {
+	var buf bytes.Buffer
+	shadow := &failingConsumer{}
+	mc := NewMultiConsumer().
+		Add(NewWriterConsumer(&buf), FailOnError).
+		Add(shadow, IgnoreErrors)
+
+	mp := NewMixpanelWithConsumer(token, mc)
+	if err := mp.Track("12345", "Signed Up", nil); err != nil {
+		t.Fatal(err)
+	}
+	if shadow.calls != 1 {
+		t.Errorf("Expected the shadow consumer to be called once, got %d", shadow.calls)
+	}
+	if !strings.HasPrefix(buf.String(), `{"endpoint":"events","data":{"event":"Signed Up"`) {
+		t.Errorf("Unexpected output %s", buf.String())
+	}
+
+	mc.Add(&failingConsumer{}, FailOnError)
+	if err := mp.Track("12345", "Signed Up", nil); err == nil {
+		t.Error("Expected the failing consumer error")
+	}
+	if strings.Count(buf.String(), "\n") != 2 {
+		t.Errorf("Expected the writer to receive both messages, got %s", buf.String())
+	}
+}
@@ -0,0 +1,149 @@
+package mixpanel
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+KeyNormalizer renames property keys to a single naming convention, so
+that events tracked by different services end up with the same
+properties. Rename maps keys to their new name, "plan_name" to "Plan"
+for example; the other keys have their surrounding whitespace removed
+with TrimSpace, and are turned into Title Case words with TitleCase:
+"plan_name", "planName" and "plan-name" all become "Plan Name", while
+acronyms such as "HTTPStatus" become "HTTP Status".
+
+Reserved properties, starting with $ or mp_, and token, distinct_id,
+time and ip are only renamed by Rename. When several keys get the same
+name, the property already named so wins, then the first key in sorted
+order. Example:
+
+	mp := NewMixpanel(token, WithKeyNormalizer(&KeyNormalizer{
+	    TrimSpace: true,
+	    TitleCase: true,
+	    Rename:    map[string]string{"sku": "SKU"},
+	}))
+*/
+type KeyNormalizer struct {
+	Rename    map[string]string
+	TrimSpace bool
+	TitleCase bool
+}
+
+// WithKeyNormalizer normalizes the property keys of every event, and of
+// the properties changed by people and group updates.
+func WithKeyNormalizer(n *KeyNormalizer) Option {
+	return WithMiddleware(n.normalizeMessage)
+}
+
+// normalizeMessage implements Middleware.
+func (n *KeyNormalizer) normalizeMessage(msg *Message) error {
+	if msg.IsEvent() {
+		msg.Properties = n.Normalize(msg.Properties)
+		return nil
+	}
+	props := *msg.Properties
+	for _, op := range propertyOperations {
+		if m, ok := objectValue(props[op]); ok {
+			p := P(m)
+			props[op] = n.Normalize(&p)
+		}
+	}
+	if keys, ok := props["$unset"].([]string); ok {
+		normalized := make([]string, len(keys))
+		for i, key := range keys {
+			normalized[i] = n.Key(key)
+		}
+		props["$unset"] = normalized
+	}
+	return nil
+}
+
+// Normalize returns a copy of p with normalized keys.
+func (n *KeyNormalizer) Normalize(p *P) *P {
+	if p == nil {
+		return nil
+	}
+	keys := make([]string, 0, len(*p))
+	for key := range *p {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	normalized := make(P, len(*p))
+	for _, key := range keys {
+		name := n.Key(key)
+		if _, taken := normalized[name]; taken {
+			continue
+		}
+		if _, named := (*p)[name]; named && name != key {
+			continue
+		}
+		normalized[name] = (*p)[key]
+	}
+	return &normalized
+}
+
+// Key returns the normalized name of key.
+func (n *KeyNormalizer) Key(key string) string {
+	if name, ok := n.Rename[key]; ok {
+		return name
+	}
+	if reservedKey(key) {
+		return key
+	}
+	if n.TrimSpace {
+		key = strings.TrimSpace(key)
+	}
+	if n.TitleCase {
+		key = titleCase(key)
+	}
+	return key
+}
+
+// reservedKey reports whether key is a property of Mixpanel.
+func reservedKey(key string) bool {
+	switch key {
+	case PropToken, PropDistinctID, PropTime, PropIP:
+		return true
+	}
+	return strings.HasPrefix(key, "$") || strings.HasPrefix(key, "mp_")
+}
+
+// titleCase splits s into words, at underscores, dashes, spaces and case
+// changes, and joins them capitalized with spaces.
+func titleCase(s string) string {
+	var words []string
+	var word []rune
+	runes := []rune(s)
+	for i, r := range runes {
+		if r == '_' || r == '-' || unicode.IsSpace(r) {
+			if len(word) > 0 {
+				words = append(words, string(word))
+				word = word[:0]
+			}
+			continue
+		}
+		// a word starts at an upper case letter following a lower case
+		// one, or ending a run of upper case letters: "planName", "HTTPStatus"
+		if len(word) > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || unicode.IsUpper(prev) && nextLower {
+				words = append(words, string(word))
+				word = word[:0]
+			}
+		}
+		word = append(word, r)
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+	for i, w := range words {
+		r, size := utf8.DecodeRuneInString(w)
+		words[i] = string(unicode.ToUpper(r)) + w[size:]
+	}
+	return strings.Join(words, " ")
+}
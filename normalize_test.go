@@ -0,0 +1,75 @@
+package mixpanel
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestTitleCase(t *testing.T) {
+	for key, expected := range map[string]string{
+		"plan_name":    "Plan Name",
+		"planName":     "Plan Name",
+		"plan-name":    "Plan Name",
+		"Plan Name":    "Plan Name",
+		"  plan  name": "Plan Name",
+		"HTTPStatus":   "HTTP Status",
+		"userID":       "User ID",
+		"step2Done":    "Step2 Done",
+		"été_prévu":    "Été Prévu",
+	} {
+		if got := titleCase(key); got != expected {
+			t.Errorf("Expected %q for %q got %q", expected, key, got)
+		}
+	}
+}
+
+func TestKeyNormalizer(t *testing.T) {
+	n := &KeyNormalizer{TrimSpace: true, TitleCase: true, Rename: map[string]string{"sku": "SKU"}}
+	got := n.Normalize(&P{
+		"plan_name":   "Pro",
+		"Plan Name":   "Enterprise",
+		" coupon ":    "WINTER",
+		"sku":         "A-1",
+		"distinct_id": "12345",
+		"$browser":    "Chrome",
+		"mp_lib":      "go",
+	})
+	expected := &P{
+		"Plan Name":   "Enterprise",
+		"Coupon":      "WINTER",
+		"SKU":         "A-1",
+		"distinct_id": "12345",
+		"$browser":    "Chrome",
+		"mp_lib":      "go",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v got %v", expected, got)
+	}
+}
+
+func TestWithKeyNormalizer(t *testing.T) {
+	var buf bytes.Buffer
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf), WithKeyNormalizer(&KeyNormalizer{TitleCase: true}))
+	mp.Track("12345", "Signed Up", &P{"referral_source": "ads"})
+	mp.PeopleUnset("12345", []string{"days_overdue"})
+
+	dec := json.NewDecoder(&buf)
+	var event, update struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := dec.Decode(&event); err != nil {
+		t.Fatal(err)
+	}
+	props := event.Data["properties"].(map[string]interface{})
+	if props["Referral Source"] != "ads" || props["distinct_id"] != "12345" {
+		t.Errorf("Unexpected properties %v", props)
+	}
+	if err := dec.Decode(&update); err != nil {
+		t.Fatal(err)
+	}
+	if unset := update.Data["$unset"].([]interface{}); len(unset) != 1 || unset[0] != "Days Overdue" {
+		t.Errorf("Unexpected $unset %v", update.Data["$unset"])
+	}
+}
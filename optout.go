@@ -0,0 +1,135 @@
+package mixpanel
+
+import (
+	"errors"
+	"sync"
+)
+
+// Events recorded by OptInTracking and OptOutTracking, see WithOptOut.
+const (
+	OptInEvent  = "$opt_in"
+	OptOutEvent = "$opt_out"
+)
+
+// ErrNoOptOutRegistry is returned by OptOutTracking and OptInTracking
+// without WithOptOut.
+var ErrNoOptOutRegistry = errors.New("mixpanel: no opt-out registry, see WithOptOut")
+
+/*
+OptOutRegistry remembers the distinct_ids opted out of tracking.
+NewMemoryOptOutRegistry keeps them in memory; implement it on top of the
+database of the users so that consents survive restarts and are shared
+between processes.
+*/
+type OptOutRegistry interface {
+	OptedOut(distinct_id string) (bool, error)
+	SetOptedOut(distinct_id string, opted_out bool) error
+}
+
+type optOut struct {
+	registry OptOutRegistry
+	events   bool
+}
+
+/*
+WithOptOut turns the events and profile updates of the distinct_ids
+opted out in registry into no-ops, as they return nil without sending
+anything. Profile deletions still go through, so that opted out users
+can be forgotten. When the registry fails, calls fail with its error
+rather than risk tracking an opted out user.
+
+OptOutTracking and OptInTracking update the registry; with events set
+they also track an $opt_out event before opting out, and an $opt_in
+event after opting in. Example:
+
+	mp := NewMixpanel(token, WithOptOut(NewMemoryOptOutRegistry(), true))
+	mp.OptOutTracking("12345")
+*/
+func WithOptOut(registry OptOutRegistry, events bool) Option {
+	return func(mp *Mixpanel) {
+		mp.optOut = &optOut{registry: registry, events: events}
+		mp.middleware = append(mp.middleware, func(msg *Message) error {
+			if msg.DistinctID == "" || (msg.Endpoint == "people" && hasKey(msg.Properties, "$delete")) {
+				return nil
+			}
+			out, err := registry.OptedOut(msg.DistinctID)
+			if err != nil {
+				return err
+			}
+			if out {
+				return ErrSkipped
+			}
+			return nil
+		})
+	}
+}
+
+func hasKey(p *P, key string) bool {
+	_, ok := (*p)[key]
+	return ok
+}
+
+// OptOutTracking opts distinct_id out of tracking, see WithOptOut.
+func (mp *Mixpanel) OptOutTracking(distinct_id string) error {
+	if mp.optOut == nil {
+		return ErrNoOptOutRegistry
+	}
+	if mp.optOut.events {
+		if err := mp.Track(distinct_id, OptOutEvent, nil); err != nil {
+			return err
+		}
+	}
+	return mp.optOut.registry.SetOptedOut(distinct_id, true)
+}
+
+// OptInTracking opts distinct_id back in to tracking, see WithOptOut.
+func (mp *Mixpanel) OptInTracking(distinct_id string) error {
+	if mp.optOut == nil {
+		return ErrNoOptOutRegistry
+	}
+	if err := mp.optOut.registry.SetOptedOut(distinct_id, false); err != nil {
+		return err
+	}
+	if mp.optOut.events {
+		return mp.Track(distinct_id, OptInEvent, nil)
+	}
+	return nil
+}
+
+// HasOptedOutTracking reports whether distinct_id is opted out of
+// tracking, never without WithOptOut.
+func (mp *Mixpanel) HasOptedOutTracking(distinct_id string) (bool, error) {
+	if mp.optOut == nil {
+		return false, nil
+	}
+	return mp.optOut.registry.OptedOut(distinct_id)
+}
+
+// MemoryOptOutRegistry is an OptOutRegistry in memory, for a single
+// process.
+type MemoryOptOutRegistry struct {
+	mu  sync.RWMutex
+	out map[string]bool
+}
+
+// NewMemoryOptOutRegistry returns an empty MemoryOptOutRegistry.
+func NewMemoryOptOutRegistry() *MemoryOptOutRegistry {
+	return &MemoryOptOutRegistry{out: make(map[string]bool)}
+}
+
+func (r *MemoryOptOutRegistry) OptedOut(distinct_id string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.out[distinct_id], nil
+}
+
+func (r *MemoryOptOutRegistry) SetOptedOut(distinct_id string, opted_out bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if opted_out {
+		r.out[distinct_id] = true
+	} else {
+		delete(r.out, distinct_id)
+	}
+	return nil
+}
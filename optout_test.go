@@ -0,0 +1,73 @@
+package mixpanel
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type brokenOptOutRegistry struct{}
+
+func (brokenOptOutRegistry) OptedOut(distinct_id string) (bool, error) {
+	return false, errors.New("unavailable")
+}
+
+func (brokenOptOutRegistry) SetOptedOut(distinct_id string, opted_out bool) error {
+	return errors.New("unavailable")
+}
+
+func TestOptOut(t *testing.T) {
+	var buf bytes.Buffer
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf), WithOptOut(NewMemoryOptOutRegistry(), true))
+
+	if err := mp.OptOutTracking("u1"); err != nil {
+		t.Fatal(err)
+	}
+	if out, _ := mp.HasOptedOutTracking("u1"); !out {
+		t.Error("Expected u1 to be opted out")
+	}
+	for _, call := range []func() error{
+		func() error { return mp.Track("u1", "Viewed", nil) },
+		func() error { return mp.PeopleSet("u1", &P{"plan": "pro"}) },
+		func() error { return mp.Track("u2", "Viewed", nil) },
+		func() error { return mp.PeopleDelete("u1") },
+	} {
+		if err := call(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mp.OptInTracking("u1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mp.Track("u1", "Viewed", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []string{`"event":"$opt_out"`, `"distinct_id":"u2"`, `"$delete"`, `"event":"$opt_in"`, `"event":"Viewed"`}
+	if len(lines) != len(want) {
+		t.Fatalf("Expected %d messages got %s", len(want), buf.String())
+	}
+	for i, s := range want {
+		if !strings.Contains(lines[i], s) {
+			t.Errorf("Message %d: expected %s in %s", i, s, lines[i])
+		}
+	}
+}
+
+func TestOptOutErrors(t *testing.T) {
+	var buf bytes.Buffer
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf))
+	if err := mp.OptOutTracking("u1"); err != ErrNoOptOutRegistry {
+		t.Errorf("Expected ErrNoOptOutRegistry got %v", err)
+	}
+
+	mp = NewMixpanelWithConsumer(token, NewWriterConsumer(&buf), WithOptOut(brokenOptOutRegistry{}, false))
+	if err := mp.Track("u1", "Viewed", nil); err == nil {
+		t.Error("Expected the registry error")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected nothing sent got %s", buf.String())
+	}
+}
@@ -0,0 +1,104 @@
+package mixpanel
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// PanicEvent is the event tracked for panics.
+const PanicEvent = "Application Error"
+
+// maxPanicFrames bounds the frames hashed into the Stack Hash of a panic.
+const maxPanicFrames = 16
+
+/*
+RecoverAndTrack, deferred, tracks a panic of the goroutine as an
+"Application Error" event of distinct_id, see TrackPanic, flushes the
+consumer for the event to survive the crash, and panics again. It does
+nothing when the goroutine does not panic. Example:
+
+	func worker(mp *mixpanel.Mixpanel, job Job) {
+	    defer mp.RecoverAndTrack(job.UserID)
+	    ...
+	}
+*/
+func (mp *Mixpanel) RecoverAndTrack(distinct_id string) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	mp.TrackPanic(distinct_id, p, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultDrainTimeout)
+	mp.Flush(ctx)
+	cancel()
+	panic(p)
+}
+
+/*
+TrackPanic tracks the panic p, as returned by recover, as an
+"Application Error" event of distinct_id carrying prop and:
+
+  - Error, the panic value or the message of the panic error
+  - Panic Type, the Go type of the panic value
+  - Function and Location, the function and file:line that panicked
+  - Stack Hash, a hash of the functions of the stack, the same for the
+    panics of the same code path across deploys, to group crashes
+
+It must be called from the deferred function that recovered p, for the
+stack to be the one of the panic.
+*/
+func (mp *Mixpanel) TrackPanic(distinct_id string, p interface{}, prop *P) error {
+	props := P{
+		"Error":      fmt.Sprint(p),
+		"Panic Type": fmt.Sprintf("%T", p),
+	}
+	if err, ok := p.(error); ok {
+		props["Error"] = err.Error()
+	}
+	frames := panicFrames()
+	if len(frames) > 0 {
+		props["Function"] = frames[0].Function
+		props["Location"] = fmt.Sprintf("%s:%d", filepath.Base(frames[0].File), frames[0].Line)
+	}
+	h := sha1.New()
+	for i, frame := range frames {
+		if i == maxPanicFrames {
+			break
+		}
+		fmt.Fprintln(h, frame.Function)
+	}
+	props["Stack Hash"] = hex.EncodeToString(h.Sum(nil)[:8])
+	props.Update(prop)
+	return mp.Track(distinct_id, PanicEvent, &props)
+}
+
+// panicFrames returns the frames of the stack from the function that
+// panicked on, or the whole stack outside of a panic.
+func panicFrames() []runtime.Frame {
+	pcs := make([]uintptr, 64)
+	pcs = pcs[:runtime.Callers(2, pcs)]
+	var frames []runtime.Frame
+	it := runtime.CallersFrames(pcs)
+	for {
+		frame, more := it.Next()
+		if frame.Function == "runtime.gopanic" {
+			// the frames so far are those of the recovery
+			frames = frames[:0]
+		} else {
+			frames = append(frames, frame)
+		}
+		if !more {
+			break
+		}
+	}
+	// leave out the frames of runtime errors, such as runtime.panicIndex
+	for len(frames) > 0 && strings.HasPrefix(frames[0].Function, "runtime.") {
+		frames = frames[1:]
+	}
+	return frames
+}
@@ -0,0 +1,65 @@
+package mixpanel
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func panicking(mp *Mixpanel, index int) {
+	defer mp.RecoverAndTrack("13793")
+	_ = []int{}[index]
+}
+
+func TestRecoverAndTrack(t *testing.T) {
+	var buf bytes.Buffer
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf))
+
+	hashes := map[interface{}]bool{}
+	for i := 0; i < 2; i++ {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("Expected RecoverAndTrack to panic again")
+				}
+			}()
+			panicking(mp, i)
+		}()
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 events, got %q", lines)
+	}
+	for _, line := range lines {
+		var e Envelope
+		json.Unmarshal([]byte(line), &e)
+		var event struct {
+			Event      string
+			Properties map[string]interface{}
+		}
+		json.Unmarshal(e.Data, &event)
+		props := event.Properties
+		if event.Event != PanicEvent || props["distinct_id"] != "13793" || props["Panic Type"] != "runtime.boundsError" ||
+			!strings.Contains(props["Error"].(string), "index out of range") || !strings.HasSuffix(props["Function"].(string), ".panicking") ||
+			!strings.HasPrefix(props["Location"].(string), "panic_test.go:") {
+			t.Errorf("Unexpected event %+v", event)
+		}
+		hashes[props["Stack Hash"]] = true
+	}
+	if len(hashes) != 1 {
+		t.Errorf("Expected the same Stack Hash for the same panic, got %v", hashes)
+	}
+}
+
+func TestRecoverAndTrackWithoutPanic(t *testing.T) {
+	var buf bytes.Buffer
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf))
+	func() {
+		defer mp.RecoverAndTrack("13793")
+	}()
+	if buf.Len() != 0 {
+		t.Errorf("Expected no event, got %s", buf.String())
+	}
+}
@@ -0,0 +1,60 @@
+package mixpanel
+
+import (
+	"context"
+)
+
+/*
+WithPriorityEvents marks the events whose name matches one of patterns,
+exact names or globs as for WithEventAllowlist, as high priority: they
+bypass the queue of an AsyncConsumer and the buffer of a BuffConsumer
+and are sent right away, in the calling goroutine, while the other
+events keep batching. A purchase never waits behind thousands of page
+views. Names are matched before the middleware runs. Example:
+
+	mp := NewMixpanelWithConsumer(token, NewBuffConsumer(50),
+	    WithPriorityEvents("Purchase", "Subscription *"))
+
+Calls add up; see also TrackPriority.
+*/
+func WithPriorityEvents(patterns ...string) Option {
+	re := compileEventPatterns(patterns)
+	return func(mp *Mixpanel) {
+		mp.priority = append(mp.priority, re)
+	}
+}
+
+// TrackPriority tracks an event like Track, as a high priority event, see
+// WithPriorityEvents.
+func (mp *Mixpanel) TrackPriority(distinct_id, event string, prop *P) error {
+	data, err := mp.eventRecord("events", distinct_id, event, mp.eventProperties(distinct_id, prop))
+	if data == nil {
+		return err
+	}
+	return mp.sendBatch(withPriority(context.Background()), "events", [][]byte{data})
+}
+
+// isPriority reports whether event is a high priority event.
+func (mp *Mixpanel) isPriority(event string) bool {
+	for _, re := range mp.priority {
+		if re.MatchString(event) {
+			return true
+		}
+	}
+	return false
+}
+
+type priorityKey struct{}
+
+// withPriority marks the messages sent with ctx as high priority, for the
+// consumers to send them right away.
+func withPriority(ctx context.Context) context.Context {
+	return context.WithValue(ctx, priorityKey{}, true)
+}
+
+// isPriorityContext reports whether the messages sent with ctx are high
+// priority.
+func isPriorityContext(ctx context.Context) bool {
+	priority, _ := ctx.Value(priorityKey{}).(bool)
+	return priority
+}
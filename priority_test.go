@@ -0,0 +1,53 @@
+package mixpanel
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestPriorityEvents(t *testing.T) {
+	rs := newRecordingServer()
+	defer rs.Close()
+
+	mp := NewMixpanelWithConsumer(token, NewBuffConsumer(10), WithAPIHost(rs.URL), WithPriorityEvents("Purchase*"))
+	mp.Track("13793", "Page View", nil)
+	mp.Track("13793", "Purchase Completed", nil)
+	mp.TrackPriority("13793", "Refund", nil)
+
+	payloads := rs.Payloads()
+	if len(payloads) != 2 || !strings.Contains(payloads[0], `"Purchase Completed"`) || !strings.Contains(payloads[1], `"Refund"`) {
+		t.Fatalf("Expected the priority events to be sent right away, got %q", payloads)
+	}
+	mp.Flush(context.Background())
+	if payloads = rs.Payloads(); len(payloads) != 3 || !strings.Contains(payloads[2], `"Page View"`) {
+		t.Errorf("Expected the page view on flush, got %q", payloads)
+	}
+}
+
+func TestPriorityEventsAsync(t *testing.T) {
+	gc := &gatedConsumer{gate: make(chan struct{})}
+	close(gc.gate)
+	results := make(chan error, 1)
+	mp := NewMixpanelWithConsumer(token, gc, WithAsync(AsyncConfig{}), WithPriorityEvents("Purchase"))
+	mp.TrackWithCallback("13793", "Purchase", nil, func(err error) { results <- err })
+	select {
+	case err := <-results:
+		if err != nil {
+			t.Errorf("Expected a delivered event, got %v", err)
+		}
+	default:
+		t.Error("Expected the purchase to be sent before TrackWithCallback returned")
+	}
+	mp.Close(context.Background())
+	if got := gc.Messages(); len(got) != 1 {
+		t.Errorf("Expected 1 message, got %q", got)
+	}
+}
+
+func TestPriorityEventsWithToken(t *testing.T) {
+	mp := NewMixpanel(token, WithPriorityEvents("Purchase")).WithToken("other")
+	if !mp.isPriority("Purchase") {
+		t.Error("Expected WithToken to keep the priority events")
+	}
+}
@@ -0,0 +1,93 @@
+package mixpanel
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+/*
+MultiProjectMixpanel sends to several Mixpanel projects, keyed by an
+application defined name such as an environment or a tenant:
+
+	mpp := NewMultiProjectMixpanel(NewBuffConsumer(50))
+	mpp.AddProject("acme", acmeToken)
+	mpp.AddProject("globex", globexToken)
+
+	mpp.Track("acme", "12345", "Signed Up", nil)
+
+All projects share the same consumer, since every payload carries its
+own project token. It is safe for concurrent use.
+*/
+type MultiProjectMixpanel struct {
+	mu       sync.RWMutex
+	projects map[string]*Mixpanel
+	c        Consumer
+}
+
+// NewMultiProjectMixpanel creates a MultiProjectMixpanel without any
+// project, sending through c.
+func NewMultiProjectMixpanel(c Consumer) *MultiProjectMixpanel {
+	return &MultiProjectMixpanel{
+		projects: make(map[string]*Mixpanel),
+		c:        c,
+	}
+}
+
+// AddProject registers or replaces the token used for key and returns
+// the Mixpanel object tracking to that project.
+func (mpp *MultiProjectMixpanel) AddProject(key, token string) *Mixpanel {
+	mp := NewMixpanelWithConsumer(token, mpp.c)
+	mpp.mu.Lock()
+	mpp.projects[key] = mp
+	mpp.mu.Unlock()
+	return mp
+}
+
+// RemoveProject forgets the project registered for key.
+func (mpp *MultiProjectMixpanel) RemoveProject(key string) {
+	mpp.mu.Lock()
+	delete(mpp.projects, key)
+	mpp.mu.Unlock()
+}
+
+// Project returns the Mixpanel object of the project registered for key.
+func (mpp *MultiProjectMixpanel) Project(key string) (*Mixpanel, error) {
+	mpp.mu.RLock()
+	mp, ok := mpp.projects[key]
+	mpp.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("No Mixpanel project registered for '%s'", key)
+	}
+	return mp, nil
+}
+
+// Track tracks an event in the project registered for key. See
+// Mixpanel.Track.
+func (mpp *MultiProjectMixpanel) Track(key, distinct_id, event string, prop *P) error {
+	mp, err := mpp.Project(key)
+	if err != nil {
+		return err
+	}
+	return mp.Track(distinct_id, event, prop)
+}
+
+// PeopleSet sets properties of a people record in the project registered
+// for key. See Mixpanel.PeopleSet.
+func (mpp *MultiProjectMixpanel) PeopleSet(key, id string, properties *P) error {
+	mp, err := mpp.Project(key)
+	if err != nil {
+		return err
+	}
+	return mp.PeopleSet(id, properties)
+}
+
+// Flush flushes the shared consumer.
+func (mpp *MultiProjectMixpanel) Flush(ctx context.Context) error {
+	return mpp.c.Flush(ctx)
+}
+
+// Close closes the shared consumer.
+func (mpp *MultiProjectMixpanel) Close(ctx context.Context) error {
+	return mpp.c.Close(ctx)
+}
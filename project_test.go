@@ -0,0 +1,89 @@
+package mixpanel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMultiProjectMixpanel(t *testing.T) {
+	var buf bytes.Buffer
+	mpp := NewMultiProjectMixpanel(NewWriterConsumer(&buf))
+	mpp.AddProject("acme", "acme-token")
+	mpp.AddProject("globex", "globex-token")
+
+	if err := mpp.Track("globex", "12345", "Signed Up", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := mpp.Track("initech", "12345", "Signed Up", nil); err == nil {
+		t.Error("Expected an error for an unknown project")
+	}
+
+	var envelope struct {
+		Data Event `json:"data"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &envelope); err != nil {
+		t.Fatal(err)
+	}
+	if tok := (*envelope.Data.Properties)["token"]; tok != "globex-token" {
+		t.Errorf("Expected globex-token got %v", tok)
+	}
+}
+
+func TestTokenOverride(t *testing.T) {
+	var buf bytes.Buffer
+	mp := NewMixpanelWithConsumer("old-token", NewWriterConsumer(&buf))
+	mp.SetToken("new-token")
+	mp.Track("12345", "Signed Up", nil)
+	mp.WithToken("tenant-token").Track("12345", "Signed Up", nil)
+	mp.Track("12345", "Signed Up", nil)
+
+	dec := json.NewDecoder(&buf)
+	for _, expected := range []string{"new-token", "tenant-token", "new-token"} {
+		var envelope struct {
+			Data Event `json:"data"`
+		}
+		if err := dec.Decode(&envelope); err != nil {
+			t.Fatal(err)
+		}
+		if tok := (*envelope.Data.Properties)["token"]; tok != expected {
+			t.Errorf("Expected %s got %v", expected, tok)
+		}
+	}
+}
+
+func TestWithTokenKeepsConfig(t *testing.T) {
+	t.Setenv(DisableEnv, "true")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mp := NewMixpanelWithConsumer("old-token", NewWriterConsumer(io.Discard),
+		WithAPISecret("secret"),
+		WithServiceAccount(ServiceAccount{Username: "sa", Secret: "s3cr3t", ProjectID: 1}),
+		WithAPIHost("https://api.example.com"),
+		WithEndpointURL("events", "https://events.example.com/track"),
+		WithHTTPClient(&http.Client{}),
+		WithHeader("X-Gateway-Key", "k1"),
+		WithUserAgent("shop/2.1"),
+		WithRequestIDHeader(DefaultRequestIDHeader),
+		WithMiddleware(func(msg *Message) error { return nil }),
+		WithPriorityEvents("Purchase"),
+		WithShutdownContext(ctx, time.Second),
+		WithTimeouts(Timeouts{Flush: time.Second}),
+		WithOptOut(NewMemoryOptOutRegistry(), true),
+		WithClock(ClockFunc(time.Now)),
+		WithIDGenerator(IDGeneratorFunc(func() string { return "id" })),
+		WithLib("shop", "2.1"),
+	)
+
+	clone := reflect.ValueOf(mp.WithToken("tenant-token").config)
+	for i := 0; i < clone.NumField(); i++ {
+		if clone.Field(i).IsZero() {
+			t.Errorf("Expected WithToken to keep %s, set it above when adding an option", clone.Type().Field(i).Name)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package mixpanel
+
+import (
+	"time"
+)
+
+// TimeLayout is the ISO-8601 format Mixpanel expects for date properties.
+const TimeLayout = "2006-01-02T15:04:05"
+
+/*
+NewProps returns an empty property set to be filled with the chainable
+setters:
+
+	mp.Track("12345", "Signed Up", NewProps().
+	    Str("Plan", "Pro").
+	    Int("Seats", 5).
+	    Time("Trial Ends", trialEnd))
+*/
+func NewProps() *P {
+	return &P{}
+}
+
+// Set sets a property to an arbitrary value.
+func (this *P) Set(key string, value interface{}) *P {
+	(*this)[key] = value
+	return this
+}
+
+// Str sets a string property.
+func (this *P) Str(key, value string) *P {
+	return this.Set(key, value)
+}
+
+// Int sets an integer property.
+func (this *P) Int(key string, value int64) *P {
+	return this.Set(key, value)
+}
+
+// Float sets a numeric property.
+func (this *P) Float(key string, value float64) *P {
+	return this.Set(key, value)
+}
+
+// Bool sets a boolean property.
+func (this *P) Bool(key string, value bool) *P {
+	return this.Set(key, value)
+}
+
+// Time sets a date property, formatted in UTC with TimeLayout.
+func (this *P) Time(key string, value time.Time) *P {
+	return this.Set(key, value.UTC().Format(TimeLayout))
+}
+
+// Strs sets a list of strings property.
+func (this *P) Strs(key string, values ...string) *P {
+	return this.Set(key, values)
+}
+
+/*
+formatTimes returns p with every time.Time value, nested ones included,
+formatted in UTC with TimeLayout, which is what Mixpanel date operators
+understand. The top level epochKey property ("time" for events, "$time"
+for people updates) is converted to epoch seconds instead. Maps are only
+copied when they hold a time, p is never modified.
+*/
+func formatTimes(p *P, epochKey string) *P {
+	if p == nil {
+		return p
+	}
+	var formatted P
+	for key, value := range *p {
+		var v interface{}
+		var changed bool
+		if key == epochKey {
+			v, changed = epochTime(value)
+		} else {
+			v, changed = formatTime(value)
+		}
+		if changed {
+			if formatted == nil {
+				formatted = make(P, len(*p))
+				for k, v := range *p {
+					formatted[k] = v
+				}
+			}
+			formatted[key] = v
+		}
+	}
+	if formatted == nil {
+		return p
+	}
+	return &formatted
+}
+
+func epochTime(value interface{}) (interface{}, bool) {
+	switch t := value.(type) {
+	case time.Time:
+		return t.Unix(), true
+	case *time.Time:
+		if t != nil {
+			return t.Unix(), true
+		}
+	}
+	return value, false
+}
+
+func formatTime(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v.UTC().Format(TimeLayout), true
+	case *time.Time:
+		if v != nil {
+			return v.UTC().Format(TimeLayout), true
+		}
+	case *P:
+		if f := formatTimes(v, ""); f != v {
+			return f, true
+		}
+	case P:
+		if f := formatTimes(&v, ""); f != &v {
+			return f, true
+		}
+	case map[string]interface{}:
+		p := P(v)
+		if f := formatTimes(&p, ""); f != &p {
+			return f, true
+		}
+	case []interface{}:
+		var list []interface{}
+		for i, item := range v {
+			if f, changed := formatTime(item); changed {
+				if list == nil {
+					list = append([]interface{}(nil), v...)
+				}
+				list[i] = f
+			}
+		}
+		if list != nil {
+			return list, true
+		}
+	case []P:
+		if v != nil {
+			list := make([]interface{}, len(v))
+			for i, item := range v {
+				list[i] = item
+			}
+			return formatTime(list)
+		}
+	case []map[string]interface{}:
+		if v != nil {
+			list := make([]interface{}, len(v))
+			for i, item := range v {
+				list[i] = item
+			}
+			return formatTime(list)
+		}
+	case []time.Time:
+		if v == nil {
+			break
+		}
+		list := make([]string, len(v))
+		for i, t := range v {
+			list[i] = t.UTC().Format(TimeLayout)
+		}
+		return list, true
+	}
+	return value, false
+}
@@ -0,0 +1,403 @@
+package mixpanel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const query_endpoint string = "https://mixpanel.com/api/2.0"
+const export_endpoint string = "https://data.mixpanel.com/api/2.0"
+
+// Query and export API endpoints of the EU residency servers.
+const (
+	EUQueryEndpoint  = "https://eu.mixpanel.com/api/2.0"
+	EUExportEndpoint = "https://data-eu.mixpanel.com/api/2.0"
+)
+
+// dateLayout is the day format used by the query API for from_date/to_date.
+const dateLayout = "2006-01-02"
+
+/*
+QueryClient reads data back out of Mixpanel through the query API.
+
+The query API is authenticated either with the project's API secret or
+with a service account; neither must ever be shipped to clients. Example:
+
+	q := NewQueryClient("my-api-secret")
+	ts, err := q.Segmentation(ctx, &SegmentationQuery{
+	    Event: "Signed Up",
+	    From:  time.Now().AddDate(0, 0, -7),
+	    To:    time.Now(),
+	    Unit:  "day",
+	})
+*/
+type QueryClient struct {
+	// Endpoint is the base URL of the query API.
+	Endpoint string
+	// ExportEndpoint is the base URL of the raw export API.
+	ExportEndpoint string
+	// ProjectID is sent as project_id when non zero.
+	ProjectID int64
+	// HTTPClient is used for all requests, http.DefaultClient when nil.
+	HTTPClient *http.Client
+
+	username string
+	password string
+}
+
+// NewQueryClient creates a QueryClient authenticated with an API secret.
+func NewQueryClient(apiSecret string) *QueryClient {
+	return &QueryClient{
+		Endpoint:       query_endpoint,
+		ExportEndpoint: export_endpoint,
+		username:       apiSecret,
+	}
+}
+
+// NewQueryClientWithServiceAccount creates a QueryClient authenticated
+// with a service account, on the project of sa.
+func NewQueryClientWithServiceAccount(sa ServiceAccount) *QueryClient {
+	return &QueryClient{
+		Endpoint:       query_endpoint,
+		ExportEndpoint: export_endpoint,
+		ProjectID:      sa.ProjectID,
+		username:       sa.Username,
+		password:       sa.Secret,
+	}
+}
+
+// QueryError is returned when the query or compliance API answers with an
+// error.
+type QueryError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("Mixpanel query error (%d): %s", e.StatusCode, e.Message)
+}
+
+// get performs an authenticated GET on path and decodes the JSON body into v.
+func (q *QueryClient) get(ctx context.Context, path string, params url.Values, v interface{}) error {
+	return q.do(ctx, "GET", path, params, v)
+}
+
+// post is like get but sends params as a form encoded body.
+func (q *QueryClient) post(ctx context.Context, path string, params url.Values, v interface{}) error {
+	return q.do(ctx, "POST", path, params, v)
+}
+
+func (q *QueryClient) do(ctx context.Context, method, path string, params url.Values, v interface{}) error {
+	resp, err := q.request(ctx, method, q.Endpoint+path, params)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("Cannot interpret Mixpanel query response: %v", err)
+	}
+	return nil
+}
+
+// request sends an authenticated request to endpoint and returns the
+// response, or a QueryError when its status is not 2xx. The caller must
+// close the body.
+func (q *QueryClient) request(ctx context.Context, method, endpoint string, params url.Values) (*http.Response, error) {
+	if q.ProjectID != 0 {
+		params.Set("project_id", strconv.FormatInt(q.ProjectID, 10))
+	}
+	var req *http.Request
+	var err error
+	if method == "GET" {
+		req, err = http.NewRequestWithContext(ctx, method, endpoint+"?"+params.Encode(), nil)
+	} else {
+		req, err = http.NewRequestWithContext(ctx, method, endpoint, strings.NewReader(params.Encode()))
+		if req != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(q.username, q.password)
+	req.Header.Set("Accept", "application/json")
+
+	client := q.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &e) != nil || e.Error == "" {
+			e.Error = string(body)
+		}
+		return nil, &QueryError{StatusCode: resp.StatusCode, Message: e.Error}
+	}
+	return resp, nil
+}
+
+/*
+SegmentationQuery describes a request to the segmentation endpoint.
+
+Event, From and To are required. Unit is one of "minute", "hour", "day",
+"week" or "month" and defaults to "day". Where is a segmentation
+expression such as `properties["Plan"] == "Pro"`, On names a property
+to break the results down by, and Type is one of "general", "unique"
+or "average".
+*/
+type SegmentationQuery struct {
+	Event string
+	From  time.Time
+	To    time.Time
+	Where string
+	On    string
+	Unit  string
+	Type  string
+}
+
+// TimeSeries is the result of a segmentation query. Values maps each
+// segment (the event name when On is empty) to a value per date of Series.
+type TimeSeries struct {
+	Series []string                      `json:"series"`
+	Values map[string]map[string]float64 `json:"values"`
+}
+
+// Points returns the values of segment in the order given by Series.
+// Dates without data are returned as zero.
+func (ts *TimeSeries) Points(segment string) []float64 {
+	points := make([]float64, len(ts.Series))
+	for i, date := range ts.Series {
+		points[i] = ts.Values[segment][date]
+	}
+	return points
+}
+
+// Segmentation returns the time series of an event, optionally filtered
+// and broken down by a property.
+func (q *QueryClient) Segmentation(ctx context.Context, query *SegmentationQuery) (*TimeSeries, error) {
+	if query.Event == "" {
+		return nil, fmt.Errorf("Segmentation query needs an event")
+	}
+	params := url.Values{}
+	params.Set("event", query.Event)
+	params.Set("from_date", query.From.Format(dateLayout))
+	params.Set("to_date", query.To.Format(dateLayout))
+	if query.Where != "" {
+		params.Set("where", query.Where)
+	}
+	if query.On != "" {
+		params.Set("on", query.On)
+	}
+	if query.Unit != "" {
+		params.Set("unit", query.Unit)
+	}
+	if query.Type != "" {
+		params.Set("type", query.Type)
+	}
+
+	var response struct {
+		Data TimeSeries `json:"data"`
+	}
+	if err := q.get(ctx, "/segmentation", params, &response); err != nil {
+		return nil, err
+	}
+	return &response.Data, nil
+}
+
+// InsightsResult is the result of a saved Insights report. Series maps
+// each metric to a value per date.
+type InsightsResult struct {
+	ComputedAt string `json:"computed_at"`
+	DateRange  struct {
+		FromDate string `json:"from_date"`
+		ToDate   string `json:"to_date"`
+	} `json:"date_range"`
+	Headers []string                      `json:"headers"`
+	Series  map[string]map[string]float64 `json:"series"`
+}
+
+// Insights returns the results of the saved Insights report identified
+// by bookmarkID.
+func (q *QueryClient) Insights(ctx context.Context, bookmarkID int64) (*InsightsResult, error) {
+	params := url.Values{}
+	params.Set("bookmark_id", strconv.FormatInt(bookmarkID, 10))
+
+	result := new(InsightsResult)
+	if err := q.get(ctx, "/insights", params, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Funnel identifies a saved funnel.
+type Funnel struct {
+	FunnelID int64  `json:"funnel_id"`
+	Name     string `json:"name"`
+}
+
+// ListFunnels returns the funnels saved in the project.
+func (q *QueryClient) ListFunnels(ctx context.Context) ([]Funnel, error) {
+	var funnels []Funnel
+	if err := q.get(ctx, "/funnels/list", url.Values{}, &funnels); err != nil {
+		return nil, err
+	}
+	return funnels, nil
+}
+
+// FunnelStep is the conversion data of a single funnel step.
+type FunnelStep struct {
+	Event            string  `json:"event"`
+	Goal             string  `json:"goal"`
+	Count            int64   `json:"count"`
+	StepConvRatio    float64 `json:"step_conv_ratio"`
+	OverallConvRatio float64 `json:"overall_conv_ratio"`
+	AvgTime          float64 `json:"avg_time"`
+}
+
+// FunnelAnalysis summarizes a funnel over one date.
+type FunnelAnalysis struct {
+	Completion     int64 `json:"completion"`
+	StartingAmount int64 `json:"starting_amount"`
+	Steps          int   `json:"steps"`
+	Worst          int   `json:"worst"`
+}
+
+// FunnelDay holds the steps and summary of a funnel for one date.
+type FunnelDay struct {
+	Steps    []FunnelStep   `json:"steps"`
+	Analysis FunnelAnalysis `json:"analysis"`
+}
+
+// FunnelResult is the result of a funnel query. Data is keyed by the
+// dates listed in Dates.
+type FunnelResult struct {
+	Dates []string
+	Data  map[string]FunnelDay
+}
+
+/*
+FunnelQuery describes a request to the funnels endpoint.
+
+FunnelID, From and To are required. Unit is one of "day", "week" or
+"month". Where and On filter and segment the funnel like in a
+SegmentationQuery.
+*/
+type FunnelQuery struct {
+	FunnelID int64
+	From     time.Time
+	To       time.Time
+	Unit     string
+	Where    string
+	On       string
+}
+
+// QueryFunnel returns the conversion data of a saved funnel.
+func (q *QueryClient) QueryFunnel(ctx context.Context, query *FunnelQuery) (*FunnelResult, error) {
+	params := url.Values{}
+	params.Set("funnel_id", strconv.FormatInt(query.FunnelID, 10))
+	params.Set("from_date", query.From.Format(dateLayout))
+	params.Set("to_date", query.To.Format(dateLayout))
+	if query.Unit != "" {
+		params.Set("unit", query.Unit)
+	}
+	if query.Where != "" {
+		params.Set("where", query.Where)
+	}
+	if query.On != "" {
+		params.Set("on", query.On)
+	}
+
+	var response struct {
+		Meta struct {
+			Dates []string `json:"dates"`
+		} `json:"meta"`
+		Data map[string]FunnelDay `json:"data"`
+	}
+	if err := q.get(ctx, "/funnels", params, &response); err != nil {
+		return nil, err
+	}
+	return &FunnelResult{Dates: response.Meta.Dates, Data: response.Data}, nil
+}
+
+/*
+RetentionQuery describes a request to the retention endpoint.
+
+From and To are required. RetentionType is "birth" (the default) or
+"compounded". BornEvent is the event that puts a user in a cohort and
+is required for birth retention; Event is the event counted as the
+user coming back, any event when empty. Unit is "day", "week" or
+"month", or use Interval to set a custom number of days per bucket.
+*/
+type RetentionQuery struct {
+	From          time.Time
+	To            time.Time
+	RetentionType string
+	BornEvent     string
+	Event         string
+	BornWhere     string
+	Where         string
+	On            string
+	Unit          string
+	Interval      int
+	IntervalCount int
+}
+
+// RetentionCohort is the retention of the users born on one date. Counts
+// holds the number of users who came back in each interval and First
+// the size of the cohort.
+type RetentionCohort struct {
+	Counts []int64 `json:"counts"`
+	First  int64   `json:"first"`
+}
+
+// Retention returns the retention cohorts keyed by their birth date.
+func (q *QueryClient) Retention(ctx context.Context, query *RetentionQuery) (map[string]RetentionCohort, error) {
+	params := url.Values{}
+	params.Set("from_date", query.From.Format(dateLayout))
+	params.Set("to_date", query.To.Format(dateLayout))
+	for key, value := range map[string]string{
+		"retention_type": query.RetentionType,
+		"born_event":     query.BornEvent,
+		"event":          query.Event,
+		"born_where":     query.BornWhere,
+		"where":          query.Where,
+		"on":             query.On,
+		"unit":           query.Unit,
+	} {
+		if value != "" {
+			params.Set(key, value)
+		}
+	}
+	if query.Interval > 0 {
+		params.Set("interval", strconv.Itoa(query.Interval))
+	}
+	if query.IntervalCount > 0 {
+		params.Set("interval_count", strconv.Itoa(query.IntervalCount))
+	}
+
+	var cohorts map[string]RetentionCohort
+	if err := q.get(ctx, "/retention", params, &cohorts); err != nil {
+		return nil, err
+	}
+	return cohorts, nil
+}
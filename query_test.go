@@ -0,0 +1,91 @@
+package mixpanel
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSegmentation(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, _, ok := r.BasicAuth(); !ok || user != "secret" {
+			t.Errorf("Expected basic auth with the api secret, got %q", user)
+		}
+		if r.URL.Path != "/segmentation" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		q := r.URL.Query()
+		if q.Get("event") != "Signed Up" || q.Get("from_date") != "2024-01-01" || q.Get("unit") != "day" {
+			t.Errorf("Unexpected query %s", r.URL.RawQuery)
+		}
+		w.Write([]byte(`{"data": {"series": ["2024-01-01", "2024-01-02"],
+			"values": {"Signed Up": {"2024-01-02": 7, "2024-01-01": 3}}}, "legend_size": 1}`))
+	}))
+	defer ts.Close()
+
+	q := NewQueryClient("secret")
+	q.Endpoint = ts.URL
+	result, err := q.Segmentation(context.Background(), &SegmentationQuery{
+		Event: "Signed Up",
+		From:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:    time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		Unit:  "day",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	points := result.Points("Signed Up")
+	if len(points) != 2 || points[0] != 3 || points[1] != 7 {
+		t.Errorf("Expected [3 7] got %v", points)
+	}
+}
+
+func TestQueryError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error": "Invalid API secret", "request": "/api/2.0/insights"}`))
+	}))
+	defer ts.Close()
+
+	q := NewQueryClient("bad")
+	q.Endpoint = ts.URL
+	_, err := q.Insights(context.Background(), 42)
+	qe, ok := err.(*QueryError)
+	if !ok {
+		t.Fatalf("Expected a QueryError got %v", err)
+	}
+	if qe.StatusCode != http.StatusUnauthorized || qe.Message != "Invalid API secret" {
+		t.Errorf("Unexpected error %#v", qe)
+	}
+}
+
+func TestQueryFunnelServiceAccount(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		if user != "sa.user" || pass != "sa-secret" {
+			t.Errorf("Expected service account auth, got %q:%q", user, pass)
+		}
+		if r.URL.Query().Get("project_id") != "123" || r.URL.Query().Get("funnel_id") != "7509" {
+			t.Errorf("Unexpected query %s", r.URL.RawQuery)
+		}
+		w.Write([]byte(`{"meta": {"dates": ["2024-01-01"]}, "data": {"2024-01-01": {
+			"steps": [{"count": 10, "event": "Signup", "overall_conv_ratio": 1},
+			          {"count": 4, "event": "Purchase", "step_conv_ratio": 0.4, "overall_conv_ratio": 0.4}],
+			"analysis": {"completion": 4, "starting_amount": 10, "steps": 2, "worst": 1}}}}`))
+	}))
+	defer ts.Close()
+
+	sa := ServiceAccount{Username: "sa.user", Secret: "sa-secret", ProjectID: 123}
+	q := NewQueryClientWithServiceAccount(sa)
+	q.Endpoint = ts.URL
+	result, err := q.QueryFunnel(context.Background(), &FunnelQuery{FunnelID: 7509})
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := result.Data[result.Dates[0]]
+	if len(day.Steps) != 2 || day.Steps[1].Count != 4 || day.Analysis.Completion != 4 {
+		t.Errorf("Unexpected funnel %#v", day)
+	}
+}
@@ -0,0 +1,130 @@
+package mixpanel
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+// ErrInvalidRawProperties is returned by TrackRaw for properties that are
+// not a JSON object.
+var ErrInvalidRawProperties = errors.New("mixpanel: raw properties must be a JSON object")
+
+/*
+TrackRaw tracks an event like Track, for properties already serialized
+as a JSON object, by another pipeline for example. The object is copied
+into the event as is, rather than decoded and encoded again; like the
+properties of Track, its members take precedence over the token,
+distinct_id, time and library properties TrackRaw adds. Example:
+
+	mp.TrackRaw("12345", "Page Viewed", json.RawMessage(`{"Page": "/pricing"}`))
+
+Middleware needs the properties as a P: when mp has any, such as
+WithValidation or WithOptOut, they are decoded, with json.Number for
+numbers, and the event goes through Track.
+*/
+func (mp *Mixpanel) TrackRaw(distinct_id, event string, rawProps json.RawMessage) error {
+	raw := bytes.TrimSpace(rawProps)
+	if len(raw) == 0 {
+		raw = []byte("{}")
+	}
+	if raw[0] != '{' || !json.Valid(raw) {
+		return ErrInvalidRawProperties
+	}
+	if len(mp.middleware) > 0 {
+		var props P
+		if err := unmarshalNumbers(raw, &props); err != nil {
+			return err
+		}
+		return mp.Track(distinct_id, event, &props)
+	}
+	return mp.send("events", mp.rawEvent(distinct_id, event, raw))
+}
+
+// rawEvent serializes an event whose properties are the JSON object raw
+// along with the properties Track adds, unless raw has them.
+func (mp *Mixpanel) rawEvent(distinct_id, event string, raw []byte) []byte {
+	var has struct{ token, distinctID, time, lib, libVersion bool }
+	topLevelKeys(raw, func(key []byte) {
+		switch string(key) {
+		case PropToken:
+			has.token = true
+		case PropDistinctID:
+			has.distinctID = true
+		case PropTime:
+			has.time = true
+		case PropLib:
+			has.lib = true
+		case PropLibVersion:
+			has.libVersion = true
+		}
+	})
+	lib, version := mp.libProperties()
+
+	b := make([]byte, 0, len(raw)+len(event)+160)
+	b = append(b, `{"event":`...)
+	b = appendString(b, event)
+	b = append(b, `,"properties":{`...)
+	if !has.token {
+		b = append(b, `"token":`...)
+		b = appendString(b, mp.GetToken())
+		b = append(b, ',')
+	}
+	if !has.distinctID {
+		b = append(b, `"distinct_id":`...)
+		b = appendString(b, distinct_id)
+		b = append(b, ',')
+	}
+	if !has.time {
+		b = append(b, `"time":`...)
+		b = strconv.AppendInt(b, mp.now().Unix(), 10)
+		b = append(b, ',')
+	}
+	if !has.lib {
+		b = append(b, `"mp_lib":`...)
+		b = appendString(b, lib)
+		b = append(b, ',')
+	}
+	if !has.libVersion {
+		b = append(b, `"$lib_version":`...)
+		b = appendString(b, version)
+		b = append(b, ',')
+	}
+	// drop the braces of raw, and the last comma when it is empty
+	if members := bytes.TrimSpace(raw[1 : len(raw)-1]); len(members) > 0 {
+		b = append(b, members...)
+	} else if b[len(b)-1] == ',' {
+		b = b[:len(b)-1]
+	}
+	return append(b, "}}"...)
+}
+
+// topLevelKeys calls fn with the keys of the members of the valid JSON
+// object raw, escapes left as is.
+func topLevelKeys(raw []byte, fn func(key []byte)) {
+	depth := 0
+	expectKey := false
+	for i := 0; i < len(raw); i++ {
+		switch raw[i] {
+		case '{', '[':
+			depth++
+			expectKey = depth == 1
+		case '}', ']':
+			depth--
+		case ',':
+			expectKey = depth == 1
+		case '"':
+			start := i + 1
+			for i++; raw[i] != '"'; i++ {
+				if raw[i] == '\\' {
+					i++
+				}
+			}
+			if expectKey {
+				fn(raw[start:i])
+				expectKey = false
+			}
+		}
+	}
+}
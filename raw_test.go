@@ -0,0 +1,78 @@
+package mixpanel
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrackRaw(t *testing.T) {
+	var buf bytes.Buffer
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf), WithClock(ClockFunc(func() time.Time { return at })))
+
+	for _, raw := range []string{
+		` {"Page": "/pricing", "nested": {"time": 1, "token": "x"}, "list": [{"a": "b"}]} `,
+		`{"time": 1704067200123, "distinct_id": "other"}`,
+		`{}`,
+		``,
+	} {
+		if err := mp.TrackRaw("12345", "Page Viewed", json.RawMessage(raw)); err != nil {
+			t.Fatalf("%q: %v", raw, err)
+		}
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected 4 messages got %s", buf.String())
+	}
+	for i, expected := range []P{
+		{"token": token, "distinct_id": "12345", "time": 1704110400, "Page": "/pricing", "nested": P{"time": 1, "token": "x"}, "list": []interface{}{P{"a": "b"}}},
+		{"token": token, "distinct_id": "other", "time": int64(1704067200123)},
+		{"token": token, "distinct_id": "12345", "time": 1704110400},
+		{"token": token, "distinct_id": "12345", "time": 1704110400},
+	} {
+		var envelope struct {
+			Data Event `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(lines[i]), &envelope); err != nil {
+			t.Fatalf("Invalid message %s: %v", lines[i], err)
+		}
+		props := *envelope.Data.Properties
+		if props["mp_lib"] != "go" || props["$lib_version"] != Version {
+			t.Errorf("Expected the library properties in %s", lines[i])
+		}
+		delete(props, "mp_lib")
+		delete(props, "$lib_version")
+		got, _ := json.Marshal(props)
+		want, _ := json.Marshal(expected)
+		if !bytes.Equal(got, want) {
+			t.Errorf("Message %d: expected %s got %s", i, want, got)
+		}
+	}
+
+	for _, raw := range []string{`[1]`, `"x"`, `{"a":`} {
+		if err := mp.TrackRaw("12345", "Page Viewed", json.RawMessage(raw)); err != ErrInvalidRawProperties {
+			t.Errorf("%q: expected ErrInvalidRawProperties got %v", raw, err)
+		}
+	}
+}
+
+func TestTrackRawMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	var seen P
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf), WithMiddleware(func(msg *Message) error {
+		seen = *msg.Properties
+		return nil
+	}))
+	if err := mp.TrackRaw("12345", "Purchase", json.RawMessage(`{"order_id": 9007199254740993}`)); err != nil {
+		t.Fatal(err)
+	}
+	if seen["order_id"] != json.Number("9007199254740993") {
+		t.Errorf("Expected the middleware to see the decoded properties got %v", seen)
+	}
+	if !strings.Contains(buf.String(), `"order_id":9007199254740993`) {
+		t.Errorf("Expected the exact order_id in %s", buf.String())
+	}
+}
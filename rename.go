@@ -0,0 +1,58 @@
+package mixpanel
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+/*
+RenameTable renames events and properties as they are sent, to
+consolidate legacy names without changing every call site at once:
+Events maps event names to their new name, and Properties property keys
+to their new key, on events and on the properties changed by people and
+group updates. When both a property and its new name are set, the
+property already named so wins, see KeyNormalizer. Example:
+
+	mp := NewMixpanel(token, WithRenameTable(&RenameTable{
+	    Events:     map[string]string{"signup": "Signed Up", "Sign Up": "Signed Up"},
+	    Properties: map[string]string{"plan_name": "Plan"},
+	}))
+
+A table can be kept in a JSON file, {"events": {...}, "properties":
+{...}}, see LoadRenameTable.
+*/
+type RenameTable struct {
+	Events     map[string]string `json:"events,omitempty"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+// LoadRenameTable reads a RenameTable from the JSON file path.
+func LoadRenameTable(path string) (*RenameTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("mixpanel: %v", err)
+	}
+	var t RenameTable
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("mixpanel: invalid rename table %s: %v", path, err)
+	}
+	return &t, nil
+}
+
+// WithRenameTable applies t to every event and people and group update.
+func WithRenameTable(t *RenameTable) Option {
+	return WithMiddleware(t.Rename)
+}
+
+// Rename implements Middleware.
+func (t *RenameTable) Rename(msg *Message) error {
+	if name, ok := t.Events[msg.Event]; ok && msg.IsEvent() {
+		msg.Event = name
+	}
+	if len(t.Properties) == 0 || msg.Properties == nil {
+		return nil
+	}
+	n := &KeyNormalizer{Rename: t.Properties}
+	return n.normalizeMessage(msg)
+}
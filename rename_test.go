@@ -0,0 +1,55 @@
+package mixpanel
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRenameTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "renames.json")
+	os.WriteFile(path, []byte(`{"events": {"signup": "Signed Up"}, "properties": {"plan_name": "Plan", "coupon": "Coupon"}}`), 0o644)
+	table, err := LoadRenameTable(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf), WithRenameTable(table))
+	mp.Track("12345", "signup", &P{"plan_name": "Pro", "Source": "ad"})
+	mp.Track("12345", "Purchase", &P{"coupon": "WINTER", "Coupon": "SPRING"})
+	mp.PeopleSet("12345", &P{"plan_name": "Pro"})
+
+	var msgs []map[string]interface{}
+	dec := json.NewDecoder(&buf)
+	for {
+		var envelope Envelope
+		if err := dec.Decode(&envelope); err != nil {
+			break
+		}
+		var msg map[string]interface{}
+		json.Unmarshal(envelope.Data, &msg)
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) != 3 {
+		t.Fatalf("Expected 3 messages got %v", msgs)
+	}
+	props := msgs[0]["properties"].(map[string]interface{})
+	if msgs[0]["event"] != "Signed Up" || props["Plan"] != "Pro" || props["Source"] != "ad" || props["plan_name"] != nil {
+		t.Errorf("Unexpected event %v", msgs[0])
+	}
+	props = msgs[1]["properties"].(map[string]interface{})
+	if msgs[1]["event"] != "Purchase" || props["Coupon"] != "SPRING" || props["coupon"] != nil {
+		t.Errorf("Unexpected event %v", msgs[1])
+	}
+	if set := msgs[2]["$set"]; !reflect.DeepEqual(set, map[string]interface{}{"Plan": "Pro"}) {
+		t.Errorf("Unexpected update %v", msgs[2])
+	}
+
+	if _, err := LoadRenameTable(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Expected an error for a missing table")
+	}
+}
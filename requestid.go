@@ -0,0 +1,68 @@
+package mixpanel
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// DefaultRequestIDHeader is the usual header of request IDs, see
+// WithRequestIDHeader.
+const DefaultRequestIDHeader = "X-Request-Id"
+
+/*
+RequestError is the error of a failed request of a StdConsumer, of an
+import or of a ping, carrying the ID generated for the request, a random
+UUID, so that logs, and support tickets with Mixpanel, can reference the
+request. StatusCode is the HTTP status of the response, 0 without
+response. The request ID is also given to the OnResponse, BeforeSend
+and AfterSend hooks, listed in ImportProgress.RequestIDs, and sent to
+Mixpanel with WithRequestIDHeader.
+*/
+type RequestError struct {
+	RequestID  string
+	StatusCode int
+	Err        error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("%v (request %s)", e.Err, e.RequestID)
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// WithRequestIDHeader sends the ID of every request, of the consumer and
+// of the imports and pings of mp, in the header name,
+// DefaultRequestIDHeader for example. It is handed to the consumer when
+// it has a SetRequestIDHeader method.
+func WithRequestIDHeader(name string) Option {
+	return func(mp *Mixpanel) {
+		mp.requestIDHeader = name
+		if c, ok := findConsumer[interface{ SetRequestIDHeader(string) }](mp.c); ok {
+			c.SetRequestIDHeader(name)
+		}
+	}
+}
+
+// newRequestID returns a random UUID identifying a request.
+func newRequestID() string {
+	return NewDeviceID()
+}
+
+// newRequest returns a request of mp with a new ID, sent in the header of
+// WithRequestIDHeader, along with the extra headers and User-Agent.
+func (mp *Mixpanel) newRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, string, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, "", err
+	}
+	id := newRequestID()
+	setHeaders(req, mp.header, mp.userAgent)
+	if mp.requestIDHeader != "" {
+		req.Header.Set(mp.requestIDHeader, id)
+	}
+	return req, id, nil
+}
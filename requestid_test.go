@@ -0,0 +1,71 @@
+package mixpanel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	var headers []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header.Get(DefaultRequestIDHeader))
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+	}))
+	defer ts.Close()
+
+	var responses []*Response
+	c := NewStdConsumer()
+	c.OnResponse(func(r *Response) {
+		responses = append(responses, r)
+	})
+	mp := NewMixpanelWithConsumer(token, c, WithAPIHost(ts.URL), WithRequestIDHeader(DefaultRequestIDHeader))
+	err := mp.Track("12345", "Viewed", nil)
+
+	var re *RequestError
+	if !errors.As(err, &re) || re.StatusCode != http.StatusBadGateway || !IsTransient(err) {
+		t.Fatalf("Expected a transient *RequestError, got %v", err)
+	}
+	if len(headers) != 1 || headers[0] == "" || headers[0] != re.RequestID {
+		t.Errorf("Expected the request ID %q in the header, got %q", re.RequestID, headers)
+	}
+	if !strings.Contains(err.Error(), re.RequestID) {
+		t.Errorf("Expected the request ID in the message, got %q", err)
+	}
+	if len(responses) != 1 || responses[0].RequestID != re.RequestID {
+		t.Errorf("Expected the request ID in the response, got %+v", responses)
+	}
+
+	if err := mp.Track("12345", "Viewed", nil); !errors.As(err, &re) || re.RequestID == headers[0] {
+		t.Errorf("Expected a new request ID, got %v", err)
+	}
+}
+
+func TestRequestIDImportAndPing(t *testing.T) {
+	var headers []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header.Get(DefaultRequestIDHeader))
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+	}))
+	defer ts.Close()
+
+	mp := NewMixpanel(token, WithAPIHost(ts.URL), WithAPISecret("secret"), WithRequestIDHeader(DefaultRequestIDHeader))
+	input := `{"event": "Signed Up", "properties": {"time": 1704067200, "distinct_id": "12345"}}`
+	progress, err := mp.ImportFromReader(context.Background(), strings.NewReader(input), nil)
+	var re *RequestError
+	if !errors.As(err, &re) || re.StatusCode != http.StatusBadGateway || !IsTransient(err) {
+		t.Fatalf("Expected a transient *RequestError, got %v", err)
+	}
+	if len(headers) != 1 || headers[0] != re.RequestID || fmt.Sprint(progress.RequestIDs) != "["+re.RequestID+"]" {
+		t.Errorf("Expected the ID of the import in its header and progress, got %q and %v", headers, progress.RequestIDs)
+	}
+
+	err = mp.Ping(context.Background())
+	if !errors.As(err, &re) || len(headers) != 2 || headers[1] != re.RequestID {
+		t.Errorf("Expected the ID of the ping in its header and error, got %q and %v", headers, err)
+	}
+}
@@ -0,0 +1,103 @@
+package mixpanel
+
+import (
+	"time"
+)
+
+// Reserved event properties.
+const (
+	PropToken           = "token"
+	PropDistinctID      = "distinct_id"
+	PropTime            = "time"
+	PropInsertID        = "$insert_id"
+	PropDeviceID        = "$device_id"
+	PropUserID          = "$user_id"
+	PropLib             = "mp_lib"
+	PropLibVersion      = "$lib_version"
+	PropIP              = "ip"
+	PropCity            = "$city"
+	PropRegion          = "$region"
+	PropCountryCode     = "mp_country_code"
+	PropOS              = "$os"
+	PropBrowser         = "$browser"
+	PropCurrentURL      = "$current_url"
+	PropReferrer        = "$referrer"
+	PropReferringDomain = "$referring_domain"
+	PropDuration        = "$duration"
+	PropSampleRate      = "$sample_rate"
+	PropProcessingTime  = "mp_processing_time_ms"
+)
+
+// Reserved profile properties.
+const (
+	PropEmail     = "$email"
+	PropName      = "$name"
+	PropFirstName = "$first_name"
+	PropLastName  = "$last_name"
+	PropCreated   = "$created"
+	PropPhone     = "$phone"
+	PropAvatar    = "$avatar"
+	PropTimezone  = "$timezone"
+	// PropLastSeen is the time of the last update of a profile without
+	// PropIgnoreTime, set by Mixpanel from its $time.
+	PropLastSeen   = "$last_seen"
+	PropIgnoreTime = "$ignore_time"
+)
+
+/*
+PeopleTouch marks the profile id as seen now, updating its $last_seen
+without changing its properties, for activity that tracks no event such
+as a session resumed from a token. See PeopleTouchAt.
+*/
+func (mp *Mixpanel) PeopleTouch(id string) error {
+	return mp.PeopleTouchAt(id, mp.now())
+}
+
+// PeopleTouchAt sets the $last_seen of the profile id to at, when
+// backfilling activity. It updates $last_seen even with WithIgnoreTime.
+func (mp *Mixpanel) PeopleTouchAt(id string, at time.Time) error {
+	return mp.PeopleUpdate(&P{
+		"$distinct_id": id,
+		"$time":        at,
+		PropIgnoreTime: false,
+		"$set":         P{},
+	})
+}
+
+/*
+WithIgnoreTime sends every profile update with $ignore_time, so that the
+updates do not change the $last_seen of the profiles, for services
+updating profiles on behalf of the users, such as a nightly CRM sync.
+Updates with an explicit $ignore_time, and PeopleTouch, are left as is.
+*/
+func WithIgnoreTime() Option {
+	return WithMiddleware(func(msg *Message) error {
+		if msg.Endpoint != "people" || msg.Properties == nil {
+			return nil
+		}
+		if _, ok := (*msg.Properties)[PropIgnoreTime]; !ok {
+			(*msg.Properties)[PropIgnoreTime] = true
+		}
+		return nil
+	})
+}
+
+// SetProfileEmail sets the $email of a profile, used by Mixpanel messaging.
+func (mp *Mixpanel) SetProfileEmail(id, email string) error {
+	return mp.PeopleSet(id, &P{PropEmail: email})
+}
+
+// SetProfileName sets the $name displayed for a profile.
+func (mp *Mixpanel) SetProfileName(id, name string) error {
+	return mp.PeopleSet(id, &P{PropName: name})
+}
+
+// SetProfilePhone sets the $phone of a profile.
+func (mp *Mixpanel) SetProfilePhone(id, phone string) error {
+	return mp.PeopleSet(id, &P{PropPhone: phone})
+}
+
+// SetProfileCreated sets the $created date of a profile.
+func (mp *Mixpanel) SetProfileCreated(id string, created time.Time) error {
+	return mp.PeopleSet(id, &P{PropCreated: created})
+}
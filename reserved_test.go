@@ -0,0 +1,55 @@
+package mixpanel
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// updates decodes the profile updates written by a WriterConsumer.
+func updates(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var out []map[string]interface{}
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var envelope Envelope
+		if err := dec.Decode(&envelope); err != nil {
+			t.Fatal(err)
+		}
+		var update map[string]interface{}
+		if err := json.Unmarshal(envelope.Data, &update); err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, update)
+	}
+	return out
+}
+
+func TestPeopleTouch(t *testing.T) {
+	var buf bytes.Buffer
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf), WithIgnoreTime())
+	at := time.Unix(1700000000, 0)
+	if err := mp.PeopleTouchAt("12345", at); err != nil {
+		t.Fatal(err)
+	}
+	if err := mp.SetProfileEmail("12345", "amy@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mp.PeopleUpdate(&P{"$distinct_id": "12345", PropIgnoreTime: false, "$set": P{"Plan": "Pro"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := updates(t, &buf)
+	if len(got) != 3 {
+		t.Fatalf("Expected 3 updates, got %v", got)
+	}
+	if got[0]["$time"] != float64(1700000000) || got[0][PropIgnoreTime] != false || got[0]["$set"] == nil {
+		t.Errorf("Expected a touch at the given time, got %v", got[0])
+	}
+	if got[1][PropIgnoreTime] != true {
+		t.Errorf("Expected updates to ignore the time, got %v", got[1])
+	}
+	if got[2][PropIgnoreTime] != false {
+		t.Errorf("Expected an explicit $ignore_time to be kept, got %v", got[2])
+	}
+}
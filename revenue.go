@@ -0,0 +1,100 @@
+package mixpanel
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+/*
+Charge is a transaction recorded on a profile for the Mixpanel revenue
+report, see PeopleTrackRevenue.
+
+Currency is an ISO 4217 code such as "USD" or "EUR", recorded as the
+currency property of the transaction when set. Time defaults to the
+current time; a $time in Properties takes precedence over both. The
+Properties hold any other metadata of the transaction, such as an order
+or invoice id.
+*/
+type Charge struct {
+	Amount     float64
+	Currency   string
+	Time       time.Time
+	Properties *P
+}
+
+// transaction returns the entry of c in the $transactions of a profile.
+func (c *Charge) transaction(now time.Time) (*P, error) {
+	if math.IsNaN(c.Amount) || math.IsInf(c.Amount, 0) {
+		return nil, fmt.Errorf("mixpanel: invalid charge amount %v", c.Amount)
+	}
+	if c.Currency != "" && !isCurrency(c.Currency) {
+		return nil, fmt.Errorf("mixpanel: invalid currency code %q", c.Currency)
+	}
+	at := c.Time
+	if at.IsZero() {
+		at = now
+	}
+	transaction := (&P{"$time": at}).Update(c.Properties)
+	(*transaction)["$amount"] = c.Amount
+	if c.Currency != "" {
+		(*transaction)["currency"] = c.Currency
+	}
+	return transaction, nil
+}
+
+// isCurrency reports whether code looks like an ISO 4217 code.
+func isCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+PeopleTrackRevenue records a charge on the profile of id, in a given
+currency. Example:
+
+	mp.PeopleTrackRevenue("1234", Charge{
+	    Amount:     49.90,
+	    Currency:   "EUR",
+	    Properties: &P{"order_id": "A-1029"},
+	})
+*/
+func (mp *Mixpanel) PeopleTrackRevenue(id string, charge Charge) error {
+	transaction, err := charge.transaction(mp.now())
+	if err != nil {
+		return err
+	}
+	return mp.PeopleAppend(id, &P{"$transactions": transaction})
+}
+
+/*
+PeopleTrackRefund records a refund on the profile of id: a negative
+charge of the amount of refund, whatever its sign, marked with a refund
+property so that reports can tell refunds from charges. The metadata of
+the refund, such as the refunded order or the reason, go in its
+Properties. Example:
+
+	mp.PeopleTrackRefund("1234", Charge{
+	    Amount:     49.90,
+	    Currency:   "EUR",
+	    Properties: &P{"order_id": "A-1029", "reason": "damaged"},
+	})
+*/
+func (mp *Mixpanel) PeopleTrackRefund(id string, refund Charge) error {
+	refund.Amount = -math.Abs(refund.Amount)
+	refund.Properties = (&P{}).Update(refund.Properties).Update(&P{"refund": true})
+	return mp.PeopleTrackRevenue(id, refund)
+}
+
+// PeopleClearCharges removes every charge of the profile of id, by
+// setting its $transactions to an empty list.
+func (mp *Mixpanel) PeopleClearCharges(id string) error {
+	return mp.PeopleSet(id, &P{"$transactions": []interface{}{}})
+}
@@ -0,0 +1,76 @@
+package mixpanel
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPeopleTrackRevenue(t *testing.T) {
+	var buf bytes.Buffer
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf))
+	at := time.Date(2013, 4, 1, 9, 2, 0, 0, time.UTC)
+
+	if err := mp.PeopleTrackRevenue("1234", Charge{Amount: 49.9, Currency: "EUR", Time: at, Properties: &P{"order_id": "A-1029"}}); err != nil {
+		t.Fatal(err)
+	}
+	props := &P{"order_id": "A-1029"}
+	if err := mp.PeopleTrackRefund("1234", Charge{Amount: 49.9, Currency: "EUR", Time: at, Properties: props}); err != nil {
+		t.Fatal(err)
+	}
+	if len(*props) != 1 {
+		t.Errorf("Expected the refund properties to be left alone got %v", props)
+	}
+	if err := mp.PeopleClearCharges("1234"); err != nil {
+		t.Fatal(err)
+	}
+
+	var updates []P
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var msg struct {
+			Data P `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			t.Fatal(err)
+		}
+		updates = append(updates, msg.Data)
+	}
+	if len(updates) != 3 {
+		t.Fatalf("Expected 3 updates got %s", buf.String())
+	}
+	want := []interface{}{
+		map[string]interface{}{"$transactions": map[string]interface{}{
+			"$amount": 49.9, "$time": "2013-04-01T09:02:00", "currency": "EUR", "order_id": "A-1029",
+		}},
+		map[string]interface{}{"$transactions": map[string]interface{}{
+			"$amount": -49.9, "$time": "2013-04-01T09:02:00", "currency": "EUR", "order_id": "A-1029", "refund": true,
+		}},
+		map[string]interface{}{"$transactions": []interface{}{}},
+	}
+	for i, op := range []string{"$append", "$append", "$set"} {
+		if !reflect.DeepEqual(updates[i][op], want[i]) {
+			t.Errorf("Update %d: expected %s %v got %v", i, op, want[i], updates[i])
+		}
+	}
+}
+
+func TestPeopleTrackRevenueInvalid(t *testing.T) {
+	var buf bytes.Buffer
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf))
+	for _, charge := range []Charge{
+		{Amount: 10, Currency: "usd"},
+		{Amount: 10, Currency: "EURO"},
+		{Amount: math.NaN()},
+	} {
+		if err := mp.PeopleTrackRevenue("1234", charge); err == nil {
+			t.Errorf("Expected an error for %+v", charge)
+		}
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected nothing sent got %s", buf.String())
+	}
+}
@@ -0,0 +1,67 @@
+package mixpanel
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+)
+
+/*
+WithSampling keeps only a fraction rate (between 0 and 1) of the tracked
+events and stamps the kept ones with a $sample_rate property, so reports
+can be scaled back up.
+
+Sampling is deterministic: the values of the hashBy properties
+("distinct_id" when none is given) are hashed, so that a user is either
+always or never sampled and funnels stay consistent. Events carrying
+none of the hashBy properties are sampled randomly. People updates are
+never sampled. Example:
+
+	// keep 10% of the users
+	mp := NewMixpanel(token, WithSampling(0.1))
+*/
+func WithSampling(rate float64, hashBy ...string) Option {
+	if len(hashBy) == 0 {
+		hashBy = []string{"distinct_id"}
+	}
+	return WithMiddleware(func(msg *Message) error {
+		if !msg.IsEvent() || rate >= 1 {
+			return nil
+		}
+		if !sampled(msg.Properties, rate, hashBy) {
+			return ErrSkipped
+		}
+		(*msg.Properties)["$sample_rate"] = rate
+		return nil
+	})
+}
+
+func sampled(properties *P, rate float64, hashBy []string) bool {
+	if rate <= 0 {
+		return false
+	}
+	h := fnv.New64a()
+	found := false
+	for _, key := range hashBy {
+		if value, ok := (*properties)[key]; ok && value != "" {
+			fmt.Fprintf(h, "%s=%v\x00", key, value)
+			found = true
+		}
+	}
+	if !found {
+		return rand.Float64() < rate
+	}
+	return float64(mix64(h.Sum64())) < rate*math.MaxUint64
+}
+
+// mix64 spreads the bits of a FNV hash, whose high bits barely change
+// between inputs differing only by their last characters.
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
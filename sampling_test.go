@@ -0,0 +1,42 @@
+package mixpanel
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestWithSampling(t *testing.T) {
+	var buf bytes.Buffer
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf), WithSampling(0.25))
+
+	users := 2000
+	for i := 0; i < users; i++ {
+		if err := mp.Track(fmt.Sprintf("user-%d", i), "Page Viewed", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	kept := strings.Count(buf.String(), "\n")
+	if kept < users/5 || kept > users*3/10 {
+		t.Errorf("Expected about %d sampled events, got %d", users/4, kept)
+	}
+	if strings.Count(buf.String(), `"$sample_rate":0.25`) != kept {
+		t.Error("Expected every sampled event to carry $sample_rate")
+	}
+
+	// the same users are sampled every time
+	buf.Reset()
+	for i := 0; i < users; i++ {
+		mp.Track(fmt.Sprintf("user-%d", i), "Page Viewed", nil)
+	}
+	if again := strings.Count(buf.String(), "\n"); again != kept {
+		t.Errorf("Expected deterministic sampling, got %d then %d", kept, again)
+	}
+
+	buf.Reset()
+	mp.PeopleSet("user-1", &P{"Plan": "Pro"})
+	if buf.Len() == 0 {
+		t.Error("Expected people updates not to be sampled")
+	}
+}
@@ -0,0 +1,147 @@
+package mixpanel
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Patterns commonly used with a Scrubber.
+var (
+	EmailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	PhonePattern = regexp.MustCompile(`\+?\d[\d\s().\-]{7,}\d`)
+)
+
+// DefaultRedaction replaces redacted values when Scrubber.Replacement is empty.
+const DefaultRedaction = "[REDACTED]"
+
+// ScrubHook is called for every property after the other scrubbing rules.
+// It returns the value to send, or false to remove the property.
+type ScrubHook func(key string, value interface{}) (interface{}, bool)
+
+/*
+Scrubber redacts personal data from event properties and people
+updates before they are serialized. Nested maps and lists are walked,
+and the caller's maps are never modified.
+
+The project token and the time properties are never scrubbed; every
+other property, distinct_id included, is. Example:
+
+	mp := NewMixpanel(token, WithScrubber(&Scrubber{
+	    Keys:     []string{"password", "ssn"},
+	    Patterns: []*regexp.Regexp{EmailPattern, PhonePattern},
+	}))
+*/
+type Scrubber struct {
+	// Keys lists property names whose values are always redacted,
+	// compared case insensitively.
+	Keys []string
+	// Patterns are searched in string values and every match redacted.
+	Patterns []*regexp.Regexp
+	// Replacement substitutes redacted values, DefaultRedaction when empty.
+	Replacement string
+	// Hooks run in order on every property.
+	Hooks []ScrubHook
+}
+
+// WithScrubber applies s to every event and people update.
+func WithScrubber(s *Scrubber) Option {
+	return WithMiddleware(func(msg *Message) error {
+		msg.Properties = s.Scrub(msg.Properties)
+		return nil
+	})
+}
+
+var unscrubbed = map[string]bool{
+	"token":  true,
+	"$token": true,
+	"time":   true,
+	"$time":  true,
+}
+
+// Scrub returns a redacted copy of p.
+func (s *Scrubber) Scrub(p *P) *P {
+	if p == nil {
+		return nil
+	}
+	scrubbed := make(P, len(*p))
+	for key, value := range *p {
+		if unscrubbed[key] {
+			scrubbed[key] = value
+			continue
+		}
+		if value, keep := s.scrubProperty(key, value); keep {
+			scrubbed[key] = value
+		}
+	}
+	return &scrubbed
+}
+
+func (s *Scrubber) scrubProperty(key string, value interface{}) (interface{}, bool) {
+	if s.denied(key) {
+		value = s.replacement()
+	} else {
+		value = s.scrubValue(value)
+	}
+	for _, hook := range s.Hooks {
+		var keep bool
+		if value, keep = hook(key, value); !keep {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func (s *Scrubber) scrubValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		for _, pattern := range s.Patterns {
+			v = pattern.ReplaceAllLiteralString(v, s.replacement())
+		}
+		return v
+	case *P:
+		return s.scrubMap(*v)
+	case P:
+		return s.scrubMap(v)
+	case map[string]interface{}:
+		return s.scrubMap(v)
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = s.scrubValue(item)
+		}
+		return list
+	case []string:
+		list := make([]string, len(v))
+		for i, item := range v {
+			list[i] = s.scrubValue(item).(string)
+		}
+		return list
+	}
+	return value
+}
+
+func (s *Scrubber) scrubMap(m map[string]interface{}) *P {
+	scrubbed := make(P, len(m))
+	for key, value := range m {
+		if value, keep := s.scrubProperty(key, value); keep {
+			scrubbed[key] = value
+		}
+	}
+	return &scrubbed
+}
+
+func (s *Scrubber) denied(key string) bool {
+	for _, k := range s.Keys {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Scrubber) replacement() string {
+	if s.Replacement == "" {
+		return DefaultRedaction
+	}
+	return s.Replacement
+}
@@ -0,0 +1,48 @@
+package mixpanel
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestScrubber(t *testing.T) {
+	var buf bytes.Buffer
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf), WithScrubber(&Scrubber{
+		Keys:     []string{"Password"},
+		Patterns: []*regexp.Regexp{EmailPattern, PhonePattern},
+		Hooks: []ScrubHook{func(key string, value interface{}) (interface{}, bool) {
+			return value, key != "Internal"
+		}},
+	}))
+
+	props := &P{
+		"password": "hunter2",
+		"Note":     "call +1 (415) 555-0100 or mail amy@mixpanel.com",
+		"Internal": true,
+		"Plan":     "Pro",
+	}
+	if err := mp.Track("12345", "Signed Up", props); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, leak := range []string{"hunter2", "amy@mixpanel.com", "555-0100", "Internal"} {
+		if strings.Contains(out, leak) {
+			t.Errorf("Expected %q to be scrubbed from %s", leak, out)
+		}
+	}
+	if !strings.Contains(out, `"Plan":"Pro"`) || !strings.Contains(out, `"token":"`+token+`"`) {
+		t.Errorf("Expected other properties to be kept: %s", out)
+	}
+
+	buf.Reset()
+	set := &P{"$email": "amy@mixpanel.com"}
+	mp.PeopleSet("12345", set)
+	if strings.Contains(buf.String(), "amy@mixpanel.com") {
+		t.Errorf("Expected people updates to be scrubbed: %s", buf.String())
+	}
+	if (*set)["$email"] != "amy@mixpanel.com" {
+		t.Error("Expected the caller's properties to be left untouched")
+	}
+}
@@ -0,0 +1,204 @@
+package mixpanel
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+/*
+SegmentMessage is a call of the Segment tracking spec, as sent by the
+Segment libraries and the Segment HTTP API: a track, page, screen,
+identify or alias call.
+*/
+type SegmentMessage struct {
+	Type              string                 `json:"type"`
+	Event             string                 `json:"event,omitempty"`
+	Name              string                 `json:"name,omitempty"`
+	Category          string                 `json:"category,omitempty"`
+	UserID            string                 `json:"userId,omitempty"`
+	AnonymousID       string                 `json:"anonymousId,omitempty"`
+	PreviousID        string                 `json:"previousId,omitempty"`
+	MessageID         string                 `json:"messageId,omitempty"`
+	Timestamp         time.Time              `json:"timestamp,omitempty"`
+	OriginalTimestamp time.Time              `json:"originalTimestamp,omitempty"`
+	Properties        map[string]interface{} `json:"properties,omitempty"`
+	Traits            map[string]interface{} `json:"traits,omitempty"`
+	Context           map[string]interface{} `json:"context,omitempty"`
+}
+
+// segmentTraits are the Segment traits with a reserved Mixpanel profile
+// property.
+var segmentTraits = map[string]string{
+	"email":     PropEmail,
+	"name":      PropName,
+	"firstName": PropFirstName,
+	"lastName":  PropLastName,
+	"createdAt": PropCreated,
+	"phone":     PropPhone,
+	"avatar":    PropAvatar,
+	"username":  "$username",
+}
+
+/*
+SendSegment converts a Segment call into Mixpanel events and profile
+updates, easing the migration of code and pipelines written for
+Segment:
+
+  - track calls become events, page and screen calls "Loaded a Page"
+    and "Loaded a Screen" events, or "Viewed <name> Page" and "Viewed
+    <name> Screen" when they are named
+  - identify calls set the traits on the profile, email, name,
+    firstName, lastName, createdAt, phone, avatar and username as the
+    reserved $ properties, and identify the anonymousId as the userId
+  - alias calls alias the userId to the previousId
+
+The distinct_id is the userId, or the anonymousId for anonymous calls.
+The messageId becomes the $insert_id, the timestamp the time, and the
+ip, os, device, app, page and campaign of the context the matching
+Mixpanel properties. Events are sent through the track endpoint, which
+only accepts events of the last 5 days.
+*/
+func (mp *Mixpanel) SendSegment(msg *SegmentMessage) error {
+	distinct_id := msg.UserID
+	if distinct_id == "" {
+		distinct_id = msg.AnonymousID
+	}
+	if distinct_id == "" && msg.Type != "alias" {
+		return fmt.Errorf("mixpanel: Segment %s call without userId or anonymousId", msg.Type)
+	}
+
+	switch msg.Type {
+	case "track":
+		if msg.Event == "" {
+			return errors.New("mixpanel: Segment track call without event")
+		}
+		return mp.Track(distinct_id, msg.Event, msg.eventProperties())
+	case "page", "screen":
+		kind := "Page"
+		if msg.Type == "screen" {
+			kind = "Screen"
+		}
+		event := "Loaded a " + kind
+		props := msg.eventProperties()
+		if msg.Name != "" {
+			event = "Viewed " + msg.Name + " " + kind
+			(*props)["name"] = msg.Name
+		}
+		if msg.Category != "" {
+			(*props)["category"] = msg.Category
+		}
+		return mp.Track(distinct_id, event, props)
+	case "identify":
+		if msg.UserID != "" && msg.AnonymousID != "" {
+			if err := mp.Identify(msg.UserID, msg.AnonymousID); err != nil {
+				return err
+			}
+		}
+		if len(msg.Traits) == 0 {
+			return nil
+		}
+		traits := make(P, len(msg.Traits))
+		for key, value := range msg.Traits {
+			if name, ok := segmentTraits[key]; ok {
+				key = name
+			}
+			traits[key] = value
+		}
+		return mp.PeopleSet(distinct_id, &traits)
+	case "alias":
+		if msg.UserID == "" || msg.PreviousID == "" {
+			return errors.New("mixpanel: Segment alias call without userId or previousId")
+		}
+		return mp.Alias(msg.UserID, msg.PreviousID)
+	}
+	return fmt.Errorf("mixpanel: unsupported Segment call type %q", msg.Type)
+}
+
+/*
+SendSegmentJSON sends the Segment calls of data, a single call, a JSON
+array of calls or a batch object {"batch": [...]}, see SendSegment. It
+stops at the first failing call.
+*/
+func (mp *Mixpanel) SendSegmentJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	var msgs []*SegmentMessage
+	switch {
+	case bytes.HasPrefix(data, []byte("[")):
+		if err := json.Unmarshal(data, &msgs); err != nil {
+			return fmt.Errorf("mixpanel: invalid Segment calls: %v", err)
+		}
+	default:
+		var batch struct {
+			SegmentMessage
+			Batch []*SegmentMessage `json:"batch"`
+		}
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return fmt.Errorf("mixpanel: invalid Segment call: %v", err)
+		}
+		msgs = batch.Batch
+		if batch.Batch == nil {
+			msgs = []*SegmentMessage{&batch.SegmentMessage}
+		}
+	}
+	for _, msg := range msgs {
+		if err := mp.SendSegment(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eventProperties returns the Mixpanel properties of a track, page or
+// screen call.
+func (msg *SegmentMessage) eventProperties() *P {
+	props := make(P, len(msg.Properties)+8)
+	for key, value := range msg.Properties {
+		props[key] = value
+	}
+	if msg.UserID != "" && msg.AnonymousID != "" {
+		props[PropUserID] = msg.UserID
+		props[PropDeviceID] = msg.AnonymousID
+	}
+	if msg.MessageID != "" {
+		props[PropInsertID] = msg.MessageID
+	}
+	at := msg.Timestamp
+	if at.IsZero() {
+		at = msg.OriginalTimestamp
+	}
+	if !at.IsZero() {
+		props[PropTime] = at.Unix()
+	}
+
+	if ip, ok := msg.Context["ip"].(string); ok {
+		props[PropIP] = ip
+	}
+	copyContext := func(object, key, prop string) {
+		if m, ok := msg.Context[object].(map[string]interface{}); ok {
+			if value, ok := m[key]; ok && value != "" {
+				props[prop] = value
+			}
+		}
+	}
+	copyContext("os", "name", PropOS)
+	copyContext("os", "version", "$os_version")
+	copyContext("device", "manufacturer", "$manufacturer")
+	copyContext("device", "model", "$model")
+	copyContext("app", "version", "$app_version_string")
+	copyContext("app", "build", "$app_build_number")
+	copyContext("page", "url", PropCurrentURL)
+	copyContext("page", "referrer", PropReferrer)
+	copyContext("screen", "width", "$screen_width")
+	copyContext("screen", "height", "$screen_height")
+	for _, param := range []string{"source", "medium", "name", "content", "term"} {
+		prop := "utm_" + param
+		if param == "name" {
+			prop = "utm_campaign"
+		}
+		copyContext("campaign", param, prop)
+	}
+	return &props
+}
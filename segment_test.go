@@ -0,0 +1,74 @@
+package mixpanel
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSendSegmentJSON(t *testing.T) {
+	var buf bytes.Buffer
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf))
+
+	err := mp.SendSegmentJSON([]byte(`{"batch": [
+		{"type": "track", "event": "Order Completed", "userId": "13793", "anonymousId": "d-1",
+		 "messageId": "m-1", "timestamp": "2024-01-02T03:04:05Z",
+		 "properties": {"revenue": 49.9},
+		 "context": {"ip": "1.2.3.4", "os": {"name": "iOS"}, "campaign": {"name": "spring", "source": "mail"}}},
+		{"type": "page", "name": "Pricing", "anonymousId": "d-1", "properties": {"path": "/pricing"}},
+		{"type": "screen", "userId": "13793"},
+		{"type": "identify", "userId": "13793", "anonymousId": "d-1", "traits": {"email": "amy@mixpanel.com", "plan": "pro"}},
+		{"type": "alias", "userId": "13793", "previousId": "amy@mixpanel.com"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var envelopes []Envelope
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var e Envelope
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatal(err)
+		}
+		envelopes = append(envelopes, e)
+	}
+	if len(envelopes) != 6 {
+		t.Fatalf("Expected 6 messages, got %d: %s", len(envelopes), buf.String())
+	}
+
+	var order struct {
+		Event      string
+		Properties map[string]interface{}
+	}
+	json.Unmarshal(envelopes[0].Data, &order)
+	props := order.Properties
+	if order.Event != "Order Completed" || props["distinct_id"] != "13793" || props["$device_id"] != "d-1" ||
+		props["$insert_id"] != "m-1" || props["time"] != 1704164645.0 || props["ip"] != "1.2.3.4" ||
+		props["$os"] != "iOS" || props["utm_campaign"] != "spring" || props["utm_source"] != "mail" || props["revenue"] != 49.9 {
+		t.Errorf("Unexpected track event %+v", order)
+	}
+
+	for i, expected := range []string{`"Viewed Pricing Page"`, `"Loaded a Screen"`, `"$identify"`, `"$email":"amy@mixpanel.com"`, `"$create_alias"`} {
+		if data := string(envelopes[i+1].Data); !strings.Contains(data, expected) {
+			t.Errorf("Expected %s in %s", expected, data)
+		}
+	}
+	if envelopes[4].Endpoint != "people" {
+		t.Errorf("Expected the traits on the profile, got %+v", envelopes[4])
+	}
+}
+
+func TestSendSegmentErrors(t *testing.T) {
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&bytes.Buffer{}))
+	for _, data := range []string{
+		`{"type": "track", "event": "Signed Up"}`,
+		`{"type": "track", "userId": "13793"}`,
+		`{"type": "group", "userId": "13793", "groupId": "acme"}`,
+		`[{"type": "track"`,
+	} {
+		if err := mp.SendSegmentJSON([]byte(data)); err == nil {
+			t.Errorf("Expected an error for %s", data)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package mixpanel
+
+import (
+	"net/http"
+	"strconv"
+)
+
+/*
+ServiceAccount is the credential of a Mixpanel service account, created
+in the organization settings, which authenticates the import, export,
+query and GDPR APIs in place of the project API secret and OAuth tokens.
+Service accounts are not bound to a project, so ProjectID is mandatory:
+it is added as project_id to the requests.
+
+	sa := ServiceAccount{Username: "backfill.1a2b3c.mp-service-account", Secret: secret, ProjectID: 12345}
+	mp := NewMixpanel(token, WithServiceAccount(sa))
+	q := NewQueryClientWithServiceAccount(sa)
+	c := NewComplianceClientWithServiceAccount(token, sa)
+*/
+type ServiceAccount struct {
+	Username  string
+	Secret    string
+	ProjectID int64
+}
+
+// authorize sets the Basic auth of req and adds the project_id to its
+// query.
+func (sa *ServiceAccount) authorize(req *http.Request) {
+	req.SetBasicAuth(sa.Username, sa.Secret)
+	if sa.ProjectID != 0 {
+		query := req.URL.Query()
+		query.Set("project_id", strconv.FormatInt(sa.ProjectID, 10))
+		req.URL.RawQuery = query.Encode()
+	}
+}
+
+// WithServiceAccount authenticates the imports with a service account,
+// rather than with the API secret of WithAPISecret. It is handed to the
+// consumer when it has a SetServiceAccount method.
+func WithServiceAccount(sa ServiceAccount) Option {
+	return func(mp *Mixpanel) {
+		mp.serviceAccount = &sa
+		if c, ok := findConsumer[interface{ SetServiceAccount(ServiceAccount) }](mp.c); ok {
+			c.SetServiceAccount(sa)
+		}
+	}
+}
+
+// canImport reports whether mp has credentials for the import endpoint.
+func (mp *Mixpanel) canImport() bool {
+	return mp.apiSecret != "" || mp.serviceAccount != nil
+}
+
+// authorizeImport sets the credentials of an import request.
+func (mp *Mixpanel) authorizeImport(req *http.Request) {
+	if mp.serviceAccount != nil {
+		mp.serviceAccount.authorize(req)
+		return
+	}
+	req.SetBasicAuth(mp.apiSecret, "")
+}
+
+// SetServiceAccount authenticates the "import" endpoint with a service
+// account rather than with the API secret.
+func (c *StdConsumer) SetServiceAccount(sa ServiceAccount) {
+	c.serviceAccount = &sa
+}
+
+// NewComplianceClientWithServiceAccount creates a ComplianceClient for
+// the project of token, authenticated with a service account rather
+// than a GDPR OAuth token.
+func NewComplianceClientWithServiceAccount(token string, sa ServiceAccount) *ComplianceClient {
+	return &ComplianceClient{
+		Endpoint:       compliance_endpoint,
+		token:          token,
+		serviceAccount: &sa,
+	}
+}
@@ -0,0 +1,49 @@
+package mixpanel
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServiceAccount(t *testing.T) {
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, secret, _ := r.BasicAuth()
+		if user != "sa.user" || secret != "sa-secret" || r.URL.Query().Get("project_id") != "42" {
+			t.Errorf("Unexpected authentication of %s: %q %q", r.URL, user, secret)
+		}
+		requests = append(requests, r.URL.Path)
+		if strings.HasPrefix(r.URL.Path, "/data-deletions") {
+			if r.URL.Query().Get("token") != token || r.Header.Get("Authorization") == "Bearer " {
+				t.Errorf("Unexpected compliance request %s", r.URL)
+			}
+			w.Write([]byte(`{"status": "ok", "results": {"task_id": "7"}}`))
+			return
+		}
+		w.Write([]byte(`{"code": 200, "num_records_imported": 1, "status": "OK"}`))
+	}))
+	defer ts.Close()
+
+	sa := ServiceAccount{Username: "sa.user", Secret: "sa-secret", ProjectID: 42}
+	mp := NewMixpanel(token, WithAPIHost(ts.URL), WithServiceAccount(sa))
+	if err := mp.Import("12345", "Signed Up", time.Now(), nil); err != nil {
+		t.Fatal(err)
+	}
+	input := `{"event": "Signed Up", "properties": {"time": 1704067200, "distinct_id": "12345"}}`
+	if _, err := mp.ImportFromReader(context.Background(), strings.NewReader(input), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewComplianceClientWithServiceAccount(token, sa)
+	c.Endpoint = ts.URL
+	if _, err := c.RequestDeletion(context.Background(), []string{"12345"}, GDPR); err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 3 {
+		t.Errorf("Expected 3 requests got %v", requests)
+	}
+}
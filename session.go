@@ -0,0 +1,98 @@
+package mixpanel
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Events tracked by a Session.
+const (
+	SessionStartEvent = "Session Start"
+	SessionEndEvent   = "Session End"
+)
+
+// PropSessionID is the property identifying the session of an event.
+const PropSessionID = "session_id"
+
+// ErrSessionEnded is returned when tracking through an ended Session.
+var ErrSessionEnded = errors.New("mixpanel: session ended")
+
+/*
+Session groups the events of a user between a start and an end event:
+
+	s, err := mp.StartSession("12345", &P{"platform": "web"})
+	...
+	s.Track("Viewed Item", &P{"item": 42})
+	...
+	s.End(nil)
+
+Every event tracked through a session carries its session_id and its
+properties, given to StartSession or added by Set; the properties of the
+event win over those of the session. The end event records the
+$duration of the session in seconds. A Session is safe for concurrent
+use.
+*/
+type Session struct {
+	ID         string
+	DistinctID string
+	Start      time.Time
+
+	mp    *Mixpanel
+	mu    sync.Mutex
+	props P
+	ended bool
+}
+
+// StartSession starts a session of distinct_id with a random id and
+// tracks its SessionStartEvent.
+func (mp *Mixpanel) StartSession(distinct_id string, props *P) (*Session, error) {
+	s := &Session{
+		ID:         mp.newSessionID(),
+		DistinctID: distinct_id,
+		Start:      mp.now(),
+		mp:         mp,
+		props:      P{},
+	}
+	s.props.Update(props)
+	return s, s.Track(SessionStartEvent, &P{PropTime: s.Start})
+}
+
+// Set adds properties to the session, for the events tracked from now
+// on.
+func (s *Session) Set(props *P) {
+	s.mu.Lock()
+	s.props.Update(props)
+	s.mu.Unlock()
+}
+
+// Track tracks an event of the session.
+func (s *Session) Track(event string, prop *P) error {
+	return s.track(event, prop, false)
+}
+
+// End tracks the SessionEndEvent of the session, with its $duration,
+// after which the session tracks no more events.
+func (s *Session) End(prop *P) error {
+	end := s.mp.now()
+	properties := (&P{}).Update(prop)
+	(*properties)[PropTime] = end
+	(*properties)[PropDuration] = end.Sub(s.Start).Seconds()
+	return s.track(SessionEndEvent, properties, true)
+}
+
+// track tracks an event with the properties of the session, ending the
+// session when end is set.
+func (s *Session) track(event string, prop *P, end bool) error {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return ErrSessionEnded
+	}
+	s.ended = end
+	properties := (&P{}).Update(&s.props)
+	s.mu.Unlock()
+	properties.Update(prop)
+	(*properties)[PropSessionID] = s.ID
+	return s.mp.Track(s.DistinctID, event, properties)
+}
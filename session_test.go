@@ -0,0 +1,69 @@
+package mixpanel
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSession(t *testing.T) {
+	var buf bytes.Buffer
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf))
+
+	s, err := mp.StartSession("12345", &P{"platform": "web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Set(&P{"plan": "pro"})
+	if err := s.Track("Viewed Item", &P{"platform": "ios", "item": 42}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.End(&P{"reason": "logout"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Track("Viewed Item", nil); err != ErrSessionEnded {
+		t.Errorf("Expected ErrSessionEnded got %v", err)
+	}
+	if err := s.End(nil); err != ErrSessionEnded {
+		t.Errorf("Expected ErrSessionEnded got %v", err)
+	}
+
+	var events []Event
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var msg struct {
+			Data Event `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, msg.Data)
+	}
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events got %s", buf.String())
+	}
+	for i, want := range []P{
+		{"platform": "web"},
+		{"platform": "ios", "plan": "pro", "item": float64(42)},
+		{"platform": "web", "plan": "pro", "reason": "logout"},
+	} {
+		props := *events[i].Properties
+		if props[PropSessionID] != s.ID || props["distinct_id"] != "12345" {
+			t.Errorf("Event %d: unexpected session %v", i, props)
+		}
+		for key, value := range want {
+			if props[key] != value {
+				t.Errorf("Event %d: expected %s=%v got %v", i, key, value, props[key])
+			}
+		}
+	}
+	if events[0].Event != SessionStartEvent || events[2].Event != SessionEndEvent {
+		t.Errorf("Unexpected events %s and %s", events[0].Event, events[2].Event)
+	}
+	if d, ok := (*events[2].Properties)[PropDuration].(float64); !ok || d < 0 {
+		t.Errorf("Expected a duration got %v", (*events[2].Properties)[PropDuration])
+	}
+	if (*events[0].Properties)[PropDuration] != nil {
+		t.Error("Expected no duration on the start event")
+	}
+}
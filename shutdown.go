@@ -0,0 +1,76 @@
+package mixpanel
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// DefaultDrainTimeout bounds the flush on shutdown when no drain timeout
+// is given.
+const DefaultDrainTimeout = 5 * time.Second
+
+// shutdown closes the consumer of a Mixpanel object once, on the first
+// shutdown signal.
+type shutdown struct {
+	once    sync.Once
+	drained chan struct{}
+}
+
+/*
+WithShutdownContext closes the consumer, delivering the buffered and
+queued messages, once ctx is done, for applications already handling
+their shutdown with a context. The delivery is bounded by drainTimeout,
+DefaultDrainTimeout when 0. Wait on Drained before exiting:
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	defer stop()
+	mp := NewMixpanelWithConsumer(token, NewBuffConsumer(50), WithShutdownContext(ctx, 10*time.Second))
+	...
+	<-ctx.Done()
+	<-mp.Drained()
+*/
+func WithShutdownContext(ctx context.Context, drainTimeout time.Duration) Option {
+	return func(mp *Mixpanel) {
+		s := mp.onShutdown()
+		go func() {
+			<-ctx.Done()
+			mp.drain(s, drainTimeout)
+		}()
+	}
+}
+
+/*
+Drained returns a channel closed once the consumer has been closed by
+WithShutdownContext or WithSignalFlush, or nil, which blocks forever,
+without either option.
+*/
+func (mp *Mixpanel) Drained() <-chan struct{} {
+	if mp.shutdown == nil {
+		return nil
+	}
+	return mp.shutdown.drained
+}
+
+func (mp *Mixpanel) onShutdown() *shutdown {
+	if mp.shutdown == nil {
+		mp.shutdown = &shutdown{drained: make(chan struct{})}
+	}
+	return mp.shutdown
+}
+
+// drain closes the consumer within timeout, the first time it is called.
+func (mp *Mixpanel) drain(s *shutdown, timeout time.Duration) {
+	s.once.Do(func() {
+		defer close(s.drained)
+		if timeout <= 0 {
+			timeout = DefaultDrainTimeout
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := mp.Close(ctx); err != nil {
+			log.Printf("mixpanel: flush on shutdown failed: %v", err)
+		}
+	})
+}
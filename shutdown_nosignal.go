@@ -0,0 +1,15 @@
+//go:build js || wasip1 || tinygo
+
+package mixpanel
+
+import (
+	"os"
+	"time"
+)
+
+// WithSignalFlush does nothing in WASM runtimes and under TinyGo, where
+// the process gets no signals: use WithShutdownContext, or Close the
+// client when the runtime stops it.
+func WithSignalFlush(drainTimeout time.Duration, exit bool, signals ...os.Signal) Option {
+	return func(mp *Mixpanel) {}
+}
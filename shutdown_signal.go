@@ -0,0 +1,49 @@
+//go:build !js && !wasip1 && !tinygo
+
+package mixpanel
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+/*
+WithSignalFlush closes the consumer, delivering the buffered and queued
+messages, when the process receives one of signals, SIGTERM and SIGINT
+by default, so that rollouts do not lose the tail of the buffers. The
+delivery is bounded by drainTimeout, DefaultDrainTimeout when 0.
+
+When exit is true the signal is then raised again, with the handler of
+WithSignalFlush removed, to terminate the process as the signal would
+have without it. Leave exit false when the application handles the
+signals itself, with signal.Notify, since it receives them already: a
+raised signal would reach its handlers a second time. Example:
+
+	mp := NewMixpanelWithConsumer(token, NewBuffConsumer(50), WithSignalFlush(10*time.Second, true))
+
+Messages tracked after the flush fail with ErrClosed when the consumer
+is, or wraps, a StdConsumer, BuffConsumer or AsyncConsumer.
+*/
+func WithSignalFlush(drainTimeout time.Duration, exit bool, signals ...os.Signal) Option {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	return func(mp *Mixpanel) {
+		s := mp.onShutdown()
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, signals...)
+		go func() {
+			sig := <-ch
+			mp.drain(s, drainTimeout)
+			signal.Stop(ch)
+			if !exit {
+				return
+			}
+			if p, err := os.FindProcess(os.Getpid()); err == nil {
+				p.Signal(sig)
+			}
+		}()
+	}
+}
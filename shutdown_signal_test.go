@@ -0,0 +1,41 @@
+//go:build unix
+
+package mixpanel
+
+import (
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSignalFlush(t *testing.T) {
+	rs := newRecordingServer()
+	defer rs.Close()
+
+	// the handler of the application
+	app := make(chan os.Signal, 2)
+	signal.Notify(app, syscall.SIGUSR1)
+	defer signal.Stop(app)
+
+	mp := NewMixpanelWithConsumer(token, NewBuffConsumer(10), WithAPIHost(rs.URL), WithSignalFlush(time.Second, false, syscall.SIGUSR1))
+	mp.Track("13793", "Signed Up", nil)
+	syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+	select {
+	case <-mp.Drained():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the consumer to be drained")
+	}
+	if payloads := rs.Payloads(); len(payloads) != 1 || !strings.Contains(payloads[0], `"Signed Up"`) {
+		t.Errorf("Expected the buffered event on the signal, got %q", payloads)
+	}
+
+	<-app
+	select {
+	case <-app:
+		t.Error("Expected the signal to reach the application once")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
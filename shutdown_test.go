@@ -0,0 +1,34 @@
+package mixpanel
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShutdownContext(t *testing.T) {
+	rs := newRecordingServer()
+	defer rs.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	mp := NewMixpanelWithConsumer(token, NewBuffConsumer(10), WithAPIHost(rs.URL), WithShutdownContext(ctx, time.Second))
+	mp.Track("13793", "Signed Up", nil)
+	if len(rs.Payloads()) != 0 {
+		t.Fatal("Expected the event to be buffered")
+	}
+
+	cancel()
+	select {
+	case <-mp.Drained():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the consumer to be drained")
+	}
+	if payloads := rs.Payloads(); len(payloads) != 1 || !strings.Contains(payloads[0], `"Signed Up"`) {
+		t.Errorf("Expected the buffered event on shutdown, got %q", payloads)
+	}
+	if err := mp.Track("13793", "Signed Out", nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed after the shutdown got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package mixpanel
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// legacySignatureTTL is how long a legacy signature is valid, sent as the
+// expire parameter.
+const legacySignatureTTL = 10 * time.Minute
+
+/*
+SetBase64Encoding replaces the URL-safe base64 encoding of the data of
+the "events", "people" and "groups" requests, for proxies mangling one
+of the alphabets: Mixpanel decodes both base64.URLEncoding, the default,
+and base64.StdEncoding.
+*/
+func (c *StdConsumer) SetBase64Encoding(enc *base64.Encoding) {
+	c.encoding = enc
+}
+
+/*
+SetLegacySignature signs the "events", "people" and "groups" requests
+with the legacy scheme of the Mixpanel API: the api_key of the project,
+an expire time and a sig parameter, the MD5 of the sorted parameters and
+of apiSecret. It is only needed by proxies and endpoints still checking
+it; the import endpoint authenticates with the API secret instead.
+*/
+func (c *StdConsumer) SetLegacySignature(apiKey, apiSecret string) {
+	c.legacyKey, c.legacySecret = apiKey, apiSecret
+}
+
+// sign adds the legacy signature to form, when the consumer has one.
+func (c *StdConsumer) sign(form url.Values) {
+	if c.legacyKey == "" {
+		return
+	}
+	form.Set("api_key", c.legacyKey)
+	form.Set("expire", strconv.FormatInt(time.Now().Add(legacySignatureTTL).Unix(), 10))
+	form.Set("sig", legacySignature(form, c.legacySecret))
+}
+
+// legacySignature returns the sig of params: the hex MD5 of their sorted
+// key=value pairs followed by secret.
+func legacySignature(params url.Values, secret string) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		if key != "sig" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, key := range keys {
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(params.Get(key))
+	}
+	b.WriteString(secret)
+	sum := md5.Sum([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// WithBase64Encoding sets the base64 encoding of the requests, see
+// StdConsumer.SetBase64Encoding. It is handed to the consumer when it has
+// a SetBase64Encoding method.
+func WithBase64Encoding(enc *base64.Encoding) Option {
+	return func(mp *Mixpanel) {
+		if c, ok := findConsumer[interface{ SetBase64Encoding(*base64.Encoding) }](mp.c); ok {
+			c.SetBase64Encoding(enc)
+		}
+	}
+}
+
+// WithLegacySignature signs the requests with the legacy api_key and sig
+// scheme, see StdConsumer.SetLegacySignature. It is handed to the
+// consumer when it has a SetLegacySignature method.
+func WithLegacySignature(apiKey, apiSecret string) Option {
+	return func(mp *Mixpanel) {
+		if c, ok := findConsumer[interface{ SetLegacySignature(string, string) }](mp.c); ok {
+			c.SetLegacySignature(apiKey, apiSecret)
+		}
+	}
+}
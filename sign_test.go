@@ -0,0 +1,49 @@
+package mixpanel
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestLegacySignature(t *testing.T) {
+	params := url.Values{}
+	params.Set("api_key", "f0aa346688cee071cd85d857285a3464")
+	params.Set("expire", "1275624968")
+	params.Set("event", `["pages"]`)
+	params.Set("unit", "hour")
+	params.Set("interval", "24")
+	params.Set("type", "general")
+	sig := legacySignature(params, "secret")
+	params.Set("sig", "stale")
+	if len(sig) != 32 || legacySignature(params, "secret") != sig || legacySignature(params, "other") == sig {
+		t.Errorf("Unexpected signature %s", sig)
+	}
+}
+
+func TestWithLegacySignatureAndBase64(t *testing.T) {
+	var form url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.PostForm
+		w.Write([]byte(`{"status": 1, "error": null}`))
+	}))
+	defer ts.Close()
+
+	mp := NewMixpanel(token, WithAPIHost(ts.URL), WithAsync(AsyncConfig{}),
+		WithBase64Encoding(base64.StdEncoding), WithLegacySignature("key", "secret"))
+	// ">>>" and "???" encode to "+" and "/" in standard base64
+	mp.Track("12345", ">>>???", nil)
+	mp.Flush(context.Background())
+	data := form.Get("data")
+	if _, err := base64.StdEncoding.DecodeString(data); err != nil || !strings.ContainsAny(data, "+/") {
+		t.Errorf("Expected standard base64 got %q", data)
+	}
+	if form.Get("api_key") != "key" || form.Get("expire") == "" || form.Get("sig") != legacySignature(form, "secret") {
+		t.Errorf("Unexpected signed request %v", form)
+	}
+}
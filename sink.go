@@ -0,0 +1,186 @@
+package mixpanel
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+/*
+ExportSink receives the events of ExportTo, to store them in files or
+feed them to a data lake. NewJSONLSink, NewGzipJSONLSink and
+PartitionedSink are sinks of this package; the mixpanelparquet package
+writes Parquet files.
+
+WriteEvent is given the JSON of an event as exported, only valid until
+it returns. Close flushes what the sink buffers, it does not close the
+writer the sink writes to.
+*/
+type ExportSink interface {
+	WriteEvent(raw json.RawMessage) error
+	Close() error
+}
+
+/*
+ExportTo exports the events matching query to sink, and closes the sink.
+It returns the number of events written. Example:
+
+	f, err := os.Create("events.jsonl.gz")
+	...
+	n, err := q.ExportTo(ctx, &ExportQuery{From: from, To: to}, NewGzipJSONLSink(f))
+*/
+func (q *QueryClient) ExportTo(ctx context.Context, query *ExportQuery, sink ExportSink) (int, error) {
+	it := q.Export(ctx, query)
+	defer it.Close()
+	n := 0
+	for it.Next() {
+		if err := it.WriteEventTo(sink); err != nil {
+			sink.Close()
+			return n, err
+		}
+		n++
+	}
+	if err := it.Err(); err != nil {
+		sink.Close()
+		return n, err
+	}
+	return n, sink.Close()
+}
+
+// WriteEventTo writes the current event to sink.
+func (it *EventIterator) WriteEventTo(sink ExportSink) error {
+	return sink.WriteEvent(it.line)
+}
+
+// jsonlSink writes events as JSON lines.
+type jsonlSink struct {
+	w  *bufio.Writer
+	gz *gzip.Writer
+}
+
+// NewJSONLSink returns a sink writing the events to w as JSON lines.
+func NewJSONLSink(w io.Writer) ExportSink {
+	return &jsonlSink{w: bufio.NewWriter(w)}
+}
+
+// NewGzipJSONLSink returns a sink writing the events to w as gzipped
+// JSON lines, the format BigQuery and most data lakes load.
+func NewGzipJSONLSink(w io.Writer) ExportSink {
+	gz := gzip.NewWriter(w)
+	return &jsonlSink{w: bufio.NewWriter(gz), gz: gz}
+}
+
+func (s *jsonlSink) WriteEvent(raw json.RawMessage) error {
+	s.w.Write(raw)
+	return s.w.WriteByte('\n')
+}
+
+func (s *jsonlSink) Close() error {
+	err := s.w.Flush()
+	if s.gz != nil {
+		if cerr := s.gz.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+/*
+PartitionedSink writes the events to a file per day, in the Hive layout
+S3, BigQuery and Spark read as partitions:
+
+	sink := &PartitionedSink{Dir: "export"}
+	n, err := q.ExportTo(ctx, &ExportQuery{From: from, To: to}, sink)
+	// export/date=2024-01-01/events.jsonl.gz
+	// export/date=2024-01-02/events.jsonl.gz
+	// ...
+
+The day of an event is that of its time in Location, UTC when nil. Path
+returns the path of the file of a day under Dir, by default
+"date=2006-01-02/events.jsonl.gz", and NewSink the sink writing to it,
+NewGzipJSONLSink by default. Files are overwritten, and stay open until
+Close.
+*/
+type PartitionedSink struct {
+	Dir      string
+	Path     func(day time.Time) string
+	Location *time.Location
+	NewSink  func(w io.Writer) ExportSink
+
+	partitions map[string]*partition
+}
+
+// partition is the file of a day of a PartitionedSink.
+type partition struct {
+	f    *os.File
+	sink ExportSink
+}
+
+func (s *PartitionedSink) WriteEvent(raw json.RawMessage) error {
+	var event struct {
+		Properties struct {
+			Time interface{} `json:"time"`
+		} `json:"properties"`
+	}
+	if err := unmarshalNumbers(raw, &event); err != nil {
+		return fmt.Errorf("Cannot interpret Mixpanel export line: %v", err)
+	}
+	at, _, err := importTime(event.Properties.Time, &ImportOptions{})
+	if err != nil {
+		return fmt.Errorf("mixpanel: cannot partition an event: %v", err)
+	}
+	location := s.Location
+	if location == nil {
+		location = time.UTC
+	}
+	at = at.In(location)
+	day := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, location)
+
+	path := "date=" + day.Format(dateLayout) + "/events.jsonl.gz"
+	if s.Path != nil {
+		path = s.Path(day)
+	}
+	p, ok := s.partitions[path]
+	if !ok {
+		file := filepath.Join(s.Dir, path)
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			return err
+		}
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		p = &partition{f: f}
+		if s.NewSink != nil {
+			p.sink = s.NewSink(f)
+		} else {
+			p.sink = NewGzipJSONLSink(f)
+		}
+		if s.partitions == nil {
+			s.partitions = map[string]*partition{}
+		}
+		s.partitions[path] = p
+	}
+	return p.sink.WriteEvent(raw)
+}
+
+// Close closes the files of the partitions.
+func (s *PartitionedSink) Close() error {
+	var err error
+	for path, p := range s.partitions {
+		if cerr := p.sink.Close(); err == nil {
+			err = cerr
+		}
+		if cerr := p.f.Close(); err == nil {
+			err = cerr
+		}
+		delete(s.partitions, path)
+	}
+	return err
+}
@@ -0,0 +1,92 @@
+package mixpanel
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func exportServer(t *testing.T) *QueryClient {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"event": "Signed Up", "properties": {"distinct_id": "u1", "time": 1704067200}}
+{"event": "Signed Up", "properties": {"distinct_id": "u2", "time": 1704153599}}
+{"event": "Purchase", "properties": {"distinct_id": "u1", "time": 1704153600, "Amount": 12.5}}
+`))
+	}))
+	t.Cleanup(ts.Close)
+	q := NewQueryClient("secret")
+	q.ExportEndpoint = ts.URL
+	return q
+}
+
+// gunzipLines returns the lines of the gzipped data.
+func gunzipLines(t *testing.T, data []byte) []string {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return lines
+}
+
+func TestExportToGzipJSONL(t *testing.T) {
+	q := exportServer(t)
+	var buf bytes.Buffer
+	n, err := q.ExportTo(context.Background(), &ExportQuery{}, NewGzipJSONLSink(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := gunzipLines(t, buf.Bytes())
+	if n != 3 || len(lines) != 3 || lines[2] != `{"event": "Purchase", "properties": {"distinct_id": "u1", "time": 1704153600, "Amount": 12.5}}` {
+		t.Errorf("Unexpected export of %d events %q", n, lines)
+	}
+}
+
+func TestPartitionedSink(t *testing.T) {
+	q := exportServer(t)
+	dir := t.TempDir()
+	if _, err := q.ExportTo(context.Background(), &ExportQuery{}, &PartitionedSink{Dir: dir}); err != nil {
+		t.Fatal(err)
+	}
+	for path, expected := range map[string]int{"date=2024-01-01/events.jsonl.gz": 2, "date=2024-01-02/events.jsonl.gz": 1} {
+		data, err := os.ReadFile(filepath.Join(dir, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines := gunzipLines(t, data); len(lines) != expected {
+			t.Errorf("Expected %d events in %s got %q", expected, path, lines)
+		}
+	}
+
+	// midnight UTC is the evening before in New York
+	newYork, _ := time.LoadLocation("America/New_York")
+	sink := &PartitionedSink{
+		Dir:      dir,
+		Location: newYork,
+		Path:     func(day time.Time) string { return day.Format("2006/01/02") + ".jsonl" },
+		NewSink:  NewJSONLSink,
+	}
+	if _, err := q.ExportTo(context.Background(), &ExportQuery{}, sink); err != nil {
+		t.Fatal(err)
+	}
+	for path, expected := range map[string]int{"2023/12/31.jsonl": 1, "2024/01/01.jsonl": 2} {
+		data, err := os.ReadFile(filepath.Join(dir, path))
+		if err != nil || bytes.Count(data, []byte("\n")) != expected {
+			t.Errorf("Expected %d events in %s got %q (%v)", expected, path, data, err)
+		}
+	}
+}
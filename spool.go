@@ -0,0 +1,399 @@
+package mixpanel
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultResendInterval is how often a SpoolConsumer retries spooled
+// messages when no interval is given.
+const DefaultResendInterval = 30 * time.Second
+
+/*
+SpoolConsumer protects another consumer against network outages. When
+a send fails with a network error the messages are written to a local
+directory instead, and a background goroutine resends them once the
+network is back.
+
+Spooled events are resent through the import endpoint, which keeps
+their original time even when the outage lasts longer than the window
+accepted by the track endpoint; the wrapped consumer must therefore be
+configured with the project API secret. Example:
+
+	sc, err := NewSpoolConsumer(NewBuffConsumer(50), "/var/spool/mixpanel", time.Minute)
+	mp := NewMixpanelWithConsumer(token, sc, WithAPISecret(secret))
+
+A wrapped BuffConsumer keeps the messages of its failed flushes for the
+next one, see BuffConfig.MaxRetained; those it gives up on, dropped over
+MaxRetained or failing the final flush of Close, are spooled instead
+when Flush or Close fail with a network error.
+
+A spool file is resent in batches, and the messages the wrapped
+consumer delivers, or retains for its next flush, are removed from it
+as they go, so that a file resent again after a failure does not
+deliver them twice. Spool files the wrapped consumer rejects for
+another reason than the network are renamed with a ".rejected" suffix,
+holding the messages left, and never retried.
+*/
+type SpoolConsumer struct {
+	next Consumer
+	dir  string
+
+	mu     sync.Mutex // serializes resends
+	seq    atomic.Uint64
+	stop   chan struct{}
+	done   chan struct{}
+	closed sync.Once
+}
+
+// NewSpoolConsumer creates a SpoolConsumer wrapping next and spooling to
+// dir, created when missing, retrying every interval.
+func NewSpoolConsumer(next Consumer, dir string, interval time.Duration) (*SpoolConsumer, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		interval = DefaultResendInterval
+	}
+	sc := &SpoolConsumer{
+		next: next,
+		dir:  dir,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go sc.loop(interval)
+	return sc, nil
+}
+
+// isNetworkError reports whether err is worth spooling for later.
+func isNetworkError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+func (sc *SpoolConsumer) Send(ctx context.Context, endpoint string, msgs [][]byte) error {
+	err := sc.next.Send(ctx, endpoint, msgs)
+	if err == nil || !isNetworkError(err) {
+		return err
+	}
+	if err := sc.spool(endpoint, msgs); err != nil {
+		return err
+	}
+	if done := claimDelivery(ctx); done != nil {
+		done(ErrSpooled)
+	}
+	return nil
+}
+
+func (sc *SpoolConsumer) Flush(ctx context.Context) error {
+	return sc.spoolFailed(sc.next.Flush(ctx))
+}
+
+// Close stops resending and closes the wrapped consumer, spooling the
+// messages its final flush failed to deliver. Messages still spooled
+// are kept on disk for the next SpoolConsumer using dir.
+func (sc *SpoolConsumer) Close(ctx context.Context) error {
+	sc.stopResending()
+	return sc.spoolFailed(sc.next.Close(ctx))
+}
+
+// Unwrap returns the consumer wrapped by sc.
+func (sc *SpoolConsumer) Unwrap() Consumer {
+	return sc.next
+}
+
+// spoolFailed spools the messages of the DeliveryErrors of err lost to
+// the network, and returns the errors left.
+func (sc *SpoolConsumer) spoolFailed(err error) error {
+	if err == nil {
+		return nil
+	}
+	delivery, errs := deliveryErrors(err)
+	for _, de := range delivery {
+		switch {
+		case !isNetworkError(de.Err):
+			errs = append(errs, de)
+		case de.Retained:
+			// the wrapped consumer keeps them, only log the outage
+			log.Printf("mixpanel: flush failed, will retry: %v", de)
+		default:
+			if err := sc.spool(de.Endpoint, de.Messages); err != nil {
+				errs = append(errs, de, err)
+			}
+		}
+	}
+	if len(delivery) == 0 && isNetworkError(err) {
+		log.Printf("mixpanel: flush failed, will retry: %v", err)
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
+func (sc *SpoolConsumer) stopResending() {
+	sc.closed.Do(func() {
+		close(sc.stop)
+		<-sc.done
+	})
+}
+
+// Resend immediately retries the spooled messages, oldest first. It stops
+// at the first network error.
+func (sc *SpoolConsumer) Resend(ctx context.Context) error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	files, err := filepath.Glob(filepath.Join(sc.dir, "*.spool"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		if err := sc.resendFile(ctx, file); err != nil {
+			if isNetworkError(err) || ctx.Err() != nil {
+				return err
+			}
+			log.Printf("mixpanel: rejected spool file %s: %v", file, err)
+			os.Rename(file, file+".rejected")
+		}
+	}
+	return nil
+}
+
+// Spooled returns the number of spool files waiting to be resent.
+func (sc *SpoolConsumer) Spooled() int {
+	files, _ := filepath.Glob(filepath.Join(sc.dir, "*.spool"))
+	return len(files)
+}
+
+func (sc *SpoolConsumer) loop(interval time.Duration) {
+	defer close(sc.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			sc.Resend(context.Background())
+		case <-sc.stop:
+			return
+		}
+	}
+}
+
+// resendBatch bounds the messages of a spool file replayed at once.
+const resendBatch = DefaultBatchSize
+
+// spool writes msgs as envelopes to a new spool file.
+func (sc *SpoolConsumer) spool(endpoint string, msgs [][]byte) error {
+	envelopes := make([]Envelope, len(msgs))
+	for i, msg := range msgs {
+		envelopes[i] = Envelope{Endpoint: endpoint, Data: msg}
+	}
+	name := fmt.Sprintf("%020d-%06d", time.Now().UnixNano(), sc.seq.Add(1)%1000000)
+	return writeSpool(filepath.Join(sc.dir, name+".spool"), envelopes)
+}
+
+// writeSpool writes envelopes to file through a temporary file, renamed
+// into place once complete so a crash never leaves a truncated spool
+// file behind.
+func writeSpool(file string, envelopes []Envelope) error {
+	tmp := strings.TrimSuffix(file, ".spool") + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for i := range envelopes {
+		if err = enc.Encode(&envelopes[i]); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+/*
+resendFile replays file one endpoint after the other, in batches of at
+most resendBatch messages each sent and flushed before the next. The
+messages handed over, delivered or retained by the wrapped consumer for
+its next flush, are removed from file after every batch, so that a
+later resend does not deliver them, and the people updates such as $add
+that are not idempotent, twice.
+*/
+func (sc *SpoolConsumer) resendFile(ctx context.Context, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	var envelopes []Envelope
+	var msgs [][]byte
+	batches := map[string][]int{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		var envelope Envelope
+		if err := json.Unmarshal(scanner.Bytes(), &envelope); err != nil {
+			f.Close()
+			return err
+		}
+		endpoint, data := envelope.Endpoint, []byte(envelope.Data)
+		if endpoint == "events" {
+			endpoint = "import"
+			if data, err = importable(data); err != nil {
+				f.Close()
+				return err
+			}
+		}
+		batches[endpoint] = append(batches[endpoint], len(envelopes))
+		envelopes = append(envelopes, envelope)
+		msgs = append(msgs, data)
+	}
+	f.Close()
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	endpoints := make([]string, 0, len(batches))
+	for endpoint := range batches {
+		if endpoint != "import" && endpoint != "people" {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	sort.Strings(endpoints)
+	endpoints = append([]string{"import", "people"}, endpoints...)
+
+	sent := make([]bool, len(envelopes))
+	for _, endpoint := range endpoints {
+		indexes := batches[endpoint]
+		for len(indexes) > 0 {
+			n := len(indexes)
+			if n > resendBatch {
+				n = resendBatch
+			}
+			batch := make([][]byte, n)
+			for i, index := range indexes[:n] {
+				batch[i] = msgs[index]
+			}
+			err := sc.next.Send(ctx, endpoint, batch)
+			if err == nil {
+				err = sc.next.Flush(ctx)
+			}
+			failed := undelivered(batch, err)
+			for i, index := range indexes[:n] {
+				sent[index] = !failed[i]
+			}
+			if err := removeSent(file, envelopes, sent); err != nil {
+				return err
+			}
+			if err != nil && (isNetworkError(err) || ctx.Err() != nil || len(failed) > 0) {
+				return err
+			}
+			indexes = indexes[n:]
+		}
+	}
+	return nil
+}
+
+/*
+undelivered returns the indexes of the messages of batch that err, the
+error of their send and flush, tells are not delivered. They all are
+when err is not made of DeliveryErrors; otherwise they are those of the
+DeliveryErrors that the wrapped consumer does not retain for its next
+flush, the others being delivered or left to it.
+*/
+func undelivered(batch [][]byte, err error) map[int]bool {
+	failed := map[int]bool{}
+	if err == nil {
+		return failed
+	}
+	delivery, other := deliveryErrors(err)
+	if len(other) > 0 {
+		for i := range batch {
+			failed[i] = true
+		}
+		return failed
+	}
+	lost := map[string]int{}
+	for _, de := range delivery {
+		if !de.Retained {
+			for _, msg := range de.Messages {
+				lost[string(msg)]++
+			}
+		}
+	}
+	for i, msg := range batch {
+		if lost[string(msg)] > 0 {
+			lost[string(msg)]--
+			failed[i] = true
+		}
+	}
+	return failed
+}
+
+// removeSent rewrites file with the envelopes not sent yet, and removes
+// it once they all are.
+func removeSent(file string, envelopes []Envelope, sent []bool) error {
+	var left []Envelope
+	for i, envelope := range envelopes {
+		if !sent[i] {
+			left = append(left, envelope)
+		}
+	}
+	if len(left) == 0 {
+		return os.Remove(file)
+	}
+	if len(left) == len(envelopes) {
+		return nil
+	}
+	return writeSpool(file, left)
+}
+
+/*
+importable rewrites a tracked event for the import endpoint: the time
+must be a number, and a $insert_id derived from the payload makes the
+import idempotent should the same file be resent twice.
+*/
+func importable(data []byte) ([]byte, error) {
+	var event Event
+	if err := unmarshalNumbers(data, &event); err != nil {
+		return nil, err
+	}
+	if event.Properties == nil {
+		event.Properties = &P{}
+	}
+	props := *event.Properties
+	if t, ok := props["time"].(string); ok {
+		if _, err := strconv.ParseInt(t, 10, 64); err == nil {
+			props["time"] = json.Number(t)
+		}
+	}
+	if _, ok := props[PropInsertID]; !ok {
+		sum := sha1.Sum(data)
+		props[PropInsertID] = hex.EncodeToString(sum[:16])
+	}
+	return json.Marshal(&event)
+}
@@ -0,0 +1,187 @@
+package mixpanel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSpoolConsumer(t *testing.T) {
+	var mu sync.Mutex
+	var imported []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, _, _ := r.BasicAuth(); user != "secret" {
+			t.Errorf("Expected the API secret, got %q", user)
+		}
+		var events []Event
+		json.NewDecoder(r.Body).Decode(&events)
+		mu.Lock()
+		for _, e := range events {
+			if _, ok := (*e.Properties)["time"].(float64); !ok {
+				t.Errorf("Expected a numeric time in %v", e.Properties)
+			}
+			imported = append(imported, e.Event)
+		}
+		mu.Unlock()
+		w.Write([]byte(`{"code": 200, "num_records_imported": 1, "status": "OK"}`))
+	}))
+	defer ts.Close()
+
+	std := NewStdConsumer()
+	// nothing listens there, every send fails with a network error
+	std.SetAPIHost("http://127.0.0.1:1")
+	sc, err := NewSpoolConsumer(std, t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mp := NewMixpanelWithConsumer(token, sc, WithAPISecret("secret"))
+	ctx := context.Background()
+
+	if err := mp.Track("12345", "Signed Up", nil); err != nil {
+		t.Fatalf("Expected the event to be spooled, got %v", err)
+	}
+	if sc.Spooled() != 1 {
+		t.Fatalf("Expected one spool file, got %d", sc.Spooled())
+	}
+	if err := sc.Resend(ctx); err == nil {
+		t.Error("Expected resend to fail while offline")
+	}
+
+	std.SetAPIHost(ts.URL)
+	if err := sc.Resend(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sc.Spooled() != 0 || strings.Join(imported, ",") != "Signed Up" {
+		t.Errorf("Expected the spooled event to be imported, got %q (%d left)", imported, sc.Spooled())
+	}
+	sc.Close(ctx)
+}
+
+func TestSpoolConsumerBuffered(t *testing.T) {
+	bc := NewBuffConsumer(50)
+	// nothing listens there, every flush fails with a network error
+	bc.SetAPIHost("http://127.0.0.1:1")
+	sc, err := NewSpoolConsumer(bc, t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mp := NewMixpanelWithConsumer(token, sc)
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		mp.Track("12345", "Signed Up", nil)
+	}
+
+	if err := mp.Flush(ctx); err != nil {
+		t.Fatalf("Expected the outage to be absorbed, got %v", err)
+	}
+	if sc.Spooled() != 0 || bc.Retained() != 3 {
+		t.Fatalf("Expected the messages to be retained by the buffer, got %d spooled and %d retained", sc.Spooled(), bc.Retained())
+	}
+	if err := mp.Close(ctx); err != nil {
+		t.Fatalf("Expected the messages to be spooled, got %v", err)
+	}
+	if sc.Spooled() != 1 || bc.Len() != 0 {
+		t.Errorf("Expected the buffer to be spooled on close, got %d spool files and %d buffered", sc.Spooled(), bc.Len())
+	}
+}
+
+func TestSpoolConsumerResendsInBatches(t *testing.T) {
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = time.Millisecond
+	var mu sync.Mutex
+	var imports []int
+	var updates int
+	var online atomic.Bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/engage" {
+			if !online.Load() {
+				// drop the connection, as an outage would
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.Close()
+				return
+			}
+			r.ParseForm()
+			mu.Lock()
+			updates++
+			mu.Unlock()
+			w.Write([]byte(`{"status": 1, "error": null}`))
+			return
+		}
+		var events []json.RawMessage
+		json.NewDecoder(r.Body).Decode(&events)
+		mu.Lock()
+		imports = append(imports, len(events))
+		mu.Unlock()
+		w.Write([]byte(`{"code": 200, "num_records_imported": 1, "status": "OK"}`))
+	}))
+	defer ts.Close()
+
+	std := NewStdConsumer()
+	std.SetAPIHost(ts.URL)
+	std.SetAPISecret("secret")
+	sc, err := NewSpoolConsumer(std, t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close(context.Background())
+	events := make([][]byte, 120)
+	for i := range events {
+		events[i] = []byte(fmt.Sprintf(`{"event":"Viewed","properties":{"n":%d,"time":1700000000}}`, i))
+	}
+	if err := sc.spool("events", events); err != nil {
+		t.Fatal(err)
+	}
+	if err := sc.spool("people", [][]byte{[]byte(`{"$distinct_id":"12345","$add":{"Visits":1}}`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := sc.Resend(ctx); err == nil {
+		t.Fatal("Expected the resend of the people update to fail")
+	}
+	online.Store(true)
+	if err := sc.Resend(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	total := 0
+	for _, n := range imports {
+		if n > resendBatch {
+			t.Errorf("Expected batches of at most %d events, got %d", resendBatch, n)
+		}
+		total += n
+	}
+	if total != 120 || updates != 1 || sc.Spooled() != 0 {
+		t.Errorf("Expected every message delivered once, got %d events, %d updates and %d spool files", total, updates, sc.Spooled())
+	}
+}
+
+func TestSpoolConsumerResendRetained(t *testing.T) {
+	bc := NewBuffConsumer(50)
+	// nothing listens there, every flush fails with a network error
+	bc.SetAPIHost("http://127.0.0.1:1")
+	bc.SetAPISecret("secret")
+	bc.SetErrorHandler(func(error) {})
+	sc, err := NewSpoolConsumer(bc, t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.stopResending()
+	if err := sc.spool("people", [][]byte{[]byte(`{"$distinct_id":"12345","$add":{"Visits":1}}`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sc.Resend(context.Background()); err == nil {
+		t.Fatal("Expected the resend to fail while offline")
+	}
+	if sc.Spooled() != 0 || bc.Retained() != 1 {
+		t.Errorf("Expected the message left to the buffer alone, got %d spool files and %d retained", sc.Spooled(), bc.Retained())
+	}
+}
@@ -0,0 +1,151 @@
+package mixpanel
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+Stats is a snapshot of the counters of a consumer, for dashboards and
+health checks to poll, see Mixpanel.Stats.
+
+Requests counts the requests made to Mixpanel, Sent and Failed the
+messages they delivered or failed to, and LastError is the error of the
+last failed request, at LastErrorTime. Queued and QueuedBytes measure
+the messages waiting in a buffer or a queue, LastFlush is when the
+consumer last delivered them, Retained the queued messages of failed
+flushes a BuffConsumer keeps for the next flush. Dropped and Spilled
+count the messages an AsyncConsumer discarded or wrote to disk as its
+queue was full.
+*/
+type Stats struct {
+	Requests      uint64
+	Sent          uint64
+	Failed        uint64
+	LastSend      time.Time
+	LastError     string `json:",omitempty"`
+	LastErrorTime time.Time
+	Queued        int
+	QueuedBytes   int64
+	LastFlush     time.Time
+	Retained      int
+	Dropped       uint64
+	Spilled       uint64
+}
+
+// requestStats counts the requests of a StdConsumer, shared by the
+// copies of the consumer.
+type requestStats struct {
+	requests atomic.Uint64
+	sent     atomic.Uint64
+	failed   atomic.Uint64
+
+	mu            sync.Mutex
+	lastSend      time.Time
+	lastError     string
+	lastErrorTime time.Time
+}
+
+// record counts a request of n messages that ended with err.
+func (rs *requestStats) record(n int, err error) {
+	now := time.Now()
+	rs.requests.Add(1)
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.lastSend = now
+	if err != nil {
+		rs.failed.Add(uint64(n))
+		rs.lastError = err.Error()
+		rs.lastErrorTime = now
+	} else {
+		rs.sent.Add(uint64(n))
+	}
+}
+
+func (rs *requestStats) snapshot() Stats {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return Stats{
+		Requests:      rs.requests.Load(),
+		Sent:          rs.sent.Load(),
+		Failed:        rs.failed.Load(),
+		LastSend:      rs.lastSend,
+		LastError:     rs.lastError,
+		LastErrorTime: rs.lastErrorTime,
+	}
+}
+
+// Stats returns the counters of the requests of c.
+func (c *StdConsumer) Stats() Stats {
+	return c.stats.snapshot()
+}
+
+// Stats returns the counters of the requests of bc and of its buffers.
+func (bc *BuffConsumer) Stats() Stats {
+	s := bc.StdConsumer.Stats()
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	for _, msgs := range bc.buffers {
+		s.Queued += len(msgs)
+		for _, msg := range msgs {
+			s.QueuedBytes += int64(len(msg))
+		}
+	}
+	for _, n := range bc.retained {
+		s.Retained += n
+	}
+	s.LastFlush = bc.lastFlush
+	return s
+}
+
+// Stats returns the counters of the queue of ac, along with those of
+// the wrapped consumers when one has a Stats method.
+func (ac *AsyncConsumer) Stats() Stats {
+	var s Stats
+	if c, ok := findConsumer[interface{ Stats() Stats }](ac.next); ok {
+		s = c.Stats()
+	}
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	for _, l := range ac.lanes {
+		s.Queued += len(l.queue)
+		for _, q := range l.queue {
+			s.QueuedBytes += int64(len(q.msg))
+		}
+	}
+	s.LastFlush = ac.lastFlush
+	s.Dropped += ac.dropped.Load()
+	s.Spilled += ac.spilled.Load()
+	return s
+}
+
+// Stats returns the counters of the consumer of mp, zero when neither it
+// nor the consumers it wraps have a Stats method.
+func (mp *Mixpanel) Stats() Stats {
+	if c, ok := findConsumer[interface{ Stats() Stats }](mp.c); ok {
+		return c.Stats()
+	}
+	return Stats{}
+}
+
+/*
+PublishExpvar publishes the Stats of mp as the expvar variable name,
+served as JSON on /debug/vars by the expvar package:
+
+	mp.PublishExpvar("mixpanel")
+
+Unlike expvar.Publish, it returns an error rather than panicking when
+name is already published.
+*/
+func (mp *Mixpanel) PublishExpvar(name string) error {
+	if expvar.Get(name) != nil {
+		return fmt.Errorf("mixpanel: expvar %q is already published", name)
+	}
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return mp.Stats()
+	}))
+	return nil
+}
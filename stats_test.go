@@ -0,0 +1,154 @@
+package mixpanel
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	var fail atomic.Bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			w.Write([]byte(`{"status": 0, "error": "invalid token"}`))
+			return
+		}
+		w.Write([]byte(`{"status": 1, "error": null}`))
+	}))
+	defer ts.Close()
+
+	bc := NewBuffConsumer(10)
+	mp := NewMixpanelWithConsumer(token, bc, WithAPIHost(ts.URL))
+	mp.Track("12345", "Viewed", nil)
+	mp.Track("12345", "Viewed", nil)
+	if s := mp.Stats(); s.Queued != 2 || s.QueuedBytes == 0 || s.Requests != 0 || !s.LastFlush.IsZero() {
+		t.Errorf("Unexpected stats before flush %+v", s)
+	}
+	mp.Flush(context.Background())
+	fail.Store(true)
+	mp.PeopleSet("12345", &P{"plan": "pro"})
+	mp.Flush(context.Background())
+
+	s := mp.Stats()
+	if s.Queued != 0 || s.QueuedBytes != 0 || s.Requests != 2 || s.Sent != 2 || s.Failed != 1 ||
+		s.LastError != "Mixpanel error: invalid token" || s.LastErrorTime.IsZero() || s.LastFlush.IsZero() {
+		t.Errorf("Unexpected stats %+v", s)
+	}
+
+	name := fmt.Sprintf("mixpanel_test_%d", time.Now().UnixNano())
+	if err := mp.PublishExpvar(name); err != nil {
+		t.Fatal(err)
+	}
+	if err := mp.PublishExpvar(name); err == nil {
+		t.Error("Expected an error publishing the same name twice")
+	}
+	var published Stats
+	if err := json.Unmarshal([]byte(expvar.Get(name).String()), &published); err != nil {
+		t.Fatal(err)
+	}
+	if published.Requests != 2 {
+		t.Errorf("Unexpected published stats %+v", published)
+	}
+}
+
+func TestAsyncConsumerStats(t *testing.T) {
+	rs := newRecordingServer()
+	defer rs.Close()
+
+	c := NewStdConsumer()
+	c.endpoints = rs.endpoints()
+	ac, err := NewAsyncConsumer(c, AsyncConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ac.Send(context.Background(), "events", [][]byte{[]byte(`{"a":1}`), []byte(`{"b":2}`)})
+	ac.Flush(context.Background())
+	if s := ac.Stats(); s.Sent != 2 || s.Queued != 0 || s.LastFlush.IsZero() {
+		t.Errorf("Unexpected stats %+v", s)
+	}
+	ac.Close(context.Background())
+}
+
+func TestBuffConsumerLen(t *testing.T) {
+	rs := newRecordingServer()
+	defer rs.Close()
+
+	bc := NewBuffConsumer(10)
+	bc.endpoints = rs.endpoints()
+	ctx := context.Background()
+	bc.Send(ctx, "events", [][]byte{[]byte(`{"a":1}`), []byte(`{"b":2}`)})
+	bc.Send(ctx, "people", [][]byte{[]byte(`{"c":3}`)})
+	if n, size := bc.Len(), bc.Bytes(); n != 3 || size != 21 || !bc.LastFlush().IsZero() {
+		t.Errorf("Expected 3 messages of 21 bytes before the first flush, got %d of %d", n, size)
+	}
+	bc.Flush(ctx)
+	if n, size := bc.Len(), bc.Bytes(); n != 0 || size != 0 || bc.LastFlush().IsZero() {
+		t.Errorf("Expected an empty buffer after a flush, got %d messages of %d bytes", n, size)
+	}
+}
+
+func TestBuffConsumerStatsDuringFlush(t *testing.T) {
+	release := make(chan struct{})
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		w.Write([]byte(`{"status": 1, "error": null}`))
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	bc := NewBuffConsumer(1)
+	bc.SetAPIHost(ts.URL)
+	go bc.Send(context.Background(), "events", [][]byte{[]byte(`{"a":1}`), []byte(`{"b":2}`)})
+	for requests.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		bc.Len()
+		bc.Bytes()
+		bc.LastFlush()
+		bc.Retained()
+		bc.Stats()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the stats not to wait for the flush in flight")
+	}
+}
+
+func TestAsyncConsumerLen(t *testing.T) {
+	gate := make(chan struct{})
+	next := &gatedConsumer{gate: gate}
+	ac, err := NewAsyncConsumer(next, AsyncConfig{BatchSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		ac.Send(ctx, "events", [][]byte{[]byte(`{"a":1}`)})
+	}
+	// the worker holds the first message, waiting for the gate
+	deadline := time.Now().Add(time.Second)
+	for ac.Len() != 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n, size := ac.Len(), ac.Bytes(); n != 2 || size != 14 {
+		t.Errorf("Expected 2 queued messages of 14 bytes, got %d of %d", n, size)
+	}
+	close(gate)
+	ac.Close(ctx)
+	if n := ac.Len(); n != 0 || ac.LastFlush().IsZero() {
+		t.Errorf("Expected an empty queue after Close, got %d messages", n)
+	}
+}
@@ -0,0 +1,147 @@
+package mixpanel
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// structField describes how one struct field maps to a property.
+type structField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// structFields caches the fields of every struct type seen, keyed by
+// reflect.Type.
+var structFields sync.Map
+
+var timeType = reflect.TypeOf(time.Time{})
+
+/*
+TrackStruct tracks an event whose properties are the fields of a struct.
+
+Fields are named after their `mixpanel` tag, or the field name when
+untagged. The "omitempty" option skips zero values and a "-" tag skips
+the field. Embedded structs are flattened and other nested structs
+become nested objects. Example:
+
+	type OrderPlaced struct {
+	    OrderID  string    `mixpanel:"Order ID"`
+	    Total    float64   `mixpanel:"Total"`
+	    Coupon   string    `mixpanel:"Coupon,omitempty"`
+	    PlacedAt time.Time `mixpanel:"time"`
+	}
+
+	mp.TrackStruct("12345", "Order Placed", &OrderPlaced{...})
+*/
+func (mp *Mixpanel) TrackStruct(distinct_id, event string, v interface{}) error {
+	props, err := StructProps(v)
+	if err != nil {
+		return err
+	}
+	return mp.Track(distinct_id, event, props)
+}
+
+// StructProps converts a struct, or a pointer to one, into properties
+// following the rules of TrackStruct.
+func StructProps(v interface{}) (*P, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return &P{}, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("mixpanel: expected a struct, got %T", v)
+	}
+	return structProps(rv), nil
+}
+
+func structProps(rv reflect.Value) *P {
+	props := P{}
+	for _, f := range cachedFields(rv.Type()) {
+		fv, ok := fieldByIndex(rv, f.index)
+		if !ok || (f.omitEmpty && fv.IsZero()) {
+			continue
+		}
+		props[f.name] = structValue(fv)
+	}
+	return &props
+}
+
+// structValue converts nested structs into properties, leaving other
+// values to the serializer.
+func structValue(fv reflect.Value) interface{} {
+	for fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			return nil
+		}
+		fv = fv.Elem()
+	}
+	if fv.Kind() == reflect.Struct && fv.Type() != timeType {
+		return structProps(fv)
+	}
+	return fv.Interface()
+}
+
+// fieldByIndex is like reflect.Value.FieldByIndex but reports false
+// instead of panicking on a nil embedded pointer.
+func fieldByIndex(rv reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				return reflect.Value{}, false
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(x)
+	}
+	return rv, true
+}
+
+func cachedFields(t reflect.Type) []structField {
+	if fields, ok := structFields.Load(t); ok {
+		return fields.([]structField)
+	}
+	fields, _ := structFields.LoadOrStore(t, typeFields(t, nil))
+	return fields.([]structField)
+}
+
+func typeFields(t reflect.Type, index []int) []structField {
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("mixpanel")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		fieldIndex := append(append([]int(nil), index...), i)
+
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			fields = append(fields, typeFields(ft, fieldIndex)...)
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, structField{
+			name:      name,
+			index:     fieldIndex,
+			omitEmpty: opts == "omitempty",
+		})
+	}
+	return fields
+}
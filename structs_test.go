@@ -0,0 +1,55 @@
+package mixpanel
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type orderMeta struct {
+	Source string `mixpanel:"Source"`
+}
+
+type orderPlaced struct {
+	orderMeta
+	OrderID  string    `mixpanel:"Order ID"`
+	Total    float64   `mixpanel:"Total"`
+	Coupon   string    `mixpanel:"Coupon,omitempty"`
+	PlacedAt time.Time `mixpanel:"time"`
+	Internal string    `mixpanel:"-"`
+	Shipping *struct {
+		Country string `mixpanel:"Country"`
+	} `mixpanel:"Shipping,omitempty"`
+	Items  int
+	secret string
+}
+
+func TestStructProps(t *testing.T) {
+	at := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	props, err := StructProps(&orderPlaced{
+		orderMeta: orderMeta{Source: "web"},
+		OrderID:   "A-1",
+		Total:     9.99,
+		PlacedAt:  at,
+		Internal:  "hidden",
+		Items:     2,
+		secret:    "hidden",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := P{
+		"Source":   "web",
+		"Order ID": "A-1",
+		"Total":    9.99,
+		"time":     at,
+		"Items":    2,
+	}
+	if !reflect.DeepEqual(*props, expected) {
+		t.Errorf("Expected %v got %v", expected, *props)
+	}
+
+	if _, err := StructProps("not a struct"); err == nil {
+		t.Error("Expected an error for a non struct value")
+	}
+}
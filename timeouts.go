@@ -0,0 +1,91 @@
+package mixpanel
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Defaults of Timeouts. A request taking longer than DefaultRequestTimeout
+// is more likely a hung connection than a slow one.
+const (
+	DefaultDialTimeout         = 30 * time.Second
+	DefaultTLSHandshakeTimeout = 10 * time.Second
+	DefaultRequestTimeout      = 30 * time.Second
+	DefaultFlushTimeout        = 2 * time.Minute
+)
+
+/*
+Timeouts bounds the steps of the delivery of the messages, from the
+innermost to the outermost:
+
+  - Dial, the opening of a connection to Mixpanel, or to the proxy
+  - TLSHandshake, the TLS handshake of a new connection
+  - Request, a request of the consumer, from its connection to the end
+    of the response
+  - Flush, a whole Flush or Close of the Mixpanel object, across the
+    requests of all endpoints
+
+Zero fields keep their defaults, DefaultDialTimeout,
+DefaultTLSHandshakeTimeout, DefaultRequestTimeout and
+DefaultFlushTimeout; negative ones remove the bound. A deadline of the
+context of the caller applies as well. Example:
+
+	mp := NewMixpanelWithConsumer(token, NewBuffConsumer(50), WithTimeouts(Timeouts{
+	    Dial:    5 * time.Second,
+	    Request: 10 * time.Second,
+	}))
+*/
+type Timeouts struct {
+	Dial         time.Duration
+	TLSHandshake time.Duration
+	Request      time.Duration
+	Flush        time.Duration
+}
+
+// WithTimeouts bounds the delivery of the messages by t. The dial and TLS
+// handshake timeouts adjust the transport like WithProxy, and the
+// request timeout is handed to the consumer when it has a
+// SetRequestTimeout method.
+func WithTimeouts(t Timeouts) Option {
+	return func(mp *Mixpanel) {
+		if t.Dial != 0 || t.TLSHandshake != 0 {
+			withTransport(func(transport *http.Transport) {
+				if t.Dial != 0 {
+					setDialTimeout(transport, positive(t.Dial))
+				}
+				if t.TLSHandshake != 0 {
+					transport.TLSHandshakeTimeout = positive(t.TLSHandshake)
+				}
+			})(mp)
+		}
+		if t.Request != 0 {
+			if c, ok := findConsumer[interface{ SetRequestTimeout(time.Duration) }](mp.c); ok {
+				c.SetRequestTimeout(positive(t.Request))
+			}
+		}
+		if t.Flush != 0 {
+			mp.flushTimeout = t.Flush
+		}
+	}
+}
+
+// positive returns d, or 0, no bound, when it is negative.
+func positive(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// flushContext returns ctx bounded by the flush timeout of mp.
+func (mp *Mixpanel) flushContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := mp.flushTimeout
+	if timeout == 0 {
+		timeout = DefaultFlushTimeout
+	}
+	if timeout < 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
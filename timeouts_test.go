@@ -0,0 +1,50 @@
+package mixpanel
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithTimeouts(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		w.Write([]byte(`{"status": 1, "error": null}`))
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	mp := NewMixpanel(token, WithAPIHost(ts.URL), WithTimeouts(Timeouts{
+		Dial:         time.Second,
+		TLSHandshake: -1,
+		Request:      20 * time.Millisecond,
+	}))
+	if err := mp.Track("12345", "Viewed", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the request to time out, got %v", err)
+	}
+	transport := mp.client.Transport.(*http.Transport)
+	if transport.DialContext == nil || transport.TLSHandshakeTimeout != 0 {
+		t.Errorf("Unexpected transport %+v", transport)
+	}
+
+	bc := NewBuffConsumer(10)
+	mp = NewMixpanelWithConsumer(token, bc, WithAPIHost(ts.URL), WithTimeouts(Timeouts{Request: -1, Flush: 20 * time.Millisecond}))
+	if bc.requestTimeout != 0 {
+		t.Errorf("Expected no request timeout, got %v", bc.requestTimeout)
+	}
+	mp.Track("12345", "Viewed", nil)
+	start := time.Now()
+	if err := mp.Flush(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the flush to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the flush to be bounded, took %v", elapsed)
+	}
+}
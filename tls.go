@@ -0,0 +1,102 @@
+package mixpanel
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+/*
+WithTLSConfig sends the requests with the TLS settings of cfg, for
+environments that intercept the egress traffic with their own
+certificate authority, or require client certificates. Like WithProxy,
+WithRootCAs, WithClientCertificate and WithMinTLSVersion, it adjusts a
+copy of the *http.Transport of the HTTP client, so that these options
+add up, and replaces any other RoundTripper or Transport. Example:
+
+	pool, err := NewCertPool("/etc/ssl/corp-ca.pem")
+	...
+	mp := NewMixpanel(token, WithRootCAs(pool), WithMinTLSVersion(tls.VersionTLS12))
+*/
+func WithTLSConfig(cfg *tls.Config) Option {
+	return withTransport(func(t *http.Transport) {
+		t.TLSClientConfig = cfg.Clone()
+	})
+}
+
+// WithRootCAs verifies the certificate of Mixpanel, or of the proxy in
+// front of it, with the authorities of pool rather than those of the
+// system, see NewCertPool.
+func WithRootCAs(pool *x509.CertPool) Option {
+	return withTransport(func(t *http.Transport) {
+		tlsConfig(t).RootCAs = pool
+	})
+}
+
+// WithClientCertificate presents cert to the servers asking for a client
+// certificate, such as a gateway authenticating the services.
+func WithClientCertificate(cert tls.Certificate) Option {
+	return withTransport(func(t *http.Transport) {
+		c := tlsConfig(t)
+		c.Certificates = append(c.Certificates, cert)
+	})
+}
+
+// WithMinTLSVersion refuses the connections of a TLS version lower than
+// version, tls.VersionTLS12 for example.
+func WithMinTLSVersion(version uint16) Option {
+	return withTransport(func(t *http.Transport) {
+		tlsConfig(t).MinVersion = version
+	})
+}
+
+/*
+NewCertPool returns the certificate authorities of the system along
+with those of the PEM files, such as the authority of a corporate proxy
+intercepting the egress traffic.
+*/
+func NewCertPool(pemFiles ...string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	for _, file := range pemFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("mixpanel: no certificate in %s", file)
+		}
+	}
+	return pool, nil
+}
+
+// withTransport applies fn to a copy of the *http.Transport of the HTTP
+// client of mp, or of the default transport, and sends the requests
+// through the copy.
+func withTransport(fn func(*http.Transport)) Option {
+	return func(mp *Mixpanel) {
+		var transport *http.Transport
+		if mp.client != nil {
+			if t, ok := mp.client.Transport.(*http.Transport); ok {
+				transport = t.Clone()
+			}
+		}
+		if transport == nil {
+			transport = NewTransport()
+		}
+		fn(transport)
+		WithRoundTripper(transport)(mp)
+	}
+}
+
+// tlsConfig returns the TLS configuration of t, created when missing.
+func tlsConfig(t *http.Transport) *tls.Config {
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	}
+	return t.TLSClientConfig
+}
@@ -0,0 +1,77 @@
+package mixpanel
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWithRootCAs(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": 1, "error": null}`))
+	}))
+	defer ts.Close()
+
+	mp := NewMixpanel(token, WithAPIHost(ts.URL))
+	if err := mp.Track("12345", "Viewed", nil); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Fatalf("Expected an unknown certificate authority, got %v", err)
+	}
+
+	file := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	if err := os.WriteFile(file, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	pool, err := NewCertPool(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxyURL, _ := url.Parse("http://proxy.invalid")
+	mp = NewMixpanel(token, WithAPIHost(ts.URL), WithProxy(proxyURL), WithRootCAs(pool), WithMinTLSVersion(tls.VersionTLS12))
+	transport := mp.client.Transport.(*http.Transport)
+	if transport.Proxy == nil || transport.TLSClientConfig.MinVersion != tls.VersionTLS12 {
+		t.Errorf("Expected the options to add up, got %+v", transport)
+	}
+	mp = NewMixpanel(token, WithAPIHost(ts.URL), WithRootCAs(pool))
+	if err := mp.Track("12345", "Viewed", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewCertPool(os.DevNull); err == nil {
+		t.Error("Expected an error for a file without certificates")
+	}
+}
+
+func TestWithClientCertificate(t *testing.T) {
+	var peers int
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peers = len(r.TLS.PeerCertificates)
+		w.Write([]byte(`{"status": 1, "error": null}`))
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert, MaxVersion: tls.VersionTLS12}
+	ts.StartTLS()
+	defer ts.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+	cert := ts.TLS.Certificates[0]
+
+	mp := NewMixpanel(token, WithAPIHost(ts.URL), WithRootCAs(pool), WithMinTLSVersion(tls.VersionTLS13))
+	if err := mp.Track("12345", "Viewed", nil); err == nil {
+		t.Error("Expected TLS 1.2 to be refused")
+	}
+	mp = NewMixpanel(token, WithAPIHost(ts.URL), WithTLSConfig(&tls.Config{RootCAs: pool}), WithClientCertificate(cert))
+	if err := mp.Track("12345", "Viewed", nil); err != nil {
+		t.Fatal(err)
+	}
+	if peers != 1 {
+		t.Errorf("Expected the client certificate, got %d", peers)
+	}
+}
@@ -0,0 +1,59 @@
+package mixpanel
+
+import (
+	"net/http"
+)
+
+/*
+Transport sends the HTTP requests of the consumers. *http.Client
+implements it, and is the transport of the consumers by default; other
+implementations let the client run where the standard HTTP client does
+not, such as WASM edge runtimes with their own fetch API, or TinyGo.
+Example:
+
+	mp := NewMixpanel(token, WithTransport(edgeFetch{}))
+
+Do must return a response whose body the caller reads and closes, or an
+error, as http.Client.Do does.
+*/
+type Transport interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// WithTransport sends the requests of the consumer, and those made by the
+// Mixpanel object itself, such as imports, through t. It is handed to the
+// consumer when it has a SetTransport method.
+func WithTransport(t Transport) Option {
+	if client, ok := t.(*http.Client); ok {
+		return WithHTTPClient(client)
+	}
+	return func(mp *Mixpanel) {
+		mp.client = &http.Client{Transport: transportRoundTripper{t}}
+		if c, ok := findConsumer[interface{ SetTransport(Transport) }](mp.c); ok {
+			c.SetTransport(t)
+		}
+	}
+}
+
+// transportRoundTripper sends the requests of an HTTP client through a
+// Transport.
+type transportRoundTripper struct {
+	t Transport
+}
+
+func (rt transportRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return rt.t.Do(req)
+}
+
+var defaultHTTPClient = &http.Client{Transport: defaultTransport}
+
+/*
+NewTransport returns a copy of the transport of the consumers, which
+goes through the proxy of the HTTP_PROXY and HTTPS_PROXY environment
+variables, for custom transports to wrap or adjust:
+
+	mp := NewMixpanel(token, WithRoundTripper(metrics.Wrap(NewTransport())))
+*/
+func NewTransport() *http.Transport {
+	return defaultTransport.Clone()
+}
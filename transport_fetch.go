@@ -0,0 +1,20 @@
+//go:build (js && wasm) || tinygo
+
+package mixpanel
+
+import (
+	"net/http"
+	"time"
+)
+
+// defaultTransport is shared by every StdConsumer. It has no dialer: in
+// browsers and js/wasm runtimes the standard transport sends the
+// requests with the Fetch API only when it dials nothing itself, and
+// TinyGo has no net.Dialer.
+var defaultTransport = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+}
+
+// setDialTimeout does nothing: the connections are opened by the
+// runtime.
+func setDialTimeout(t *http.Transport, timeout time.Duration) {}
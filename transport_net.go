@@ -0,0 +1,37 @@
+//go:build !(js && wasm) && !tinygo
+
+package mixpanel
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+/*
+defaultTransport is shared by every StdConsumer. Unlike the standard
+library default it keeps enough idle connections per host for busy
+services to reuse them instead of opening, and leaving in TIME_WAIT, a
+new connection for most requests.
+*/
+var defaultTransport = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	DialContext: (&net.Dialer{
+		Timeout:   DefaultDialTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	ForceAttemptHTTP2:     true,
+	MaxIdleConns:          100,
+	MaxIdleConnsPerHost:   64,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   DefaultTLSHandshakeTimeout,
+	ExpectContinueTimeout: 1 * time.Second,
+}
+
+// setDialTimeout bounds the connections of t by timeout, 0 for none.
+func setDialTimeout(t *http.Transport, timeout time.Duration) {
+	t.DialContext = (&net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+}
@@ -0,0 +1,46 @@
+package mixpanel
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fetchTransport answers the requests itself, like the fetch API of a
+// WASM runtime.
+type fetchTransport struct {
+	mu   sync.Mutex
+	urls []string
+}
+
+func (t *fetchTransport) Do(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	t.urls = append(t.urls, req.URL.String())
+	t.mu.Unlock()
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader(`{"status": 1, "error": null}`)),
+		Request:    req,
+	}, nil
+}
+
+func TestWithTransport(t *testing.T) {
+	transport := &fetchTransport{}
+	mp := NewMixpanelWithConsumer(token, NewBuffConsumer(10), WithTransport(transport))
+	if err := mp.Track("13793", "Signed Up", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := mp.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := mp.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(transport.urls) != 2 || !strings.HasSuffix(transport.urls[0], "/track") {
+		t.Errorf("Expected the consumer and the client to use the transport, got %q", transport.urls)
+	}
+}
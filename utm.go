@@ -0,0 +1,52 @@
+package mixpanel
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// utmParams are the campaign parameters copied by URLProperties.
+var utmParams = []string{"utm_source", "utm_medium", "utm_campaign", "utm_content", "utm_term"}
+
+/*
+URLProperties returns the utm_* campaign parameters of the query string
+of u, ready to be merged into the properties of an event:
+
+	props := mixpanel.URLProperties(landing).Update(&mixpanel.P{"plan": "pro"})
+	mp.Track("12345", "Signed Up", props)
+
+Parameters that are missing or empty are left out.
+*/
+func URLProperties(u *url.URL) *P {
+	props := &P{}
+	if u == nil {
+		return props
+	}
+	query := u.Query()
+	for _, param := range utmParams {
+		if value := strings.TrimSpace(query.Get(param)); value != "" {
+			(*props)[param] = value
+		}
+	}
+	return props
+}
+
+/*
+RequestProperties returns the utm_* campaign parameters of the URL of r
+along with its referrer, as the Mixpanel JavaScript library reports
+them: $referrer holds the Referer header and $referring_domain the host
+it names. Both are left out when r has no referrer.
+*/
+func RequestProperties(r *http.Request) *P {
+	props := URLProperties(r.URL)
+	referrer := r.Referer()
+	if referrer == "" {
+		return props
+	}
+	(*props)["$referrer"] = referrer
+	if u, err := url.Parse(referrer); err == nil && u.Host != "" {
+		(*props)["$referring_domain"] = u.Host
+	}
+	return props
+}
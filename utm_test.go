@@ -0,0 +1,37 @@
+package mixpanel
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestURLProperties(t *testing.T) {
+	u, _ := url.Parse("https://example.com/pricing?utm_source=newsletter&utm_medium=email&utm_term=+&page=2")
+	want := &P{"utm_source": "newsletter", "utm_medium": "email"}
+	if got := URLProperties(u); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v got %v", want, got)
+	}
+	if got := URLProperties(nil); len(*got) != 0 {
+		t.Errorf("Expected no properties got %v", got)
+	}
+}
+
+func TestRequestProperties(t *testing.T) {
+	r := httptest.NewRequest("GET", "/?utm_campaign=spring", nil)
+	r.Header.Set("Referer", "https://news.example.org:8443/post/1?ref=x")
+	want := &P{
+		"utm_campaign":      "spring",
+		"$referrer":         "https://news.example.org:8443/post/1?ref=x",
+		"$referring_domain": "news.example.org:8443",
+	}
+	if got := RequestProperties(r); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v got %v", want, got)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	if got := RequestProperties(r); len(*got) != 0 {
+		t.Errorf("Expected no properties got %v", got)
+	}
+}
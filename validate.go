@@ -0,0 +1,191 @@
+package mixpanel
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// Limits enforced by a Validator when its fields are zero.
+const (
+	DefaultMaxKeyLength = 255
+	DefaultMaxDepth     = 3
+)
+
+// ValidationError reports a message rejected by a Validator. Nothing is
+// sent when it is returned.
+type ValidationError struct {
+	Event    string
+	Property string
+	Reason   string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Property != "" {
+		return fmt.Sprintf("mixpanel: invalid property '%s' of '%s': %s", e.Property, e.Event, e.Reason)
+	}
+	return fmt.Sprintf("mixpanel: invalid message '%s': %s", e.Event, e.Reason)
+}
+
+/*
+Validator checks events, people and group updates before they are sent.
+
+It rejects empty distinct ids and event names, group updates without
+$group_key or $group_id, property names longer than MaxKeyLength,
+values JSON cannot encode (channels, functions, complex numbers, NaN)
+and values nested deeper than MaxDepth. Event properties using the
+reserved "$" and "mp_" prefixes that Mixpanel does not define are
+reported to Warn, if set, but still sent.
+*/
+type Validator struct {
+	MaxKeyLength int
+	MaxDepth     int
+	Warn         func(msg *Message, warning string)
+}
+
+// WithValidation rejects invalid messages with a ValidationError. A nil
+// Validator uses the default limits.
+func WithValidation(v *Validator) Option {
+	if v == nil {
+		v = &Validator{}
+	}
+	return WithMiddleware(v.Validate)
+}
+
+// libraryProperties are the properties set by the library itself or
+// documented by Mixpanel and are allowed despite their prefix.
+var libraryProperties = map[string]bool{
+	PropLibVersion: true, PropLib: true, PropSampleRate: true,
+	PropInsertID: true, PropDeviceID: true, PropUserID: true,
+	PropCurrentURL: true, PropReferrer: true, PropReferringDomain: true,
+	PropOS: true, PropBrowser: true, PropCity: true, PropRegion: true,
+	PropCountryCode: true, PropDuration: true,
+	"$source": true, "$ignore_time": true, "$groups": true, "$anon_id": true,
+	"$identified_id": true, "$distinct_ids": true,
+}
+
+// Validate implements Middleware.
+func (v *Validator) Validate(msg *Message) error {
+	if msg.Endpoint == "groups" {
+		// group updates name their profile with $group_key and
+		// $group_id rather than a distinct id
+		for _, key := range []string{"$group_key", "$group_id"} {
+			if msg.Properties == nil || (*msg.Properties)[key] == nil || (*msg.Properties)[key] == "" {
+				return &ValidationError{Event: msg.Event, Reason: "empty " + key}
+			}
+		}
+	} else if msg.DistinctID == "" {
+		return &ValidationError{Event: msg.Event, Reason: "empty distinct_id"}
+	}
+	if msg.IsEvent() && strings.TrimSpace(msg.Event) == "" {
+		return &ValidationError{Event: msg.Event, Reason: "empty event name"}
+	}
+	if msg.Properties == nil {
+		return nil
+	}
+	for key, value := range *msg.Properties {
+		if msg.IsEvent() {
+			if err := v.checkKey(msg, key); err != nil {
+				return err
+			}
+			if v.Warn != nil && !libraryProperties[key] && (strings.HasPrefix(key, "$") || strings.HasPrefix(key, "mp_")) {
+				v.Warn(msg, fmt.Sprintf("property '%s' uses a prefix reserved by Mixpanel", key))
+			}
+			if err := v.checkValue(msg, key, value, 0); err != nil {
+				return err
+			}
+		} else if err := v.checkValue(msg, key, value, -1); err != nil {
+			// the operations of people and group updates ($set,
+			// $add...) do not count as a nesting level, the names of
+			// the properties they update are checked as those of events
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *Validator) checkKey(msg *Message, key string) error {
+	max := v.MaxKeyLength
+	if max == 0 {
+		max = DefaultMaxKeyLength
+	}
+	if key == "" {
+		return &ValidationError{Event: msg.Event, Reason: "empty property name"}
+	}
+	if libraryProperties[key] || key == PropToken || key == PropDistinctID || key == PropTime || key == PropIP {
+		// the properties of the library, whatever the limit
+		return nil
+	}
+	if len(key) > max {
+		name := truncateString(key, 32)
+		if name != key {
+			name += "..."
+		}
+		return &ValidationError{Event: msg.Event, Property: name,
+			Reason: fmt.Sprintf("name longer than %d characters", max)}
+	}
+	return nil
+}
+
+func (v *Validator) checkValue(msg *Message, key string, value interface{}, depth int) error {
+	max := v.MaxDepth
+	if max == 0 {
+		max = DefaultMaxDepth
+	}
+	if value == nil {
+		return nil
+	}
+	if n, ok := value.(json.Number); ok && n != "" && !isNumber(string(n)) {
+		return &ValidationError{Event: msg.Event, Property: key, Reason: fmt.Sprintf("invalid number %q", n)}
+	}
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	invalid := func(reason string) error {
+		return &ValidationError{Event: msg.Event, Property: key, Reason: reason}
+	}
+	switch rv.Kind() {
+	case reflect.Chan, reflect.Func, reflect.Complex64, reflect.Complex128, reflect.UnsafePointer:
+		return invalid(fmt.Sprintf("unsupported value of type %s", rv.Type()))
+	case reflect.Float32, reflect.Float64:
+		if f := rv.Float(); math.IsNaN(f) || math.IsInf(f, 0) {
+			return invalid("number is not finite")
+		}
+	case reflect.Map:
+		if depth+1 > max {
+			return invalid(fmt.Sprintf("nested deeper than %d levels", max))
+		}
+		if rv.Type().Key().Kind() != reflect.String {
+			return invalid(fmt.Sprintf("map keys of type %s", rv.Type().Key()))
+		}
+		iter := rv.MapRange()
+		for iter.Next() {
+			k := iter.Key().String()
+			if err := v.checkKey(msg, k); err != nil {
+				return err
+			}
+			if err := v.checkValue(msg, key+"."+k, iter.Value().Interface(), depth+1); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return nil
+		}
+		if depth+1 > max {
+			return invalid(fmt.Sprintf("nested deeper than %d levels", max))
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if err := v.checkValue(msg, key, rv.Index(i).Interface(), depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package mixpanel
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidation(t *testing.T) {
+	var buf bytes.Buffer
+	var warnings []string
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf), WithValidation(&Validator{
+		Warn: func(msg *Message, warning string) {
+			warnings = append(warnings, warning)
+		},
+	}))
+
+	invalid := []struct {
+		id, event string
+		props     *P
+	}{
+		{"", "Signed Up", nil},
+		{"12345", " ", nil},
+		{"12345", "Signed Up", &P{strings.Repeat("k", 256): 1}},
+		{"12345", "Signed Up", &P{"Callback": func() {}}},
+		{"12345", "Signed Up", &P{"Updates": make(chan int)}},
+		{"12345", "Signed Up", &P{"a": P{"b": P{"c": P{"d": []int{1}}}}}},
+	}
+	for _, c := range invalid {
+		err := mp.Track(c.id, c.event, c.props)
+		var ve *ValidationError
+		if !errors.As(err, &ve) {
+			t.Errorf("Expected a ValidationError for %q %q %v, got %v", c.id, c.event, c.props, err)
+		}
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected nothing to be sent, got %s", buf.String())
+	}
+
+	if err := mp.Track("12345", "Signed Up", &P{"$plan": "Pro", "a": P{"b": []int{1}}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "$plan") {
+		t.Errorf("Expected a warning for $plan, got %q", warnings)
+	}
+	if err := mp.PeopleSet("12345", &P{"$email": "amy@mixpanel.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	buf.Reset()
+	long := strings.Repeat("k", 300)
+	for _, err := range []error{
+		mp.PeopleSet("12345", &P{long: 1}),
+		mp.PeopleIncrement("12345", &P{long: 1}),
+		mp.GroupSet("company", "Acme Inc", &P{long: 1}),
+	} {
+		var ve *ValidationError
+		if !errors.As(err, &ve) || !strings.Contains(ve.Reason, "longer than 255") {
+			t.Errorf("Expected a ValidationError for the long property name, got %v", err)
+		}
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected nothing to be sent, got %s", buf.String())
+	}
+}
+
+func TestValidationGroups(t *testing.T) {
+	var buf bytes.Buffer
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf), WithValidation(nil))
+	if err := mp.GroupSet("company", "Acme Inc", &P{"Plan": "Enterprise"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"$group_id":"Acme Inc"`) {
+		t.Errorf("Expected the group update to be sent, got %s", buf.String())
+	}
+
+	buf.Reset()
+	err := mp.GroupSet("company", "", &P{"Plan": "Enterprise"})
+	var ve *ValidationError
+	if !errors.As(err, &ve) || !strings.Contains(ve.Reason, "$group_id") {
+		t.Errorf("Expected a ValidationError for the empty $group_id, got %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected nothing to be sent, got %s", buf.String())
+	}
+}
+
+func TestValidationShortKeyLimit(t *testing.T) {
+	var buf bytes.Buffer
+	mp := NewMixpanelWithConsumer(token, NewWriterConsumer(&buf), WithValidation(&Validator{MaxKeyLength: 10}))
+	for key, name := range map[string]string{
+		"Coupon Code Used":                       "Coupon Code Used",
+		"Réduction appliquée au panier de l'été": "Réduction appliquée au panier de...",
+	} {
+		err := mp.Track("12345", "Purchase", &P{key: true})
+		var ve *ValidationError
+		if !errors.As(err, &ve) || ve.Property != name {
+			t.Errorf("Expected a ValidationError for %q, got %v", name, err)
+		}
+	}
+}
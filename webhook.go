@@ -0,0 +1,166 @@
+package mixpanel
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Cohort webhook actions sent by Mixpanel.
+const (
+	CohortActionMembers       = "members"
+	CohortActionAddMembers    = "add_members"
+	CohortActionRemoveMembers = "remove_members"
+)
+
+// maxWebhookBody bounds the size of a cohort webhook payload.
+const maxWebhookBody = 32 << 20
+
+// CohortMember is a user exported by a cohort sync.
+type CohortMember struct {
+	DistinctID  string `json:"mixpanel_distinct_id"`
+	Email       string `json:"email"`
+	FirstName   string `json:"first_name"`
+	LastName    string `json:"last_name"`
+	PhoneNumber string `json:"phone_number"`
+}
+
+// CohortSync is a single cohort webhook call. Large cohorts are split in
+// several pages sharing the same SessionID.
+type CohortSync struct {
+	Action            string
+	ProjectID         string
+	CohortID          string
+	CohortName        string
+	CohortDescription string
+	SessionID         string
+	Page              int
+	TotalPages        int
+	Members           []CohortMember
+}
+
+type cohortPayload struct {
+	Action     string `json:"action"`
+	Parameters struct {
+		ProjectID         string `json:"mixpanel_project_id"`
+		CohortID          string `json:"mixpanel_cohort_id"`
+		CohortName        string `json:"mixpanel_cohort_name"`
+		CohortDescription string `json:"mixpanel_cohort_description"`
+		SessionID         string `json:"mixpanel_session_id"`
+		PageInfo          struct {
+			TotalPages int `json:"total_pages"`
+			PageCount  int `json:"page_count"`
+		} `json:"page_info"`
+		Members []CohortMember `json:"members"`
+	} `json:"parameters"`
+}
+
+/*
+CohortWebhook is an http.Handler receiving the payloads of a Mixpanel
+cohort sync to a custom webhook.
+
+Each action is dispatched to its callback; an action without a callback
+is acknowledged and ignored. When Username is set requests must carry
+the matching basic auth credentials configured in Mixpanel. Example:
+
+	http.Handle("/mixpanel/cohorts", &CohortWebhook{
+	    Username: "mixpanel",
+	    Password: os.Getenv("WEBHOOK_PASSWORD"),
+	    OnAddMembers: func(s *CohortSync) error {
+	        return emailTool.Subscribe(s.CohortName, s.Members)
+	    },
+	})
+*/
+type CohortWebhook struct {
+	Username string
+	Password string
+
+	// OnMembers receives a full sync of the cohort.
+	OnMembers func(*CohortSync) error
+	// OnAddMembers receives users who entered the cohort.
+	OnAddMembers func(*CohortSync) error
+	// OnRemoveMembers receives users who left the cohort.
+	OnRemoveMembers func(*CohortSync) error
+}
+
+func (h *CohortWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		writeWebhookError(w, http.StatusMethodNotAllowed, "", "method not allowed")
+		return
+	}
+	if h.Username != "" {
+		user, pass, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(user), []byte(h.Username)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(pass), []byte(h.Password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="mixpanel"`)
+			writeWebhookError(w, http.StatusUnauthorized, "", "invalid credentials")
+			return
+		}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		writeWebhookError(w, http.StatusBadRequest, "", err.Error())
+		return
+	}
+	var payload cohortPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		writeWebhookError(w, http.StatusBadRequest, "", "invalid payload: "+err.Error())
+		return
+	}
+
+	var callback func(*CohortSync) error
+	switch payload.Action {
+	case CohortActionMembers:
+		callback = h.OnMembers
+	case CohortActionAddMembers:
+		callback = h.OnAddMembers
+	case CohortActionRemoveMembers:
+		callback = h.OnRemoveMembers
+	default:
+		writeWebhookError(w, http.StatusBadRequest, payload.Action, fmt.Sprintf("unknown action '%s'", payload.Action))
+		return
+	}
+
+	if callback != nil {
+		params := payload.Parameters
+		err := callback(&CohortSync{
+			Action:            payload.Action,
+			ProjectID:         params.ProjectID,
+			CohortID:          params.CohortID,
+			CohortName:        params.CohortName,
+			CohortDescription: params.CohortDescription,
+			SessionID:         params.SessionID,
+			Page:              params.PageInfo.PageCount,
+			TotalPages:        params.PageInfo.TotalPages,
+			Members:           params.Members,
+		})
+		if err != nil {
+			writeWebhookError(w, http.StatusInternalServerError, payload.Action, err.Error())
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"action": payload.Action,
+		"status": "success",
+	})
+}
+
+// writeWebhookError answers with the failure format Mixpanel expects.
+func writeWebhookError(w http.ResponseWriter, code int, action, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"action": action,
+		"status": "failure",
+		"error": map[string]interface{}{
+			"message": message,
+			"code":    code,
+		},
+	})
+}
@@ -0,0 +1,51 @@
+package mixpanel
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const addMembersPayload = `{"action": "add_members", "parameters": {
+	"mixpanel_project_id": "1", "mixpanel_cohort_id": "42", "mixpanel_cohort_name": "Power Users",
+	"mixpanel_session_id": "s1", "page_info": {"total_pages": 1, "page_count": 0},
+	"members": [{"email": "amy@mixpanel.com", "mixpanel_distinct_id": "13793"}]}}`
+
+func TestCohortWebhook(t *testing.T) {
+	var got *CohortSync
+	h := &CohortWebhook{
+		Username: "mixpanel",
+		Password: "secret",
+		OnAddMembers: func(s *CohortSync) error {
+			got = s
+			return nil
+		},
+	}
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(addMembersPayload))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized || got != nil {
+		t.Errorf("Expected unauthenticated request to be rejected, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/", strings.NewReader(addMembersPayload))
+	req.SetBasicAuth("mixpanel", "secret")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"success"`) {
+		t.Errorf("Unexpected response %d %s", w.Code, w.Body.String())
+	}
+	if got == nil || got.CohortName != "Power Users" || len(got.Members) != 1 || got.Members[0].DistinctID != "13793" {
+		t.Errorf("Unexpected sync %#v", got)
+	}
+
+	req = httptest.NewRequest("POST", "/", strings.NewReader(`{"action": "bogus"}`))
+	req.SetBasicAuth("mixpanel", "secret")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected unknown action to be rejected, got %d", w.Code)
+	}
+}